@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Admin config
+var (
+	// ADMIN_API_KEYS is a comma-separated list of keys for /admin/ endpoints
+	AdminAPIKeys = parseKeyList(getEnv("ADMIN_API_KEYS", ""))
+)
+
+// AdminNamespace is where admins' own operations are stored
+const AdminNamespace = "admin"
+
+func parseKeyList(value string) []string {
+	var keys []string
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// registerAdminRoutes mounts the admin API. Every route requires an
+// admin key and is logged.
+func registerAdminRoutes(mux *Router) {
+	mux.HandleFunc("/admin/operations", adminOnly(handleAdminOperations))
+	mux.HandleFunc("/admin/operations/", adminOnly(handleAdminCancel))
+	mux.HandleFunc("/admin/files/purge", adminOnly(handleAdminPurge))
+	mux.HandleFunc("/admin/config", adminOnly(handleAdminConfig))
+	mux.HandleFunc("/admin/toggles", adminOnly(handleAdminToggles))
+}
+
+func adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !principalFrom(r).Admin {
+			sendError(w, "Admin API key required", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != "GET" {
+			log.Printf("🛠️  Admin %s %s from %s", r.Method, r.URL.Path, clientIP(r))
+		}
+		next(w, r)
+	}
+}
+
+func sendJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// GET /admin/operations
+func handleAdminOperations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	active := []TrackedOperation{}
+	queued := []TrackedOperation{}
+	uploading := []TrackedOperation{}
+	for _, op := range listOperations() {
+		switch op.State {
+		case StateRunning:
+			active = append(active, op)
+		case StateQueued:
+			queued = append(queued, op)
+		default:
+			uploading = append(uploading, op)
+		}
+	}
+
+	// Uploads do not hold slots, so they are listed on their own
+	sendJSON(w, map[string]interface{}{
+		"active":        active,
+		"queued":        queued,
+		"uploading":     uploading,
+		"maxConcurrent": cap(opSlots),
+	})
+}
+
+// POST /admin/operations/{id}/cancel
+func handleAdminCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/operations/"), "/")
+	if action != "cancel" || id == "" {
+		sendError(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if !cancelOperation(id) {
+		sendError(w, "Operation not found or already finished", http.StatusNotFound)
+		return
+	}
+	sendJSON(w, map[string]interface{}{"id": id, "cancelled": true})
+}
+
+// POST /admin/files/purge?scope=expired|all&namespace=
+func handleAdminPurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	namespace := r.FormValue("namespace")
+	if namespace != "" && !namespacePattern.MatchString(namespace) {
+		sendError(w, "Invalid namespace", http.StatusBadRequest)
+		return
+	}
+
+	var olderThan time.Duration
+	switch scope := r.FormValue("scope"); scope {
+	case "", "expired":
+		olderThan = time.Duration(FileTTLMinutes) * time.Minute
+	case "all":
+		olderThan = 0
+	default:
+		sendError(w, "scope must be 'expired' or 'all'", http.StatusBadRequest)
+		return
+	}
+
+	fileMutex.Lock()
+	deleted := removeFilesLocked(namespace, olderThan)
+	fileMutex.Unlock()
+
+	total := 0
+	for _, count := range deleted {
+		total += count
+	}
+	log.Printf("🧹 Admin purge removed %d files", total)
+
+	sendJSON(w, map[string]interface{}{
+		"deleted":     total,
+		"byNamespace": deleted,
+	})
+}
+
+// GET /admin/config
+func handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Secrets are never echoed, only whether they are set
+	namespaces := []string{}
+	for _, apiKey := range APIKeys {
+		namespaces = append(namespaces, apiKey.Namespace)
+	}
+	sort.Strings(namespaces)
+
+	sendJSON(w, map[string]interface{}{
+		"port":                  Port,
+		"host":                  Host,
+		"tempDir":               TempDir,
+		"fileTTLMinutes":        FileTTLMinutes,
+		"requireApiKey":         RequireAPIKey,
+		"apiKeyNamespaces":      namespaces,
+		"adminKeys":             len(AdminAPIKeys),
+		"shareSecretConfigured": shareSecretConfigured(),
+		"encryptionAtRest":      encryptionEnabled(),
+		"namespaceQuotaMB":      NamespaceQuotaMB,
+		"minFreeDiskMB":         MinFreeDiskMB,
+		"diskLowMB":             DiskLowMB,
+		"auditLogPath":          AuditLogPath,
+		"trustProxy":            TrustProxy,
+		"maxConcurrentOps":      cap(opSlots),
+		"grpcPort":              GRPCPort,
+		"sandbox":               sandboxSummary(),
+		"inputLimits":           inputLimits,
+	})
+}
+
+// GET  /admin/toggles
+// POST /admin/toggles {"operation": "pdf/ocr", "enabled": false}
+func handleAdminToggles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var req struct {
+			Operation string `json:"operation"`
+			Enabled   *bool  `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+			sendError(w, "Expected JSON body with 'operation' and 'enabled'", http.StatusBadRequest)
+			return
+		}
+		if !isKnownOperation(req.Operation) {
+			sendError(w, "Unknown operation: "+req.Operation, http.StatusNotFound)
+			return
+		}
+		setOperationEnabled(req.Operation, *req.Enabled)
+		log.Printf("🛠️  Operation %s enabled=%v", req.Operation, *req.Enabled)
+	default:
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	toggles := make(map[string]bool)
+	for _, def := range operationDefs {
+		toggles[def.Name] = operationEnabled(def.Name)
+	}
+	sendJSON(w, map[string]interface{}{"operations": toggles})
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// adminRequest sends a request with key through the auth middleware
+func adminRequest(method, path, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	authMiddleware(setupRoutes()).ServeHTTP(rec, req)
+	return rec
+}
+
+func withAdminKey(t *testing.T) {
+	oldTempDir, oldKeys, oldAdmin := TempDir, APIKeys, AdminAPIKeys
+	TempDir, APIKeys, AdminAPIKeys = t.TempDir(), parseAPIKeys("k1:acme"), []string{"root"}
+	t.Cleanup(func() { TempDir, APIKeys, AdminAPIKeys = oldTempDir, oldKeys, oldAdmin })
+}
+
+// trackForTest registers an operation in state as trackMiddleware would
+func trackForTest(t *testing.T, state string) (*TrackedOperation, context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+	now := time.Now()
+	op := &TrackedOperation{ID: state + "-op", Operation: "pdf/rotate", Namespace: "acme", State: state,
+		ReceivedAt: now.Add(-2 * time.Second), PIDs: []int{}, cancel: cancel}
+	if state != StateUploading {
+		op.QueuedAt = &now
+	}
+	operationsMu.Lock()
+	operations[op.ID] = op
+	operationsMu.Unlock()
+	t.Cleanup(func() {
+		cancel()
+		operationsMu.Lock()
+		delete(operations, op.ID)
+		operationsMu.Unlock()
+	})
+	return op, ctx
+}
+
+func TestAdminRequiresAdminKey(t *testing.T) {
+	withAdminKey(t)
+	for _, key := range []string{"", "k1"} {
+		if rec := adminRequest("GET", "/admin/config", key); rec.Code != http.StatusUnauthorized {
+			t.Errorf("key %q: %d", key, rec.Code)
+		}
+	}
+}
+
+func TestAdminOperations(t *testing.T) {
+	withAdminKey(t)
+	trackForTest(t, StateUploading)
+	trackForTest(t, StateRunning)
+
+	rec := adminRequest("GET", "/admin/operations", "root")
+	var resp struct {
+		Active, Queued, Uploading []TrackedOperation
+		MaxConcurrent             int
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%d %s", rec.Code, rec.Body.String())
+	}
+	if len(resp.Active) != 1 || len(resp.Queued) != 0 || len(resp.Uploading) != 1 || resp.MaxConcurrent != cap(opSlots) {
+		t.Fatalf("operations = %s", rec.Body.String())
+	}
+	if up := resp.Uploading[0]; up.ID != "uploading-op" || up.UploadSeconds < 2 || up.QueuedAt != nil {
+		t.Errorf("uploading = %+v", up)
+	}
+	if run := resp.Active[0]; run.UploadSeconds < 1.9 || run.UploadSeconds > 2.1 {
+		t.Errorf("upload time of running operation = %v", run.UploadSeconds)
+	}
+}
+
+func TestAdminCancel(t *testing.T) {
+	withAdminKey(t)
+	_, ctx := trackForTest(t, StateRunning)
+
+	if rec := adminRequest("POST", "/admin/operations/running-op/cancel", "root"); rec.Code != http.StatusOK {
+		t.Fatalf("cancel: %d %s", rec.Code, rec.Body.String())
+	}
+	if ctx.Err() == nil {
+		t.Error("operation context not cancelled")
+	}
+	for path, want := range map[string]int{
+		"/admin/operations/unknown/cancel":   http.StatusNotFound,
+		"/admin/operations/running-op/pause": http.StatusNotFound,
+	} {
+		if rec := adminRequest("POST", path, "root"); rec.Code != want {
+			t.Errorf("%s: %d", path, rec.Code)
+		}
+	}
+	if rec := adminRequest("GET", "/admin/operations/running-op/cancel", "root"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET cancel: %d", rec.Code)
+	}
+}
+
+func TestAdminPurge(t *testing.T) {
+	withAdminKey(t)
+	file := func(namespace, name string, age time.Duration) string {
+		path := filepath.Join(TempDir, "ns", namespace, "output", name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("x"), 0644)
+		registerFileAt(path, time.Now().Add(-age))
+		return path
+	}
+	expired := file("acme", "old.pdf", 2*time.Duration(FileTTLMinutes)*time.Minute)
+	fresh := file("acme", "new.pdf", 0)
+	other := file("beta", "new.pdf", 0)
+
+	rec := adminRequest("POST", "/admin/files/purge", "root")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"deleted":1`) {
+		t.Fatalf("purge expired: %d %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Error("expired file kept")
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Error("fresh file removed")
+	}
+
+	rec = adminRequest("POST", "/admin/files/purge?scope=all&namespace=acme", "root")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"byNamespace":{"acme":1}`) {
+		t.Fatalf("purge acme: %d %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Error("other namespace purged")
+	}
+
+	for _, query := range []string{"?scope=some", "?namespace=../etc"} {
+		if rec := adminRequest("POST", "/admin/files/purge"+query, "root"); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d", query, rec.Code)
+		}
+	}
+}
+
+func TestAdminConfig(t *testing.T) {
+	withAdminKey(t)
+	rec := adminRequest("GET", "/admin/config", "root")
+	var config map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &config); err != nil {
+		t.Fatalf("%d %s", rec.Code, rec.Body.String())
+	}
+	if config["adminKeys"] != 1.0 || config["maxConcurrentOps"] != float64(cap(opSlots)) {
+		t.Errorf("config = %v", config)
+	}
+	// Keys are counted or mapped to namespaces, never echoed
+	if strings.Contains(rec.Body.String(), "root") || strings.Contains(rec.Body.String(), "k1") {
+		t.Errorf("config leaks a key: %s", rec.Body.String())
+	}
+}
+
+func TestSlotTakenAfterUpload(t *testing.T) {
+	op, ctx := trackForTest(t, StateUploading)
+	ctx = context.WithValue(ctx, trackedKey{}, op)
+
+	release, ok := acquireSlot(ctx)
+	if !ok {
+		t.Fatal("no slot")
+	}
+	if op.State != StateRunning || op.QueuedAt == nil || op.StartedAt == nil {
+		t.Errorf("after acquiring: %+v", op)
+	}
+	release()
+
+	// With every slot taken the operation waits as queued
+	for i := 0; i < cap(opSlots); i++ {
+		opSlots <- struct{}{}
+	}
+	defer func() {
+		for i := 0; i < cap(opSlots); i++ {
+			<-opSlots
+		}
+	}()
+	waiting, waitCtx := trackForTest(t, StateUploading)
+	waitCtx, cancel := context.WithTimeout(context.WithValue(waitCtx, trackedKey{}, waiting), 20*time.Millisecond)
+	defer cancel()
+	if _, ok := acquireSlot(waitCtx); ok || waiting.State != StateQueued {
+		t.Errorf("acquired %v with all slots taken, state %s", ok, waiting.State)
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// Encryption config
+var (
+	// ENCRYPTION_KEY is a base64-encoded 32-byte key. When set, uploads,
+	// outputs and spooled job bodies are stored encrypted; tools only ever
+	// see plaintext copies inside the workspace of a running operation.
+	EncryptionKey = loadEncryptionKey(getEnv("ENCRYPTION_KEY", ""))
+)
+
+// Stored files are encrypted with a random data key per file, wrapped with
+// EncryptionKey in the header:
+//
+//	magic | key ID | nonce | wrapped data key | chunk 0 | chunk 1 | ...
+//
+// The body is split into chunks of storeChunkSize bytes, each sealed with
+// AES-GCM under a nonce made of its index and a flag marking the last
+// chunk, so chunks cannot be reordered and truncation is detected. The
+// last chunk is always shorter than storeChunkSize, possibly empty.
+const (
+	storeMagic     = "PDFPALE1"
+	storeKeyIDLen  = 8
+	storeChunkSize = 64 << 10
+	storeOverhead  = 16 // GCM tag per chunk
+	storeHeaderLen = len(storeMagic) + storeKeyIDLen + 12 + 32 + storeOverhead
+)
+
+func loadEncryptionKey(value string) []byte {
+	if value == "" {
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != 32 {
+		log.Fatalf("Invalid ENCRYPTION_KEY: must be 32 bytes, base64-encoded")
+	}
+	return key
+}
+
+// encryptionEnabled reports whether new files are stored encrypted
+func encryptionEnabled() bool {
+	return len(EncryptionKey) > 0
+}
+
+// storeKeyID identifies the server key a file was encrypted with, so a
+// file from another key fails with a clear error instead of a bad tag
+func storeKeyID(key []byte) []byte {
+	sum := sha256.Sum256(key)
+	return sum[:storeKeyIDLen]
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce is the nonce of chunk index; the data key is never reused,
+// so the index alone keeps nonces unique
+func chunkNonce(index int64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, uint64(index))
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// ==================== WRITING ====================
+
+// createStored creates path like os.Create, encrypting what is written if
+// ENCRYPTION_KEY is set
+func createStored(path string) (io.WriteCloser, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := storeFile(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// storeFile wraps a new, empty file so that what is written to it is
+// stored encrypted if ENCRYPTION_KEY is set. Closing it closes f.
+func storeFile(f *os.File) (io.WriteCloser, error) {
+	if !encryptionEnabled() {
+		return f, nil
+	}
+
+	dataKey := make([]byte, 32)
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	serverGCM, err := newGCM(EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	prefix := append([]byte(storeMagic), storeKeyID(EncryptionKey)...)
+	header := append(append([]byte{}, prefix...), nonce...)
+	header = serverGCM.Seal(header, nonce, dataKey, prefix)
+	if _, err := f.Write(header); err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptWriter{file: f, aead: aead, buf: make([]byte, 0, storeChunkSize)}, nil
+}
+
+// encryptWriter seals full chunks as they fill up and the rest on Close
+type encryptWriter struct {
+	file  *os.File
+	aead  cipher.AEAD
+	buf   []byte
+	index int64
+	err   error
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+		// A full chunk is never the last one
+		if len(w.buf) == storeChunkSize {
+			if w.err = w.seal(false); w.err != nil {
+				return written, w.err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *encryptWriter) seal(last bool) error {
+	sealed := w.aead.Seal(nil, chunkNonce(w.index, last), w.buf, nil)
+	w.index++
+	w.buf = w.buf[:0]
+	_, err := w.file.Write(sealed)
+	return err
+}
+
+func (w *encryptWriter) Close() error {
+	if w.err == nil {
+		w.err = w.seal(true)
+	}
+	if err := w.file.Close(); w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// ==================== READING ====================
+
+// storedFile reads a stored file as plaintext, whether it was written
+// encrypted or before ENCRYPTION_KEY was set. It supports Read, Seek and
+// ReadAt, so it can be served with ranges by http.ServeContent.
+type storedFile struct {
+	*io.SectionReader
+	file *os.File
+}
+
+func (s *storedFile) Close() error { return s.file.Close() }
+
+// Stat describes the file on disk; use Size for the plaintext size
+func (s *storedFile) Stat() (os.FileInfo, error) { return s.file.Stat() }
+
+// openStored opens path for reading as plaintext
+func openStored(path string) (*storedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	magic := make([]byte, len(storeMagic))
+	if n, _ := f.ReadAt(magic, 0); n < len(magic) || string(magic) != storeMagic {
+		return &storedFile{io.NewSectionReader(f, 0, info.Size()), f}, nil
+	}
+
+	d, err := newDecrypter(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &storedFile{io.NewSectionReader(d, 0, d.size), f}, nil
+}
+
+var errStoreCorrupt = errors.New("encrypted file is corrupt or truncated")
+
+// decrypter decrypts the chunks of an encrypted file on demand
+type decrypter struct {
+	file *os.File
+	aead cipher.AEAD
+	// chunks is the number of chunks; all but the last are full
+	chunks  int64
+	lastLen int64
+	size    int64
+
+	mu     sync.Mutex
+	cached int64
+	plain  []byte
+}
+
+func newDecrypter(f *os.File, fileSize int64) (*decrypter, error) {
+	header := make([]byte, storeHeaderLen)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return nil, errStoreCorrupt
+	}
+	if !encryptionEnabled() {
+		return nil, errors.New("file is encrypted but ENCRYPTION_KEY is not set")
+	}
+	idEnd := len(storeMagic) + storeKeyIDLen
+	if !bytes.Equal(header[len(storeMagic):idEnd], storeKeyID(EncryptionKey)) {
+		return nil, errors.New("file was encrypted with a different ENCRYPTION_KEY")
+	}
+	serverGCM, err := newGCM(EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := header[idEnd : idEnd+12]
+	dataKey, err := serverGCM.Open(nil, nonce, header[idEnd+12:], header[:idEnd])
+	if err != nil {
+		return nil, errStoreCorrupt
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	body := fileSize - int64(storeHeaderLen)
+	sealedChunk := int64(storeChunkSize + storeOverhead)
+	full, rest := body/sealedChunk, body%sealedChunk
+	if body < 0 || rest < storeOverhead {
+		return nil, errStoreCorrupt
+	}
+	lastLen := rest - storeOverhead
+	return &decrypter{
+		file:    f,
+		aead:    aead,
+		chunks:  full + 1,
+		lastLen: lastLen,
+		size:    full*storeChunkSize + lastLen,
+		cached:  -1,
+	}, nil
+}
+
+// chunk returns the plaintext of chunk index; the caller holds d.mu
+func (d *decrypter) chunk(index int64) ([]byte, error) {
+	if index == d.cached {
+		return d.plain, nil
+	}
+	last := index == d.chunks-1
+	length := int64(storeChunkSize)
+	if last {
+		length = d.lastLen
+	}
+	sealed := make([]byte, length+storeOverhead)
+	offset := int64(storeHeaderLen) + index*(storeChunkSize+storeOverhead)
+	if _, err := d.file.ReadAt(sealed, offset); err != nil {
+		return nil, errStoreCorrupt
+	}
+	plain, err := d.aead.Open(sealed[:0], chunkNonce(index, last), sealed, nil)
+	if err != nil {
+		return nil, errStoreCorrupt
+	}
+	d.cached, d.plain = index, plain
+	return plain, nil
+}
+
+func (d *decrypter) ReadAt(p []byte, off int64) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		if off >= d.size {
+			return n, io.EOF
+		}
+		index := off / storeChunkSize
+		plain, err := d.chunk(index)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], plain[off-index*storeChunkSize:])
+		n += copied
+		off += int64(copied)
+	}
+	return n, nil
+}
+
+// ==================== HELPERS ====================
+
+// sealFile stores the plaintext file src at dest, encrypted if
+// ENCRYPTION_KEY is set. dest must not exist yet.
+func sealFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	out, err := storeFile(f)
+	if err != nil {
+		f.Close()
+		os.Remove(dest)
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dest)
+		return err
+	}
+	return nil
+}
+
+// unsealFile moves the stored file src to dest as plaintext
+func unsealFile(src, dest string) error {
+	in, err := openStored(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return removeFile(src)
+}
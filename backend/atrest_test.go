@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func withEncryptionKey(t *testing.T, key []byte) {
+	oldKey := EncryptionKey
+	EncryptionKey = key
+	t.Cleanup(func() { EncryptionKey = oldKey })
+}
+
+func TestStoredFileRoundTrip(t *testing.T) {
+	withEncryptionKey(t, bytes.Repeat([]byte{7}, 32))
+	dir := t.TempDir()
+
+	for _, size := range []int{0, 1, storeChunkSize - 1, storeChunkSize, storeChunkSize + 1, 3*storeChunkSize + 5} {
+		data := make([]byte, size)
+		rand.Read(data)
+		path := filepath.Join(dir, "stored")
+		os.Remove(path)
+
+		w, err := createStored(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Odd write sizes cross chunk boundaries
+		for rest := data; len(rest) > 0; {
+			n := 1000 + len(rest)%7
+			if n > len(rest) {
+				n = len(rest)
+			}
+			w.Write(rest[:n])
+			rest = rest[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		raw, _ := os.ReadFile(path)
+		if size > 16 && bytes.Contains(raw, data[:16]) {
+			t.Errorf("%d bytes: plaintext on disk", size)
+		}
+
+		f, err := openStored(path)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		got, err := io.ReadAll(f)
+		if err != nil || !bytes.Equal(got, data) || f.Size() != int64(size) {
+			t.Errorf("%d bytes: read %d, size %d, %v", size, len(got), f.Size(), err)
+		}
+		if size > 10 {
+			part := make([]byte, 10)
+			off := int64(size - 10)
+			if _, err := f.ReadAt(part, off); err != nil || !bytes.Equal(part, data[off:]) {
+				t.Errorf("%d bytes: ReadAt at %d: %v", size, off, err)
+			}
+		}
+		f.Close()
+	}
+}
+
+func TestStoredFileRejectsTampering(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	withEncryptionKey(t, key)
+	path := filepath.Join(t.TempDir(), "stored")
+	w, _ := createStored(path)
+	w.Write(bytes.Repeat([]byte("x"), 2*storeChunkSize))
+	w.Close()
+	raw, _ := os.ReadFile(path)
+
+	read := func(data []byte) error {
+		os.WriteFile(path, data, 0644)
+		f, err := openStored(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.ReadAll(f)
+		return err
+	}
+
+	if err := read(raw); err != nil {
+		t.Fatal(err)
+	}
+	flipped := append([]byte{}, raw...)
+	flipped[len(flipped)-storeChunkSize] ^= 1
+	if read(flipped) == nil {
+		t.Error("modified chunk accepted")
+	}
+	// Dropping the final chunk leaves only full chunks
+	if read(raw[:len(raw)-storeOverhead]) == nil {
+		t.Error("truncated file accepted")
+	}
+	EncryptionKey = bytes.Repeat([]byte{8}, 32)
+	if read(raw) == nil {
+		t.Error("file opened with another key")
+	}
+	EncryptionKey = nil
+	if read(raw) == nil {
+		t.Error("file opened without a key")
+	}
+
+	// Files from before the key was set are read as they are
+	if err := os.WriteFile(path, []byte("%PDF-1.7"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := openStored(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got, _ := io.ReadAll(f); string(got) != "%PDF-1.7" {
+		t.Errorf("plain file read as %q", got)
+	}
+}
+
+func TestEncryptedOutputs(t *testing.T) {
+	oldTempDir, oldKeys := TempDir, APIKeys
+	TempDir, APIKeys = t.TempDir(), nil
+	t.Cleanup(func() { TempDir, APIKeys = oldTempDir, oldKeys })
+	withEncryptionKey(t, bytes.Repeat([]byte{7}, 32))
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("angle", "90")
+	part, _ := form.CreateFormFile("file0", "in.pdf")
+	part.Write(minimalPDF())
+	form.Close()
+	req := httptest.NewRequest("POST", "/api/pdf/rotate", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	setupRoutes().ServeHTTP(rec, req)
+	var resp struct {
+		DownloadURL string `json:"downloadUrl"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.DownloadURL == "" {
+		t.Fatalf("rotate: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// The output is encrypted on disk and decrypted on download
+	u, _ := url.Parse(resp.DownloadURL)
+	raw, err := os.ReadFile(filepath.Join(TempDir, "ns", AnonymousNamespace, "output", filepath.Base(u.Path)))
+	if err != nil || !bytes.HasPrefix(raw, []byte(storeMagic)) {
+		t.Fatalf("output on disk: %q, %v", raw[:8], err)
+	}
+	rec = httptest.NewRecorder()
+	setupRoutes().ServeHTTP(rec, httptest.NewRequest("GET", u.RequestURI(), nil))
+	if rec.Code != http.StatusOK || !bytes.HasPrefix(rec.Body.Bytes(), []byte("%PDF-")) {
+		t.Fatalf("download: %d %q", rec.Code, rec.Body.Bytes())
+	}
+	full := rec.Body.Bytes()
+
+	req = httptest.NewRequest("GET", u.RequestURI(), nil)
+	req.Header.Set("Range", "bytes=5-9")
+	rec = httptest.NewRecorder()
+	setupRoutes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent || !bytes.Equal(rec.Body.Bytes(), full[5:10]) {
+		t.Errorf("range: %d %q", rec.Code, rec.Body.Bytes())
+	}
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Audit config
+var (
+	AuditLogPath = getEnv("AUDIT_LOG_PATH", "./audit/audit.log")
+	TrustProxy   = getEnv("TRUST_PROXY", "false") == "true"
+)
+
+// Parameters that must never reach the audit log in clear text
+var (
+	maskedParams   = map[string]bool{"password": true}
+	digestedParams = map[string]bool{"signature": true}
+)
+
+const maxAuditParamLength = 256
+
+// AuditEntry is a single hash-chained record of a document operation.
+// Hash covers every other field, including PrevHash, so editing or
+// dropping an entry breaks the chain from that point on.
+type AuditEntry struct {
+	Seq           int64             `json:"seq"`
+	Time          time.Time         `json:"time"`
+	Actor         string            `json:"actor"`
+	Authenticated bool              `json:"authenticated"`
+	Operation     string            `json:"operation"`
+	Inputs        []string          `json:"inputs,omitempty"`
+	Outputs       []string          `json:"outputs,omitempty"`
+	Params        map[string]string `json:"params,omitempty"`
+	Status        int               `json:"status"`
+	Result        string            `json:"result"`
+	ClientIP      string            `json:"clientIp"`
+	PrevHash      string            `json:"prevHash"`
+	Hash          string            `json:"hash"`
+}
+
+// AuditLog appends entries to a JSON-lines file
+type AuditLog struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	seq      int64
+	lastHash string
+}
+
+var auditLog *AuditLog
+
+// openAuditLog opens the log for appending and resumes the chain from its
+// last entry. A partial last line, left by a crash during Append, is cut
+// off; a broken chain among the complete entries is an error.
+func openAuditLog(path string) (*AuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	a := &AuditLog{path: path}
+	if err := a.resume(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var err error
+	a.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// resume verifies the complete entries of the log and continues their
+// chain, truncating whatever follows the last line end
+func (a *AuditLog) resume() error {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	complete, err := lastLineEnd(f, info.Size())
+	if err != nil {
+		return err
+	}
+
+	a.seq, a.lastHash, err = checkAuditChain(io.LimitReader(f, complete))
+	if err != nil {
+		return fmt.Errorf("%s is invalid after %d entries: %w", a.path, a.seq, err)
+	}
+	if torn := info.Size() - complete; torn > 0 {
+		log.Printf("⚠️  Audit log %s ends in a partial entry of %d bytes, probably from a crash; removing it", a.path, torn)
+		return os.Truncate(a.path, complete)
+	}
+	return nil
+}
+
+// lastLineEnd returns the length of f up to and including its last '\n'
+func lastLineEnd(f *os.File, size int64) (int64, error) {
+	buf := make([]byte, 64*1024)
+	for end := size; end > 0; {
+		start := max(end-int64(len(buf)), 0)
+		n, err := f.ReadAt(buf[:end-start], start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// Append chains the entry onto the log and flushes it to disk
+func (a *AuditLog) Append(entry AuditEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry.Seq = a.seq + 1
+	entry.PrevHash = a.lastHash
+	entry.Hash = hashAuditEntry(entry)
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := a.file.Sync(); err != nil {
+		return err
+	}
+
+	a.seq = entry.Seq
+	a.lastHash = entry.Hash
+	return nil
+}
+
+func hashAuditEntry(entry AuditEntry) string {
+	entry.Hash = ""
+	data, _ := json.Marshal(entry)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func readAuditLog(path string, fn func(AuditEntry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return readAuditEntries(f, fn)
+}
+
+func readAuditEntries(r io.Reader, fn func(AuditEntry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Read calls fn for every entry appended so far. The length of the log is
+// taken under the lock, so an entry that is being written while the log
+// is read is left for the next read rather than seen half-written; the
+// lock is not held while fn runs.
+func (a *AuditLog) Read(fn func(AuditEntry) error) error {
+	a.mu.Lock()
+	info, err := a.file.Stat()
+	a.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return readAuditEntries(io.LimitReader(f, info.Size()), fn)
+}
+
+// verifyAuditLog walks the chain and returns the number of valid entries,
+// stopping at the first broken link
+func verifyAuditLog(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	count, _, err := checkAuditChain(f)
+	return count, err
+}
+
+// checkAuditChain reads entries until the chain breaks and returns how
+// many were valid and the hash of the last one
+func checkAuditChain(r io.Reader) (count int64, lastHash string, err error) {
+	err = readAuditEntries(r, func(entry AuditEntry) error {
+		if entry.Seq != count+1 {
+			return fmt.Errorf("entry %d: expected seq %d", entry.Seq, count+1)
+		}
+		if entry.PrevHash != lastHash {
+			return fmt.Errorf("entry %d: previous hash does not match entry %d", entry.Seq, count)
+		}
+		if hashAuditEntry(entry) != entry.Hash {
+			return fmt.Errorf("entry %d: hash mismatch, entry was modified", entry.Seq)
+		}
+		count++
+		lastHash = entry.Hash
+		return nil
+	})
+	return count, lastHash, err
+}
+
+// runAuditVerify implements the "audit-verify [path]" command
+func runAuditVerify(args []string) int {
+	path := AuditLogPath
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	count, err := verifyAuditLog(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Audit log %s is invalid after %d entries: %v\n", path, count, err)
+		return 1
+	}
+	fmt.Printf("✅ Audit log %s verified: %d entries\n", path, count)
+	return 0
+}
+
+// ==================== REQUEST RECORDING ====================
+
+// auditRecord collects the files a request touched while it runs
+type auditRecord struct {
+	mu      sync.Mutex
+	inputs  []string // SHA-256 sums
+	outputs []string // SHA-256 sums
+	params  map[string][]string
+}
+
+type auditKey struct{}
+
+// auditInput records the SHA-256 of an input, taken while it was uploaded
+func auditInput(r *http.Request, sum string) {
+	if rec, ok := r.Context().Value(auditKey{}).(*auditRecord); ok {
+		rec.mu.Lock()
+		rec.inputs = append(rec.inputs, sum)
+		rec.mu.Unlock()
+	}
+}
+
+// auditOutput hashes an output right away, since inline results never
+// leave the workspace
+func auditOutput(r *http.Request, path string) {
+	if rec, ok := r.Context().Value(auditKey{}).(*auditRecord); ok {
+		sum := hashFiles([]string{path})[0]
+		rec.mu.Lock()
+		rec.outputs = append(rec.outputs, sum)
+		rec.mu.Unlock()
+	}
+}
+
+// auditForm records the form values of the request
+func auditForm(r *http.Request, values map[string][]string) {
+	if rec, ok := r.Context().Value(auditKey{}).(*auditRecord); ok {
+		rec.mu.Lock()
+		rec.params = values
+		rec.mu.Unlock()
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Audit middleware records every document operation after it completes
+func auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auditLog == nil || r.Method != "POST" || !isDocumentOperation(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &auditRecord{}
+		r = r.WithContext(context.WithValue(r.Context(), auditKey{}, rec))
+		sw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(sw, r)
+
+		principal := principalFrom(r)
+		entry := AuditEntry{
+			Time:          time.Now().UTC(),
+			Actor:         principal.Namespace,
+			Authenticated: principal.Authenticated,
+			Operation:     strings.TrimPrefix(r.URL.Path, "/api/"),
+			Inputs:        rec.inputs,
+			Outputs:       rec.outputs,
+			Params:        auditParams(rec.params),
+			Status:        sw.status,
+			Result:        "success",
+			ClientIP:      clientIP(r),
+		}
+		if sw.status >= 400 {
+			entry.Result = "failure"
+		}
+
+		if err := auditLog.Append(entry); err != nil {
+			log.Printf("⚠️  Audit log write failed: %v", err)
+		}
+	})
+}
+
+func isDocumentOperation(path string) bool {
+	return strings.HasPrefix(path, "/api/pdf/") ||
+		strings.HasPrefix(path, "/api/convert/") ||
+		strings.HasPrefix(path, "/api/security/")
+}
+
+func hashFiles(paths []string) []string {
+	var sums []string
+	for _, path := range paths {
+		sum, err := sha256File(path)
+		if err != nil {
+			sums = append(sums, "unavailable")
+			continue
+		}
+		sums = append(sums, sum)
+	}
+	return sums
+}
+
+func sha256File(path string) (string, error) {
+	f, err := openStored(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// auditParams copies the form values, masking secrets and truncating
+// anything long enough to bloat the log
+func auditParams(form map[string][]string) map[string]string {
+	if len(form) == 0 {
+		return nil
+	}
+
+	params := make(map[string]string)
+	for key, values := range form {
+		value := strings.Join(values, ",")
+		switch {
+		case maskedParams[strings.ToLower(key)]:
+			value = "***"
+		case digestedParams[strings.ToLower(key)]:
+			sum := sha256.Sum256([]byte(value))
+			value = "sha256:" + hex.EncodeToString(sum[:])
+		case len(value) > maxAuditParamLength:
+			// Cut at the start of a rune so the value stays valid UTF-8
+			cut := maxAuditParamLength
+			for cut > 0 && !utf8.RuneStart(value[cut]) {
+				cut--
+			}
+			value = value[:cut] + "..."
+		}
+		params[key] = value
+	}
+	return params
+}
+
+func clientIP(r *http.Request) string {
+	if TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ==================== QUERY & EXPORT ====================
+
+// GET /api/audit?operation=&from=&to=&limit=
+// GET /api/audit/export
+func handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if auditLog == nil {
+		sendError(w, "Audit log is disabled", http.StatusNotFound)
+		return
+	}
+
+	// Callers only ever see the entries of their own namespace, except
+	// admins who may filter by any actor
+	principal := principalFrom(r)
+	if !principal.Authenticated {
+		sendError(w, "API key required", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	filter, err := parseAuditFilter(query)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if principal.Admin {
+		filter.actor = query.Get("actor")
+	} else {
+		filter.actor = principal.Namespace
+	}
+
+	if r.URL.Path == "/api/audit/export" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"audit.jsonl\"")
+		enc := json.NewEncoder(w)
+		err = auditLog.Read(func(entry AuditEntry) error {
+			if filter.match(entry) {
+				return enc.Encode(entry)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Audit export failed: %v", err)
+		}
+		return
+	}
+
+	entries := []AuditEntry{}
+	err = auditLog.Read(func(entry AuditEntry) error {
+		if filter.match(entry) {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		sendError(w, fmt.Sprintf("Failed to read audit log: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Newest first, capped at limit
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq > entries[j].Seq })
+	if len(entries) > filter.limit {
+		entries = entries[:filter.limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+	})
+}
+
+type auditFilter struct {
+	actor     string
+	operation string
+	from, to  time.Time
+	limit     int
+}
+
+func parseAuditFilter(query map[string][]string) (auditFilter, error) {
+	get := func(key string) string {
+		if values := query[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	filter := auditFilter{operation: get("operation"), limit: 100}
+	if from := get("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return filter, fmt.Errorf("invalid 'from': expected RFC 3339 timestamp")
+		}
+		filter.from = t
+	}
+	if to := get("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return filter, fmt.Errorf("invalid 'to': expected RFC 3339 timestamp")
+		}
+		filter.to = t
+	}
+	if limit := get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > 1000 {
+			return filter, fmt.Errorf("invalid 'limit': expected 1-1000")
+		}
+		filter.limit = n
+	}
+	return filter, nil
+}
+
+func (f auditFilter) match(entry AuditEntry) bool {
+	if f.actor != "" && entry.Actor != f.actor {
+		return false
+	}
+	if f.operation != "" && entry.Operation != f.operation {
+		return false
+	}
+	if !f.from.IsZero() && entry.Time.Before(f.from) {
+		return false
+	}
+	if !f.to.IsZero() && entry.Time.After(f.to) {
+		return false
+	}
+	return true
+}
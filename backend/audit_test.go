@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestAuditChainDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a, err := openAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range []string{"pdf/merge", "pdf/rotate", "pdf/split"} {
+		if err := a.Append(AuditEntry{Actor: "acme", Operation: op, Status: 200, Result: "success"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.file.Close()
+
+	if count, err := verifyAuditLog(path); err != nil || count != 3 {
+		t.Fatalf("intact log: %d entries, %v", count, err)
+	}
+
+	// Reopening resumes the chain where it ended
+	a, err = openAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Append(AuditEntry{Actor: "acme", Operation: "pdf/compress", Status: 200, Result: "success"})
+	a.file.Close()
+	if count, err := verifyAuditLog(path); err != nil || count != 4 {
+		t.Fatalf("reopened log: %d entries, %v", count, err)
+	}
+
+	original, _ := os.ReadFile(path)
+	lines := bytes.SplitAfter(original, []byte("\n"))
+	tests := []struct {
+		name   string
+		edit   func() []byte
+		count  int64
+		reason string
+	}{
+		{"edited entry", func() []byte {
+			return bytes.Replace(original, []byte(`"pdf/rotate"`), []byte(`"pdf/unlock"`), 1)
+		}, 1, "modified"},
+		{"dropped entry", func() []byte {
+			return bytes.Join([][]byte{lines[0], lines[2], lines[3]}, nil)
+		}, 1, "expected seq"},
+		{"reordered entries", func() []byte {
+			return bytes.Join([][]byte{lines[1], lines[0], lines[2], lines[3]}, nil)
+		}, 0, "expected seq"},
+	}
+	for _, tt := range tests {
+		os.WriteFile(path, tt.edit(), 0600)
+		count, err := verifyAuditLog(path)
+		if err == nil || count != tt.count || !strings.Contains(err.Error(), tt.reason) {
+			t.Errorf("%s: %d entries, %v", tt.name, count, err)
+		}
+	}
+
+	// Rehashing an edited entry still breaks the link to the next one
+	var entries []AuditEntry
+	os.WriteFile(path, original, 0600)
+	readAuditLog(path, func(entry AuditEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	entries[1].Operation = "pdf/unlock"
+	entries[1].Hash = hashAuditEntry(entries[1])
+	var rewritten bytes.Buffer
+	enc := json.NewEncoder(&rewritten)
+	for _, entry := range entries {
+		enc.Encode(entry)
+	}
+	os.WriteFile(path, rewritten.Bytes(), 0600)
+	if count, err := verifyAuditLog(path); err == nil || count != 2 || !strings.Contains(err.Error(), "previous hash") {
+		t.Errorf("rehashed entry: %d entries, %v", count, err)
+	}
+}
+
+func TestAuditLogResumesAfterCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a, err := openAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Append(AuditEntry{Actor: "acme", Operation: "pdf/merge"})
+	a.Append(AuditEntry{Actor: "acme", Operation: "pdf/rotate"})
+	a.file.Close()
+	intact, _ := os.ReadFile(path)
+
+	// A crash during Append leaves part of a line behind
+	os.WriteFile(path, append(intact, `{"seq":3,"time":"2024-`...), 0600)
+	a, err = openAuditLog(path)
+	if err != nil {
+		t.Fatalf("torn last line: %v", err)
+	}
+	a.Append(AuditEntry{Actor: "acme", Operation: "pdf/split"})
+	a.file.Close()
+	if count, err := verifyAuditLog(path); err != nil || count != 3 {
+		t.Errorf("after resuming: %d entries, %v", count, err)
+	}
+
+	// A broken chain in complete entries still stops the log from opening
+	os.WriteFile(path, bytes.Replace(intact, []byte(`"pdf/merge"`), []byte(`"pdf/unlock"`), 1), 0600)
+	if _, err := openAuditLog(path); err == nil || !strings.Contains(err.Error(), "modified") {
+		t.Errorf("tampered log opened: %v", err)
+	}
+}
+
+func TestAuditParamsTruncateAtRune(t *testing.T) {
+	params := auditParams(map[string][]string{"text": {"a" + strings.Repeat("é", maxAuditParamLength)}})
+	if value := params["text"]; !utf8.ValidString(value) || !strings.HasSuffix(value, "é...") {
+		t.Errorf("truncated to %q", value)
+	}
+}
+
+func TestAuditReadWhileAppending(t *testing.T) {
+	a, err := openAuditLog(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.file.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			a.Append(AuditEntry{Actor: "acme", Operation: "pdf/rotate", Params: map[string]string{"angle": strings.Repeat("9", 2000)}})
+		}
+	}()
+
+	// Every read sees an unbroken prefix of the log, never a torn entry
+	for reading := true; reading; {
+		select {
+		case <-done:
+			reading = false
+		default:
+		}
+		var seq int64
+		err := a.Read(func(entry AuditEntry) error {
+			if entry.Seq != seq+1 {
+				t.Fatalf("read seq %d after %d", entry.Seq, seq)
+			}
+			seq = entry.Seq
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("read after %d entries: %v", seq, err)
+		}
+		if !reading && seq != 200 {
+			t.Errorf("final read saw %d entries", seq)
+		}
+	}
+}
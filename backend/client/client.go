@@ -0,0 +1,544 @@
+// Package client is a Go client for the PDF processing API.
+//
+// Every document operation has a typed method that uploads its input
+// files and returns a Result holding the download URL:
+//
+//	c := client.New("https://pdf.example.com", apiKey)
+//	f, _ := os.Open("scan.pdf")
+//	defer f.Close()
+//	res, err := c.Compress(ctx, client.File{Name: "scan.pdf", Body: f}, client.CompressOptions{TargetSize: 2 << 20})
+//	if err != nil { ... }
+//	err = c.Download(ctx, res.DownloadURL, out)
+//
+// Uploads are streamed from io.Reader. Requests answered with 429 or 503
+// are retried with backoff, honouring Retry-After, as long as every input
+// can be rewound (it implements io.Seeker, like *os.File). Operations the
+// server runs as async jobs (202 Accepted) are polled until they finish.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the API at BaseURL. Adjust the exported fields before the
+// first request.
+type Client struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+
+	// Retries is how often a 429 or 503 response is retried
+	Retries int
+	// Async asks the server to run operations as jobs ("Prefer:
+	// respond-async"), which keeps long conversions from hitting
+	// proxy timeouts. The client waits for the job either way.
+	Async bool
+	// PollInterval is the wait between job status checks when the server
+	// sends no Retry-After
+	PollInterval time.Duration
+	// DeleteAfterDownload asks the server to delete each result as soon as
+	// it has been downloaded in full, instead of after its TTL
+	DeleteAfterDownload bool
+}
+
+// New returns a client for baseURL, e.g. "http://localhost:8080". apiKey
+// may be empty for servers that allow anonymous use.
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		APIKey:       apiKey,
+		HTTPClient:   http.DefaultClient,
+		Retries:      3,
+		PollInterval: time.Second,
+	}
+}
+
+// File is an input document. Name is sent as the upload's filename. The
+// server tells the input type from the content, and keeps the name's
+// extension only where it agrees.
+type File struct {
+	Name string
+	Body io.Reader
+}
+
+// Result is the outcome of a document operation
+type Result struct {
+	DownloadURL string `json:"downloadUrl"`
+	// Warnings are things to check about a result that still succeeded
+	Warnings []string `json:"warnings,omitempty"`
+	// Parts lists every file of a split or image result when a manifest
+	// was asked for; DownloadURL is then the ZIP of them all
+	Parts []Part `json:"parts,omitempty"`
+	// JobID is set when the operation ran as an async job
+	JobID string `json:"-"`
+}
+
+// Part is one file of a manifest result
+type Part struct {
+	Name        string    `json:"name"`
+	Pages       PageRange `json:"pages"`
+	PageCount   int       `json:"pageCount"`
+	Size        int64     `json:"size"`
+	DownloadURL string    `json:"downloadUrl"`
+	// ThumbnailURL links to a PNG of the first page, if asked for
+	ThumbnailURL string `json:"thumbnailUrl,omitempty"`
+}
+
+// FieldError explains why the server rejected a form field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error codes the server reports in APIError.Code; switch on these rather
+// than on messages. Servers may add codes.
+const (
+	CodeInvalidInput        = "INVALID_INPUT"
+	CodeUnsupportedType     = "UNSUPPORTED_TYPE"
+	CodeEncryptedPDF        = "ENCRYPTED_PDF"
+	CodeWrongPassword       = "WRONG_PASSWORD"
+	CodeLimitExceeded       = "LIMIT_EXCEEDED"
+	CodeUnauthorized        = "UNAUTHORIZED"
+	CodeNotFound            = "NOT_FOUND"
+	CodeMethodNotAllowed    = "METHOD_NOT_ALLOWED"
+	CodeToolUnavailable     = "TOOL_UNAVAILABLE"
+	CodeTimeout             = "TIMEOUT"
+	CodeCanceled            = "CANCELED"
+	CodeUnavailable         = "UNAVAILABLE"
+	CodeInsufficientStorage = "INSUFFICIENT_STORAGE"
+	CodeProcessingFailed    = "PROCESSING_FAILED"
+	CodeInternal            = "INTERNAL"
+)
+
+// APIError is an error response from the server
+type APIError struct {
+	StatusCode int
+	Message    string
+	Fields     []FieldError
+	// Code is one of the Code constants; empty for answers that did not
+	// come from the API, e.g. a proxy's
+	Code      string
+	RequestID string
+	// Retriable is the server's verdict whether a later retry may succeed
+	Retriable bool
+	// Diagnostics describes the external tool that failed, if any
+	Diagnostics *Diagnostics
+}
+
+// Diagnostics is what a failed server-side tool left behind
+type Diagnostics struct {
+	Operation string `json:"operation"`
+	Tool      string `json:"tool,omitempty"`
+	ExitCode  int    `json:"exitCode,omitempty"`
+	// Output is the end of what the tool printed
+	Output string `json:"output,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+	if e.Code != "" {
+		msg = fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	for _, f := range e.Fields {
+		msg += fmt.Sprintf("; %s: %s", f.Field, f.Message)
+	}
+	return msg
+}
+
+// Temporary reports whether retrying the same request later may succeed
+func (e *APIError) Temporary() bool {
+	if e.Code != "" {
+		return e.Retriable
+	}
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusServiceUnavailable
+}
+
+// Run calls a document operation such as "pdf/merge" with files sent as
+// file0, file1, ... and the given form fields. The typed methods are
+// built on it; use it for operations this package does not know yet.
+func (c *Client) Run(ctx context.Context, operation string, files []File, fields map[string]string) (*Result, error) {
+	starts, rewindable := seekPositions(files)
+	if c.DeleteAfterDownload {
+		withFlag := map[string]string{"deleteAfterDownload": "true"}
+		for name, value := range fields {
+			withFlag[name] = value
+		}
+		fields = withFlag
+	}
+
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if err := rewind(files, starts); err != nil {
+				return nil, err
+			}
+		}
+
+		var err error
+		resp, err = c.post(ctx, operation, files, fields)
+		if err != nil {
+			return nil, err
+		}
+		if !retryable(resp.StatusCode) || !rewindable || attempt >= c.Retries {
+			break
+		}
+		resp.Body.Close()
+		if err := sleep(ctx, retryDelay(resp, attempt)); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusAccepted {
+		var accepted struct {
+			ID        string `json:"id"`
+			StatusURL string `json:"statusUrl"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&accepted); err != nil {
+			return nil, fmt.Errorf("decoding job: %w", err)
+		}
+		return c.waitForJob(ctx, accepted.ID)
+	}
+
+	var result Result
+	if err := decodeResponse(resp, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// post streams the multipart body through a pipe so large inputs are
+// never held in memory
+func (c *Client) post(ctx context.Context, operation string, files []File, fields map[string]string) (*http.Response, error) {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(writeForm(form, files, fields))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/api/"+operation, pr)
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if c.Async {
+		req.Header.Set("Prefer", "respond-async")
+	}
+
+	resp, err := c.send(req)
+	pr.Close()
+	return resp, err
+}
+
+func writeForm(form *multipart.Writer, files []File, fields map[string]string) error {
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+	for i, file := range files {
+		part, err := form.CreateFormFile(fmt.Sprintf("file%d", i), file.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, file.Body); err != nil {
+			return err
+		}
+	}
+	return form.Close()
+}
+
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+	return c.HTTPClient.Do(req)
+}
+
+// get fetches a JSON resource, retrying 429 and 503
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	return c.call(ctx, "GET", path, nil, v)
+}
+
+func (c *Client) call(ctx context.Context, method, path string, body []byte, v interface{}) error {
+	for attempt := 0; ; attempt++ {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+		if err != nil {
+			return err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.send(req)
+		if err != nil {
+			return err
+		}
+		if retryable(resp.StatusCode) && attempt < c.Retries {
+			resp.Body.Close()
+			if err := sleep(ctx, retryDelay(resp, attempt)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = decodeResponse(resp, v)
+		resp.Body.Close()
+		return err
+	}
+}
+
+// Job is the state of an async operation
+type Job struct {
+	ID         string          `json:"id"`
+	Operation  string          `json:"operation"`
+	Status     string          `json:"status"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	FinishedAt *time.Time      `json:"finishedAt"`
+	StatusCode int             `json:"statusCode"`
+	Result     json.RawMessage `json:"result"`
+}
+
+// Job fetches the state of an async job
+func (c *Client) Job(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	if err := c.get(ctx, "/api/jobs/"+url.PathEscape(id), &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CancelJob cancels an async job that has not finished yet
+func (c *Client) CancelJob(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	if err := c.call(ctx, "DELETE", "/api/jobs/"+url.PathEscape(id), nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// waitForJob polls a job until it finishes. Cancelling ctx stops waiting
+// and cancels the job on the server.
+func (c *Client) waitForJob(ctx context.Context, id string) (*Result, error) {
+	for {
+		job, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.FinishedAt != nil {
+			return jobResult(job)
+		}
+
+		if err := sleep(ctx, c.PollInterval); err != nil {
+			// Don't leave the job running for nobody
+			cancelCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			c.CancelJob(cancelCtx, id)
+			cancel()
+			return nil, err
+		}
+	}
+}
+
+func jobResult(job *Job) (*Result, error) {
+	if job.StatusCode >= 400 {
+		return nil, apiError(job.StatusCode, job.Result)
+	}
+	result := Result{JobID: job.ID}
+	if err := json.Unmarshal(job.Result, &result); err != nil {
+		return nil, fmt.Errorf("decoding job result: %w", err)
+	}
+	return &result, nil
+}
+
+// Download writes the file behind a download URL to w
+func (c *Client) Download(ctx context.Context, downloadURL string, w io.Writer) error {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := c.send(req)
+		if err != nil {
+			return err
+		}
+
+		if retryable(resp.StatusCode) && attempt < c.Retries {
+			resp.Body.Close()
+			if err := sleep(ctx, retryDelay(resp, attempt)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			return apiError(resp.StatusCode, body)
+		}
+		_, err = io.Copy(w, resp.Body)
+		return err
+	}
+}
+
+// Delete removes the file behind a download URL from the server before it
+// expires
+func (c *Client) Delete(ctx context.Context, downloadURL string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", downloadURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return apiError(resp.StatusCode, body)
+	}
+	return nil
+}
+
+// Share returns a link to the file behind a download URL that works
+// without an API key until the file expires. Only the file's owner can
+// share it.
+func (c *Client) Share(ctx context.Context, downloadURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", downloadURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var shared struct {
+		DownloadURL string `json:"downloadUrl"`
+	}
+	if err := decodeResponse(resp, &shared); err != nil {
+		return "", err
+	}
+	return shared.DownloadURL, nil
+}
+
+func decodeResponse(resp *http.Response, v interface{}) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		return apiError(resp.StatusCode, body)
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+func apiError(status int, body []byte) error {
+	var payload struct {
+		Error       string       `json:"error"`
+		Code        string       `json:"code"`
+		RequestID   string       `json:"requestId"`
+		Retriable   bool         `json:"retriable"`
+		Fields      []FieldError `json:"fields"`
+		Diagnostics *Diagnostics `json:"diagnostics"`
+	}
+	if json.Unmarshal(body, &payload) != nil || payload.Error == "" {
+		payload.Error = strings.TrimSpace(string(body))
+		if payload.Error == "" {
+			payload.Error = http.StatusText(status)
+		}
+	}
+	return &APIError{
+		StatusCode:  status,
+		Message:     payload.Error,
+		Fields:      payload.Fields,
+		Code:        payload.Code,
+		RequestID:   payload.RequestID,
+		Retriable:   payload.Retriable,
+		Diagnostics: payload.Diagnostics,
+	}
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// retryDelay honours Retry-After, otherwise backs off exponentially from
+// half a second up to 8 seconds
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		if at, err := http.ParseTime(value); err == nil {
+			return time.Until(at)
+		}
+	}
+	delay := 500 * time.Millisecond << attempt
+	if delay > 8*time.Second {
+		delay = 8 * time.Second
+	}
+	return delay
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// seekPositions records where each input starts, so a retry can send it
+// again. Inputs that cannot seek make the request non-retryable.
+func seekPositions(files []File) ([]int64, bool) {
+	starts := make([]int64, len(files))
+	for i, file := range files {
+		seeker, ok := file.Body.(io.Seeker)
+		if !ok {
+			return nil, false
+		}
+		pos, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, false
+		}
+		starts[i] = pos
+	}
+	return starts, true
+}
+
+func rewind(files []File, starts []int64) error {
+	for i, file := range files {
+		if _, err := file.Body.(io.Seeker).Seek(starts[i], io.SeekStart); err != nil {
+			return fmt.Errorf("rewinding %s for retry: %w", file.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c := New(server.URL, "secret")
+	c.PollInterval = time.Millisecond
+	return c
+}
+
+func TestMergeSendsFilesAndCount(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/pdf/merge" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if got := r.Header.Get("X-API-Key"); got != "secret" {
+			t.Errorf("X-API-Key = %q", got)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.FormValue("fileCount"); got != "2" {
+			t.Errorf("fileCount = %q", got)
+		}
+		for i, want := range []string{"first", "second"} {
+			file, header, err := r.FormFile([]string{"file0", "file1"}[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(file)
+			if string(body) != want {
+				t.Errorf("%s = %q, want %q", header.Filename, body, want)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]string{"downloadUrl": "http://x/files/ns/merged.pdf"})
+	})
+
+	res, err := c.Merge(context.Background(),
+		File{Name: "a.pdf", Body: strings.NewReader("first")},
+		File{Name: "b.pdf", Body: strings.NewReader("second")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.DownloadURL != "http://x/files/ns/merged.pdf" {
+		t.Errorf("DownloadURL = %q", res.DownloadURL)
+	}
+}
+
+func TestMergeWithOptionsSendsFields(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseMultipartForm(1 << 20)
+		for field, want := range map[string]string{
+			"pages":           `{"file1":[{"start":2,"end":5}]}`,
+			"sort":            "name",
+			"bookmarks":       "false",
+			"tableOfContents": "",
+		} {
+			if got := r.FormValue(field); got != want {
+				t.Errorf("%s = %q, want %q", field, got, want)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]string{"downloadUrl": "http://x/files/ns/merged.pdf"})
+	})
+
+	_, err := c.MergeWithOptions(context.Background(),
+		MergeOptions{Pages: map[int][]PageRange{1: {{Start: 2, End: 5}}}, Sort: "name", NoBookmarks: true},
+		File{Name: "a.pdf", Body: strings.NewReader("first")},
+		File{Name: "b.pdf", Body: strings.NewReader("second")})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSplitSendsFields(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseMultipartForm(1 << 20)
+		for field, want := range map[string]string{
+			"mode":       "size",
+			"maxSizeMB":  "2.5",
+			"response":   "manifest",
+			"thumbnails": "",
+			"ranges":     "",
+			"every":      "",
+		} {
+			if got := r.FormValue(field); got != want {
+				t.Errorf("%s = %q, want %q", field, got, want)
+			}
+		}
+		w.Write([]byte(`{"downloadUrl":"http://x/files/ns/split.zip","parts":[` +
+			`{"name":"a-pages_1-3.pdf","pages":{"start":1,"end":3},"pageCount":3,"size":2048,"downloadUrl":"http://x/files/ns/a-pages_1-3.pdf"}]}`))
+	})
+
+	res, err := c.Split(context.Background(), File{Name: "a.pdf", Body: strings.NewReader("pdf")},
+		SplitOptions{Mode: "size", MaxSize: 5 << 19, Manifest: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Parts) != 1 || res.Parts[0].Pages.End != 3 || res.Parts[0].Size != 2048 {
+		t.Errorf("parts = %+v", res.Parts)
+	}
+}
+
+func TestRetriesOnServiceUnavailable(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseMultipartForm(1 << 20)
+		file, _, err := r.FormFile("file0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body, _ := io.ReadAll(file); string(body) != "pdf" {
+			t.Errorf("attempt %d sent %q", calls+1, body)
+		}
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"downloadUrl": "ok"})
+	})
+
+	res, err := c.Repair(context.Background(), File{Name: "a.pdf", Body: strings.NewReader("pdf")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.DownloadURL != "ok" || calls != 3 {
+		t.Errorf("DownloadURL = %q after %d calls", res.DownloadURL, calls)
+	}
+}
+
+func TestNoRetryForUnseekableBody(t *testing.T) {
+	var calls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Rate limit exceeded"})
+	})
+
+	body := io.MultiReader(strings.NewReader("pdf"))
+	_, err := c.Repair(context.Background(), File{Name: "a.pdf", Body: body})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || !apiErr.Temporary() {
+		t.Fatalf("err = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestFollowsAsyncJob(t *testing.T) {
+	var polls int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/pdf/compress":
+			if r.Header.Get("Prefer") != "respond-async" {
+				t.Errorf("Prefer = %q", r.Header.Get("Prefer"))
+			}
+			r.ParseMultipartForm(1 << 20)
+			if got := r.FormValue("targetSize"); got != "2048" {
+				t.Errorf("targetSize = %q", got)
+			}
+			w.Header().Set("Location", "/api/jobs/j1")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]string{"id": "j1", "status": "pending", "statusUrl": "/api/jobs/j1"})
+		case "/api/jobs/j1":
+			if atomic.AddInt32(&polls, 1) < 2 {
+				json.NewEncoder(w).Encode(map[string]string{"id": "j1", "status": "running"})
+				return
+			}
+			w.Write([]byte(`{"id":"j1","status":"succeeded","finishedAt":"2024-01-01T00:00:00Z","statusCode":200,"result":{"downloadUrl":"done"}}`))
+		default:
+			t.Errorf("unexpected %s", r.URL.Path)
+		}
+	})
+	c.Async = true
+
+	res, err := c.Compress(context.Background(), File{Name: "a.pdf", Body: strings.NewReader("pdf")}, CompressOptions{TargetSize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.DownloadURL != "done" || res.JobID != "j1" {
+		t.Errorf("result = %+v", res)
+	}
+}
+
+func TestFailedJobReturnsAPIError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"id":"j2"}`))
+			return
+		}
+		w.Write([]byte(`{"id":"j2","status":"failed","finishedAt":"2024-01-01T00:00:00Z","statusCode":400,
+			"result":{"error":"Invalid request parameters","fields":[{"field":"angle","message":"must be one of 90, 180, 270"}]}}`))
+	})
+
+	_, err := c.Rotate(context.Background(), File{Name: "a.pdf", Body: strings.NewReader("pdf")}, RotateOptions{Angle: 45})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v", err)
+	}
+	if apiErr.StatusCode != 400 || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "angle" {
+		t.Errorf("err = %+v", apiErr)
+	}
+}
+
+func TestDownloadWritesBody(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/files/ns/missing.pdf" {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("%PDF-1.7"))
+	})
+
+	var buf bytes.Buffer
+	if err := c.Download(context.Background(), c.BaseURL+"/files/ns/out.pdf", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "%PDF-1.7" {
+		t.Errorf("downloaded %q", buf.String())
+	}
+
+	err := c.Download(context.Background(), c.BaseURL+"/files/ns/missing.pdf", io.Discard)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestAPIErrorCarriesCode(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"Wrong password for the PDF","code":"WRONG_PASSWORD","requestId":"r-1","retriable":false,
+			"diagnostics":{"operation":"unlock"}}`))
+	})
+
+	_, err := c.Unlock(context.Background(), File{Name: "a.pdf", Body: strings.NewReader("pdf")}, PasswordOptions{Password: "nope"})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v", err)
+	}
+	if apiErr.Code != CodeWrongPassword || apiErr.RequestID != "r-1" || apiErr.Temporary() ||
+		apiErr.Diagnostics == nil || apiErr.Diagnostics.Operation != "unlock" {
+		t.Errorf("err = %+v", apiErr)
+	}
+}
+
+func TestDeleteAndDeleteAfterDownload(t *testing.T) {
+	var deleted string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "DELETE":
+			deleted = r.URL.Path
+			w.WriteHeader(http.StatusNoContent)
+		case "POST":
+			r.ParseMultipartForm(1 << 20)
+			if got := r.FormValue("deleteAfterDownload"); got != "true" {
+				t.Errorf("deleteAfterDownload = %q", got)
+			}
+			json.NewEncoder(w).Encode(map[string]string{"downloadUrl": "/files/ns/out.pdf"})
+		}
+	})
+	c.DeleteAfterDownload = true
+
+	if _, err := c.Repair(context.Background(), File{Name: "a.pdf", Body: strings.NewReader("pdf")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(context.Background(), c.BaseURL+"/files/ns/out.pdf"); err != nil || deleted != "/files/ns/out.pdf" {
+		t.Errorf("delete: %v, deleted %q", err, deleted)
+	}
+}
+
+func TestShare(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/files/ns/out.pdf" {
+			t.Errorf("%s %s", r.Method, r.URL.Path)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"downloadUrl": "/files/ns/out.pdf?token=1.sig"})
+	})
+
+	link, err := c.Share(context.Background(), c.BaseURL+"/files/ns/out.pdf")
+	if err != nil || link != "/files/ns/out.pdf?token=1.sig" {
+		t.Errorf("share = %q, %v", link, err)
+	}
+}
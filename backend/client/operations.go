@@ -0,0 +1,430 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+)
+
+// PageRange is an inclusive range of 1-based page numbers
+type PageRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// RedactArea is a rectangle in points from the bottom-left corner of a page
+type RedactArea struct {
+	Page   int     `json:"page"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+func jsonField(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// setNonEmpty adds a form field unless value is empty, leaving the server
+// default in place
+func setNonEmpty(fields map[string]string, name, value string) {
+	if value != "" {
+		fields[name] = value
+	}
+}
+
+func setPositive(fields map[string]string, name string, value int64) {
+	if value > 0 {
+		fields[name] = strconv.FormatInt(value, 10)
+	}
+}
+
+// manifestFields asks for response=manifest, with thumbnails if wanted
+func manifestFields(manifest, thumbnails bool) map[string]string {
+	fields := make(map[string]string)
+	if manifest {
+		fields["response"] = "manifest"
+		if thumbnails {
+			fields["thumbnails"] = "true"
+		}
+	}
+	return fields
+}
+
+func (c *Client) single(ctx context.Context, operation string, file File, fields map[string]string) (*Result, error) {
+	return c.Run(ctx, operation, []File{file}, fields)
+}
+
+func (c *Client) counted(ctx context.Context, operation string, files []File, fields map[string]string) (*Result, error) {
+	if fields == nil {
+		fields = make(map[string]string)
+	}
+	fields["fileCount"] = strconv.Itoa(len(files))
+	return c.Run(ctx, operation, files, fields)
+}
+
+// Merge combines PDFs into one, in order
+func (c *Client) Merge(ctx context.Context, files ...File) (*Result, error) {
+	return c.MergeWithOptions(ctx, MergeOptions{}, files...)
+}
+
+// MergeOptions controls MergeWithOptions
+type MergeOptions struct {
+	// Pages selects page ranges by index into files; files without an
+	// entry are taken in full
+	Pages map[int][]PageRange
+	// Sort orders the files: "given" (default), "name" for natural
+	// filename order or "created" for the documents' creation dates
+	Sort string
+	// NoBookmarks leaves out the top-level bookmark per file, named after
+	// it, that the server adds by default
+	NoBookmarks bool
+	// TableOfContents inserts a page listing each file and its first page
+	TableOfContents bool
+	// Interleave alternates the pages of exactly two files, the fronts and
+	// backs of a duplex scan; it excludes Sort, NoBookmarks and
+	// TableOfContents. ReverseSecond takes the backs last to first.
+	Interleave    bool
+	ReverseSecond bool
+}
+
+// MergeWithOptions combines selected pages of PDFs into one
+func (c *Client) MergeWithOptions(ctx context.Context, opts MergeOptions, files ...File) (*Result, error) {
+	fields := make(map[string]string)
+	if len(opts.Pages) > 0 {
+		pages := make(map[string][]PageRange)
+		for i, ranges := range opts.Pages {
+			pages["file"+strconv.Itoa(i)] = ranges
+		}
+		fields["pages"] = jsonField(pages)
+	}
+	setNonEmpty(fields, "sort", opts.Sort)
+	if opts.NoBookmarks {
+		fields["bookmarks"] = "false"
+	}
+	if opts.TableOfContents {
+		fields["tableOfContents"] = "true"
+	}
+	if opts.Interleave {
+		fields["mode"] = "interleave"
+	}
+	if opts.ReverseSecond {
+		fields["reverseSecond"] = "true"
+	}
+	return c.counted(ctx, "pdf/merge", files, fields)
+}
+
+// SplitOptions controls Split. Without ranges or a mode every page becomes
+// its own PDF.
+type SplitOptions struct {
+	Ranges []PageRange
+	// Mode is "every", "bookmarks", "size" or "blank"; it cannot be
+	// combined with Ranges
+	Mode string
+	// Every is the number of pages per file for mode "every"
+	Every int
+	// Level is the deepest bookmark level mode "bookmarks" splits at; zero
+	// uses the server default, top-level only
+	Level int
+	// MaxSize is the largest file in bytes for mode "size"
+	MaxSize int64
+	// BlankThreshold is the ink coverage in percent below which mode
+	// "blank" counts a page as a separator; zero uses the server default
+	BlankThreshold float64
+	// Manifest lists every part in Result.Parts with a link of its own,
+	// and Thumbnails adds a thumbnail link to each
+	Manifest   bool
+	Thumbnails bool
+}
+
+// Split splits a PDF; the result is a ZIP archive
+func (c *Client) Split(ctx context.Context, file File, opts SplitOptions) (*Result, error) {
+	fields := manifestFields(opts.Manifest, opts.Thumbnails)
+	if len(opts.Ranges) > 0 {
+		fields["ranges"] = jsonField(opts.Ranges)
+		return c.single(ctx, "pdf/split", file, fields)
+	}
+	fields["mode"] = "individual"
+	setNonEmpty(fields, "mode", opts.Mode)
+	setPositive(fields, "every", int64(opts.Every))
+	setPositive(fields, "level", int64(opts.Level))
+	if opts.MaxSize > 0 {
+		fields["maxSizeMB"] = strconv.FormatFloat(float64(opts.MaxSize)/(1<<20), 'f', -1, 64)
+	}
+	if opts.BlankThreshold > 0 {
+		fields["blankThreshold"] = strconv.FormatFloat(opts.BlankThreshold, 'f', -1, 64)
+	}
+	return c.single(ctx, "pdf/split", file, fields)
+}
+
+// CompressOptions controls Compress
+type CompressOptions struct {
+	// TargetSize in bytes makes the server downsample images until the
+	// file fits. Zero uses the default compression.
+	TargetSize int64
+}
+
+// Compress reduces the size of a PDF
+func (c *Client) Compress(ctx context.Context, file File, opts CompressOptions) (*Result, error) {
+	fields := make(map[string]string)
+	setPositive(fields, "targetSize", opts.TargetSize)
+	return c.single(ctx, "pdf/compress", file, fields)
+}
+
+// RotateOptions controls Rotate
+type RotateOptions struct {
+	Angle int // 90 (default), 180 or 270 degrees clockwise
+}
+
+// Rotate rotates every page
+func (c *Client) Rotate(ctx context.Context, file File, opts RotateOptions) (*Result, error) {
+	fields := make(map[string]string)
+	setPositive(fields, "angle", int64(opts.Angle))
+	return c.single(ctx, "pdf/rotate", file, fields)
+}
+
+// PagesOptions selects pages for ExtractPages and DeletePages
+type PagesOptions struct {
+	Pages []int
+}
+
+// ExtractPages creates a PDF from the selected pages
+func (c *Client) ExtractPages(ctx context.Context, file File, opts PagesOptions) (*Result, error) {
+	return c.single(ctx, "pdf/extract", file, map[string]string{"pages": jsonField(opts.Pages)})
+}
+
+// DeletePages removes the selected pages
+func (c *Client) DeletePages(ctx context.Context, file File, opts PagesOptions) (*Result, error) {
+	return c.single(ctx, "pdf/delete-pages", file, map[string]string{"pages": jsonField(opts.Pages)})
+}
+
+// ReorderOptions controls Reorder
+type ReorderOptions struct {
+	// Order lists the pages in their new order; pages left out are dropped
+	Order []int
+}
+
+// Reorder rearranges pages
+func (c *Client) Reorder(ctx context.Context, file File, opts ReorderOptions) (*Result, error) {
+	return c.single(ctx, "pdf/reorder", file, map[string]string{"order": jsonField(opts.Order)})
+}
+
+// WatermarkOptions controls Watermark
+type WatermarkOptions struct {
+	Text string // default "WATERMARK"
+}
+
+// Watermark stamps diagonal text on every page
+func (c *Client) Watermark(ctx context.Context, file File, opts WatermarkOptions) (*Result, error) {
+	fields := make(map[string]string)
+	setNonEmpty(fields, "text", opts.Text)
+	return c.single(ctx, "pdf/watermark", file, fields)
+}
+
+// CropOptions gives the margins to cut from every page, in points
+type CropOptions struct {
+	Top, Right, Bottom, Left float64
+}
+
+// Crop sets the crop box of every page
+func (c *Client) Crop(ctx context.Context, file File, opts CropOptions) (*Result, error) {
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	return c.single(ctx, "pdf/crop", file, map[string]string{
+		"top":    format(opts.Top),
+		"right":  format(opts.Right),
+		"bottom": format(opts.Bottom),
+		"left":   format(opts.Left),
+	})
+}
+
+// Repair rebuilds a damaged PDF
+func (c *Client) Repair(ctx context.Context, file File) (*Result, error) {
+	return c.single(ctx, "pdf/repair", file, nil)
+}
+
+// PageNumberOptions controls AddPageNumbers
+type PageNumberOptions struct {
+	// Position such as "bottom-center" (default) or "top-right"
+	Position string
+}
+
+// AddPageNumbers stamps page numbers
+func (c *Client) AddPageNumbers(ctx context.Context, file File, opts PageNumberOptions) (*Result, error) {
+	fields := make(map[string]string)
+	setNonEmpty(fields, "position", opts.Position)
+	return c.single(ctx, "pdf/add-page-numbers", file, fields)
+}
+
+// HeaderFooterOptions controls AddHeaderFooter
+type HeaderFooterOptions struct {
+	Header, Footer string
+}
+
+// AddHeaderFooter stamps header and footer text on every page
+func (c *Client) AddHeaderFooter(ctx context.Context, file File, opts HeaderFooterOptions) (*Result, error) {
+	fields := make(map[string]string)
+	setNonEmpty(fields, "header", opts.Header)
+	setNonEmpty(fields, "footer", opts.Footer)
+	return c.single(ctx, "pdf/add-header-footer", file, fields)
+}
+
+// Metadata holds document properties; empty fields are left unchanged
+type Metadata struct {
+	Title, Author, Subject, Keywords string
+}
+
+// SetMetadata sets document properties
+func (c *Client) SetMetadata(ctx context.Context, file File, meta Metadata) (*Result, error) {
+	fields := make(map[string]string)
+	setNonEmpty(fields, "title", meta.Title)
+	setNonEmpty(fields, "author", meta.Author)
+	setNonEmpty(fields, "subject", meta.Subject)
+	setNonEmpty(fields, "keywords", meta.Keywords)
+	return c.single(ctx, "pdf/metadata", file, fields)
+}
+
+// PasswordOptions controls Unlock and Protect
+type PasswordOptions struct {
+	Password string
+}
+
+// Unlock removes password protection
+func (c *Client) Unlock(ctx context.Context, file File, opts PasswordOptions) (*Result, error) {
+	fields := make(map[string]string)
+	setNonEmpty(fields, "password", opts.Password)
+	return c.single(ctx, "pdf/unlock", file, fields)
+}
+
+// Protect encrypts a PDF with a password
+func (c *Client) Protect(ctx context.Context, file File, opts PasswordOptions) (*Result, error) {
+	return c.single(ctx, "security/protect", file, map[string]string{"password": opts.Password})
+}
+
+// OCROptions controls OCR
+type OCROptions struct {
+	// Language is a Tesseract language such as "eng" (default) or "deu+fra"
+	Language string
+}
+
+// OCR adds a searchable text layer
+func (c *Client) OCR(ctx context.Context, file File, opts OCROptions) (*Result, error) {
+	fields := make(map[string]string)
+	setNonEmpty(fields, "language", opts.Language)
+	return c.single(ctx, "pdf/ocr", file, fields)
+}
+
+// SignOptions controls Sign
+type SignOptions struct {
+	Signature []byte // PNG image
+	Page      int    // default 1
+}
+
+// Sign stamps a signature image on a page
+func (c *Client) Sign(ctx context.Context, file File, opts SignOptions) (*Result, error) {
+	fields := map[string]string{"signature": base64.StdEncoding.EncodeToString(opts.Signature)}
+	setPositive(fields, "page", int64(opts.Page))
+	return c.single(ctx, "pdf/sign", file, fields)
+}
+
+// RedactOptions controls Redact
+type RedactOptions struct {
+	Areas []RedactArea
+}
+
+// Redact blacks out rectangular areas
+func (c *Client) Redact(ctx context.Context, file File, opts RedactOptions) (*Result, error) {
+	return c.single(ctx, "pdf/redact", file, map[string]string{"areas": jsonField(opts.Areas)})
+}
+
+// Compare highlights the visual differences between two PDFs
+func (c *Client) Compare(ctx context.Context, a, b File) (*Result, error) {
+	return c.Run(ctx, "pdf/compare", []File{a, b}, nil)
+}
+
+// BatchOptions controls Batch
+type BatchOptions struct {
+	Operation string // "compress" (default) or "merge"
+}
+
+// Batch compresses or merges many PDFs at once; the result is a ZIP
+// archive
+func (c *Client) Batch(ctx context.Context, files []File, opts BatchOptions) (*Result, error) {
+	fields := make(map[string]string)
+	setNonEmpty(fields, "operation", opts.Operation)
+	return c.counted(ctx, "pdf/batch", files, fields)
+}
+
+// WordToPDF converts a Word document to PDF
+func (c *Client) WordToPDF(ctx context.Context, file File) (*Result, error) {
+	return c.single(ctx, "convert/word-to-pdf", file, nil)
+}
+
+// ExcelToPDF converts a spreadsheet to PDF
+func (c *Client) ExcelToPDF(ctx context.Context, file File) (*Result, error) {
+	return c.single(ctx, "convert/excel-to-pdf", file, nil)
+}
+
+// PPTToPDF converts a presentation to PDF
+func (c *Client) PPTToPDF(ctx context.Context, file File) (*Result, error) {
+	return c.single(ctx, "convert/ppt-to-pdf", file, nil)
+}
+
+// HTMLToPDF renders an HTML file to PDF
+func (c *Client) HTMLToPDF(ctx context.Context, file File) (*Result, error) {
+	return c.single(ctx, "convert/html-to-pdf", file, nil)
+}
+
+// ImagesToPDF combines images into a PDF, one page each
+func (c *Client) ImagesToPDF(ctx context.Context, images ...File) (*Result, error) {
+	return c.counted(ctx, "convert/image-to-pdf", images, nil)
+}
+
+// ScanToPDF enhances scanned images and makes a searchable PDF
+func (c *Client) ScanToPDF(ctx context.Context, images ...File) (*Result, error) {
+	return c.counted(ctx, "convert/scan-to-pdf", images, nil)
+}
+
+// PDFToWord converts a PDF to DOCX
+func (c *Client) PDFToWord(ctx context.Context, file File) (*Result, error) {
+	return c.single(ctx, "convert/pdf-to-word", file, nil)
+}
+
+// PDFToExcel converts PDF text tables to XLSX
+func (c *Client) PDFToExcel(ctx context.Context, file File) (*Result, error) {
+	return c.single(ctx, "convert/pdf-to-excel", file, nil)
+}
+
+// PDFToPPT converts PDF pages to PPTX slides
+func (c *Client) PDFToPPT(ctx context.Context, file File) (*Result, error) {
+	return c.single(ctx, "convert/pdf-to-ppt", file, nil)
+}
+
+// ImageOptions controls PDFToImage
+type ImageOptions struct {
+	Format string // png (default), jpg or jpeg
+	DPI    int    // default 150
+	// Manifest lists every image in Result.Parts with a link of its own,
+	// and Thumbnails adds a thumbnail link to each
+	Manifest   bool
+	Thumbnails bool
+}
+
+// PDFToImage renders every page to an image; the result is a ZIP archive
+func (c *Client) PDFToImage(ctx context.Context, file File, opts ImageOptions) (*Result, error) {
+	fields := manifestFields(opts.Manifest, opts.Thumbnails)
+	setNonEmpty(fields, "format", opts.Format)
+	setPositive(fields, "dpi", int64(opts.DPI))
+	return c.single(ctx, "convert/pdf-to-image", file, fields)
+}
+
+// PDFToText extracts text, keeping the layout
+func (c *Client) PDFToText(ctx context.Context, file File) (*Result, error) {
+	return c.single(ctx, "convert/pdf-to-text", file, nil)
+}
+
+// PDFToPDFA converts a PDF to PDF/A-2 for archiving
+func (c *Client) PDFToPDFA(ctx context.Context, file File) (*Result, error) {
+	return c.single(ctx, "convert/pdf-to-pdfa", file, nil)
+}
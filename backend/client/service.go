@@ -0,0 +1,240 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Health is the server status with the availability of its external tools
+type Health struct {
+	Status       string          `json:"status"`
+	Dependencies map[string]bool `json:"dependencies"`
+}
+
+// Health checks that the server is up
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var health Health
+	if err := c.get(ctx, "/health", &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// Operation describes a document operation the server offers
+type Operation struct {
+	Name        string   `json:"name"`
+	Path        string   `json:"path"`
+	Method      string   `json:"method"`
+	Category    string   `json:"category"`
+	Summary     string   `json:"summary"`
+	Files       FileSpec `json:"files"`
+	Params      []Param  `json:"params"`
+	Output      string   `json:"output"`
+	MaxUploadMB int64    `json:"maxUploadMB"`
+	MaxFileMB   int64    `json:"maxFileMB,omitempty"`
+	Requires    []string `json:"requires,omitempty"`
+}
+
+// FileSpec says how many files an operation takes and of which types
+type FileSpec struct {
+	Min        int      `json:"min"`
+	Max        int      `json:"max,omitempty"`
+	CountField bool     `json:"countField"`
+	Accept     []string `json:"accept"`
+}
+
+// Param describes a form field of an operation
+type Param struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required"`
+	Default     interface{} `json:"default,omitempty"`
+	Min         *float64    `json:"min,omitempty"`
+	Max         *float64    `json:"max,omitempty"`
+	MaxLength   int         `json:"maxLength,omitempty"`
+	Enum        []string    `json:"enum,omitempty"`
+	Pattern     string      `json:"pattern,omitempty"`
+	Example     string      `json:"example,omitempty"`
+}
+
+// Operations lists the document operations the server offers
+func (c *Client) Operations(ctx context.Context) ([]Operation, error) {
+	var resp struct {
+		Operations []Operation `json:"operations"`
+	}
+	if err := c.get(ctx, "/api/operations", &resp); err != nil {
+		return nil, err
+	}
+	return resp.Operations, nil
+}
+
+// AuditEntry records one document operation
+type AuditEntry struct {
+	Seq           int64             `json:"seq"`
+	Time          time.Time         `json:"time"`
+	Actor         string            `json:"actor"`
+	Authenticated bool              `json:"authenticated"`
+	Operation     string            `json:"operation"`
+	Inputs        []string          `json:"inputs,omitempty"`
+	Outputs       []string          `json:"outputs,omitempty"`
+	Params        map[string]string `json:"params,omitempty"`
+	Status        int               `json:"status"`
+	Result        string            `json:"result"`
+	ClientIP      string            `json:"clientIp"`
+	PrevHash      string            `json:"prevHash"`
+	Hash          string            `json:"hash"`
+}
+
+// AuditQuery filters the audit log; zero fields are not applied
+type AuditQuery struct {
+	Operation string
+	From, To  time.Time
+	Limit     int
+	// Actor filters by namespace; only admin keys may use it
+	Actor string
+}
+
+func (q AuditQuery) encode() string {
+	values := url.Values{}
+	if q.Operation != "" {
+		values.Set("operation", q.Operation)
+	}
+	if !q.From.IsZero() {
+		values.Set("from", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		values.Set("to", q.To.Format(time.RFC3339))
+	}
+	if q.Limit > 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Actor != "" {
+		values.Set("actor", q.Actor)
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
+
+// Audit returns audit log entries of the caller's namespace
+func (c *Client) Audit(ctx context.Context, q AuditQuery) ([]AuditEntry, error) {
+	var resp struct {
+		Entries []AuditEntry `json:"entries"`
+	}
+	if err := c.get(ctx, "/api/audit"+q.encode(), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Entries, nil
+}
+
+// AuditExport writes the matching audit entries to w as JSON lines
+func (c *Client) AuditExport(ctx context.Context, q AuditQuery, w io.Writer) error {
+	return c.Download(ctx, c.BaseURL+"/api/audit/export"+q.encode(), w)
+}
+
+// TrackedOperation is a running, queued or uploading operation as seen by
+// admins
+type TrackedOperation struct {
+	ID         string     `json:"id"`
+	Operation  string     `json:"operation"`
+	Namespace  string     `json:"namespace"`
+	State      string     `json:"state"`
+	ReceivedAt time.Time  `json:"receivedAt"`
+	QueuedAt   *time.Time `json:"queuedAt,omitempty"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	// UploadSeconds is how long the request took to upload and check
+	UploadSeconds float64 `json:"uploadSeconds"`
+	PIDs          []int   `json:"pids"`
+}
+
+// ActiveOperations is the admin view of the operation queue. Operations
+// still uploading do not hold one of the MaxConcurrent slots.
+type ActiveOperations struct {
+	Active        []TrackedOperation `json:"active"`
+	Queued        []TrackedOperation `json:"queued"`
+	Uploading     []TrackedOperation `json:"uploading"`
+	MaxConcurrent int                `json:"maxConcurrent"`
+}
+
+// ActiveOperations lists running and queued operations. Admin only.
+func (c *Client) ActiveOperations(ctx context.Context) (*ActiveOperations, error) {
+	var resp ActiveOperations
+	if err := c.get(ctx, "/admin/operations", &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CancelOperation stops a running or queued operation. Admin only.
+func (c *Client) CancelOperation(ctx context.Context, id string) error {
+	return c.call(ctx, "POST", "/admin/operations/"+url.PathEscape(id)+"/cancel", nil, nil)
+}
+
+// PurgeResult counts the files removed by PurgeFiles
+type PurgeResult struct {
+	Deleted     int            `json:"deleted"`
+	ByNamespace map[string]int `json:"byNamespace"`
+}
+
+// PurgeFiles deletes output files. scope is "expired" (default) or "all";
+// an empty namespace purges every namespace. Admin only.
+func (c *Client) PurgeFiles(ctx context.Context, scope, namespace string) (*PurgeResult, error) {
+	values := url.Values{}
+	if scope != "" {
+		values.Set("scope", scope)
+	}
+	if namespace != "" {
+		values.Set("namespace", namespace)
+	}
+	path := "/admin/files/purge"
+	if len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+
+	var resp PurgeResult
+	if err := c.call(ctx, "POST", path, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Config returns the effective server settings, without secrets. Admin
+// only.
+func (c *Client) Config(ctx context.Context) (map[string]interface{}, error) {
+	var config map[string]interface{}
+	if err := c.get(ctx, "/admin/config", &config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Toggles reports which operations are enabled. Admin only.
+func (c *Client) Toggles(ctx context.Context) (map[string]bool, error) {
+	var resp struct {
+		Operations map[string]bool `json:"operations"`
+	}
+	if err := c.get(ctx, "/admin/toggles", &resp); err != nil {
+		return nil, err
+	}
+	return resp.Operations, nil
+}
+
+// SetToggle enables or disables an operation such as "pdf/ocr". Admin
+// only.
+func (c *Client) SetToggle(ctx context.Context, operation string, enabled bool) error {
+	body, err := json.Marshal(map[string]interface{}{"operation": operation, "enabled": enabled})
+	if err != nil {
+		return err
+	}
+	if err := c.call(ctx, "POST", "/admin/toggles", body, nil); err != nil {
+		return fmt.Errorf("toggling %s: %w", operation, err)
+	}
+	return nil
+}
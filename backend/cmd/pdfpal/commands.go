@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"pdf-backend/client"
+	"pdf-backend/ops"
+)
+
+// How a command maps inputs to outputs
+const (
+	perFile = iota // every input gets its own output file
+	combine        // all inputs go into one output file
+	parts          // every input gets a directory of output files
+)
+
+type command struct {
+	name    string
+	summary string
+	mode    int
+	accept  []string // extensions picked up from directories
+	suffix  string   // output name: <input>-<suffix><ext>, or <suffix><ext> when combining
+	ext     string
+	// minInputs and maxInputs bound the inputs of a combine command
+	minInputs, maxInputs int
+	required             []string // flags that must be set
+
+	flags  func(fs *flag.FlagSet, o *options)
+	local  func(ctx context.Context, o *options, in []string, out string) error
+	remote func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error)
+}
+
+var (
+	acceptPDF   = []string{".pdf"}
+	acceptWord  = []string{".doc", ".docx", ".odt", ".rtf"}
+	acceptExcel = []string{".xls", ".xlsx", ".ods", ".csv"}
+	acceptPPT   = []string{".ppt", ".pptx", ".odp"}
+	acceptImage = []string{".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tif", ".tiff", ".webp"}
+	acceptHTML  = []string{".html", ".htm"}
+)
+
+// convertCommand is a one-file conversion without options
+func convertCommand(name, summary string, accept []string, suffix, ext string,
+	local func(ctx context.Context, in, out string) error,
+	remote func(c *client.Client, ctx context.Context, file client.File) (*client.Result, error)) *command {
+	return &command{
+		name: name, summary: summary, mode: perFile, accept: accept, suffix: suffix, ext: ext,
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return local(ctx, in[0], out)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return remote(c, ctx, in[0])
+		},
+	}
+}
+
+var commands = []*command{
+	{
+		name: "merge", summary: "Merge PDFs into one document",
+		mode: combine, accept: acceptPDF, suffix: "merged", ext: ".pdf", minInputs: 2,
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.StringVar(&o.sort, "sort", "given", "input order: given, name or created")
+			fs.BoolVar(&o.bookmarks, "bookmarks", true, "add a bookmark per input, named after it")
+			fs.BoolVar(&o.toc, "toc", false, "insert a table of contents page")
+			fs.BoolVar(&o.interleave, "interleave", false, "alternate the pages of two inputs, fronts and backs of a duplex scan")
+			fs.BoolVar(&o.reverseSecond, "reverse-second", false, "with --interleave, take the second input's pages last to first")
+		},
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			inputs := make([]ops.MergeInput, len(in))
+			for i, path := range in {
+				inputs[i] = ops.MergeInput{Path: path}
+			}
+			if o.interleave {
+				if len(inputs) != 2 {
+					return usageErrorf("--interleave takes exactly 2 inputs")
+				}
+				unpaired, err := ops.Interleave(ctx, inputs[0], inputs[1], out, ops.InterleaveOptions{ReverseBack: o.reverseSecond})
+				if err == nil && unpaired > 0 {
+					log.Printf("warning: page counts differ by %d: the extra pages were appended at the end", unpaired)
+				}
+				return err
+			}
+			return ops.MergeDocuments(ctx, inputs, out, ops.MergeOptions{Sort: o.sort, Bookmarks: o.bookmarks, TableOfContents: o.toc})
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.MergeWithOptions(ctx, client.MergeOptions{Sort: o.sort, NoBookmarks: !o.bookmarks, TableOfContents: o.toc,
+				Interleave: o.interleave, ReverseSecond: o.reverseSecond}, in...)
+		},
+	},
+	{
+		name: "split", summary: "Split PDFs into single pages, page ranges or parts",
+		mode: parts, accept: acceptPDF, suffix: "split",
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.Var(&o.ranges, "ranges", "page ranges written to separate files, e.g. 1-3,5-7 (default: one file per page)")
+			fs.IntVar(&o.every, "every", 0, "a file every N pages")
+			fs.BoolVar(&o.bookmarks, "bookmarks", false, "a file per bookmark, named after it")
+			fs.IntVar(&o.level, "level", 1, "with --bookmarks, the deepest bookmark level to split at")
+			fs.Var(&o.maxSize, "max-size", "files of at most this size, e.g. 10MB")
+			fs.BoolVar(&o.blank, "blank", false, "split at blank separator pages, leaving them out")
+			fs.Float64Var(&o.blankThreshold, "blank-threshold", ops.DefaultBlankThreshold, "with --blank, the ink coverage in percent below which a page is blank")
+		},
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			opts, err := splitOptions(o)
+			if err != nil {
+				return err
+			}
+			parts, err := ops.Split(ctx, in[0], out, opts)
+			if opts.Mode == ops.SplitSize {
+				for _, part := range parts {
+					if info, err := os.Stat(part.Path); err == nil && info.Size() > opts.MaxSize {
+						log.Printf("warning: %s is over the maximum size: its page is that big on its own", filepath.Base(part.Path))
+					}
+				}
+			}
+			return err
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			opts, err := splitOptions(o)
+			if err != nil {
+				return nil, err
+			}
+			ranges := make([]client.PageRange, len(o.ranges))
+			for i, r := range o.ranges {
+				ranges[i] = client.PageRange{Start: r.Start, End: r.End}
+			}
+			return c.Split(ctx, in[0], client.SplitOptions{Ranges: ranges, Mode: opts.Mode, Every: opts.Every,
+				Level: opts.Level, MaxSize: opts.MaxSize, BlankThreshold: opts.BlankThreshold})
+		},
+	},
+	{
+		name: "compress", summary: "Reduce PDF file size",
+		mode: perFile, accept: acceptPDF, suffix: "compressed", ext: ".pdf",
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.Var(&o.targetSize, "target-size", "downsample images until the file fits, e.g. 2MB or 500KB")
+		},
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.Compress(ctx, in[0], out, ops.CompressOptions{TargetSize: int64(o.targetSize)})
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.Compress(ctx, in[0], client.CompressOptions{TargetSize: int64(o.targetSize)})
+		},
+	},
+	{
+		name: "rotate", summary: "Rotate all pages",
+		mode: perFile, accept: acceptPDF, suffix: "rotated", ext: ".pdf",
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.IntVar(&o.angle, "angle", 90, "clockwise rotation: 90, 180 or 270")
+		},
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.Rotate(ctx, in[0], out, o.angle)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.Rotate(ctx, in[0], client.RotateOptions{Angle: o.angle})
+		},
+	},
+	{
+		name: "extract", summary: "Create a PDF from selected pages",
+		mode: perFile, accept: acceptPDF, suffix: "extracted", ext: ".pdf", required: []string{"pages"},
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.Var(&o.pages, "pages", "pages to extract, e.g. 1,3,5-7")
+		},
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.ExtractPages(ctx, in[0], out, o.pages)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.ExtractPages(ctx, in[0], client.PagesOptions{Pages: o.pages})
+		},
+	},
+	{
+		name: "watermark", summary: "Add a diagonal text watermark",
+		mode: perFile, accept: acceptPDF, suffix: "watermarked", ext: ".pdf",
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.StringVar(&o.text, "text", "WATERMARK", "watermark text")
+		},
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.Watermark(ctx, in[0], out, o.text)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.Watermark(ctx, in[0], client.WatermarkOptions{Text: o.text})
+		},
+	},
+	{
+		name: "delete-pages", summary: "Remove pages",
+		mode: perFile, accept: acceptPDF, suffix: "deleted-pages", ext: ".pdf", required: []string{"pages"},
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.Var(&o.pages, "pages", "pages to delete, e.g. 2,4-6")
+		},
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.DeletePages(ctx, in[0], out, o.pages)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.DeletePages(ctx, in[0], client.PagesOptions{Pages: o.pages})
+		},
+	},
+	{
+		name: "reorder", summary: "Reorder pages",
+		mode: perFile, accept: acceptPDF, suffix: "reordered", ext: ".pdf", required: []string{"order"},
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.Var(&o.order, "order", "new page order, e.g. 3,1,2; pages left out are dropped")
+		},
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.Reorder(ctx, in[0], out, o.order)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.Reorder(ctx, in[0], client.ReorderOptions{Order: o.order})
+		},
+	},
+	{
+		name: "crop", summary: "Set the crop box of every page",
+		mode: perFile, accept: acceptPDF, suffix: "cropped", ext: ".pdf",
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.Float64Var(&o.crop.Top, "top", 0, "top edge in points")
+			fs.Float64Var(&o.crop.Right, "right", 0, "right edge in points")
+			fs.Float64Var(&o.crop.Bottom, "bottom", 0, "bottom edge in points")
+			fs.Float64Var(&o.crop.Left, "left", 0, "left edge in points")
+		},
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.Crop(ctx, in[0], out, o.crop)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.Crop(ctx, in[0], client.CropOptions(o.crop))
+		},
+	},
+	convertCommand("repair", "Rebuild damaged PDFs", acceptPDF, "repaired", ".pdf", ops.Repair, (*client.Client).Repair),
+	{
+		name: "add-page-numbers", summary: "Stamp page numbers",
+		mode: perFile, accept: acceptPDF, suffix: "numbered", ext: ".pdf",
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.StringVar(&o.position, "position", "bottom-center", "one of bottom-center, bottom-left, bottom-right, top-center, top-left, top-right")
+		},
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.AddPageNumbers(ctx, in[0], out, o.position)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.AddPageNumbers(ctx, in[0], client.PageNumberOptions{Position: o.position})
+		},
+	},
+	{
+		name: "add-header-footer", summary: "Stamp header and footer text",
+		mode: perFile, accept: acceptPDF, suffix: "header-footer", ext: ".pdf",
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.StringVar(&o.header, "header", "", "header text")
+			fs.StringVar(&o.footer, "footer", "", "footer text")
+		},
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.AddHeaderFooter(ctx, in[0], out, o.header, o.footer)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.AddHeaderFooter(ctx, in[0], client.HeaderFooterOptions{Header: o.header, Footer: o.footer})
+		},
+	},
+	{
+		name: "metadata", summary: "Set document properties",
+		mode: perFile, accept: acceptPDF, suffix: "metadata", ext: ".pdf",
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.StringVar(&o.meta.Title, "title", "", "document title")
+			fs.StringVar(&o.meta.Author, "author", "", "document author")
+			fs.StringVar(&o.meta.Subject, "subject", "", "document subject")
+			fs.StringVar(&o.meta.Keywords, "keywords", "", "document keywords")
+		},
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.SetMetadata(ctx, in[0], out, o.meta)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.SetMetadata(ctx, in[0], client.Metadata(o.meta))
+		},
+	},
+	{
+		name: "unlock", summary: "Remove password protection",
+		mode: perFile, accept: acceptPDF, suffix: "unlocked", ext: ".pdf",
+		flags: passwordFlag,
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.Unlock(ctx, in[0], out, o.password)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.Unlock(ctx, in[0], client.PasswordOptions{Password: o.password})
+		},
+	},
+	{
+		name: "protect", summary: "Encrypt with a password",
+		mode: perFile, accept: acceptPDF, suffix: "protected", ext: ".pdf", required: []string{"password"},
+		flags: passwordFlag,
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.Protect(ctx, in[0], out, o.password)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.Protect(ctx, in[0], client.PasswordOptions{Password: o.password})
+		},
+	},
+	{
+		name: "ocr", summary: "Add a searchable text layer",
+		mode: perFile, accept: acceptPDF, suffix: "ocr", ext: ".pdf",
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.StringVar(&o.language, "language", "eng", "Tesseract languages, e.g. eng or deu+fra")
+		},
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.OCR(ctx, in[0], out, o.language)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.OCR(ctx, in[0], client.OCROptions{Language: o.language})
+		},
+	},
+	{
+		name: "sign", summary: "Stamp a signature image",
+		mode: perFile, accept: acceptPDF, suffix: "signed", ext: ".pdf", required: []string{"signature"},
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.Var(&o.signature, "signature", "PNG image of the signature")
+			fs.IntVar(&o.page, "page", 1, "page to sign")
+		},
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.Sign(ctx, in[0], out, ops.SignOptions{Image: o.signature, Page: o.page})
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.Sign(ctx, in[0], client.SignOptions{Signature: o.signature, Page: o.page})
+		},
+	},
+	{
+		name: "redact", summary: "Black out rectangular areas",
+		mode: perFile, accept: acceptPDF, suffix: "redacted", ext: ".pdf", required: []string{"areas"},
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.Var(&o.areas, "areas", `JSON rectangles in points, e.g. [{"page":1,"x":100,"y":200,"width":50,"height":20}]`)
+		},
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.Redact(ctx, in[0], out, o.areas)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			areas := make([]client.RedactArea, len(o.areas))
+			for i, a := range o.areas {
+				areas[i] = client.RedactArea(a)
+			}
+			return c.Redact(ctx, in[0], client.RedactOptions{Areas: areas})
+		},
+	},
+	{
+		name: "compare", summary: "Highlight visual differences between two PDFs",
+		mode: combine, accept: acceptPDF, suffix: "comparison", ext: ".pdf", minInputs: 2, maxInputs: 2,
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.Compare(ctx, in[0], in[1], out)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.Compare(ctx, in[0], in[1])
+		},
+	},
+
+	// Conversions - To PDF
+	convertCommand("word-to-pdf", "Convert Word documents to PDF", acceptWord, "converted", ".pdf", ops.OfficeToPDF, (*client.Client).WordToPDF),
+	convertCommand("excel-to-pdf", "Convert spreadsheets to PDF", acceptExcel, "converted", ".pdf", ops.OfficeToPDF, (*client.Client).ExcelToPDF),
+	convertCommand("ppt-to-pdf", "Convert presentations to PDF", acceptPPT, "converted", ".pdf", ops.OfficeToPDF, (*client.Client).PPTToPDF),
+	convertCommand("html-to-pdf", "Render HTML files to PDF", acceptHTML, "html-converted", ".pdf", ops.HTMLToPDF, (*client.Client).HTMLToPDF),
+	{
+		name: "image-to-pdf", summary: "Combine images into a PDF",
+		mode: combine, accept: acceptImage, suffix: "images-to-pdf", ext: ".pdf", minInputs: 1, maxInputs: 100,
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.ImagesToPDF(ctx, in, out)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.ImagesToPDF(ctx, in...)
+		},
+	},
+	{
+		name: "scan-to-pdf", summary: "Enhance scanned images and make a searchable PDF",
+		mode: combine, accept: acceptImage, suffix: "scanned-document", ext: ".pdf", minInputs: 1, maxInputs: 100,
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			return ops.ScanToPDF(ctx, in, out)
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.ScanToPDF(ctx, in...)
+		},
+	},
+
+	// Conversions - From PDF
+	convertCommand("pdf-to-word", "Convert PDFs to DOCX", acceptPDF, "converted", ".docx", ops.PDFToWord, (*client.Client).PDFToWord),
+	convertCommand("pdf-to-excel", "Convert PDF text tables to XLSX", acceptPDF, "converted", ".xlsx", ops.PDFToExcel, (*client.Client).PDFToExcel),
+	convertCommand("pdf-to-ppt", "Convert PDF pages to PPTX slides", acceptPDF, "converted", ".pptx", ops.PDFToPPT, (*client.Client).PDFToPPT),
+	{
+		name: "pdf-to-image", summary: "Render pages to images",
+		mode: parts, accept: acceptPDF, suffix: "images",
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.StringVar(&o.format, "format", "png", "png, jpg or jpeg")
+			fs.IntVar(&o.dpi, "dpi", 150, "resolution, 36-600")
+		},
+		local: func(ctx context.Context, o *options, in []string, out string) error {
+			_, err := ops.PDFToImages(ctx, in[0], out, ops.ImageOptions{Format: o.format, DPI: o.dpi})
+			return err
+		},
+		remote: func(ctx context.Context, c *client.Client, o *options, in []client.File) (*client.Result, error) {
+			return c.PDFToImage(ctx, in[0], client.ImageOptions{Format: o.format, DPI: o.dpi})
+		},
+	},
+	convertCommand("pdf-to-text", "Extract text", acceptPDF, "extracted-text", ".txt", ops.PDFToText, (*client.Client).PDFToText),
+	convertCommand("pdf-to-pdfa", "Convert to PDF/A-2 for archiving", acceptPDF, "pdfa", ".pdf", ops.PDFToPDFA, (*client.Client).PDFToPDFA),
+}
+
+// passwordFlag reads the password from --password or, to keep it out of
+// the process list, from PDFPAL_PASSWORD
+func passwordFlag(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.password, "password", os.Getenv("PDFPAL_PASSWORD"), "PDF password (default $PDFPAL_PASSWORD)")
+}
+
+// splitOptions turns the split flags into options, allowing one way of
+// splitting at a time
+func splitOptions(o *options) (ops.SplitOptions, error) {
+	opts := ops.SplitOptions{Ranges: o.ranges}
+	chosen := 0
+	if len(o.ranges) > 0 {
+		chosen++
+	}
+	if o.every > 0 {
+		opts.Mode, opts.Every = ops.SplitEvery, o.every
+		chosen++
+	}
+	if o.bookmarks {
+		opts.Mode, opts.Level = ops.SplitBookmarks, o.level
+		chosen++
+	}
+	if o.maxSize > 0 {
+		opts.Mode, opts.MaxSize = ops.SplitSize, int64(o.maxSize)
+		chosen++
+	}
+	if o.blank {
+		opts.Mode, opts.BlankThreshold = ops.SplitBlank, o.blankThreshold
+		chosen++
+	}
+	if chosen > 1 {
+		return opts, usageErrorf("--ranges, --every, --bookmarks, --max-size and --blank cannot be combined")
+	}
+	return opts, nil
+}
+
+func lookupCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pdf-backend/ops"
+)
+
+// input is a file to process. rel is its path below the directory argument
+// it was found in, so outputs of a recursive run keep the same layout.
+type input struct {
+	path string
+	rel  string
+}
+
+// expandInputs resolves file, glob and directory arguments. Directories
+// contribute the files with an accepted extension, including those in
+// subdirectories when recursive is set. Files found through globs or
+// directories are sorted by path; explicit files keep their order.
+func expandInputs(args []string, accept []string, recursive bool) ([]input, error) {
+	var inputs []input
+	seen := make(map[string]bool)
+	add := func(path, rel string) {
+		if !seen[path] {
+			seen[path] = true
+			inputs = append(inputs, input{path: path, rel: rel})
+		}
+	}
+
+	for _, arg := range args {
+		matches := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			var err error
+			matches, err = filepath.Glob(arg)
+			if err != nil {
+				return nil, usageErrorf("bad pattern %q: %v", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, usageErrorf("no files match %q", arg)
+			}
+		}
+
+		for _, path := range matches {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, usageErrorf("%v", err)
+			}
+			if !info.IsDir() {
+				add(path, filepath.Base(path))
+				continue
+			}
+
+			files, err := walkDir(path, accept, recursive)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				rel, _ := filepath.Rel(path, file)
+				add(file, rel)
+			}
+		}
+	}
+
+	if len(inputs) == 0 {
+		return nil, usageErrorf("no input files")
+	}
+	return inputs, nil
+}
+
+func walkDir(dir string, accept []string, recursive bool) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && (!recursive || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if accepts(accept, path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+func accepts(accept []string, path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, a := range accept {
+		if ext == a {
+			return true
+		}
+	}
+	return false
+}
+
+// sizeValue is a byte count flag that takes units: 500KB, 2MB, 1.5GB
+type sizeValue int64
+
+func (s *sizeValue) String() string {
+	if *s == 0 {
+		return ""
+	}
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+func (s *sizeValue) Set(value string) error {
+	size, err := parseSize(value)
+	if err != nil {
+		return err
+	}
+	*s = sizeValue(size)
+	return nil
+}
+
+func parseSize(value string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  float64
+	}{
+		{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	}
+
+	number, scale := strings.ToUpper(strings.TrimSpace(value)), 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, scale = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix)), unit.scale
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q, use e.g. 500KB or 2MB", value)
+	}
+	return int64(n * scale), nil
+}
+
+// pageList is a page number flag: 1,3,5-7
+type pageList []int
+
+func (p *pageList) String() string {
+	parts := make([]string, len(*p))
+	for i, page := range *p {
+		parts[i] = strconv.Itoa(page)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (p *pageList) Set(value string) error {
+	ranges, err := parseRanges(value)
+	if err != nil {
+		return err
+	}
+	*p = nil
+	for _, r := range ranges {
+		for page := r.Start; page <= r.End; page++ {
+			*p = append(*p, page)
+		}
+	}
+	return nil
+}
+
+// rangeList is a page range flag: 1-3,5-7
+type rangeList []ops.PageRange
+
+func (r *rangeList) String() string {
+	parts := make([]string, len(*r))
+	for i, rng := range *r {
+		parts[i] = fmt.Sprintf("%d-%d", rng.Start, rng.End)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (r *rangeList) Set(value string) error {
+	ranges, err := parseRanges(value)
+	if err != nil {
+		return err
+	}
+	*r = ranges
+	return nil
+}
+
+func parseRanges(value string) ([]ops.PageRange, error) {
+	var ranges []ops.PageRange
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		startText, endText, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(startText))
+		end := start
+		if err == nil && isRange {
+			end, err = strconv.Atoi(strings.TrimSpace(endText))
+		}
+		if err != nil || start < 1 || end < start {
+			return nil, fmt.Errorf("invalid page or range %q, use e.g. 1,3,5-7", part)
+		}
+		ranges = append(ranges, ops.PageRange{Start: start, End: end})
+	}
+	return ranges, nil
+}
+
+// areaList is a JSON array of redaction rectangles
+type areaList []ops.RedactArea
+
+func (a *areaList) String() string {
+	if len(*a) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(*a)
+	return string(b)
+}
+
+func (a *areaList) Set(value string) error {
+	var areas []ops.RedactArea
+	if err := json.Unmarshal([]byte(value), &areas); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	if len(areas) == 0 {
+		return fmt.Errorf("no areas given")
+	}
+	*a = areas
+	return nil
+}
+
+// fileContents is a flag naming a file that is read when parsed
+type fileContents []byte
+
+func (f *fileContents) String() string { return "" }
+
+func (f *fileContents) Set(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	*f = data
+	return nil
+}
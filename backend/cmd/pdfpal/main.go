@@ -0,0 +1,442 @@
+// Command pdfpal runs the PDF operations of the backend from the shell.
+//
+//	pdfpal merge a.pdf b.pdf -o out.pdf
+//	pdfpal compress --target-size 2MB -r scans/ -o compressed/
+//	pdfpal --server https://pdf.example.com ocr 'inbox/*.pdf'
+//
+// Operations run in-process by default, using the same code as the
+// server, so the external tools (Ghostscript, LibreOffice, ...) must be
+// installed locally. With --server (or PDFPAL_SERVER) the files are sent
+// to a running backend instead.
+//
+// Exit codes:
+//
+//	0   success
+//	1   an operation failed or ran past --timeout
+//	2   usage or configuration error
+//	3   an input was rejected (invalid file, options or password)
+//	4   temporarily unavailable: a tool is missing, the server is busy,
+//	    timed out or unreachable; retrying later may help
+//	130 interrupted
+//
+// When several files are processed, the remaining files are still
+// attempted after a failure and the exit code is that of the first one.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"pdf-backend/client"
+	"pdf-backend/ops"
+)
+
+// Exit codes
+const (
+	exitOK          = 0
+	exitFailed      = 1
+	exitUsage       = 2
+	exitInvalid     = 3
+	exitUnavailable = 4
+	exitInterrupted = 130
+)
+
+type options struct {
+	// Common
+	output    string
+	recursive bool
+	server    string
+	apiKey    string
+	async     bool
+	timeout   time.Duration
+	quiet     bool
+	verbose   bool
+
+	// Operation specific
+	targetSize sizeValue
+	angle      int
+	pages      pageList
+	order      pageList
+	ranges     rangeList
+	text       string
+	crop       ops.CropBox
+	position   string
+	header     string
+	footer     string
+	meta       ops.Metadata
+	password   string
+	language   string
+	signature  fileContents
+	page       int
+	areas      areaList
+	format     string
+	dpi        int
+	sort       string
+	bookmarks  bool
+	toc        bool
+	// merge --interleave
+	interleave    bool
+	reverseSecond bool
+	// split modes
+	every          int
+	level          int
+	maxSize        sizeValue
+	blank          bool
+	blankThreshold float64
+}
+
+type usageError struct{ msg string }
+
+func (e *usageError) Error() string { return e.msg }
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &usageError{fmt.Sprintf(format, args...)}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	// Global flags may precede the command
+	global := flag.NewFlagSet("pdfpal", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	global.Usage = func() { printUsage(stderr) }
+	var o options
+	commonFlags(global, &o)
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	args = global.Args()
+	if len(args) == 0 || args[0] == "help" {
+		printUsage(stderr)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	cmd := lookupCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(stderr, "pdfpal: unknown command %q\n\n", args[0])
+		printUsage(stderr)
+		return exitUsage
+	}
+
+	// Flags set before the command carry over; registering them again
+	// below resets the shared options, so keep their values first
+	globalValues := make(map[string]string)
+	global.Visit(func(f *flag.Flag) { globalValues[f.Name] = f.Value.String() })
+
+	fs := flag.NewFlagSet("pdfpal "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { printCommandUsage(stderr, cmd, fs) }
+	commonFlags(fs, &o)
+	if cmd.flags != nil {
+		cmd.flags(fs, &o)
+	}
+	for name, value := range globalValues {
+		fs.Set(name, value)
+	}
+
+	positional, err := parseInterleaved(fs, args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if err := checkRequired(fs, cmd); err != nil {
+		fmt.Fprintf(stderr, "pdfpal %s: %v\n", cmd.name, err)
+		return exitUsage
+	}
+
+	if !o.verbose {
+		ops.Logf = func(string, ...interface{}) {}
+	}
+	log.SetFlags(0)
+	log.SetPrefix("pdfpal: ")
+	log.SetOutput(stderr)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+
+	r := &runner{cmd: cmd, opts: &o, stdout: stdout}
+	if o.server != "" {
+		r.client = client.New(o.server, o.apiKey)
+		r.client.Async = o.async
+	}
+
+	code := r.run(ctx, positional)
+	if code != exitOK && ctx.Err() == context.Canceled {
+		return exitInterrupted
+	}
+	return code
+}
+
+func commonFlags(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.output, "o", "", "output file, or directory when several outputs are written")
+	fs.StringVar(&o.output, "output", "", "same as -o")
+	fs.BoolVar(&o.recursive, "r", false, "include subdirectories of directory arguments")
+	fs.BoolVar(&o.recursive, "recursive", false, "same as -r")
+	fs.StringVar(&o.server, "server", os.Getenv("PDFPAL_SERVER"), "run on this backend instead of in-process (default $PDFPAL_SERVER)")
+	fs.StringVar(&o.apiKey, "api-key", os.Getenv("PDFPAL_API_KEY"), "API key for --server (default $PDFPAL_API_KEY)")
+	fs.BoolVar(&o.async, "async", false, "run as server jobs, for operations that outlast proxy timeouts")
+	fs.DurationVar(&o.timeout, "timeout", 0, "give up after this long, e.g. 10m (default no limit)")
+	fs.BoolVar(&o.quiet, "q", false, "do not print output paths")
+	fs.BoolVar(&o.verbose, "v", false, "print tool diagnostics")
+}
+
+// parseInterleaved lets flags follow positional arguments, as in
+// "pdfpal merge a.pdf b.pdf -o out.pdf". Arguments after "--" are never
+// treated as flags.
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		// Parse stops at the first non-flag or right after "--"
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// checkRequired reports the first required flag that was neither set nor
+// defaulted from the environment
+func checkRequired(fs *flag.FlagSet, cmd *command) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, name := range cmd.required {
+		if !set[name] && fs.Lookup(name).Value.String() == "" {
+			return fmt.Errorf("--%s is required", name)
+		}
+	}
+	return nil
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: pdfpal [--server URL] COMMAND [flags] FILE...\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	summaries := make(map[string]string)
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+		summaries[cmd.name] = cmd.summary
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-18s %s\n", name, summaries[name])
+	}
+	fmt.Fprintf(w, "\nFILE may be a file, a quoted glob or a directory (-r to recurse).\n")
+	fmt.Fprintf(w, "Run 'pdfpal COMMAND -h' for the flags of a command.\n")
+}
+
+func printCommandUsage(w io.Writer, cmd *command, fs *flag.FlagSet) {
+	args := "FILE..."
+	switch {
+	case cmd.mode == combine && cmd.maxInputs == 2:
+		args = "FILE FILE"
+	case cmd.mode == combine:
+		args = "FILE... -o OUTPUT"
+	}
+	fmt.Fprintf(w, "Usage: pdfpal %s [flags] %s\n\n%s.\n\nFlags:\n", cmd.name, args, cmd.summary)
+	fs.PrintDefaults()
+}
+
+// exitCode classifies an error for scripts
+func exitCode(err error) int {
+	var usage *usageError
+	var apiErr *client.APIError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usage):
+		return exitUsage
+	case errors.Is(err, context.DeadlineExceeded):
+		// --timeout; also satisfies net.Error, so check it first
+		return exitFailed
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.Temporary():
+			return exitUnavailable
+		case apiErr.StatusCode == 401 || apiErr.StatusCode == 403:
+			return exitUsage
+		case apiErr.StatusCode >= 400 && apiErr.StatusCode < 500:
+			return exitInvalid
+		}
+		return exitFailed
+	case errors.As(err, &netErr):
+		return exitUnavailable
+	}
+
+	switch ops.KindOf(err) {
+	case ops.KindInvalidInput, ops.KindEncrypted, ops.KindWrongPassword, ops.KindLimitExceeded:
+		return exitInvalid
+	case ops.KindToolUnavailable:
+		return exitUnavailable
+	}
+	return exitFailed
+}
+
+// runner processes the inputs of one command invocation
+type runner struct {
+	cmd    *command
+	opts   *options
+	client *client.Client // nil runs in-process
+	stdout io.Writer
+}
+
+func (r *runner) run(ctx context.Context, args []string) int {
+	inputs, err := expandInputs(args, r.cmd.accept, r.opts.recursive)
+	if err != nil {
+		log.Printf("%s: %v", r.cmd.name, err)
+		return exitCode(err)
+	}
+
+	if r.cmd.mode == combine {
+		return r.runCombined(ctx, inputs)
+	}
+
+	outDir, err := r.outputDir(inputs)
+	if err != nil {
+		log.Printf("%s: %v", r.cmd.name, err)
+		return exitCode(err)
+	}
+
+	code := exitOK
+	for _, in := range inputs {
+		if ctx.Err() != nil {
+			break
+		}
+		out := r.outputPath(in, outDir, len(inputs))
+		if err := r.process(ctx, []string{in.path}, out); err != nil {
+			log.Printf("%s %s: %v", r.cmd.name, in.path, err)
+			if code == exitOK {
+				code = exitCode(err)
+			}
+			continue
+		}
+		r.printResult(out)
+	}
+	return code
+}
+
+func (r *runner) runCombined(ctx context.Context, inputs []input) int {
+	if len(inputs) < r.cmd.minInputs || (r.cmd.maxInputs > 0 && len(inputs) > r.cmd.maxInputs) {
+		count := fmt.Sprintf("at least %d", r.cmd.minInputs)
+		if r.cmd.maxInputs == r.cmd.minInputs {
+			count = fmt.Sprintf("exactly %d", r.cmd.minInputs)
+		} else if r.cmd.maxInputs > 0 {
+			count = fmt.Sprintf("%d to %d", r.cmd.minInputs, r.cmd.maxInputs)
+		}
+		log.Printf("%s: needs %s input files, got %d", r.cmd.name, count, len(inputs))
+		return exitUsage
+	}
+
+	out := r.opts.output
+	if out == "" {
+		out = r.cmd.suffix + r.cmd.ext
+	}
+	paths := make([]string, len(inputs))
+	for i, in := range inputs {
+		paths[i] = in.path
+	}
+	if err := r.process(ctx, paths, out); err != nil {
+		log.Printf("%s: %v", r.cmd.name, err)
+		return exitCode(err)
+	}
+	r.printResult(out)
+	return exitOK
+}
+
+// outputDir returns the directory -o names for a run with several outputs,
+// or "" to write each output next to its input
+func (r *runner) outputDir(inputs []input) (string, error) {
+	dir := r.opts.output
+	if dir == "" {
+		return "", nil
+	}
+	info, err := os.Stat(dir)
+	isDir := err == nil && info.IsDir()
+	if r.cmd.mode == perFile && len(inputs) == 1 && !isDir {
+		return "", nil // -o is the output file
+	}
+	if err == nil && !isDir {
+		return "", usageErrorf("-o %s must be a directory for %d inputs", dir, len(inputs))
+	}
+	return dir, nil
+}
+
+// outputPath is the file (perFile) or directory (parts) an input goes to
+func (r *runner) outputPath(in input, outDir string, count int) string {
+	if r.opts.output != "" && outDir == "" {
+		return r.opts.output
+	}
+	if r.cmd.mode == parts && count == 1 && outDir != "" {
+		return outDir
+	}
+
+	name := strings.TrimSuffix(filepath.Base(in.path), filepath.Ext(in.path)) + "-" + r.cmd.suffix + r.cmd.ext
+	if outDir == "" {
+		return filepath.Join(filepath.Dir(in.path), name)
+	}
+	return filepath.Join(outDir, filepath.Dir(in.rel), name)
+}
+
+// process runs the command and removes partial output when it fails, so a
+// file at the output path always is a finished result
+func (r *runner) process(ctx context.Context, in []string, out string) error {
+	dir := out
+	if r.cmd.mode != parts {
+		dir = filepath.Dir(out)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var err error
+	if r.client != nil {
+		err = r.remote(ctx, in, out)
+	} else {
+		err = r.cmd.local(ctx, r.opts, in, out)
+	}
+	if err != nil && r.cmd.mode != parts {
+		os.Remove(out)
+	}
+	return err
+}
+
+func (r *runner) printResult(out string) {
+	if !r.opts.quiet {
+		fmt.Fprintln(r.stdout, out)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"pdf-backend/client"
+	"pdf-backend/ops"
+)
+
+func TestParseSize(t *testing.T) {
+	for value, want := range map[string]int64{
+		"2MB": 2 << 20, "500kb": 500 << 10, "1.5G": 3 << 29, "4096": 4096, "10 B": 10,
+	} {
+		if got, err := parseSize(value); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "MB", "-1MB", "2XB"} {
+		if _, err := parseSize(value); err == nil {
+			t.Errorf("parseSize(%q) succeeded", value)
+		}
+	}
+}
+
+func TestPageList(t *testing.T) {
+	var pages pageList
+	if err := pages.Set("1,3,5-7"); err != nil {
+		t.Fatal(err)
+	}
+	if want := (pageList{1, 3, 5, 6, 7}); !reflect.DeepEqual(pages, want) {
+		t.Errorf("pages = %v, want %v", pages, want)
+	}
+	for _, value := range []string{"0", "3-1", "a", "1,,2"} {
+		if err := pages.Set(value); err == nil {
+			t.Errorf("Set(%q) succeeded", value)
+		}
+	}
+}
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.pdf", "a.PDF", "notes.txt", "sub/c.pdf", ".hidden/d.pdf"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("%PDF"), 0644)
+	}
+
+	rels := func(inputs []input) []string {
+		var names []string
+		for _, in := range inputs {
+			names = append(names, filepath.ToSlash(in.rel))
+		}
+		return names
+	}
+
+	inputs, err := expandInputs([]string{dir}, acceptPDF, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rels(inputs), []string{"a.PDF", "b.pdf"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("flat = %v, want %v", got, want)
+	}
+
+	inputs, _ = expandInputs([]string{dir}, acceptPDF, true)
+	if got, want := rels(inputs), []string{"a.PDF", "b.pdf", "sub/c.pdf"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("recursive = %v, want %v", got, want)
+	}
+
+	// Explicit files keep their order and are not repeated
+	inputs, _ = expandInputs([]string{filepath.Join(dir, "b.pdf"), filepath.Join(dir, "*.pdf")}, acceptPDF, false)
+	if got, want := rels(inputs), []string{"b.pdf"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("glob = %v, want %v", got, want)
+	}
+
+	if _, err := expandInputs([]string{filepath.Join(dir, "*.docx")}, acceptPDF, false); exitCode(err) != exitUsage {
+		t.Errorf("unmatched glob: %v", err)
+	}
+}
+
+func TestSplitOptions(t *testing.T) {
+	opts, err := splitOptions(&options{bookmarks: true, level: 2})
+	if err != nil || opts.Mode != ops.SplitBookmarks || opts.Level != 2 {
+		t.Errorf("--bookmarks --level 2: %+v, %v", opts, err)
+	}
+	opts, err = splitOptions(&options{maxSize: 10 << 20})
+	if err != nil || opts.Mode != ops.SplitSize || opts.MaxSize != 10<<20 {
+		t.Errorf("--max-size 10MB: %+v, %v", opts, err)
+	}
+	if _, err := splitOptions(&options{every: 2, blank: true}); exitCode(err) != exitUsage {
+		t.Errorf("--every with --blank: %v", err)
+	}
+}
+
+func TestParseInterleaved(t *testing.T) {
+	var o options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	commonFlags(fs, &o)
+
+	args, err := parseInterleaved(fs, []string{"a.pdf", "b.pdf", "-o", "out.pdf", "-q", "--", "-c.pdf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.pdf", "b.pdf", "-c.pdf"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+	if o.output != "out.pdf" || !o.quiet {
+		t.Errorf("options = %+v", o)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{nil, exitOK},
+		{usageErrorf("bad"), exitUsage},
+		{&ops.Error{Kind: ops.KindInvalidInput}, exitInvalid},
+		{&ops.Error{Kind: ops.KindToolUnavailable}, exitUnavailable},
+		{&ops.Error{Kind: ops.KindFailed}, exitFailed},
+		{&client.APIError{StatusCode: 400}, exitInvalid},
+		{&client.APIError{StatusCode: 401}, exitUsage},
+		{&client.APIError{StatusCode: 503}, exitUnavailable},
+		{&client.APIError{StatusCode: 500}, exitFailed},
+	} {
+		if got := exitCode(tc.err); got != tc.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRunUsageErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"frobnicate"},
+		{"merge", "only-one.pdf"},
+		{"extract", "a.pdf"},
+		{"rotate", "--angle", "x", "a.pdf"},
+	} {
+		var stderr bytes.Buffer
+		if code := run(args, &bytes.Buffer{}, &stderr); code != exitUsage {
+			t.Errorf("run(%v) = %d, want %d; stderr: %s", args, code, exitUsage, stderr.String())
+		}
+	}
+}
+
+func TestRunMergeInProcess(t *testing.T) {
+	dir := t.TempDir()
+	var stdout, stderr bytes.Buffer
+
+	// Not PDFs: merge must fail cleanly without leaving an output behind
+	a, b := filepath.Join(dir, "a.pdf"), filepath.Join(dir, "b.pdf")
+	os.WriteFile(a, []byte("not a pdf"), 0644)
+	os.WriteFile(b, []byte("not a pdf"), 0644)
+	out := filepath.Join(dir, "out", "merged.pdf")
+
+	code := run([]string{"merge", a, b, "-o", out}, &stdout, &stderr)
+	if code == exitOK {
+		t.Fatalf("merge of invalid files succeeded")
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("partial output left at %s", out)
+	}
+	if !strings.Contains(stderr.String(), "merge") {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+}
+
+func TestRunSplitRemote(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/pdf/split":
+			if got := r.FormValue("ranges"); got != `[{"start":1,"end":2}]` {
+				t.Errorf("ranges = %q", got)
+			}
+			json.NewEncoder(w).Encode(map[string]string{"downloadUrl": server.URL + "/files/ns/split.zip"})
+		case "/files/ns/split.zip":
+			zw := zip.NewWriter(w)
+			f, _ := zw.Create("pages_1-2.pdf")
+			f.Write([]byte("%PDF part"))
+			zw.Close()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	in := filepath.Join(dir, "doc.pdf")
+	os.WriteFile(in, []byte("%PDF"), 0644)
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--server", server.URL, "split", "--ranges", "1-2", in}, &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+
+	partsDir := filepath.Join(dir, "doc-split")
+	if got := strings.TrimSpace(stdout.String()); got != partsDir {
+		t.Errorf("stdout = %q, want %q", got, partsDir)
+	}
+	part, err := os.ReadFile(filepath.Join(partsDir, "pages_1-2.pdf"))
+	if err != nil || string(part) != "%PDF part" {
+		t.Errorf("part = %q, %v", part, err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(partsDir, ".download-*")); len(leftovers) > 0 {
+		t.Errorf("archive left behind: %v", leftovers)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pdf-backend/client"
+)
+
+// remote sends the inputs to the server and downloads the result to out.
+// Commands with several results get a ZIP, which is unpacked into out.
+func (r *runner) remote(ctx context.Context, in []string, out string) error {
+	files := make([]client.File, len(in))
+	for i, path := range in {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		files[i] = client.File{Name: filepath.Base(path), Body: f}
+	}
+
+	res, err := r.cmd.remote(ctx, r.client, r.opts, files)
+	if err != nil {
+		return err
+	}
+	for _, warning := range res.Warnings {
+		log.Printf("warning: %s", warning)
+	}
+
+	if r.cmd.mode != parts {
+		return download(ctx, r.client, res.DownloadURL, out)
+	}
+
+	archive, err := os.CreateTemp(out, ".download-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive.Name())
+	archive.Close()
+
+	if err := download(ctx, r.client, res.DownloadURL, archive.Name()); err != nil {
+		return err
+	}
+	return unzip(archive.Name(), out)
+}
+
+func download(ctx context.Context, c *client.Client, url, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := c.Download(ctx, url, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// unzip extracts the files of a result archive into dir. Entries are
+// flattened to their base name, as the server never nests them.
+func unzip(archive, dir string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return fmt.Errorf("reading result archive: %w", err)
+	}
+	defer zr.Close()
+
+	for _, entry := range zr.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		name := filepath.Base(entry.Name)
+		if name == "." || strings.HasPrefix(name, "..") {
+			continue
+		}
+		if err := extract(entry, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extract(entry *zip.File, path string) error {
+	src, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Deletion config
+var (
+	// SECURE_ERASE overwrites files with zeros before unlinking them:
+	// uploads and intermediates when an operation finishes, outputs when
+	// they expire or are deleted
+	SecureErase = getEnv("SECURE_ERASE", "false") == "true"
+)
+
+// Why an output was deleted before it expired, see FileInfo.DeleteReason
+const (
+	DeletedByRequest  = "request"
+	DeletedByDownload = "download"
+)
+
+// removeFile unlinks path, erasing its contents first if SECURE_ERASE is
+// set
+func removeFile(path string) error {
+	if SecureErase {
+		if err := eraseFile(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("⚠️  Secure erase of %s failed: %v", path, err)
+		}
+	}
+	return os.Remove(path)
+}
+
+// removeAll is os.RemoveAll, erasing every file first if SECURE_ERASE is
+// set
+func removeAll(dir string) error {
+	if SecureErase {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && d.Type().IsRegular() {
+				eraseFile(path)
+			}
+			return nil
+		})
+	}
+	return os.RemoveAll(dir)
+}
+
+// eraseFile overwrites the contents of path with zeros and flushes them
+// to disk. Copy-on-write filesystems and SSDs may keep the old blocks, so
+// this guards against recovery from the filesystem, not from the device.
+func eraseFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zeros := make([]byte, 64<<10)
+	for remaining := info.Size(); remaining > 0; {
+		n := int64(len(zeros))
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := f.Write(zeros[:n]); err != nil {
+			return err
+		}
+		remaining -= n
+	}
+	return f.Sync()
+}
+
+// deleteOutput removes a registered output before it expires. Its registry
+// entry stays until the TTL runs out, recording when and why it went.
+// It reports false if path is not a live output.
+func deleteOutput(path, reason string) bool {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	info, ok := fileRegistry[path]
+	if !ok || info.DeletedAt != nil {
+		return false
+	}
+	if err := removeFile(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("⚠️  Failed to delete %s: %v", path, err)
+		return false
+	}
+	now := time.Now()
+	info.DeletedAt = &now
+	info.DeleteReason = reason
+	fileRegistry[path] = info
+	log.Printf("🗑️  Deleted %s (%s)", filepath.Base(path), reason)
+	return true
+}
+
+// deleteAfterDownload marks the output at path to be deleted once it has
+// been downloaded in full
+func deleteAfterDownload(path string) {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	if info, ok := fileRegistry[path]; ok {
+		info.DeleteAfterDownload = true
+		fileRegistry[path] = info
+	}
+}
+
+// registeredFile returns the registry entry of path
+func registeredFile(path string) (FileInfo, bool) {
+	fileMutex.RLock()
+	defer fileMutex.RUnlock()
+	info, ok := fileRegistry[path]
+	return info, ok
+}
+
+// wantsDeleteAfterDownload reports whether the client asked for the output
+// to be deleted once downloaded, with deleteAfterDownload=true
+func wantsDeleteAfterDownload(r *http.Request) bool {
+	return paramsFrom(r).Bool("deleteAfterDownload")
+}
+
+// DELETE /files/{namespace}/{filename} with the owner's or an admin key.
+// A share token lets its holder read the file, not remove it for everyone.
+func handleDeleteFile(w http.ResponseWriter, r *http.Request, path string, isOwner bool) {
+	if !isOwner && !principalFrom(r).Admin {
+		sendError(w, "Only the owner's key can delete a file", http.StatusForbidden)
+		return
+	}
+	info, ok := registeredFile(path)
+	if ok && info.DeletedAt != nil {
+		sendError(w, "File was already deleted", http.StatusGone)
+		return
+	}
+	if !ok || !deleteOutput(path, DeletedByRequest) {
+		sendError(w, "File not found or expired", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveAndCount serves the stored file at path, decrypting it on the fly,
+// and reports whether the whole file was sent with a 200
+func serveAndCount(w http.ResponseWriter, r *http.Request, path string) bool {
+	f, err := openStored(path)
+	if os.IsNotExist(err) {
+		http.Error(w, "File not found or expired", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		log.Printf("⚠️  Failed to open %s: %v", filepath.Base(path), err)
+		sendError(w, "Failed to read file", http.StatusInternalServerError)
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		sendError(w, "Failed to read file", http.StatusInternalServerError)
+		return false
+	}
+
+	cw := &countingWriter{ResponseWriter: w, status: http.StatusOK}
+	http.ServeContent(cw, r, filepath.Base(path), info.ModTime(), f)
+	return r.Method == "GET" && cw.status == http.StatusOK && cw.written == f.Size()
+}
+
+// countingWriter records the status and body size of a response
+type countingWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (c *countingWriter) WriteHeader(code int) {
+	c.status = code
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(b)
+	c.written += int64(n)
+	return n, err
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeleteOutputs(t *testing.T) {
+	oldTempDir, oldKeys, oldAdmin := TempDir, APIKeys, AdminAPIKeys
+	TempDir, APIKeys, AdminAPIKeys = t.TempDir(), parseAPIKeys("k1:acme,k2:beta"), []string{"root"}
+	t.Cleanup(func() { TempDir, APIKeys, AdminAPIKeys = oldTempDir, oldKeys, oldAdmin })
+	handler := authMiddleware(setupRoutes())
+
+	rotate := func(query string) string {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("angle", "90")
+		part, _ := form.CreateFormFile("file0", "in.pdf")
+		part.Write(minimalPDF())
+		form.Close()
+
+		req := httptest.NewRequest("POST", "/api/pdf/rotate"+query, &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.Header.Set("X-API-Key", "k1")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var resp struct {
+			DownloadURL string `json:"downloadUrl"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.DownloadURL == "" {
+			t.Fatalf("rotate: %d %s", rec.Code, rec.Body.String())
+		}
+		u, _ := url.Parse(resp.DownloadURL)
+		return u.RequestURI()
+	}
+	doAs := func(key, method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	do := func(method, target string) *httptest.ResponseRecorder {
+		return doAs("k1", method, target)
+	}
+	outputs := func() []string {
+		files, _ := filepath.Glob(filepath.Join(TempDir, "ns", "acme", "output", "*"))
+		return files
+	}
+
+	// A partial download keeps the file, a full one deletes it
+	target := rotate("?deleteAfterDownload=true")
+	req := httptest.NewRequest("GET", target, nil)
+	req.Header.Set("Range", "bytes=0-3")
+	req.Header.Set("X-API-Key", "k1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent || len(outputs()) != 1 {
+		t.Fatalf("range request: %d, outputs %v", rec.Code, outputs())
+	}
+	if rec := do("GET", target); rec.Code != http.StatusOK || !bytes.HasPrefix(rec.Body.Bytes(), []byte("%PDF-")) {
+		t.Fatalf("download: %d", rec.Code)
+	}
+	if len(outputs()) != 0 {
+		t.Errorf("downloaded file kept: %v", outputs())
+	}
+	if rec := do("GET", target); rec.Code != http.StatusGone {
+		t.Errorf("second download: %d", rec.Code)
+	}
+
+	// Without the flag files stay until deleted explicitly
+	target = rotate("")
+	do("GET", target)
+	if len(outputs()) != 1 {
+		t.Fatalf("outputs = %v", outputs())
+	}
+	if rec := do("DELETE", target); rec.Code != http.StatusNoContent || len(outputs()) != 0 {
+		t.Errorf("delete: %d, outputs %v", rec.Code, outputs())
+	}
+	u, _ := url.Parse(target)
+	info, _ := registeredFile(filepath.Join(TempDir, "ns", "acme", "output", filepath.Base(u.Path)))
+	if info.DeletedAt == nil || info.DeleteReason != DeletedByRequest {
+		t.Errorf("deletion not recorded: %+v", info)
+	}
+	if rec := do("DELETE", target); rec.Code != http.StatusGone {
+		t.Errorf("second delete: %d", rec.Code)
+	}
+
+	// A share token lets its holder download the file but not delete it
+	shared := rotate("?share=true")
+	if rec := doAs("", "GET", shared); rec.Code != http.StatusOK {
+		t.Errorf("shared download: %d", rec.Code)
+	}
+	if rec := doAs("", "DELETE", shared); rec.Code != http.StatusForbidden || len(outputs()) != 1 {
+		t.Errorf("delete with token: %d, outputs %v", rec.Code, outputs())
+	}
+	if rec := doAs("k2", "DELETE", shared); rec.Code != http.StatusForbidden || len(outputs()) != 1 {
+		t.Errorf("delete by another key with token: %d, outputs %v", rec.Code, outputs())
+	}
+	u, _ = url.Parse(shared)
+	if rec := doAs("k2", "DELETE", u.Path); rec.Code != http.StatusNotFound || len(outputs()) != 1 {
+		t.Errorf("delete by another key: %d, outputs %v", rec.Code, outputs())
+	}
+	if rec := doAs("root", "DELETE", u.Path); rec.Code != http.StatusNoContent || len(outputs()) != 0 {
+		t.Errorf("delete by admin: %d, outputs %v", rec.Code, outputs())
+	}
+}
+
+func TestEraseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret.pdf")
+	os.WriteFile(path, bytes.Repeat([]byte("secret"), 20000), 0644)
+
+	if err := eraseFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if len(data) != 120000 || !bytes.Equal(data, make([]byte, len(data))) {
+		t.Errorf("file not overwritten with zeros (%d bytes)", len(data))
+	}
+
+	oldSecureErase := SecureErase
+	SecureErase = true
+	t.Cleanup(func() { SecureErase = oldSecureErase })
+	if err := removeFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file still exists: %v", err)
+	}
+}
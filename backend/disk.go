@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Disk config
+var (
+	// MIN_FREE_DISK_MB is the free space below which new operations are
+	// refused with 507
+	MinFreeDiskMB = getEnvInt("MIN_FREE_DISK_MB", 512)
+	// DISK_LOW_MB is the free space below which expired files are removed
+	// right away instead of at the next cleanup tick
+	DiskLowMB        = getEnvInt("DISK_LOW_MB", 2048)
+	DiskCheckSeconds = getEnvInt("DISK_CHECK_SECONDS", 10)
+)
+
+// DiskStatus is the last measurement of the volume holding TempDir
+type DiskStatus struct {
+	FreeBytes    int64     `json:"freeBytes"`
+	TotalBytes   int64     `json:"totalBytes"`
+	TempDirBytes int64     `json:"tempDirBytes"`
+	Low          bool      `json:"low"`
+	CheckedAt    time.Time `json:"checkedAt"`
+}
+
+var (
+	diskStatus DiskStatus
+	diskMu     sync.RWMutex
+)
+
+// diskMonitor keeps diskStatus current and frees space when it runs low
+func diskMonitor() {
+	checkDisk()
+	ticker := time.NewTicker(time.Duration(DiskCheckSeconds) * time.Second)
+	for range ticker.C {
+		checkDisk()
+	}
+}
+
+// checkDisk measures TempDir, removing expired files first if free space
+// is below DISK_LOW_MB
+func checkDisk() DiskStatus {
+	free, total, err := diskFree(TempDir)
+	if err != nil {
+		return currentDiskStatus()
+	}
+	low := int64(DiskLowMB) << 20
+	if free < low {
+		if removed, freed := freeDiskSpace(low - free); removed > 0 {
+			log.Printf("🧹 Low disk space: removed %d expired files early (%d MB)", removed, freed>>20)
+			free, total, _ = diskFree(TempDir)
+		}
+	}
+
+	status := DiskStatus{
+		FreeBytes:    free,
+		TotalBytes:   total,
+		TempDirBytes: dirSize(TempDir),
+		Low:          free < low,
+		CheckedAt:    time.Now(),
+	}
+	diskMu.Lock()
+	diskStatus = status
+	diskMu.Unlock()
+	return status
+}
+
+func currentDiskStatus() DiskStatus {
+	diskMu.RLock()
+	defer diskMu.RUnlock()
+	return diskStatus
+}
+
+// freeDiskSpace removes expired files, oldest first, until about need
+// bytes are freed. It returns how many files and bytes went.
+func freeDiskSpace(need int64) (removed int, freed int64) {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	ttl := time.Duration(FileTTLMinutes) * time.Minute
+	var expired []FileInfo
+	for _, info := range fileRegistry {
+		if time.Since(info.CreatedAt) >= ttl && info.DeletedAt == nil {
+			expired = append(expired, info)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].CreatedAt.Before(expired[j].CreatedAt) })
+
+	for _, info := range expired {
+		if freed >= need {
+			break
+		}
+		if stat, err := os.Stat(info.Path); err == nil {
+			freed += stat.Size()
+		}
+		removeFile(info.Path)
+		delete(fileRegistry, info.Path)
+		removed++
+	}
+	return removed, freed
+}
+
+// checkDiskSpace makes sure storing incoming bytes leaves MIN_FREE_DISK_MB
+// free, clearing expired files before giving up. Hosts where free space
+// cannot be measured are not limited.
+func checkDiskSpace(incoming int64) error {
+	if MinFreeDiskMB <= 0 {
+		return nil
+	}
+	need := int64(MinFreeDiskMB)<<20 + incoming
+
+	free, _, err := diskFree(TempDir)
+	if err != nil || free >= need {
+		return nil
+	}
+	freeDiskSpace(need - free)
+	if free, _, err = diskFree(TempDir); err != nil || free >= need {
+		return nil
+	}
+	return fmt.Errorf("insufficient storage on the server: %d MB free, %d MB needed", free>>20, need>>20)
+}
+
+// dirSize sums the bytes of the files under dir
+func dirSize(dir string) int64 {
+	var total int64
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+func diskFree(dir string) (free, total int64, err error) {
+	return 0, 0, errors.New("free disk space is not available on this platform")
+}
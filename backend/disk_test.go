@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFreeDiskSpaceOldestFirst(t *testing.T) {
+	oldTempDir := TempDir
+	TempDir = t.TempDir()
+	t.Cleanup(func() { TempDir = oldTempDir })
+
+	ttl := time.Duration(FileTTLMinutes) * time.Minute
+	var paths []string
+	for i, age := range []time.Duration{ttl + time.Minute, ttl + time.Hour, time.Minute} {
+		path := filepath.Join(TempDir, "ns", "acme", "output", strings.Repeat("f", i+1)+".pdf")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, make([]byte, 100), 0644)
+		registerFileAt(path, time.Now().Add(-age))
+		paths = append(paths, path)
+	}
+	t.Cleanup(func() {
+		fileMutex.Lock()
+		defer fileMutex.Unlock()
+		for _, path := range paths {
+			delete(fileRegistry, path)
+		}
+	})
+
+	// Only one file is needed, and the oldest expired one goes
+	if removed, freed := freeDiskSpace(50); removed != 1 || freed != 100 {
+		t.Errorf("removed %d files, %d bytes", removed, freed)
+	}
+	if _, err := os.Stat(paths[1]); !os.IsNotExist(err) {
+		t.Error("oldest expired file was kept")
+	}
+
+	// Files within their TTL are never removed early
+	freeDiskSpace(1 << 40)
+	if _, err := os.Stat(paths[0]); !os.IsNotExist(err) {
+		t.Error("expired file was kept")
+	}
+	if _, err := os.Stat(paths[2]); err != nil {
+		t.Errorf("unexpired file removed: %v", err)
+	}
+}
+
+func TestInsufficientStorage(t *testing.T) {
+	if _, _, err := diskFree(t.TempDir()); err != nil {
+		t.Skipf("free space unavailable: %v", err)
+	}
+	oldTempDir, oldMin := TempDir, MinFreeDiskMB
+	TempDir, MinFreeDiskMB = t.TempDir(), 1<<30 // a petabyte
+	t.Cleanup(func() { TempDir, MinFreeDiskMB = oldTempDir, oldMin })
+
+	req := httptest.NewRequest("POST", "/api/pdf/rotate", strings.NewReader(""))
+	rec := httptest.NewRecorder()
+	authMiddleware(setupRoutes()).ServeHTTP(rec, req)
+	if rec.Code != http.StatusInsufficientStorage {
+		t.Errorf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+}
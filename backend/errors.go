@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"pdf-backend/ops"
+)
+
+// Error codes tell clients why a request failed. They are part of the
+// API: a code never changes meaning, new ones may be added.
+const (
+	CodeInvalidInput        = "INVALID_INPUT"
+	CodeUnsupportedType     = "UNSUPPORTED_TYPE"
+	CodeEncryptedPDF        = "ENCRYPTED_PDF"
+	CodeWrongPassword       = "WRONG_PASSWORD"
+	CodeLimitExceeded       = "LIMIT_EXCEEDED"
+	CodeUnauthorized        = "UNAUTHORIZED"
+	CodeNotFound            = "NOT_FOUND"
+	CodeMethodNotAllowed    = "METHOD_NOT_ALLOWED"
+	CodeToolUnavailable     = "TOOL_UNAVAILABLE"
+	CodeTimeout             = "TIMEOUT"
+	CodeCanceled            = "CANCELED"
+	CodeUnavailable         = "UNAVAILABLE"
+	CodeInsufficientStorage = "INSUFFICIENT_STORAGE"
+	CodeProcessingFailed    = "PROCESSING_FAILED"
+	CodeInternal            = "INTERNAL"
+)
+
+// errorCodes lists every code, for the OpenAPI document
+var errorCodes = []string{
+	CodeInvalidInput, CodeUnsupportedType, CodeEncryptedPDF, CodeWrongPassword,
+	CodeLimitExceeded, CodeUnauthorized, CodeNotFound, CodeMethodNotAllowed,
+	CodeToolUnavailable, CodeTimeout, CodeCanceled, CodeUnavailable,
+	CodeInsufficientStorage, CodeProcessingFailed, CodeInternal,
+}
+
+// retriableCodes may succeed when the same request is sent again later,
+// or to another server
+var retriableCodes = map[string]bool{
+	CodeToolUnavailable:     true,
+	CodeTimeout:             true,
+	CodeCanceled:            true,
+	CodeUnavailable:         true,
+	CodeInsufficientStorage: true,
+}
+
+// ErrorResponse is the body of every error answer
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	Code      string `json:"code"`
+	RequestID string `json:"requestId,omitempty"`
+	Retriable bool   `json:"retriable"`
+	// Fields explains rejected form fields and exceeded limits
+	Fields []FieldError `json:"fields,omitempty"`
+	// Diagnostics describes the external tool that failed
+	Diagnostics *ToolDiagnostics `json:"diagnostics,omitempty"`
+}
+
+// ToolDiagnostics is what a failed tool left behind
+type ToolDiagnostics struct {
+	Operation string `json:"operation"`
+	Tool      string `json:"tool,omitempty"`
+	ExitCode  int    `json:"exitCode,omitempty"`
+	// Output is the end of what the tool printed, with server paths removed
+	Output string `json:"output,omitempty"`
+}
+
+// maxDiagnosticOutput is how much tool output an error response carries
+const maxDiagnosticOutput = 2048
+
+// codeForStatus is the code of errors that only have a status
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidInput
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return CodeUnauthorized
+	case http.StatusNotFound, http.StatusGone:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusRequestEntityTooLarge:
+		return CodeLimitExceeded
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedType
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	case http.StatusInsufficientStorage:
+		return CodeInsufficientStorage
+	}
+	if status < 500 {
+		return CodeInvalidInput
+	}
+	return CodeInternal
+}
+
+// writeError sends resp with the request's ID and retriable flag filled in
+func writeError(w http.ResponseWriter, status int, resp ErrorResponse) {
+	resp.Error = hideServerPaths(resp.Error)
+	resp.RequestID = w.Header().Get(requestIDHeader)
+	resp.Retriable = retriableCodes[resp.Code]
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// opErrors maps each ops error kind to its code and status
+var opErrors = map[ops.Kind]struct {
+	code   string
+	status int
+}{
+	ops.KindInvalidInput:    {CodeInvalidInput, http.StatusBadRequest},
+	ops.KindEncrypted:       {CodeEncryptedPDF, http.StatusBadRequest},
+	ops.KindWrongPassword:   {CodeWrongPassword, http.StatusBadRequest},
+	ops.KindLimitExceeded:   {CodeLimitExceeded, http.StatusRequestEntityTooLarge},
+	ops.KindToolUnavailable: {CodeToolUnavailable, http.StatusServiceUnavailable},
+	ops.KindTimeout:         {CodeTimeout, http.StatusGatewayTimeout},
+	ops.KindCanceled:        {CodeCanceled, http.StatusServiceUnavailable},
+	ops.KindFailed:          {CodeProcessingFailed, http.StatusInternalServerError},
+}
+
+// opErrorResponse describes err and picks the status it is sent with
+func opErrorResponse(err error) (ErrorResponse, int) {
+	mapped := opErrors[ops.KindOf(err)]
+	message := hideServerPaths(err.Error())
+	if message == "" {
+		message = http.StatusText(mapped.status)
+	}
+	resp := ErrorResponse{Error: capitalize(message), Code: mapped.code}
+
+	var opErr *ops.Error
+	if errors.As(err, &opErr) && (opErr.Tool != "" || len(opErr.Output) > 0) {
+		resp.Diagnostics = &ToolDiagnostics{
+			Operation: opErr.Op,
+			Tool:      opErr.Tool,
+			ExitCode:  opErr.ExitCode,
+			Output:    diagnosticOutput(opErr.Output),
+		}
+	}
+	return resp, mapped.status
+}
+
+// capitalize upper-cases the first letter of s, which may take more than
+// one byte
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// diagnosticOutput keeps the end of a tool's output, where the error
+// usually is, and hides where files live on the server
+func diagnosticOutput(output []byte) string {
+	if len(output) > maxDiagnosticOutput {
+		output = output[len(output)-maxDiagnosticOutput:]
+	}
+	return strings.TrimSpace(hideServerPaths(strings.ToValidUTF8(string(output), "")))
+}
+
+// hideServerPaths shortens paths under TEMP_DIR to $TEMP_DIR/.../<file>,
+// so neither the server's layout nor the namespaces in it reach clients
+func hideServerPaths(text string) string {
+	prefixes := []string{}
+	if abs, err := filepath.Abs(TempDir); err == nil {
+		prefixes = append(prefixes, abs)
+	}
+	if TempDir != "." {
+		prefixes = append(prefixes, TempDir)
+	}
+	for _, prefix := range prefixes {
+		path := regexp.MustCompile(regexp.QuoteMeta(prefix) + `[^\s"'(),:;]*`)
+		text = path.ReplaceAllStringFunc(text, func(match string) string {
+			if rest := strings.Trim(strings.TrimPrefix(match, prefix), "/"); rest != "" {
+				return "$TEMP_DIR/.../" + filepath.Base(rest)
+			}
+			return "$TEMP_DIR"
+		})
+	}
+	return text
+}
+
+// ==================== REQUEST IDS ====================
+
+const requestIDHeader = "X-Request-ID"
+
+// Callers may pick their own request ID if it is short and plain
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestIDKey struct{}
+
+// Request ID middleware tags every request with an ID, taken from the
+// caller's X-Request-ID or generated, and echoes it in the response so
+// errors and logs can be matched up
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// requestIDFrom returns the ID requestIDMiddleware gave r
+func requestIDFrom(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
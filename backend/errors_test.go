@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pdf-backend/ops"
+)
+
+func TestErrorResponses(t *testing.T) {
+	oldTempDir, oldKeys := TempDir, APIKeys
+	TempDir, APIKeys = t.TempDir(), nil
+	t.Cleanup(func() { TempDir, APIKeys = oldTempDir, oldKeys })
+	handler := requestIDMiddleware(setupRoutes())
+
+	decode := func(rec *httptest.ResponseRecorder) ErrorResponse {
+		var resp ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("body %q: %v", rec.Body.String(), err)
+		}
+		return resp
+	}
+
+	// Plain errors get the code of their status and the request's ID
+	req := httptest.NewRequest("GET", "/api/pdf/merge", nil)
+	req.Header.Set("X-Request-ID", "client-chosen.1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	resp := decode(rec)
+	if rec.Code != http.StatusMethodNotAllowed || resp.Code != CodeMethodNotAllowed || resp.Retriable ||
+		resp.RequestID != "client-chosen.1" || rec.Header().Get("X-Request-ID") != "client-chosen.1" {
+		t.Errorf("method not allowed: %d %+v", rec.Code, resp)
+	}
+
+	// IDs the client cannot be trusted with are replaced
+	req = httptest.NewRequest("GET", "/api/jobs/unknown", nil)
+	req.Header.Set("X-Request-ID", "bad id\nInjected: 1")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if resp := decode(rec); resp.Code != CodeNotFound || resp.RequestID == "" || resp.RequestID == req.Header.Get("X-Request-ID") {
+		t.Errorf("not found: %+v", resp)
+	}
+
+	// A file that is not a readable PDF is invalid input
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("angle", "90")
+	part, _ := form.CreateFormFile("file0", "in.pdf")
+	part.Write([]byte("%PDF-1.7\nnot really a PDF\n%%EOF\n"))
+	form.Close()
+	req = httptest.NewRequest("POST", "/api/pdf/rotate", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if resp := decode(rec); rec.Code != http.StatusBadRequest || resp.Code != CodeInvalidInput {
+		t.Errorf("corrupt PDF: %d %+v", rec.Code, resp)
+	}
+}
+
+func TestOpErrorResponse(t *testing.T) {
+	oldTempDir := TempDir
+	TempDir = "/srv/pdf/temp"
+	t.Cleanup(func() { TempDir = oldTempDir })
+
+	for _, tc := range []struct {
+		err    error
+		code   string
+		status int
+	}{
+		{&ops.Error{Op: "unlock", Kind: ops.KindWrongPassword, Msg: "wrong password for the PDF"}, CodeWrongPassword, http.StatusBadRequest},
+		{&ops.Error{Op: "merge", Kind: ops.KindEncrypted, Msg: "PDF is encrypted"}, CodeEncryptedPDF, http.StatusBadRequest},
+		{&ops.Error{Op: "ocr", Kind: ops.KindTimeout, Msg: "OCR failed", Err: context.DeadlineExceeded}, CodeTimeout, http.StatusGatewayTimeout},
+		{&ops.Error{Op: "pdf-to-word", Kind: ops.KindToolUnavailable, Msg: "conversion failed"}, CodeToolUnavailable, http.StatusServiceUnavailable},
+		{&ops.Error{Op: "compress", Kind: ops.KindLimitExceeded, Msg: "compression failed"}, CodeLimitExceeded, http.StatusRequestEntityTooLarge},
+		{&ops.Error{Op: "repair", Kind: ops.KindFailed, Msg: "repair failed"}, CodeProcessingFailed, http.StatusInternalServerError},
+	} {
+		resp, status := opErrorResponse(tc.err)
+		if resp.Code != tc.code || status != tc.status {
+			t.Errorf("%v: %s %d, want %s %d", tc.err, resp.Code, status, tc.code, tc.status)
+		}
+	}
+
+	// Messages are capitalised by letter, not by byte, and never empty
+	for _, tc := range []struct{ msg, want string }{
+		{"échec de la conversion", "Échec de la conversion"},
+		{"ölfleck", "Ölfleck"},
+		{"Already capitalised", "Already capitalised"},
+		{"42 pages", "42 pages"},
+		{"", "Internal Server Error"},
+	} {
+		resp, _ := opErrorResponse(&ops.Error{Op: "repair", Kind: ops.KindFailed, Msg: tc.msg})
+		if resp.Error != tc.want {
+			t.Errorf("message %q sent as %q, want %q", tc.msg, resp.Error, tc.want)
+		}
+	}
+	if resp, _ := opErrorResponse(errors.New("")); resp.Error == "" {
+		t.Error("empty error sent without a message")
+	}
+
+	// Tool output is passed on without the server's paths
+	resp, _ := opErrorResponse(&ops.Error{
+		Op: "pdf-to-word", Kind: ops.KindFailed, Msg: "conversion failed",
+		Tool: "libreoffice", ExitCode: 81,
+		Output: []byte("Error: source file could not be loaded: " + filepath.Join(TempDir, "ns", "acme", "work", "in.pdf") + "\n"),
+	})
+	want := ToolDiagnostics{Operation: "pdf-to-word", Tool: "libreoffice", ExitCode: 81,
+		Output: "Error: source file could not be loaded: $TEMP_DIR/.../in.pdf"}
+	if resp.Diagnostics == nil || *resp.Diagnostics != want {
+		t.Errorf("diagnostics = %+v", resp.Diagnostics)
+	}
+
+	// So is the message
+	resp, _ = opErrorResponse(&ops.Error{Op: "merge", Kind: ops.KindFailed, Msg: "merge failed",
+		Err: &os.PathError{Op: "open", Path: filepath.Join(TempDir, "ns", "acme", "work", "merge-1", "0", "scan.pdf"), Err: os.ErrNotExist}})
+	if resp.Error != "Merge failed: open $TEMP_DIR/.../scan.pdf: file does not exist" {
+		t.Errorf("message = %q", resp.Error)
+	}
+}
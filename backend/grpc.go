@@ -0,0 +1,454 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"pdf-backend/pdfpb"
+)
+
+// GRPCPort enables the gRPC API when set
+var GRPCPort = getEnv("GRPC_PORT", "")
+
+// Size of the data chunks streamed back to gRPC clients
+const grpcChunkSize = 64 << 10
+
+// grpcServer implements the gRPC API on top of the HTTP handler chain, so
+// both APIs share validation, auth, quotas, concurrency limits, toggles,
+// jobs and the audit log. Every call becomes an internal HTTP request.
+type grpcServer struct {
+	pdfpb.UnimplementedDocumentsServer
+	pdfpb.UnimplementedJobsServer
+
+	handler http.Handler
+}
+
+func serveGRPC(port string, handler http.Handler) error {
+	lis, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+
+	srv := grpc.NewServer()
+	s := &grpcServer{handler: handler}
+	pdfpb.RegisterDocumentsServer(srv, s)
+	pdfpb.RegisterJobsServer(srv, s)
+
+	log.Printf("🔌 gRPC server listening on port %s", port)
+	return srv.Serve(lis)
+}
+
+// Run implements Documents.Run
+func (s *grpcServer) Run(stream pdfpb.Documents_RunServer) error {
+	rec, err := s.runOperation(stream.Context(), stream.Recv, false)
+	if err != nil {
+		return err
+	}
+	if err := grpcStatus(rec); err != nil {
+		return err
+	}
+
+	var result struct {
+		DownloadURL string `json:"downloadUrl"`
+	}
+	if err := json.Unmarshal(rec.body.Bytes(), &result); err != nil {
+		return status.Errorf(codes.Internal, "unexpected operation response: %v", err)
+	}
+	return sendResultFile(stream, result.DownloadURL)
+}
+
+// ListOperations implements Documents.ListOperations
+func (s *grpcServer) ListOperations(ctx context.Context, _ *pdfpb.ListOperationsRequest) (*pdfpb.ListOperationsResponse, error) {
+	rec, err := s.call(ctx, "GET", "/api/operations", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Operations []OperationDef `json:"operations"`
+	}
+	if err := json.Unmarshal(rec.body.Bytes(), &list); err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected operations response: %v", err)
+	}
+
+	resp := &pdfpb.ListOperationsResponse{}
+	for _, def := range list.Operations {
+		op := &pdfpb.Operation{
+			Name:        def.Name,
+			Category:    def.Category,
+			Summary:     def.Summary,
+			MinFiles:    int32(def.Files.Min),
+			MaxFiles:    int32(def.Files.Max),
+			Accept:      def.Files.Accept,
+			Output:      def.Output,
+			MaxUploadMb: def.MaxUploadMB,
+		}
+		for _, p := range def.Params {
+			param := &pdfpb.Param{
+				Name:        p.Name,
+				Type:        p.Type,
+				Required:    p.Required,
+				Description: p.Description,
+				Enum:        p.Enum,
+			}
+			if p.Default != nil {
+				param.Default = fmt.Sprint(p.Default)
+			}
+			op.Params = append(op.Params, param)
+		}
+		resp.Operations = append(resp.Operations, op)
+	}
+	return resp, nil
+}
+
+// Submit implements Jobs.Submit
+func (s *grpcServer) Submit(stream pdfpb.Jobs_SubmitServer) error {
+	rec, err := s.runOperation(stream.Context(), stream.Recv, true)
+	if err != nil {
+		return err
+	}
+	if err := grpcStatus(rec); err != nil {
+		return err
+	}
+
+	var accepted struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(rec.body.Bytes(), &accepted); err != nil || accepted.ID == "" {
+		return status.Error(codes.Internal, "operation was not accepted as a job")
+	}
+	job, err := s.job(stream.Context(), "GET", accepted.ID)
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(jobProto(job))
+}
+
+// Get implements Jobs.Get
+func (s *grpcServer) Get(ctx context.Context, req *pdfpb.JobRequest) (*pdfpb.Job, error) {
+	job, err := s.job(ctx, "GET", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return jobProto(job), nil
+}
+
+// Cancel implements Jobs.Cancel
+func (s *grpcServer) Cancel(ctx context.Context, req *pdfpb.JobRequest) (*pdfpb.Job, error) {
+	job, err := s.job(ctx, "DELETE", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return jobProto(job), nil
+}
+
+// Result implements Jobs.Result
+func (s *grpcServer) Result(req *pdfpb.JobRequest, stream pdfpb.Jobs_ResultServer) error {
+	job, err := s.job(stream.Context(), "GET", req.GetId())
+	if err != nil {
+		return err
+	}
+	if job.FinishedAt == nil {
+		return status.Errorf(codes.FailedPrecondition, "job is %s", job.Status)
+	}
+	if job.StatusCode >= 400 {
+		return grpcError(job.StatusCode, job.Result)
+	}
+
+	var result struct {
+		DownloadURL string `json:"downloadUrl"`
+	}
+	json.Unmarshal(job.Result, &result)
+	return sendResultFile(stream, result.DownloadURL)
+}
+
+func (s *grpcServer) job(ctx context.Context, method, id string) (*Job, error) {
+	if id == "" || strings.Contains(id, "/") {
+		return nil, status.Error(codes.InvalidArgument, "job id required")
+	}
+	rec, err := s.call(ctx, method, "/api/jobs/"+id, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := grpcStatus(rec); err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal(rec.body.Bytes(), &job); err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected job response: %v", err)
+	}
+	return &job, nil
+}
+
+func jobProto(job *Job) *pdfpb.Job {
+	pb := &pdfpb.Job{
+		Id:         job.ID,
+		Operation:  job.Operation,
+		Status:     pdfpb.Job_Status(pdfpb.Job_Status_value[strings.ToUpper(job.Status)]),
+		CreatedAt:  timestamppb.New(job.CreatedAt),
+		StatusCode: int32(job.StatusCode),
+	}
+	if job.FinishedAt != nil {
+		pb.FinishedAt = timestamppb.New(*job.FinishedAt)
+	}
+
+	var result struct {
+		DownloadURL string `json:"downloadUrl"`
+		Error       string `json:"error"`
+	}
+	json.Unmarshal(job.Result, &result)
+	pb.DownloadUrl = result.DownloadURL
+	pb.Error = result.Error
+	return pb
+}
+
+// runOperation turns a stream of RunRequests into a multipart request for
+// the operation named in the first message. The upload is piped into the
+// handler as it arrives, so it is never held in memory here.
+func (s *grpcServer) runOperation(ctx context.Context, recv func() (*pdfpb.RunRequest, error), async bool) (*jobRecorder, error) {
+	first, err := recv()
+	if err != nil {
+		return nil, err
+	}
+	start := first.GetStart()
+	if start == nil {
+		return nil, status.Error(codes.InvalidArgument, "first message must be start")
+	}
+	def := lookupOperation(start.GetOperation())
+	if def == nil {
+		return nil, status.Errorf(codes.NotFound, "unknown operation %q", start.GetOperation())
+	}
+
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeUpload(form, def, start.GetParams(), recv))
+	}()
+
+	header := http.Header{"Content-Type": {form.FormDataContentType()}}
+	if async {
+		header.Set("Prefer", "respond-async")
+	}
+	rec, err := s.call(ctx, "POST", def.Path, header, pr)
+	// Unblock the upload if the handler stopped reading early
+	pr.CloseWithError(errors.New("request finished"))
+	return rec, err
+}
+
+func writeUpload(form *multipart.Writer, def *OperationDef, params map[string]string,
+	recv func() (*pdfpb.RunRequest, error)) error {
+	for name, value := range params {
+		// Results come back as RunResponse messages, never inline
+		if name == "response" {
+			continue
+		}
+		if err := form.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+
+	var part io.Writer
+	files := 0
+	for {
+		msg, err := recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch payload := msg.GetPayload().(type) {
+		case *pdfpb.RunRequest_File:
+			part, err = form.CreateFormFile(fmt.Sprintf("file%d", files), filepath.Base(payload.File.GetName()))
+			if err != nil {
+				return err
+			}
+			files++
+		case *pdfpb.RunRequest_Data:
+			if part == nil {
+				return errors.New("data sent before file")
+			}
+			if _, err := part.Write(payload.Data); err != nil {
+				return err
+			}
+		default:
+			return errors.New("unexpected start message")
+		}
+	}
+
+	if _, ok := params["fileCount"]; def.Files.CountField && !ok {
+		if err := form.WriteField("fileCount", fmt.Sprint(files)); err != nil {
+			return err
+		}
+	}
+	return form.Close()
+}
+
+// call serves an internal request through the HTTP handler chain, passing
+// on the caller's API key and address
+func (s *grpcServer) call(ctx context.Context, method, path string, header http.Header, body io.Reader) (*jobRecorder, error) {
+	req, err := http.NewRequestWithContext(ctx, method, path, body)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, name := range []string{"X-API-Key", "Authorization", "X-Forwarded-For"} {
+		if values := md.Get(name); len(values) > 0 {
+			req.Header.Set(name, values[0])
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		req.RemoteAddr = p.Addr.String()
+	}
+
+	rec := &jobRecorder{header: make(http.Header), status: http.StatusOK}
+	s.handler.ServeHTTP(rec, req)
+	if ctx.Err() != nil {
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return rec, nil
+}
+
+// grpcStatus converts an HTTP error response to a gRPC status
+func grpcStatus(rec *jobRecorder) error {
+	if rec.status < 400 {
+		return nil
+	}
+	return grpcError(rec.status, rec.body.Bytes())
+}
+
+// grpcError carries the error code, request ID and retriable flag as
+// ErrorInfo (reason, metadata) and field errors as BadRequest details
+func grpcError(httpStatus int, body []byte) error {
+	var payload ErrorResponse
+	if json.Unmarshal(body, &payload) != nil || payload.Error == "" {
+		payload.Error = strings.TrimSpace(string(body))
+	}
+
+	st := status.New(grpcCode(httpStatus), payload.Error)
+	if payload.Code != "" {
+		info := &errdetails.ErrorInfo{
+			Reason: payload.Code,
+			Domain: "pdfpal",
+			Metadata: map[string]string{
+				"requestId": payload.RequestID,
+				"retriable": strconv.FormatBool(payload.Retriable),
+			},
+		}
+		if withDetails, err := st.WithDetails(info); err == nil {
+			st = withDetails
+		}
+	}
+	if len(payload.Fields) > 0 {
+		details := &errdetails.BadRequest{}
+		for _, f := range payload.Fields {
+			details.FieldViolations = append(details.FieldViolations,
+				&errdetails.BadRequest_FieldViolation{Field: f.Field, Description: f.Message})
+		}
+		if withDetails, err := st.WithDetails(details); err == nil {
+			st = withDetails
+		}
+	}
+	return st.Err()
+}
+
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests, http.StatusInsufficientStorage:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	return codes.Internal
+}
+
+type resultSender interface {
+	Send(*pdfpb.RunResponse) error
+}
+
+// sendResultFile streams the output file behind a download URL. The URL
+// comes from the handler chain, so it already belongs to the caller.
+func sendResultFile(stream resultSender, downloadURL string) error {
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return status.Errorf(codes.Internal, "bad download URL: %v", err)
+	}
+	namespace, filename, ok := strings.Cut(strings.TrimPrefix(u.Path, "/files/"), "/")
+	if !ok || !namespacePattern.MatchString(namespace) || strings.ContainsAny(filename, `/\`) {
+		return status.Errorf(codes.Internal, "bad download URL %q", downloadURL)
+	}
+
+	file, err := openStored(filepath.Join(TempDir, "ns", namespace, "output", filename))
+	if os.IsNotExist(err) {
+		return status.Error(codes.NotFound, "File not found or expired")
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer file.Close()
+
+	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	err = stream.Send(&pdfpb.RunResponse{Payload: &pdfpb.RunResponse_File{File: &pdfpb.ResultFile{
+		Name:        filename,
+		ContentType: contentType,
+		Size:        file.Size(),
+		DownloadUrl: downloadURL,
+	}}})
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, grpcChunkSize)
+	for {
+		n, err := file.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&pdfpb.RunResponse{Payload: &pdfpb.RunResponse_Data{Data: buf[:n]}}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+	}
+}
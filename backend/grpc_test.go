@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"pdf-backend/pdfpb"
+)
+
+// minimalPDF returns a valid one-page PDF
+func minimalPDF() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 200] /Resources << >> >>",
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// startGRPC serves the gRPC API over an in-memory listener with the
+// server's handler chain
+func startGRPC(t *testing.T) (pdfpb.DocumentsClient, pdfpb.JobsClient) {
+	t.Helper()
+
+	oldTempDir, oldKeys, oldRequire := TempDir, APIKeys, RequireAPIKey
+	TempDir = t.TempDir()
+	APIKeys = map[string]APIKey{"k1": {Namespace: "acme"}, "k2": {Namespace: "beta"}}
+	t.Cleanup(func() { TempDir, APIKeys, RequireAPIKey = oldTempDir, oldKeys, oldRequire })
+
+	handler := authMiddleware(jobMiddleware(auditMiddleware(trackMiddleware(setupRoutes()))))
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	s := &grpcServer{handler: handler}
+	pdfpb.RegisterDocumentsServer(srv, s)
+	pdfpb.RegisterJobsServer(srv, s)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pdfpb.NewDocumentsClient(conn), pdfpb.NewJobsClient(conn)
+}
+
+func withKey(t *testing.T, key string) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return metadata.AppendToOutgoingContext(ctx, "x-api-key", key)
+}
+
+type runSender interface {
+	Send(*pdfpb.RunRequest) error
+}
+
+func sendUpload(t *testing.T, stream runSender, operation string, params map[string]string, files ...[]byte) {
+	t.Helper()
+	msgs := []*pdfpb.RunRequest{{Payload: &pdfpb.RunRequest_Start{Start: &pdfpb.Start{Operation: operation, Params: params}}}}
+	for i, data := range files {
+		msgs = append(msgs,
+			&pdfpb.RunRequest{Payload: &pdfpb.RunRequest_File{File: &pdfpb.FileStart{Name: fmt.Sprintf("in%d.pdf", i)}}},
+			// Split the data to exercise chunking
+			&pdfpb.RunRequest{Payload: &pdfpb.RunRequest_Data{Data: data[:len(data)/2]}},
+			&pdfpb.RunRequest{Payload: &pdfpb.RunRequest_Data{Data: data[len(data)/2:]}})
+	}
+	for _, msg := range msgs {
+		if err := stream.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+type resultReceiver interface {
+	Recv() (*pdfpb.RunResponse, error)
+}
+
+func receiveResult(stream resultReceiver) (*pdfpb.ResultFile, []byte, error) {
+	var file *pdfpb.ResultFile
+	var data bytes.Buffer
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return file, data.Bytes(), nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if f := msg.GetFile(); f != nil {
+			file = f
+		}
+		data.Write(msg.GetData())
+	}
+}
+
+func TestGRPCRunMerge(t *testing.T) {
+	docs, _ := startGRPC(t)
+
+	stream, err := docs.Run(withKey(t, "k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendUpload(t, stream, "pdf/merge", nil, minimalPDF(), minimalPDF())
+	stream.CloseSend()
+
+	file, data, err := receiveResult(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file == nil || file.ContentType != "application/pdf" || file.Size != int64(len(data)) {
+		t.Fatalf("file = %+v with %d bytes", file, len(data))
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		t.Errorf("result is not a PDF: %q", data[:min(len(data), 16)])
+	}
+	if _, err := os.Stat(filepath.Join(TempDir, "ns", "acme", "output", file.Name)); err != nil {
+		t.Errorf("output not in the caller's namespace: %v", err)
+	}
+}
+
+func TestGRPCValidationAndAuth(t *testing.T) {
+	docs, _ := startGRPC(t)
+
+	stream, _ := docs.Run(withKey(t, "k1"))
+	sendUpload(t, stream, "pdf/rotate", map[string]string{"angle": "45"}, minimalPDF())
+	stream.CloseSend()
+	_, _, err := receiveResult(stream)
+
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("code = %v (%v)", st.Code(), err)
+	}
+	var fields []string
+	for _, detail := range st.Details() {
+		if br, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				fields = append(fields, v.Field)
+			}
+		}
+	}
+	if len(fields) != 1 || fields[0] != "angle" {
+		t.Errorf("field violations = %v", fields)
+	}
+
+	stream, _ = docs.Run(withKey(t, "wrong"))
+	sendUpload(t, stream, "pdf/repair", nil, minimalPDF())
+	stream.CloseSend()
+	if _, _, err := receiveResult(stream); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("wrong key: %v", err)
+	}
+
+	stream, _ = docs.Run(withKey(t, "k1"))
+	sendUpload(t, stream, "pdf/nope", nil)
+	stream.CloseSend()
+	if _, _, err := receiveResult(stream); status.Code(err) != codes.NotFound {
+		t.Errorf("unknown operation: %v", err)
+	}
+}
+
+func TestGRPCJobs(t *testing.T) {
+	_, jobs := startGRPC(t)
+
+	submit, err := jobs.Submit(withKey(t, "k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendUpload(t, submit, "pdf/rotate", map[string]string{"angle": "180"}, minimalPDF())
+	job, err := submit.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Id == "" || job.Operation != "pdf/rotate" {
+		t.Fatalf("job = %+v", job)
+	}
+
+	// Jobs are private to their namespace
+	if _, err := jobs.Get(withKey(t, "k2"), &pdfpb.JobRequest{Id: job.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("other namespace: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.FinishedAt == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		if job, err = jobs.Get(withKey(t, "k1"), &pdfpb.JobRequest{Id: job.Id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if job.Status != pdfpb.Job_SUCCEEDED || job.DownloadUrl == "" {
+		t.Fatalf("job = %+v", job)
+	}
+
+	result, err := jobs.Result(withKey(t, "k1"), &pdfpb.JobRequest{Id: job.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, data, err := receiveResult(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file == nil || !bytes.HasPrefix(data, []byte("%PDF")) {
+		t.Errorf("result file = %+v, %d bytes", file, len(data))
+	}
+}
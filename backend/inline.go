@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// outputTypes maps output extensions to their Content-Type
+var outputTypes = map[string]string{
+	".pdf":  outputPDF,
+	".zip":  outputZIP,
+	".docx": outputDOCX,
+	".xlsx": outputXLSX,
+	".pptx": outputPPTX,
+	".txt":  outputText + "; charset=utf-8",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+}
+
+func contentTypeFor(path string) string {
+	if typ, ok := outputTypes[strings.ToLower(filepath.Ext(path))]; ok {
+		return typ
+	}
+	return "application/octet-stream"
+}
+
+// wantsInline reports whether the client asked for the result in the
+// response body instead of a download link, with response=inline or an
+// Accept header naming a file type and not JSON. Jobs and manifests
+// always answer with JSON.
+func wantsInline(r *http.Request) bool {
+	if prefersAsync(r) {
+		return false
+	}
+	switch paramsFrom(r).String("response") {
+	case "inline":
+		return true
+	case "manifest":
+		return false
+	}
+	// Browsers and HTTP libraries often send "application/json, text/plain"
+	if accepts(r, "application/json") {
+		return false
+	}
+	for _, mediaType := range acceptedTypes(r) {
+		if mediaType == "application/octet-stream" || mediaType == "multipart/mixed" {
+			return true
+		}
+		for _, typ := range outputTypes {
+			if mediaType == typ || strings.HasPrefix(typ, mediaType+";") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// acceptedTypes lists the media types of the Accept header, without
+// parameters
+func acceptedTypes(r *http.Request) []string {
+	var types []string
+	for _, value := range r.Header.Values("Accept") {
+		for _, item := range strings.Split(value, ",") {
+			if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(item)); err == nil {
+				types = append(types, mediaType)
+			}
+		}
+	}
+	return types
+}
+
+func accepts(r *http.Request, mediaType string) bool {
+	for _, typ := range acceptedTypes(r) {
+		if typ == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// sendInlineFile streams the output at path as the response body
+func sendInlineFile(w http.ResponseWriter, r *http.Request, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Failed to read output: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		sendError(w, fmt.Sprintf("Failed to read output: %v", err), http.StatusInternalServerError)
+		return
+	}
+	auditOutput(r, path)
+
+	w.Header().Set("Content-Type", contentTypeFor(path))
+	w.Header().Set("Content-Disposition", contentDisposition(filepath.Base(path)))
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	io.Copy(w, f)
+}
+
+// sendInlineFiles streams the files in dir as the response body: as
+// multipart/mixed if the client accepts it, else as a ZIP named with
+// prefix as {op}. Nothing is written to disk.
+func sendInlineFiles(w http.ResponseWriter, r *http.Request, dir, prefix string) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		sendError(w, fmt.Sprintf("Failed to read outputs: %v", err), http.StatusInternalServerError)
+		return
+	}
+	for _, file := range files {
+		auditOutput(r, file)
+	}
+
+	if accepts(r, "multipart/mixed") {
+		parts := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+parts.Boundary())
+		for _, file := range files {
+			header := textproto.MIMEHeader{}
+			header.Set("Content-Type", contentTypeFor(file))
+			header.Set("Content-Disposition", contentDisposition(filepath.Base(file)))
+			part, err := parts.CreatePart(header)
+			if err != nil {
+				return
+			}
+			if err := copyFile(part, file); err != nil {
+				return
+			}
+		}
+		parts.Close()
+		return
+	}
+
+	w.Header().Set("Content-Type", outputZIP)
+	w.Header().Set("Content-Disposition", contentDisposition(outputName(uploadName(r, "file0"), prefix, ".zip")))
+	createZip(files, w)
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
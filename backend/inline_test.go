@@ -0,0 +1,89 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInlineResponses(t *testing.T) {
+	oldTempDir, oldKeys := TempDir, APIKeys
+	TempDir, APIKeys = t.TempDir(), nil
+	t.Cleanup(func() { TempDir, APIKeys = oldTempDir, oldKeys })
+
+	run := func(path, accept string, fields map[string]string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		for name, value := range fields {
+			form.WriteField(name, value)
+		}
+		part, _ := form.CreateFormFile("file0", "in.pdf")
+		part.Write(minimalPDF())
+		form.Close()
+
+		req := httptest.NewRequest("POST", path, &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		setupRoutes().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A single result is the response body
+	rec := run("/api/pdf/rotate", "application/pdf", map[string]string{"angle": "90"})
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/pdf" ||
+		!strings.HasPrefix(rec.Body.String(), "%PDF-") {
+		t.Fatalf("inline rotate: %d %v", rec.Code, rec.Header())
+	}
+	if rec.Header().Get("Content-Disposition") != `attachment; filename="in-rotated.pdf"` {
+		t.Errorf("Content-Disposition = %q", rec.Header().Get("Content-Disposition"))
+	}
+	if outputs, _ := filepath.Glob(filepath.Join(TempDir, "ns", "*", "output", "*")); len(outputs) != 0 {
+		t.Errorf("inline result was stored: %v", outputs)
+	}
+
+	// JSON clients keep getting links
+	rec = run("/api/pdf/rotate", "application/json, text/plain, */*", nil)
+	if !strings.Contains(rec.Body.String(), "downloadUrl") {
+		t.Errorf("JSON client got %q", rec.Header().Get("Content-Type"))
+	}
+
+	// Several results stream as a ZIP...
+	rec = run("/api/pdf/split?response=inline", "", map[string]string{"mode": "individual"})
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil || len(archive.File) != 1 || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("inline split: %d %v %v", rec.Code, rec.Header(), err)
+	}
+
+	// ...or as multipart/mixed
+	rec = run("/api/pdf/split", "multipart/mixed", map[string]string{"mode": "individual"})
+	mediaType, params, _ := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	if mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+	parts := multipart.NewReader(rec.Body, params["boundary"])
+	part, err := parts.NextPart()
+	if err != nil || part.Header.Get("Content-Type") != "application/pdf" || part.FileName() == "" {
+		t.Fatalf("first part: %v %v", part, err)
+	}
+	if data, _ := io.ReadAll(part); !bytes.HasPrefix(data, []byte("%PDF-")) {
+		t.Error("part is not a PDF")
+	}
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Errorf("expected one part, got %v", err)
+	}
+
+	if leftovers, _ := os.ReadDir(filepath.Join(TempDir, "ns", AnonymousNamespace, "work")); len(leftovers) != 0 {
+		t.Errorf("work directory not empty: %v", leftovers)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Job states
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job is a document operation accepted with "Prefer: respond-async". Its
+// Result is the JSON body the operation would have answered with.
+type Job struct {
+	ID         string          `json:"id"`
+	Operation  string          `json:"operation"`
+	Status     string          `json:"status"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+	StatusCode int             `json:"statusCode,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+
+	namespace string
+	cancel    context.CancelFunc
+}
+
+var (
+	jobs   = make(map[string]*Job)
+	jobsMu sync.Mutex
+)
+
+// Job middleware runs document operations in the background when the
+// client sends "Prefer: respond-async", answering 202 with a status URL
+func jobMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || !isDocumentOperation(r.URL.Path) || !prefersAsync(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		def := lookupOperation(strings.TrimPrefix(r.URL.Path, "/api/"))
+		if def == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The server discards the request body once we answer, so spool
+		// it to the caller's namespace before handing it to the job
+		spool, err := spoolBody(w, r, def)
+		if err != nil {
+			var uploadErr *uploadError
+			if errors.As(err, &uploadErr) {
+				sendError(w, uploadErr.msg, uploadErr.status)
+			} else {
+				sendError(w, "Failed to read request body", http.StatusBadRequest)
+			}
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+		job := &Job{
+			ID:        uuid.New().String(),
+			Operation: strings.TrimPrefix(r.URL.Path, "/api/"),
+			Status:    JobPending,
+			CreatedAt: time.Now(),
+			namespace: principalFrom(r).Namespace,
+			cancel:    cancel,
+		}
+		jobsMu.Lock()
+		jobs[job.ID] = job
+		jobsMu.Unlock()
+
+		jobReq := r.Clone(ctx)
+		jobReq.Body = spool
+		go runJob(next, job, jobReq)
+
+		statusURL := Host + "/api/jobs/" + job.ID
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", statusURL)
+		w.Header().Set("Preference-Applied", "respond-async")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{
+			"id":        job.ID,
+			"status":    JobPending,
+			"statusUrl": statusURL,
+		})
+	})
+}
+
+func prefersAsync(r *http.Request) bool {
+	for _, value := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(pref), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// multipartSlack is room in a spooled body for the boundaries and part
+// headers around the bytes the upload limit counts
+const multipartSlack = 1 << 20
+
+// spoolBody copies the request body to a temporary file, encrypted if
+// ENCRYPTION_KEY is set, that is removed when closed. A body past the
+// operation's upload limit is rejected with 413, as readForm would.
+func spoolBody(w http.ResponseWriter, r *http.Request, def *OperationDef) (io.ReadCloser, error) {
+	file, err := os.CreateTemp(namespaceDir(r, "uploads"), "job-*.body")
+	if err != nil {
+		return nil, err
+	}
+	name := file.Name()
+	registerFile(name)
+
+	out, err := storeFile(file)
+	if err != nil {
+		file.Close()
+		os.Remove(name)
+		return nil, err
+	}
+	body := http.MaxBytesReader(w, r.Body, def.MaxUploadMB<<20+multipartSlack)
+	if _, err := io.Copy(out, body); err != nil {
+		out.Close()
+		os.Remove(name)
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return nil, tooLarge("Request exceeds the %d MB upload limit", def.MaxUploadMB)
+		}
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(name)
+		return nil, err
+	}
+	stored, err := openStored(name)
+	if err != nil {
+		os.Remove(name)
+		return nil, err
+	}
+	return &spoolFile{stored, name}, nil
+}
+
+type spoolFile struct {
+	*storedFile
+	path string
+}
+
+func (s *spoolFile) Close() error {
+	err := s.storedFile.Close()
+	removeFile(s.path)
+	return err
+}
+
+func runJob(next http.Handler, job *Job, r *http.Request) {
+	defer job.cancel()
+	defer r.Body.Close()
+
+	jobsMu.Lock()
+	job.Status = JobRunning
+	jobsMu.Unlock()
+
+	// Errors in the result name the request that started the job
+	rec := &jobRecorder{header: make(http.Header), status: http.StatusOK}
+	rec.header.Set(requestIDHeader, requestIDFrom(r))
+	next.ServeHTTP(rec, r)
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	now := time.Now()
+	job.FinishedAt = &now
+	job.StatusCode = rec.status
+	job.Status = JobSucceeded
+	if rec.status >= 400 {
+		job.Status = JobFailed
+	}
+	if json.Valid(rec.body.Bytes()) {
+		job.Result = json.RawMessage(bytes.TrimSpace(rec.body.Bytes()))
+	}
+	log.Printf("📬 Job %s (%s) %s", job.ID, job.Operation, job.Status)
+}
+
+// jobRecorder captures the response of an operation run as a job
+type jobRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (j *jobRecorder) Header() http.Header         { return j.header }
+func (j *jobRecorder) WriteHeader(code int)        { j.status = code }
+func (j *jobRecorder) Write(b []byte) (int, error) { return j.body.Write(b) }
+
+// GET /api/jobs/{id} reports a job, DELETE cancels it
+func handleJob(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/jobs/")
+
+	jobsMu.Lock()
+	job, ok := jobs[id]
+	if ok && job.namespace != principalFrom(r).Namespace {
+		ok = false
+	}
+	var snapshot Job
+	if ok {
+		snapshot = *job
+	}
+	jobsMu.Unlock()
+
+	if !ok {
+		sendError(w, "Job not found or expired", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "DELETE":
+		if snapshot.FinishedAt == nil {
+			job.cancel()
+			log.Printf("📬 Job %s cancelled", id)
+		}
+	default:
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if snapshot.FinishedAt == nil {
+		w.Header().Set("Retry-After", "1")
+	}
+	sendJSON(w, snapshot)
+}
+
+// cleanupJobs forgets finished jobs once their files have expired
+func cleanupJobs() {
+	ttl := time.Duration(FileTTLMinutes) * time.Minute
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	for id, job := range jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) >= ttl {
+			delete(jobs, id)
+		}
+	}
+}
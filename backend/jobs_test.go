@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestAsyncBodyLimit(t *testing.T) {
+	oldTempDir, oldKeys := TempDir, APIKeys
+	TempDir, APIKeys = t.TempDir(), nil
+	def := lookupOperation("pdf/rotate")
+	oldLimit := def.MaxUploadMB
+	def.MaxUploadMB = 1
+	t.Cleanup(func() { TempDir, APIKeys, def.MaxUploadMB = oldTempDir, oldKeys, oldLimit })
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("angle", "90")
+	part, _ := form.CreateFormFile("file0", "big.pdf")
+	part.Write(minimalPDF())
+	io.CopyN(part, zeros{}, 1<<20+multipartSlack)
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/api/pdf/rotate", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Prefer", "respond-async")
+	rec := httptest.NewRecorder()
+	authMiddleware(jobMiddleware(setupRoutes())).ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Nothing of the body is left behind
+	spooled, _ := filepath.Glob(filepath.Join(TempDir, "ns", AnonymousNamespace+"-*", "uploads", "job-*"))
+	if len(spooled) != 0 {
+		t.Errorf("spooled bodies left: %v", spooled)
+	}
+}
+
+// zeros reads as an endless run of zero bytes
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"pdf-backend/ops"
+)
+
+// InputLimits caps how much work the PDFs of one request may cause. They
+// are checked from the document structure before any tool runs. Zero
+// inherits the limit from the level below; a negative value lifts it.
+type InputLimits struct {
+	MaxPages int `json:"maxPages,omitempty"`
+	// MaxPageSide is the longest allowed page edge, in points
+	MaxPageSide float64 `json:"maxPageSide,omitempty"`
+	// MaxImagePixels caps the decoded size of all embedded images
+	MaxImagePixels int64 `json:"maxImagePixels,omitempty"`
+	MaxObjects     int   `json:"maxObjects,omitempty"`
+	// MaxRenderPixels caps the pixels produced by operations that
+	// rasterize pages, at the DPI they render at
+	MaxRenderPixels int64 `json:"maxRenderPixels,omitempty"`
+}
+
+// defaultInputLimits apply when nothing else is configured
+var defaultInputLimits = InputLimits{
+	MaxPages:        2000,
+	MaxPageSide:     14400, // 200 inches, the largest page PDF allows
+	MaxImagePixels:  1 << 30,
+	MaxObjects:      1000000,
+	MaxRenderPixels: 1 << 30,
+}
+
+// limitSet is a default plus per-operation overrides
+type limitSet struct {
+	Default    InputLimits            `json:"default"`
+	Operations map[string]InputLimits `json:"operations"`
+}
+
+// LimitsConfig is the INPUT_LIMITS document. Plans refine the top level
+// for API keys mapped to them ("key:namespace:plan").
+type LimitsConfig struct {
+	limitSet
+	Plans map[string]limitSet `json:"plans"`
+}
+
+// INPUT_LIMITS holds a LimitsConfig as JSON, e.g.
+// {"default": {"maxPages": 500}, "plans": {"free": {"default": {"maxPages": 50}}}}
+var inputLimits = parseLimitsConfig(getEnv("INPUT_LIMITS", ""))
+
+func parseLimitsConfig(value string) LimitsConfig {
+	var config LimitsConfig
+	if value == "" {
+		return config
+	}
+	if err := json.Unmarshal([]byte(value), &config); err != nil {
+		log.Fatalf("Invalid INPUT_LIMITS: %v", err)
+	}
+	return config
+}
+
+// limitsFor resolves the limits of operation for plan, from the built-in
+// defaults through the configured default and operation, then the plan's
+func (c LimitsConfig) limitsFor(plan, operation string) InputLimits {
+	limits := defaultInputLimits
+	limits = limits.overlay(c.Default)
+	limits = limits.overlay(c.Operations[operation])
+	if p, ok := c.Plans[plan]; ok && plan != "" {
+		limits = limits.overlay(p.Default)
+		limits = limits.overlay(p.Operations[operation])
+	}
+	return limits
+}
+
+func (l InputLimits) overlay(o InputLimits) InputLimits {
+	if o.MaxPages != 0 {
+		l.MaxPages = o.MaxPages
+	}
+	if o.MaxPageSide != 0 {
+		l.MaxPageSide = o.MaxPageSide
+	}
+	if o.MaxImagePixels != 0 {
+		l.MaxImagePixels = o.MaxImagePixels
+	}
+	if o.MaxObjects != 0 {
+		l.MaxObjects = o.MaxObjects
+	}
+	if o.MaxRenderPixels != 0 {
+		l.MaxRenderPixels = o.MaxRenderPixels
+	}
+	return l
+}
+
+// preflight inspects every uploaded PDF and checks the request's totals
+// against the caller's limits. err is set for PDFs that cannot be read.
+func (def *OperationDef) preflight(r *http.Request, params Params) (errs []FieldError, err error) {
+	limits := inputLimits.limitsFor(principalFrom(r).Plan, def.Name)
+	dpi := 0
+	if def.RenderDPI != nil {
+		dpi = def.RenderDPI(params)
+	}
+
+	// Only a password meant for the input may open it: protect's is the
+	// one it is about to set
+	password := ""
+	if def.PasswordParam != "" {
+		password = params.String(def.PasswordParam)
+	}
+
+	var total ops.DocumentStats
+	for _, field := range def.fileFields(params) {
+		stats, err := inspectUpload(r, formFiles(r, field)[0], password, limits.MaxPages)
+		if err != nil {
+			return nil, err
+		}
+		if stats == nil {
+			continue
+		}
+		if limits.MaxPageSide > 0 && stats.MaxPageSide > limits.MaxPageSide {
+			errs = append(errs, FieldError{field, fmt.Sprintf("has a %.0f pt page edge, the limit is %.0f pt",
+				stats.MaxPageSide, limits.MaxPageSide)})
+		}
+		total.Pages += stats.Pages
+		total.PageArea += stats.PageArea
+		total.ImagePixels += stats.ImagePixels
+		total.Objects += stats.Objects
+	}
+
+	exceeds := func(name string, value, limit int64) {
+		if limit > 0 && value > limit {
+			errs = append(errs, FieldError{name, fmt.Sprintf("%d exceeds the limit of %d", value, limit)})
+		}
+	}
+	exceeds("pages", int64(total.Pages), int64(limits.MaxPages))
+	exceeds("imagePixels", total.ImagePixels, limits.MaxImagePixels)
+	exceeds("objects", int64(total.Objects), int64(limits.MaxObjects))
+	if dpi > 0 {
+		exceeds("renderPixels", total.RenderPixels(dpi), limits.MaxRenderPixels)
+	}
+	return errs, nil
+}
+
+// inspectUpload measures an uploaded PDF; other uploads give nil stats
+func inspectUpload(r *http.Request, upload *Upload, password string, maxPages int) (*ops.DocumentStats, error) {
+	if upload.Type.MIME != typePDF.MIME {
+		return nil, nil
+	}
+	f, err := openStored(upload.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ops.Inspect(r.Context(), f, ops.InspectOptions{Password: password, MaxPages: maxPages})
+}
+
+// sendLimitErrors rejects a request whose documents exceed the limits
+func sendLimitErrors(w http.ResponseWriter, errs []FieldError) {
+	writeFieldErrors(w, http.StatusRequestEntityTooLarge, "Document exceeds processing limits: "+errs[0].Field+" "+errs[0].Message, errs)
+}
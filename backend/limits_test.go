@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pdf-backend/ops"
+)
+
+func TestLimitsFor(t *testing.T) {
+	config := parseLimitsConfig(`{
+		"default": {"maxPages": 500},
+		"operations": {"convert/pdf-to-image": {"maxRenderPixels": 1000}},
+		"plans": {"free": {
+			"default": {"maxPages": 20, "maxObjects": -1},
+			"operations": {"convert/pdf-to-image": {"maxPages": 5}}
+		}}
+	}`)
+
+	tests := []struct {
+		plan, op string
+		want     InputLimits
+	}{
+		{"", "pdf/rotate", InputLimits{500, 14400, 1 << 30, 1000000, 1 << 30}},
+		{"", "convert/pdf-to-image", InputLimits{500, 14400, 1 << 30, 1000000, 1000}},
+		{"free", "pdf/rotate", InputLimits{20, 14400, 1 << 30, -1, 1 << 30}},
+		{"free", "convert/pdf-to-image", InputLimits{5, 14400, 1 << 30, -1, 1000}},
+		{"unknown", "pdf/rotate", InputLimits{500, 14400, 1 << 30, 1000000, 1 << 30}},
+	}
+	for _, tt := range tests {
+		if got := config.limitsFor(tt.plan, tt.op); got != tt.want {
+			t.Errorf("limitsFor(%q, %q) = %+v, want %+v", tt.plan, tt.op, got, tt.want)
+		}
+	}
+}
+
+func TestPreflightLimits(t *testing.T) {
+	oldTempDir, oldKeys, oldLimits := TempDir, APIKeys, inputLimits
+	TempDir = t.TempDir()
+	APIKeys = parseAPIKeys("k1:acme:free,k2:beta")
+	inputLimits = parseLimitsConfig(`{"plans": {"free": {
+		"default": {"maxPages": 1},
+		"operations": {"convert/pdf-to-image": {"maxRenderPixels": 1000000}}
+	}}}`)
+	t.Cleanup(func() { TempDir, APIKeys, inputLimits = oldTempDir, oldKeys, oldLimits })
+
+	handler := authMiddleware(setupRoutes())
+	upload := func(key, path string, files [][]byte, fields map[string]string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		for name, value := range fields {
+			form.WriteField(name, value)
+		}
+		for i, data := range files {
+			part, _ := form.CreateFormFile(fmt.Sprintf("file%d", i), "upload.pdf")
+			part.Write(data)
+		}
+		form.Close()
+
+		req := httptest.NewRequest("POST", path, &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	fields := func(rec *httptest.ResponseRecorder) []FieldError {
+		var payload struct {
+			Fields []FieldError `json:"fields"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &payload)
+		return payload.Fields
+	}
+
+	// Pages are counted across all files of the request
+	pdf := minimalPDF()
+	merge := map[string]string{"fileCount": "2"}
+	rec := upload("k1", "/api/pdf/merge", [][]byte{pdf, pdf}, merge)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("free merge status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if errs := fields(rec); len(errs) != 1 || errs[0].Field != "pages" {
+		t.Errorf("fields = %+v", errs)
+	}
+	if rec := upload("k2", "/api/pdf/merge", [][]byte{pdf, pdf}, merge); rec.Code != http.StatusOK {
+		t.Errorf("default plan merge status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// 200x200 pt at 600 DPI is about 2.8 million pixels
+	rec = upload("k1", "/api/convert/pdf-to-image", [][]byte{pdf}, map[string]string{"dpi": "600"})
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("render status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if errs := fields(rec); len(errs) != 1 || errs[0].Field != "renderPixels" {
+		t.Errorf("fields = %+v", errs)
+	}
+
+	// A PDF header on a broken body is rejected before any tool runs
+	rec = upload("k2", "/api/pdf/rotate", [][]byte{[]byte("%PDF-1.4\ngarbage")}, map[string]string{"angle": "90"})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "not a readable PDF") {
+		t.Errorf("broken PDF status = %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPreflightPassword(t *testing.T) {
+	oldTempDir, oldKeys := TempDir, APIKeys
+	TempDir, APIKeys = t.TempDir(), nil
+	t.Cleanup(func() { TempDir, APIKeys = oldTempDir, oldKeys })
+
+	plain, encrypted := filepath.Join(TempDir, "plain.pdf"), filepath.Join(TempDir, "encrypted.pdf")
+	os.WriteFile(plain, minimalPDF(), 0644)
+	if err := ops.Protect(context.Background(), plain, encrypted, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(encrypted)
+
+	run := func(path string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("password", "secret")
+		part, _ := form.CreateFormFile("file0", "in.pdf")
+		part.Write(data)
+		form.Close()
+
+		req := httptest.NewRequest("POST", path, &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rec := httptest.NewRecorder()
+		setupRoutes().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// unlock's password is the input's; protect's is the one to set and
+	// must not open an input that happens to use it already
+	if rec := run("/api/pdf/unlock"); rec.Code != http.StatusOK {
+		t.Errorf("unlock: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := run("/api/security/protect"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), CodeEncryptedPDF) {
+		t.Errorf("protect: %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
@@ -15,10 +16,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/google/uuid"
-	"github.com/pdfcpu/pdfcpu/pkg/api"
-	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
-	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"pdf-backend/ops"
 )
 
 // Config
@@ -29,10 +27,16 @@ var (
 	FileTTLMinutes = getEnvInt("FILE_TTL_MINUTES", 10)
 )
 
-// FileInfo tracks temporary files for cleanup
+// FileInfo tracks temporary files for cleanup. Outputs deleted before
+// they expire keep their entry until then, with DeletedAt set.
 type FileInfo struct {
 	Path      string
+	Namespace string
 	CreatedAt time.Time
+
+	DeleteAfterDownload bool
+	DeletedAt           *time.Time
+	DeleteReason        string // DeletedByRequest or DeletedByDownload
 }
 
 var (
@@ -41,78 +45,102 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "audit-verify" {
+		os.Exit(runAuditVerify(os.Args[2:]))
+	}
+
 	// Ensure temp directory exists
 	os.MkdirAll(TempDir, 0755)
-	os.MkdirAll(filepath.Join(TempDir, "uploads"), 0755)
-	os.MkdirAll(filepath.Join(TempDir, "output"), 0755)
+	os.MkdirAll(filepath.Join(TempDir, "ns"), 0755)
+
+	// Open the audit log before accepting any operations
+	var err error
+	auditLog, err = openAuditLog(AuditLogPath)
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+
+	// Converters must not run unconfined by accident
+	if err := configureSandbox(); err != nil {
+		log.Fatalf("Failed to configure tool sandbox: %v", err)
+	}
 
-	// Start cleanup goroutine
+	// Take over what the previous process left behind
+	reconciled := reconcileTempDir()
+
+	// Start cleanup and disk space monitoring
 	go cleanupRoutine()
+	go diskMonitor()
 
 	// Setup routes
-	mux := http.NewServeMux()
+	mux := setupRoutes()
+
+	// Wrap with tracking, auditing, async jobs, auth, CORS and request IDs
+	handler := requestIDMiddleware(corsMiddleware(authMiddleware(jobMiddleware(auditMiddleware(trackMiddleware(mux))))))
+
+	log.Printf("🚀 PDF Processing Server starting on port %s", Port)
+	log.Printf("📁 Temp directory: %s", TempDir)
+	log.Printf("⏱️  File TTL: %d minutes", FileTTLMinutes)
+	log.Printf("💾 Disk: refusing work below %d MB free, early cleanup below %d MB", MinFreeDiskMB, DiskLowMB)
+	log.Printf("♻️  Reconciled temp files: %d re-registered, %d expired removed, %d leftover work directories removed",
+		reconciled.Registered, reconciled.Expired, reconciled.WorkDirs)
+	if reconciled.Registered > 0 && !shareSecretConfigured() {
+		log.Printf("⚠️  SHARE_SECRET is not set: share links to the %d files kept from before the restart no longer work",
+			reconciled.Registered)
+	}
+	log.Printf("📜 Audit log: %s", AuditLogPath)
+	log.Printf("🔒 Encryption at rest: %v", encryptionEnabled())
+	log.Printf("🔑 API keys configured: %d (required: %v), admin keys: %d", len(APIKeys), RequireAPIKey, len(AdminAPIKeys))
+	log.Printf("⚙️  Max concurrent operations: %d", cap(opSlots))
+	log.Printf("🛡️  Tool sandbox: %s", sandboxLogLine())
+
+	// The gRPC API serves its calls through the same handler chain
+	if GRPCPort != "" {
+		go func() {
+			log.Fatal(serveGRPC(GRPCPort, handler))
+		}()
+	}
+
+	log.Fatal(http.ListenAndServe(":"+Port, handler))
+}
+
+// setupRoutes registers every route; each one needs an entry in the
+// OpenAPI document (see openapi_test.go)
+func setupRoutes() *Router {
+	mux := newRouter()
 
 	// Health check
 	mux.HandleFunc("/health", handleHealth)
 
+	// API description
+	mux.HandleFunc("/openapi.json", handleOpenAPI)
+
 	// Serve output files
 	mux.HandleFunc("/files/", handleServeFile)
 
-	// PDF Operations
-	mux.HandleFunc("/api/pdf/merge", handleMerge)
-	mux.HandleFunc("/api/pdf/split", handleSplit)
-	mux.HandleFunc("/api/pdf/compress", handleCompress)
-	mux.HandleFunc("/api/pdf/rotate", handleRotate)
-	mux.HandleFunc("/api/pdf/extract", handleExtract)
-	mux.HandleFunc("/api/pdf/watermark", handleWatermark)
-	mux.HandleFunc("/api/pdf/delete-pages", handleDeletePages)
-	mux.HandleFunc("/api/pdf/reorder", handleReorder)
-	mux.HandleFunc("/api/pdf/crop", handleCrop)
-	mux.HandleFunc("/api/pdf/repair", handleRepair)
-	mux.HandleFunc("/api/pdf/add-page-numbers", handleAddPageNumbers)
-	mux.HandleFunc("/api/pdf/add-header-footer", handleAddHeaderFooter)
-	mux.HandleFunc("/api/pdf/metadata", handleMetadata)
-	mux.HandleFunc("/api/pdf/unlock", handleUnlock)
-	mux.HandleFunc("/api/pdf/ocr", handleOCR)
-	mux.HandleFunc("/api/pdf/sign", handleSign)
-	mux.HandleFunc("/api/pdf/redact", handleRedact)
-	mux.HandleFunc("/api/pdf/compare", handleCompare)
-	mux.HandleFunc("/api/pdf/batch", handleBatch)
-
-	// Security
-	mux.HandleFunc("/api/security/protect", handleProtect)
-
-	// Conversions - To PDF
-	mux.HandleFunc("/api/convert/word-to-pdf", handleWordToPDF)
-	mux.HandleFunc("/api/convert/excel-to-pdf", handleExcelToPDF)
-	mux.HandleFunc("/api/convert/ppt-to-pdf", handlePPTToPDF)
-	mux.HandleFunc("/api/convert/image-to-pdf", handleImageToPDF)
-	mux.HandleFunc("/api/convert/scan-to-pdf", handleScanToPDF)
-	mux.HandleFunc("/api/convert/html-to-pdf", handleHTMLToPDF)
-
-	// Conversions - From PDF
-	mux.HandleFunc("/api/convert/pdf-to-word", handlePDFToWord)
-	mux.HandleFunc("/api/convert/pdf-to-excel", handlePDFToExcel)
-	mux.HandleFunc("/api/convert/pdf-to-ppt", handlePDFToPPT)
-	mux.HandleFunc("/api/convert/pdf-to-image", handlePDFToImage)
-	mux.HandleFunc("/api/convert/pdf-to-text", handlePDFToText)
-	mux.HandleFunc("/api/convert/pdf-to-pdfa", handlePDFToPDFA)
-
-	// Wrap with CORS
-	handler := corsMiddleware(mux)
+	// Document operations, declared in operations.go
+	registerOperations(mux)
 
-	log.Printf("🚀 PDF Processing Server starting on port %s", Port)
-	log.Printf("📁 Temp directory: %s", TempDir)
-	log.Printf("⏱️  File TTL: %d minutes", FileTTLMinutes)
-	log.Fatal(http.ListenAndServe(":"+Port, handler))
+	// Async jobs
+	mux.HandleFunc("/api/jobs/", handleJob)
+
+	// Audit log
+	mux.HandleFunc("/api/audit", handleAudit)
+	mux.HandleFunc("/api/audit/export", handleAudit)
+
+	// Admin
+	registerAdminRoutes(mux)
+
+	return mux
 }
 
 // CORS Middleware
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, Prefer, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "Location, Retry-After, X-Request-ID")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -137,6 +165,7 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":       "ok",
 		"dependencies": deps,
+		"disk":         currentDiskStatus(),
 	})
 }
 
@@ -146,38 +175,126 @@ func checkCommand(name string, args ...string) bool {
 }
 
 // Serve output files
+// GET /files/{namespace}/{filename}, DELETE removes the file
 func handleServeFile(w http.ResponseWriter, r *http.Request) {
-	filename := strings.TrimPrefix(r.URL.Path, "/files/")
-	filePath := filepath.Join(TempDir, "output", filename)
+	namespace, filename, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/files/"), "/")
+	if !ok || !namespacePattern.MatchString(namespace) || filename == "" ||
+		strings.ContainsAny(filename, `/\`) || strings.HasPrefix(filename, ".") {
+		http.Error(w, "File not found or expired", http.StatusNotFound)
+		return
+	}
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	// Owners may fetch their own files and admins any file; everyone else
+	// needs a share token
+	principal := principalFrom(r)
+	isOwner := principal.Authenticated && principal.Namespace == namespace
+	if !isOwner && !principal.Admin && !validShareToken(namespace, filename, r.URL.Query().Get("token")) {
 		http.Error(w, "File not found or expired", http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-	http.ServeFile(w, r, filePath)
+	filePath := filepath.Join(TempDir, "ns", namespace, "output", filename)
+
+	switch r.Method {
+	case "GET", "HEAD":
+	case "DELETE":
+		handleDeleteFile(w, r, filePath, isOwner)
+		return
+	case "POST":
+		handleShareFile(w, r, filePath, isOwner)
+		return
+	default:
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info, registered := registeredFile(filePath)
+	if registered && info.DeletedAt != nil {
+		http.Error(w, "File was deleted", http.StatusGone)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", contentDisposition(filename))
+	if serveAndCount(w, r, filePath) && info.DeleteAfterDownload {
+		deleteOutput(filePath, DeletedByDownload)
+	}
 }
 
-// Response helper
-func sendDownloadResponse(w http.ResponseWriter, filename string) {
+// sendDownloadResponse promotes the output at path out of the workspace
+// and sends its download link, or streams it if the client asked for that
+func sendDownloadResponse(w http.ResponseWriter, r *http.Request, path string) {
+	if wantsInline(r) {
+		sendInlineFile(w, r, path)
+		return
+	}
+
+	url, err := publishOutput(r, path)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Failed to store output: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	resp := map[string]interface{}{"downloadUrl": url}
+	if warnings := warningsOf(w); len(warnings) > 0 {
+		resp["warnings"] = warnings
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"downloadUrl": fmt.Sprintf("%s/files/%s", Host, filename),
-	})
+	json.NewEncoder(w).Encode(resp)
 }
 
-func sendError(w http.ResponseWriter, message string, code int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
+// publishOutput promotes the output at path out of the workspace and
+// returns its download link
+func publishOutput(r *http.Request, path string) (string, error) {
+	path, err := workspaceFrom(r).Promote(path)
+	if err != nil {
+		return "", err
+	}
+	auditOutput(r, path)
+	if wantsDeleteAfterDownload(r) {
+		deleteAfterDownload(path)
+	}
+	namespace := principalFrom(r).Namespace
+	if wantsShareLink(r) {
+		expires := time.Now().Add(time.Duration(FileTTLMinutes) * time.Minute)
+		return shareURL(namespace, filepath.Base(path), expires), nil
+	}
+	return downloadURL(namespace, filepath.Base(path)), nil
+}
+
+// addWarning notes something about a successful result the client should
+// check. It is sent as a Warning header, so it reaches inline results
+// too, and repeated in the warnings of the JSON response.
+func addWarning(w http.ResponseWriter, message string) {
+	w.Header().Add("Warning", `299 - "`+strings.ReplaceAll(message, `"`, "'")+`"`)
+}
+
+// warningsOf returns the messages added with addWarning
+func warningsOf(w http.ResponseWriter) []string {
+	var warnings []string
+	for _, value := range w.Header().Values("Warning") {
+		if message, ok := strings.CutPrefix(value, `299 - "`); ok {
+			warnings = append(warnings, strings.TrimSuffix(message, `"`))
+		}
+	}
+	return warnings
+}
+
+// sendError answers with message and the error code matching status,
+// see errors.go
+func sendError(w http.ResponseWriter, message string, status int) {
+	writeError(w, status, ErrorResponse{Error: message, Code: codeForStatus(status)})
 }
 
 // Register file for cleanup
 func registerFile(path string) {
+	registerFileAt(path, time.Now())
+}
+
+// registerFileAt registers a file whose TTL started at createdAt
+func registerFileAt(path string, createdAt time.Time) {
 	fileMutex.Lock()
 	defer fileMutex.Unlock()
-	fileRegistry[path] = FileInfo{Path: path, CreatedAt: time.Now()}
+	fileRegistry[path] = FileInfo{Path: path, Namespace: namespaceOf(path), CreatedAt: createdAt}
 }
 
 // Cleanup routine
@@ -185,6 +302,7 @@ func cleanupRoutine() {
 	ticker := time.NewTicker(1 * time.Minute)
 	for range ticker.C {
 		cleanupExpiredFiles()
+		cleanupJobs()
 	}
 }
 
@@ -193,805 +311,360 @@ func cleanupExpiredFiles() {
 	defer fileMutex.Unlock()
 
 	ttl := time.Duration(FileTTLMinutes) * time.Minute
+	for namespace, count := range removeFilesLocked("", ttl) {
+		log.Printf("🧹 Cleaned up %d expired files in namespace %s", count, namespace)
+	}
+}
+
+// cleanupNamespace removes the expired files of a single namespace
+func cleanupNamespace(namespace string) {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	removeFilesLocked(namespace, time.Duration(FileTTLMinutes)*time.Minute)
+}
+
+// removeFilesLocked deletes registered files older than olderThan, limited
+// to one namespace unless namespace is empty, and returns the counts per
+// namespace. Entries of files deleted earlier are dropped without being
+// counted. Callers must hold fileMutex.
+func removeFilesLocked(namespace string, olderThan time.Duration) map[string]int {
 	now := time.Now()
-	deleted := 0
+	deleted := make(map[string]int)
 
 	for path, info := range fileRegistry {
-		if now.Sub(info.CreatedAt) > ttl {
-			os.Remove(path)
+		if namespace != "" && info.Namespace != namespace {
+			continue
+		}
+		if now.Sub(info.CreatedAt) >= olderThan {
 			delete(fileRegistry, path)
-			deleted++
+			if info.DeletedAt != nil {
+				continue
+			}
+			removeFile(path)
+			deleted[info.Namespace]++
 		}
 	}
 
-	if deleted > 0 {
-		log.Printf("🧹 Cleaned up %d expired files", deleted)
-	}
+	return deleted
 }
 
-// Save uploaded file to temp
+// saveUploadedFile returns where the upload sent as key is stored, moved
+// to the extension of its actual content, which is what the converters go
+// by
 func saveUploadedFile(r *http.Request, key string) (string, error) {
-	file, header, err := r.FormFile(key)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-
-	ext := filepath.Ext(header.Filename)
-	if ext == "" {
-		ext = ".pdf"
-	}
-	tempPath := filepath.Join(TempDir, "uploads", uuid.New().String()+ext)
-
-	out, err := os.Create(tempPath)
-	if err != nil {
-		return "", err
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, file)
-	if err != nil {
-		return "", err
+	uploads := formFiles(r, key)
+	if len(uploads) == 0 {
+		return "", http.ErrMissingFile
+	}
+	upload := uploads[0]
+
+	// Tools get a plaintext copy, which goes with the workspace
+	ext := upload.Type.extFor(upload.Filename)
+	if upload.Sealed {
+		plain := workspaceFrom(r).File("upload", ext)
+		if err := unsealFile(upload.Path, plain); err != nil {
+			return "", err
+		}
+		upload.Path, upload.Sealed = plain, false
+	} else if filepath.Ext(upload.Path) != ext {
+		if err := os.Rename(upload.Path, upload.Path+ext); err != nil {
+			return "", err
+		}
+		upload.Path += ext
 	}
 
-	registerFile(tempPath)
-	return tempPath, nil
-}
-
-// Generate output path
-func generateOutputPath(prefix, ext string) string {
-	filename := fmt.Sprintf("%s-%s%s", prefix, uuid.New().String()[:8], ext)
-	path := filepath.Join(TempDir, "output", filename)
-	registerFile(path)
-	return path
+	auditInput(r, upload.SHA256)
+	return upload.Path, nil
 }
 
-// ==================== PDF HANDLERS ====================
-
-// POST /api/pdf/merge
-func handleMerge(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(100 << 20) // 100MB max
-
-	fileCountStr := r.FormValue("fileCount")
-	fileCount, _ := strconv.Atoi(fileCountStr)
-	if fileCount < 2 {
-		sendError(w, "At least 2 files required", http.StatusBadRequest)
-		return
-	}
-
-	var inputFiles []string
-	for i := 0; i < fileCount; i++ {
+// saveUploadedFiles saves file0 ... file{count-1}
+func saveUploadedFiles(r *http.Request, count int) ([]string, error) {
+	var paths []string
+	for i := 0; i < count; i++ {
 		path, err := saveUploadedFile(r, fmt.Sprintf("file%d", i))
 		if err != nil {
-			sendError(w, fmt.Sprintf("Failed to read file%d: %v", i, err), http.StatusBadRequest)
-			return
+			return nil, fmt.Errorf("Failed to read file%d: %v", i, err)
 		}
-		inputFiles = append(inputFiles, path)
-	}
-
-	outputPath := generateOutputPath("merged", ".pdf")
-
-	err := api.MergeCreateFile(inputFiles, outputPath, false, nil)
-	if err != nil {
-		sendError(w, fmt.Sprintf("Merge failed: %v", err), http.StatusInternalServerError)
-		return
+		paths = append(paths, path)
 	}
+	return paths, nil
+}
 
-	sendDownloadResponse(w, filepath.Base(outputPath))
+// Generate output path in the request's workspace, named after the upload
+// in file0; sendDownloadResponse promotes it once the operation succeeded
+func generateOutputPath(r *http.Request, op, ext string) string {
+	return workspaceFrom(r).Result(outputName(uploadName(r, "file0"), op, ext))
 }
 
-// POST /api/pdf/split
-func handleSplit(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// ==================== PDF HANDLERS ====================
 
-	r.ParseMultipartForm(50 << 20)
+// Handlers are thin adapters: they store the uploads in the caller's
+// namespace, run the matching function from package ops and answer with a
+// download link.
 
+// runSingle saves file0, runs op on it and sends the download link
+func runSingle(w http.ResponseWriter, r *http.Request, prefix, ext string, op func(ctx context.Context, in, out string) error) {
 	inputPath, err := saveUploadedFile(r, "file0")
 	if err != nil {
 		sendError(w, "Failed to read file", http.StatusBadRequest)
 		return
 	}
 
-	mode := r.FormValue("mode")
-	rangesStr := r.FormValue("ranges")
-
-	outputDir := filepath.Join(TempDir, "output", "split-"+uuid.New().String()[:8])
-	os.MkdirAll(outputDir, 0755)
-
-	if mode == "individual" {
-		// Split into individual pages
-		err = api.SplitFile(inputPath, outputDir, 1, nil)
-	} else if rangesStr != "" {
-		// Parse ranges like '[{"start":1,"end":3}]'
-		var ranges []struct {
-			Start int `json:"start"`
-			End   int `json:"end"`
-		}
-		json.Unmarshal([]byte(rangesStr), &ranges)
-
-		for i, rng := range ranges {
-			pageSelection := []string{fmt.Sprintf("%d-%d", rng.Start, rng.End)}
-			outFile := filepath.Join(outputDir, fmt.Sprintf("pages_%d-%d.pdf", rng.Start, rng.End))
-			err = api.ExtractPagesFile(inputPath, outFile, pageSelection, nil)
-			if err != nil {
-				log.Printf("Range %d extraction failed: %v", i, err)
-			}
-		}
-	} else {
-		sendError(w, "Either 'mode=individual' or 'ranges' required", http.StatusBadRequest)
-		return
-	}
-
-	// Create ZIP of output files
-	zipPath := generateOutputPath("split", ".zip")
-	err = createZipFromDir(outputDir, zipPath)
-	if err != nil {
-		sendError(w, fmt.Sprintf("ZIP creation failed: %v", err), http.StatusInternalServerError)
+	outputPath := generateOutputPath(r, prefix, ext)
+	if err := op(r.Context(), inputPath, outputPath); err != nil {
+		sendOpError(w, err)
 		return
 	}
 
-	// Cleanup split directory
-	os.RemoveAll(outputDir)
-
-	sendDownloadResponse(w, filepath.Base(zipPath))
+	sendDownloadResponse(w, r, outputPath)
 }
 
-// POST /api/pdf/compress
-func handleCompress(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// sendOpError answers with the code and status matching the ops error
+// kind, and the failed tool's diagnostics
+func sendOpError(w http.ResponseWriter, err error) {
+	var opErr *ops.Error
+	if errors.As(err, &opErr) && len(opErr.Output) > 0 {
+		log.Printf("[%s] %s tool output: %s", w.Header().Get(requestIDHeader), opErr.Op, string(opErr.Output))
 	}
 
-	r.ParseMultipartForm(50 << 20)
+	resp, status := opErrorResponse(err)
+	writeError(w, status, resp)
+}
 
-	inputPath, err := saveUploadedFile(r, "file0")
+// POST /api/pdf/merge
+func handleMerge(w http.ResponseWriter, r *http.Request) {
+	params := paramsFrom(r)
+	inputFiles, err := saveUploadedFiles(r, params.Int("fileCount"))
 	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
+		sendError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	targetSizeStr := r.FormValue("targetSize")
-	targetSize, _ := strconv.ParseInt(targetSizeStr, 10, 64)
-
-	outputPath := generateOutputPath("compressed", ".pdf")
-
-	if targetSize > 0 {
-		// Use Ghostscript for aggressive compression with target size
-		// Start with quality and iteratively reduce until target is met
-		qualities := []int{150, 100, 72, 50, 30, 20}
-		var lastOutput string
-
-		for _, quality := range qualities {
-			tempOutput := generateOutputPath(fmt.Sprintf("compress-q%d", quality), ".pdf")
-
-			cmd := exec.Command("gs",
-				"-sDEVICE=pdfwrite",
-				"-dCompatibilityLevel=1.4",
-				"-dPDFSETTINGS=/ebook",
-				"-dNOPAUSE",
-				"-dBATCH",
-				fmt.Sprintf("-dColorImageResolution=%d", quality),
-				fmt.Sprintf("-dGrayImageResolution=%d", quality),
-				fmt.Sprintf("-dMonoImageResolution=%d", quality),
-				"-dDownsampleColorImages=true",
-				"-dDownsampleGrayImages=true",
-				"-dDownsampleMonoImages=true",
-				fmt.Sprintf("-sOutputFile=%s", tempOutput),
-				inputPath)
-
-			gsOutput, gsErr := cmd.CombinedOutput()
-			if gsErr != nil {
-				log.Printf("Ghostscript compress (q=%d) failed: %s", quality, string(gsOutput))
-				continue
-			}
-
-			// Check file size
-			info, err := os.Stat(tempOutput)
-			if err != nil {
-				continue
-			}
-
-			lastOutput = tempOutput
-
-			if info.Size() <= targetSize {
-				// Target achieved
-				os.Rename(tempOutput, outputPath)
-				sendDownloadResponse(w, filepath.Base(outputPath))
-				return
-			}
-
-			// Clean up intermediate file if not final
-			if quality != qualities[len(qualities)-1] {
-				os.Remove(tempOutput)
-			}
-		}
-
-		// If we couldn't reach target, use the smallest we got
-		if lastOutput != "" {
-			os.Rename(lastOutput, outputPath)
-			sendDownloadResponse(w, filepath.Base(outputPath))
-			return
+	// Bookmarks and the table of contents show the client's file names
+	pages, _ := params.Value("pages").(map[string][]ops.PageRange)
+	inputs := make([]ops.MergeInput, len(inputFiles))
+	for i, path := range inputFiles {
+		field := fmt.Sprintf("file%d", i)
+		name := sanitizeName(uploadName(r, field))
+		if name == "" {
+			name = field + ".pdf"
 		}
+		inputs[i] = ops.MergeInput{Path: path, Name: name, Pages: pages[field]}
+	}
 
-		// Fallback to pdfcpu if Ghostscript failed
-		conf := model.NewDefaultConfiguration()
-		err = api.OptimizeFile(inputPath, outputPath, conf)
+	outputPath := generateOutputPath(r, "merged", ".pdf")
+	if params.String("mode") == "interleave" {
+		unpaired, err := ops.Interleave(r.Context(), inputs[0], inputs[1], outputPath,
+			ops.InterleaveOptions{ReverseBack: params.Bool("reverseSecond")})
 		if err != nil {
-			sendError(w, fmt.Sprintf("Compression failed: %v", err), http.StatusInternalServerError)
+			sendOpError(w, err)
 			return
 		}
+		if unpaired > 0 {
+			addWarning(w, fmt.Sprintf("Page counts differ by %d: the extra pages of the longer file were appended at the end", unpaired))
+		}
 	} else {
-		// Standard optimization without target
-		conf := model.NewDefaultConfiguration()
-		err = api.OptimizeFile(inputPath, outputPath, conf)
-		if err != nil {
-			sendError(w, fmt.Sprintf("Compression failed: %v", err), http.StatusInternalServerError)
+		opts := ops.MergeOptions{
+			Sort:            params.String("sort"),
+			Bookmarks:       params.Bool("bookmarks"),
+			TableOfContents: params.Bool("tableOfContents"),
+		}
+		if err := ops.MergeDocuments(r.Context(), inputs, outputPath, opts); err != nil {
+			sendOpError(w, err)
 			return
 		}
 	}
 
-	sendDownloadResponse(w, filepath.Base(outputPath))
+	sendDownloadResponse(w, r, outputPath)
 }
 
-// POST /api/pdf/rotate
-func handleRotate(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
+// POST /api/pdf/split
+func handleSplit(w http.ResponseWriter, r *http.Request) {
 	inputPath, err := saveUploadedFile(r, "file0")
 	if err != nil {
 		sendError(w, "Failed to read file", http.StatusBadRequest)
 		return
 	}
 
-	angleStr := r.FormValue("angle")
-	angle, _ := strconv.Atoi(angleStr)
-	if angle == 0 {
-		angle = 90
+	// validateSplit lets through either a mode or ranges
+	params := paramsFrom(r)
+	ranges, _ := params.Value("ranges").([]ops.PageRange)
+	opts := ops.SplitOptions{
+		Mode:           params.String("mode"),
+		Ranges:         ranges,
+		Every:          params.Int("every"),
+		Level:          params.Int("level"),
+		MaxSize:        int64(params.Float("maxSizeMB") * (1 << 20)),
+		BlankThreshold: ops.DefaultBlankThreshold,
 	}
-
-	outputPath := generateOutputPath("rotated", ".pdf")
-
-	// Copy input to output first, then rotate in place
-	copyFile(inputPath, outputPath)
-
-	err = api.RotateFile(outputPath, "", angle, nil, nil)
-	if err != nil {
-		sendError(w, fmt.Sprintf("Rotation failed: %v", err), http.StatusInternalServerError)
-		return
+	if params.Has("blankThreshold") {
+		opts.BlankThreshold = params.Float("blankThreshold")
 	}
 
-	sendDownloadResponse(w, filepath.Base(outputPath))
-}
-
-// POST /api/pdf/extract
-func handleExtract(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	outputDir, err := workspaceFrom(r).MkdirTemp("split")
+	if err != nil {
+		sendError(w, "Failed to create output directory", http.StatusInternalServerError)
 		return
 	}
 
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
+	parts, err := ops.Split(r.Context(), inputPath, outputDir, opts)
 	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
+		sendOpError(w, err)
 		return
 	}
-
-	pagesStr := r.FormValue("pages")
-	var pages []int
-	json.Unmarshal([]byte(pagesStr), &pages)
-
-	if len(pages) == 0 {
-		sendError(w, "No pages specified", http.StatusBadRequest)
-		return
+	paths := make([]string, len(parts))
+	oversized := 0
+	for i, part := range parts {
+		paths[i] = part.Path
+		if info, err := os.Stat(part.Path); err == nil && opts.Mode == ops.SplitSize && info.Size() > opts.MaxSize {
+			oversized++
+		}
 	}
-
-	// Use CollectPages which creates a new PDF with only the selected pages
-	// This is different from ExtractPagesFile which extracts to a directory
-	outputPath := generateOutputPath("extracted", ".pdf")
-
-	// Convert pages to page selection string (e.g., "1,3,5-7")
-	var pageSelection []string
-	for _, p := range pages {
-		pageSelection = append(pageSelection, strconv.Itoa(p))
+	if oversized > 0 {
+		addWarning(w, fmt.Sprintf("%d of the pages are over %g MB on their own and were written to files of their own", oversized, params.Float("maxSizeMB")))
 	}
-
-	// Use Collect instead of ExtractPages - Collect creates a single PDF with selected pages
-	err = api.CollectFile(inputPath, outputPath, pageSelection, nil)
+	paths, err = nameResults(r, paths)
 	if err != nil {
-		sendError(w, fmt.Sprintf("Extraction failed: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	sendDownloadResponse(w, filepath.Base(outputPath))
-}
-
-// POST /api/pdf/watermark
-func handleWatermark(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		sendError(w, fmt.Sprintf("Failed to name results: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
+	results := make([]resultPart, len(parts))
+	for i, part := range parts {
+		results[i] = resultPart{Path: paths[i], Pages: part.Pages}
 	}
+	sendPartsResponse(w, r, inputPath, outputDir, "split", results)
+}
 
-	text := r.FormValue("text")
-	if text == "" {
-		text = "WATERMARK"
-	}
+// POST /api/pdf/compress
+func handleCompress(w http.ResponseWriter, r *http.Request) {
+	opts := ops.CompressOptions{TargetSize: paramsFrom(r).Int64("targetSize")}
+	runSingle(w, r, "compressed", ".pdf", func(ctx context.Context, in, out string) error {
+		return ops.Compress(ctx, in, out, opts)
+	})
+}
 
-	outputPath := generateOutputPath("watermarked", ".pdf")
+// POST /api/pdf/rotate
+func handleRotate(w http.ResponseWriter, r *http.Request) {
+	angle := paramsFrom(r).Int("angle")
+	runSingle(w, r, "rotated", ".pdf", func(ctx context.Context, in, out string) error {
+		return ops.Rotate(ctx, in, out, angle)
+	})
+}
 
-	// Add text watermark using AddTextWatermarksFile
-	err = api.AddTextWatermarksFile(inputPath, outputPath, nil, false, text, "font:Helvetica, scale:1.0, opacity:0.3, rotation:45", nil)
-	if err != nil {
-		sendError(w, fmt.Sprintf("Watermark failed: %v", err), http.StatusInternalServerError)
-		return
-	}
+// POST /api/pdf/extract
+func handleExtract(w http.ResponseWriter, r *http.Request) {
+	pages := paramsFrom(r).Ints("pages")
+	runSingle(w, r, "extracted", ".pdf", func(ctx context.Context, in, out string) error {
+		return ops.ExtractPages(ctx, in, out, pages)
+	})
+}
 
-	sendDownloadResponse(w, filepath.Base(outputPath))
+// POST /api/pdf/watermark
+func handleWatermark(w http.ResponseWriter, r *http.Request) {
+	text := paramsFrom(r).String("text")
+	runSingle(w, r, "watermarked", ".pdf", func(ctx context.Context, in, out string) error {
+		return ops.Watermark(ctx, in, out, text)
+	})
 }
 
 // POST /api/pdf/delete-pages
 func handleDeletePages(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	pagesStr := r.FormValue("pages")
-	var pages []int
-	json.Unmarshal([]byte(pagesStr), &pages)
-
-	if len(pages) == 0 {
-		sendError(w, "No pages specified", http.StatusBadRequest)
-		return
-	}
-
-	// Convert to page selection strings
-	var pageSelection []string
-	for _, p := range pages {
-		pageSelection = append(pageSelection, strconv.Itoa(p))
-	}
-
-	outputPath := generateOutputPath("deleted-pages", ".pdf")
-	copyFile(inputPath, outputPath)
-
-	err = api.RemovePagesFile(outputPath, "", pageSelection, nil)
-	if err != nil {
-		sendError(w, fmt.Sprintf("Delete pages failed: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	sendDownloadResponse(w, filepath.Base(outputPath))
+	pages := paramsFrom(r).Ints("pages")
+	runSingle(w, r, "deleted-pages", ".pdf", func(ctx context.Context, in, out string) error {
+		return ops.DeletePages(ctx, in, out, pages)
+	})
 }
 
 // POST /api/pdf/reorder
 func handleReorder(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	order := paramsFrom(r).Ints("order")
+	runSingle(w, r, "reordered", ".pdf", func(ctx context.Context, in, out string) error {
+		return ops.Reorder(ctx, in, out, order)
+	})
+}
 
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	orderStr := r.FormValue("order")
-	var order []int
-	json.Unmarshal([]byte(orderStr), &order)
-
-	if len(order) == 0 {
-		sendError(w, "No order specified", http.StatusBadRequest)
-		return
-	}
-
-	// Build page selection string for collect
-	var pageSelection []string
-	for _, p := range order {
-		pageSelection = append(pageSelection, strconv.Itoa(p))
-	}
-
-	outputPath := generateOutputPath("reordered", ".pdf")
-
-	err = api.CollectFile(inputPath, outputPath, pageSelection, nil)
-	if err != nil {
-		sendError(w, fmt.Sprintf("Reorder failed: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	sendDownloadResponse(w, filepath.Base(outputPath))
-}
-
-// POST /api/pdf/crop
-func handleCrop(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	top, _ := strconv.ParseFloat(r.FormValue("top"), 64)
-	right, _ := strconv.ParseFloat(r.FormValue("right"), 64)
-	bottom, _ := strconv.ParseFloat(r.FormValue("bottom"), 64)
-	left, _ := strconv.ParseFloat(r.FormValue("left"), 64)
-
-	outputPath := generateOutputPath("cropped", ".pdf")
-	copyFile(inputPath, outputPath)
-
-	// Create crop box
-	boxDef := fmt.Sprintf("[%.2f %.2f %.2f %.2f]", left, bottom, right, top)
-	box, err := api.Box(boxDef, types.POINTS)
-	if err != nil {
-		sendError(w, fmt.Sprintf("Invalid crop dimensions: %v", err), http.StatusBadRequest)
-		return
-	}
-
-	err = api.CropFile(outputPath, "", nil, box, nil)
-	if err != nil {
-		sendError(w, fmt.Sprintf("Crop failed: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	sendDownloadResponse(w, filepath.Base(outputPath))
-}
+// POST /api/pdf/crop
+func handleCrop(w http.ResponseWriter, r *http.Request) {
+	params := paramsFrom(r)
+	box := ops.CropBox{
+		Top:    params.Float("top"),
+		Right:  params.Float("right"),
+		Bottom: params.Float("bottom"),
+		Left:   params.Float("left"),
+	}
+	runSingle(w, r, "cropped", ".pdf", func(ctx context.Context, in, out string) error {
+		return ops.Crop(ctx, in, out, box)
+	})
+}
 
 // POST /api/pdf/repair
 func handleRepair(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	outputPath := generateOutputPath("repaired", ".pdf")
-
-	// Optimize acts as a repair by rebuilding the PDF
-	conf := model.NewDefaultConfiguration()
-	err = api.OptimizeFile(inputPath, outputPath, conf)
-	if err != nil {
-		sendError(w, fmt.Sprintf("Repair failed: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	sendDownloadResponse(w, filepath.Base(outputPath))
+	runSingle(w, r, "repaired", ".pdf", ops.Repair)
 }
 
 // POST /api/pdf/add-page-numbers
 func handleAddPageNumbers(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	position := r.FormValue("position")
-	// Map frontend positions to pdfcpu anchor and offset
-	posConfig := map[string]struct {
-		anchor string
-		offset string
-	}{
-		"bottom-center": {"bc", "0 25"},
-		"bottom-left":   {"bl", "25 25"},
-		"bottom-right":  {"br", "-25 25"},
-		"top-center":    {"tc", "0 -25"},
-		"top-left":      {"tl", "25 -25"},
-		"top-right":     {"tr", "-25 -25"},
-	}
-	cfg, ok := posConfig[position]
-	if !ok {
-		cfg = posConfig["bottom-center"]
-	}
-
-	outputPath := generateOutputPath("numbered", ".pdf")
-
-	// Use pdfcpu stamp with explicit small scale (0.02 = 2% of page width)
-	// scale:0.02 gives approximately 10-12pt text on A4
-	stampDesc := fmt.Sprintf("font:Helvetica, scale:0.02 abs, pos:%s, offset:%s, color:0 0 0", cfg.anchor, cfg.offset)
-	err = api.AddTextWatermarksFile(inputPath, outputPath, nil, true, "%p", stampDesc, nil)
-	if err != nil {
-		sendError(w, fmt.Sprintf("Add page numbers failed: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	sendDownloadResponse(w, filepath.Base(outputPath))
+	position := paramsFrom(r).String("position")
+	runSingle(w, r, "numbered", ".pdf", func(ctx context.Context, in, out string) error {
+		return ops.AddPageNumbers(ctx, in, out, position)
+	})
 }
 
 // POST /api/pdf/add-header-footer
 func handleAddHeaderFooter(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	header := r.FormValue("header")
-	footer := r.FormValue("footer")
-
-	outputPath := generateOutputPath("header-footer", ".pdf")
-	currentInput := inputPath
-
-	// Use small scale (0.02 = ~10pt on A4) with proper margins
-	headerDesc := "font:Helvetica, scale:0.02 abs, pos:tc, offset:0 -25, color:0 0 0"
-	footerDesc := "font:Helvetica, scale:0.02 abs, pos:bc, offset:0 25, color:0 0 0"
-
-	// Add header if provided
-	if header != "" {
-		err = api.AddTextWatermarksFile(currentInput, outputPath, nil, true, header, headerDesc, nil)
-		if err != nil {
-			log.Printf("Header addition warning: %v", err)
-			copyFile(inputPath, outputPath)
-		}
-		currentInput = outputPath
-	}
-
-	// Add footer if provided
-	if footer != "" {
-		if header != "" {
-			tempOutput := generateOutputPath("header-footer-temp", ".pdf")
-			err = api.AddTextWatermarksFile(currentInput, tempOutput, nil, true, footer, footerDesc, nil)
-			if err != nil {
-				log.Printf("Footer addition warning: %v", err)
-			} else {
-				copyFile(tempOutput, outputPath)
-			}
-			os.Remove(tempOutput)
-		} else {
-			err = api.AddTextWatermarksFile(currentInput, outputPath, nil, true, footer, footerDesc, nil)
-			if err != nil {
-				log.Printf("Footer addition warning: %v", err)
-				copyFile(inputPath, outputPath)
-			}
-		}
-	}
-
-	// If neither header nor footer, just copy
-	if header == "" && footer == "" {
-		copyFile(inputPath, outputPath)
-	}
-
-	sendDownloadResponse(w, filepath.Base(outputPath))
+	params := paramsFrom(r)
+	header := params.String("header")
+	footer := params.String("footer")
+	runSingle(w, r, "header-footer", ".pdf", func(ctx context.Context, in, out string) error {
+		return ops.AddHeaderFooter(ctx, in, out, header, footer)
+	})
 }
 
 // POST /api/pdf/metadata
 func handleMetadata(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	outputPath := generateOutputPath("metadata", ".pdf")
-
-	// Build properties map
-	props := make(map[string]string)
-	if title := r.FormValue("title"); title != "" {
-		props["Title"] = title
-	}
-	if author := r.FormValue("author"); author != "" {
-		props["Author"] = author
-	}
-	if subject := r.FormValue("subject"); subject != "" {
-		props["Subject"] = subject
-	}
-	if keywords := r.FormValue("keywords"); keywords != "" {
-		props["Keywords"] = keywords
-	}
-
-	if len(props) > 0 {
-		err = api.AddPropertiesFile(inputPath, outputPath, props, nil)
-		if err != nil {
-			log.Printf("Metadata update warning: %v", err)
-			copyFile(inputPath, outputPath)
-		}
-	} else {
-		copyFile(inputPath, outputPath)
-	}
-
-	sendDownloadResponse(w, filepath.Base(outputPath))
+	params := paramsFrom(r)
+	meta := ops.Metadata{
+		Title:    params.String("title"),
+		Author:   params.String("author"),
+		Subject:  params.String("subject"),
+		Keywords: params.String("keywords"),
+	}
+	runSingle(w, r, "metadata", ".pdf", func(ctx context.Context, in, out string) error {
+		return ops.SetMetadata(ctx, in, out, meta)
+	})
 }
 
 // POST /api/pdf/unlock
 func handleUnlock(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	password := r.FormValue("password")
-
-	outputPath := generateOutputPath("unlocked", ".pdf")
-
-	conf := model.NewDefaultConfiguration()
-	conf.UserPW = password
-	conf.OwnerPW = password
-
-	err = api.DecryptFile(inputPath, outputPath, conf)
-	if err != nil {
-		sendError(w, fmt.Sprintf("Unlock failed (wrong password?): %v", err), http.StatusBadRequest)
-		return
-	}
-
-	sendDownloadResponse(w, filepath.Base(outputPath))
+	password := paramsFrom(r).String("password")
+	runSingle(w, r, "unlocked", ".pdf", func(ctx context.Context, in, out string) error {
+		return ops.Unlock(ctx, in, out, password)
+	})
 }
 
 // POST /api/security/protect
 func handleProtect(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	password := r.FormValue("password")
-	if password == "" {
-		sendError(w, "Password required", http.StatusBadRequest)
-		return
-	}
-
-	outputPath := generateOutputPath("protected", ".pdf")
-
-	conf := model.NewDefaultConfiguration()
-	conf.UserPW = password
-	conf.OwnerPW = password
-
-	err = api.EncryptFile(inputPath, outputPath, conf)
-	if err != nil {
-		sendError(w, fmt.Sprintf("Protect failed: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	sendDownloadResponse(w, filepath.Base(outputPath))
+	password := paramsFrom(r).String("password")
+	runSingle(w, r, "protected", ".pdf", func(ctx context.Context, in, out string) error {
+		return ops.Protect(ctx, in, out, password)
+	})
 }
 
 // POST /api/pdf/ocr
 func handleOCR(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	language := r.FormValue("language")
-	if language == "" {
-		language = "eng"
-	}
-
-	outputPath := generateOutputPath("ocr", ".pdf")
-
-	// Use Tesseract via ocrmypdf for best results
-	cmd := exec.Command("ocrmypdf",
-		"--language", language,
-		"--skip-text",           // Skip pages that already have text
-		"--optimize", "1",       // Light optimization
-		"--output-type", "pdf",
-		inputPath, outputPath)
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("OCR output: %s", string(output))
-		sendError(w, fmt.Sprintf("OCR failed: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	sendDownloadResponse(w, filepath.Base(outputPath))
+	language := paramsFrom(r).String("language")
+	runSingle(w, r, "ocr", ".pdf", func(ctx context.Context, in, out string) error {
+		return ops.OCR(ctx, in, out, language)
+	})
 }
 
 // POST /api/pdf/sign
 func handleSign(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	// Get signature image (base64 or file)
-	signatureData := r.FormValue("signature")
-	if signatureData == "" {
-		sendError(w, "Signature required", http.StatusBadRequest)
-		return
-	}
+	params := paramsFrom(r)
+	signatureData := params.String("signature")
 
-	// Decode base64 signature to temp file
-	signaturePath := filepath.Join(TempDir, "uploads", uuid.New().String()+".png")
-	
 	// Remove data URL prefix if present
 	if strings.HasPrefix(signatureData, "data:image") {
 		parts := strings.SplitN(signatureData, ",", 2)
@@ -1000,867 +673,219 @@ func handleSign(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Decode base64
-	decoded, err := base64.StdEncoding.DecodeString(signatureData)
+	image, err := base64.StdEncoding.DecodeString(signatureData)
 	if err != nil {
 		sendError(w, "Invalid signature data", http.StatusBadRequest)
 		return
 	}
-	
-	err = os.WriteFile(signaturePath, decoded, 0644)
-	if err != nil {
-		sendError(w, "Failed to save signature", http.StatusInternalServerError)
-		return
-	}
-	registerFile(signaturePath)
 
-	// Get position parameters
-	page := r.FormValue("page")
-	if page == "" {
-		page = "1"
-	}
-
-	outputPath := generateOutputPath("signed", ".pdf")
-
-	// Use pdfcpu to add image stamp
-	err = api.AddImageWatermarksFile(inputPath, outputPath, []string{page}, true, signaturePath, "scale:0.3, pos:br, offset:-50 50", nil)
-	if err != nil {
-		sendError(w, fmt.Sprintf("Signing failed: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	sendDownloadResponse(w, filepath.Base(outputPath))
+	opts := ops.SignOptions{Image: image, Page: params.Int("page")}
+	runSingle(w, r, "signed", ".pdf", func(ctx context.Context, in, out string) error {
+		return ops.Sign(ctx, in, out, opts)
+	})
 }
 
 // POST /api/pdf/redact
 func handleRedact(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
+	areas, _ := paramsFrom(r).Value("areas").([]ops.RedactArea)
+	runSingle(w, r, "redacted", ".pdf", func(ctx context.Context, in, out string) error {
+		return ops.Redact(ctx, in, out, areas)
+	})
+}
 
-	inputPath, err := saveUploadedFile(r, "file0")
+// POST /api/pdf/compare
+func handleCompare(w http.ResponseWriter, r *http.Request) {
+	inputFiles, err := saveUploadedFiles(r, 2)
 	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
+		sendError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Get redaction areas (JSON array of rectangles with page numbers)
-	areasStr := r.FormValue("areas")
-	if areasStr == "" {
-		sendError(w, "Redaction areas required", http.StatusBadRequest)
+	outputPath := generateOutputPath(r, "comparison", ".pdf")
+	if err := ops.Compare(r.Context(), inputFiles[0], inputFiles[1], outputPath); err != nil {
+		sendOpError(w, err)
 		return
 	}
 
-	var areas []struct {
-		Page   int     `json:"page"`
-		X      float64 `json:"x"`
-		Y      float64 `json:"y"`
-		Width  float64 `json:"width"`
-		Height float64 `json:"height"`
-	}
-	json.Unmarshal([]byte(areasStr), &areas)
-
-	outputPath := generateOutputPath("redacted", ".pdf")
-	copyFile(inputPath, outputPath)
-
-	// Apply black rectangles for each redaction area using annotations
-	for _, area := range areas {
-		// Use pdfcpu annotations API to add black rectangles
-		// This is a simplified approach - full implementation would use proper redaction
-		desc := fmt.Sprintf("pos:bl, offset:%.0f %.0f, scale:abs, width:%.0f, height:%.0f, bgcolor:#000000", 
-			area.X, area.Y, area.Width, area.Height)
-		
-		api.AddTextWatermarksFile(outputPath, outputPath, []string{strconv.Itoa(area.Page)}, true, " ", desc, nil)
-	}
-
-	sendDownloadResponse(w, filepath.Base(outputPath))
+	sendDownloadResponse(w, r, outputPath)
 }
 
-// POST /api/pdf/compare
-func handleCompare(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(100 << 20)
-
-	file1Path, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read first file", http.StatusBadRequest)
+// POST /api/pdf/batch - Batch compress multiple PDFs
+func handleBatch(w http.ResponseWriter, r *http.Request) {
+	params := paramsFrom(r)
+
+	// A merge is held to everything pdf/merge checks, then handed to its
+	// handler with the params pdf/merge would have parsed
+	if params.String("operation") == "merge" {
+		mergeParams, errs := lookupOperation("pdf/merge").parse(r)
+		if len(errs) > 0 {
+			sendFieldErrors(w, errs)
+			return
+		}
+		handleMerge(w, r.WithContext(context.WithValue(r.Context(), paramsKey{}, mergeParams)))
 		return
 	}
 
-	file2Path, err := saveUploadedFile(r, "file1")
+	// For compress, process each file and zip results
+	outputDir, err := workspaceFrom(r).MkdirTemp("batch")
 	if err != nil {
-		sendError(w, "Failed to read second file", http.StatusBadRequest)
+		sendError(w, "Failed to create output directory", http.StatusInternalServerError)
 		return
 	}
 
-	outputPath := generateOutputPath("comparison", ".pdf")
-
-	// Convert PDFs to images, compare, and create difference PDF
-	// Using ImageMagick for comparison
-	tempDir := filepath.Join(TempDir, "compare-"+uuid.New().String()[:8])
-	os.MkdirAll(tempDir, 0755)
-	defer os.RemoveAll(tempDir)
-
-	// Convert first PDF to images
-	cmd := exec.Command("gs", "-dNOPAUSE", "-dBATCH", "-sDEVICE=png16m", "-r150",
-		fmt.Sprintf("-sOutputFile=%s/page1-%%d.png", tempDir), file1Path)
-	cmd.Run()
-
-	// Convert second PDF to images
-	cmd = exec.Command("gs", "-dNOPAUSE", "-dBATCH", "-sDEVICE=png16m", "-r150",
-		fmt.Sprintf("-sOutputFile=%s/page2-%%d.png", tempDir), file2Path)
-	cmd.Run()
-
-	// Find all page images and compare
-	var diffImages []string
-	for i := 1; ; i++ {
-		img1 := filepath.Join(tempDir, fmt.Sprintf("page1-%d.png", i))
-		img2 := filepath.Join(tempDir, fmt.Sprintf("page2-%d.png", i))
-		diffImg := filepath.Join(tempDir, fmt.Sprintf("diff-%d.png", i))
-
-		if _, err := os.Stat(img1); os.IsNotExist(err) {
-			break
+	for i := 0; i < params.Int("fileCount"); i++ {
+		field := fmt.Sprintf("file%d", i)
+		inputPath, err := saveUploadedFile(r, field)
+		if err != nil {
+			continue
 		}
 
-		// Use ImageMagick to create difference image
-		if _, err := os.Stat(img2); err == nil {
-			cmd = exec.Command("compare", "-highlight-color", "red", img1, img2, diffImg)
-			cmd.Run()
-		} else {
-			// If page doesn't exist in second PDF, just use first
-			copyFile(img1, diffImg)
-		}
-		diffImages = append(diffImages, diffImg)
-	}
+		// Name the output after the original file
+		outputPath := uniquePath(outputDir, outputName(uploadName(r, field), "compressed", ".pdf"))
 
-	// Convert diff images back to PDF
-	if len(diffImages) > 0 {
-		args := append(diffImages, outputPath)
-		cmd = exec.Command("convert", args...)
-		err = cmd.Run()
-		if err != nil {
-			sendError(w, fmt.Sprintf("Comparison failed: %v", err), http.StatusInternalServerError)
-			return
+		if err := ops.Compress(r.Context(), inputPath, outputPath, ops.CompressOptions{}); err != nil {
+			if kind := ops.KindOf(err); kind == ops.KindCanceled || kind == ops.KindTimeout {
+				sendOpError(w, err)
+				return
+			}
+			log.Printf("Batch compress failed for file %d: %v", i, err)
 		}
-	} else {
-		sendError(w, "No pages to compare", http.StatusBadRequest)
-		return
 	}
 
-	sendDownloadResponse(w, filepath.Base(outputPath))
+	sendZipResponse(w, r, outputDir, "batch-compressed")
 }
 
 // ==================== CONVERSION HANDLERS ====================
 
 // POST /api/convert/word-to-pdf
 func handleWordToPDF(w http.ResponseWriter, r *http.Request) {
-	handleLibreOfficeConvert(w, r, "word", ".pdf")
+	runSingle(w, r, "converted", ".pdf", ops.OfficeToPDF)
 }
 
 // POST /api/convert/excel-to-pdf
 func handleExcelToPDF(w http.ResponseWriter, r *http.Request) {
-	handleLibreOfficeConvert(w, r, "excel", ".pdf")
+	runSingle(w, r, "converted", ".pdf", ops.OfficeToPDF)
 }
 
 // POST /api/convert/ppt-to-pdf
 func handlePPTToPDF(w http.ResponseWriter, r *http.Request) {
-	handleLibreOfficeConvert(w, r, "ppt", ".pdf")
+	runSingle(w, r, "converted", ".pdf", ops.OfficeToPDF)
 }
 
 // POST /api/convert/html-to-pdf
 func handleHTMLToPDF(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	outputPath := generateOutputPath("html-converted", ".pdf")
-
-	// Use wkhtmltopdf or LibreOffice for HTML conversion
-	cmd := exec.Command("wkhtmltopdf", inputPath, outputPath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		// Fallback to LibreOffice
-		log.Printf("wkhtmltopdf failed, trying LibreOffice: %s", string(output))
-		handleLibreOfficeConvert(w, r, "html", ".pdf")
-		return
-	}
-
-	sendDownloadResponse(w, filepath.Base(outputPath))
+	runSingle(w, r, "html-converted", ".pdf", ops.HTMLToPDF)
 }
 
 // POST /api/convert/image-to-pdf
 func handleImageToPDF(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	inputFiles, err := saveUploadedFiles(r, paramsFrom(r).Int("fileCount"))
+	if err != nil {
+		sendError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	r.ParseMultipartForm(100 << 20)
-
-	// Support multiple images
-	fileCountStr := r.FormValue("fileCount")
-	fileCount, _ := strconv.Atoi(fileCountStr)
-	if fileCount == 0 {
-		fileCount = 1
-	}
-
-	var inputFiles []string
-	for i := 0; i < fileCount; i++ {
-		path, err := saveUploadedFile(r, fmt.Sprintf("file%d", i))
-		if err != nil {
-			if i == 0 {
-				sendError(w, "Failed to read image file", http.StatusBadRequest)
-				return
-			}
-			break
-		}
-		inputFiles = append(inputFiles, path)
-	}
-
-	outputPath := generateOutputPath("images-to-pdf", ".pdf")
-
-	// Use ImageMagick to convert images to PDF
-	args := append(inputFiles, outputPath)
-	cmd := exec.Command("convert", args...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("ImageMagick output: %s", string(output))
-		sendError(w, fmt.Sprintf("Image to PDF conversion failed: %v", err), http.StatusInternalServerError)
+	outputPath := generateOutputPath(r, "images-to-pdf", ".pdf")
+	if err := ops.ImagesToPDF(r.Context(), inputFiles, outputPath); err != nil {
+		sendOpError(w, err)
 		return
 	}
 
-	sendDownloadResponse(w, filepath.Base(outputPath))
+	sendDownloadResponse(w, r, outputPath)
 }
 
 // POST /api/convert/scan-to-pdf - Convert scanned images with enhancement + OCR
 func handleScanToPDF(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(100 << 20) // 100MB max
-
-	fileCountStr := r.FormValue("fileCount")
-	fileCount, _ := strconv.Atoi(fileCountStr)
-	if fileCount == 0 {
-		fileCount = 1
-	}
-
-	// Create working directory for this scan job
-	jobID := uuid.New().String()[:8]
-	workDir := filepath.Join(TempDir, "output", "scan-"+jobID)
-	os.MkdirAll(workDir, 0755)
-
-	var enhancedImages []string
-
-	for i := 0; i < fileCount; i++ {
-		inputPath, err := saveUploadedFile(r, fmt.Sprintf("file%d", i))
-		if err != nil {
-			if i == 0 {
-				os.RemoveAll(workDir)
-				sendError(w, "Failed to read file", http.StatusBadRequest)
-				return
-			}
-			break
-		}
-
-		// Enhance image using ImageMagick:
-		// - Normalize contrast
-		// - Deskew (auto-straighten)
-		// - Sharpen for better OCR
-		// - Convert to grayscale for cleaner scan look
-		enhancedPath := filepath.Join(workDir, fmt.Sprintf("enhanced-%d.png", i))
-		
-		cmd := exec.Command("convert", inputPath,
-			"-colorspace", "gray",      // Convert to grayscale
-			"-normalize",               // Auto-adjust contrast
-			"-deskew", "40%",           // Auto-straighten
-			"-sharpen", "0x1",          // Sharpen for better OCR
-			"-quality", "95",
-			enhancedPath)
-
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			log.Printf("ImageMagick enhance output: %s", string(output))
-			// Fall back to original if enhancement fails
-			enhancedPath = inputPath
-		}
-
-		enhancedImages = append(enhancedImages, enhancedPath)
-	}
-
-	// Combine enhanced images into a single PDF
-	tempPdfPath := filepath.Join(workDir, "scanned.pdf")
-	args := append(enhancedImages, tempPdfPath)
-	cmd := exec.Command("convert", args...)
-	output, err := cmd.CombinedOutput()
+	inputFiles, err := saveUploadedFiles(r, paramsFrom(r).Int("fileCount"))
 	if err != nil {
-		log.Printf("ImageMagick PDF output: %s", string(output))
-		os.RemoveAll(workDir)
-		sendError(w, fmt.Sprintf("Failed to create PDF: %v", err), http.StatusInternalServerError)
+		sendError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Apply OCR to make the PDF searchable using ocrmypdf
-	outputPath := generateOutputPath("scanned-document", ".pdf")
-	ocrCmd := exec.Command("ocrmypdf",
-		"--skip-text",                    // Skip pages that already have text
-		"--deskew",                       // Additional deskew during OCR
-		"--clean",                        // Clean up scan artifacts
-		"--optimize", "1",                // Light optimization
-		"-l", "eng",                      // English language
-		tempPdfPath,
-		outputPath)
-
-	ocrOutput, ocrErr := ocrCmd.CombinedOutput()
-	if ocrErr != nil {
-		log.Printf("OCRmyPDF output: %s", string(ocrOutput))
-		// If OCR fails, use the non-OCR version
-		os.Rename(tempPdfPath, outputPath)
+	outputPath := generateOutputPath(r, "scanned-document", ".pdf")
+	if err := ops.ScanToPDF(r.Context(), inputFiles, outputPath); err != nil {
+		sendOpError(w, err)
+		return
 	}
 
-	// Cleanup working directory
-	os.RemoveAll(workDir)
-
-	sendDownloadResponse(w, filepath.Base(outputPath))
+	sendDownloadResponse(w, r, outputPath)
 }
 
 // POST /api/convert/pdf-to-word
 func handlePDFToWord(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	// PDF to Word: Use LibreOffice Draw to open PDF, then save as docx
-	// LibreOffice can import PDFs via Draw and export to Writer format
-	uniqueID := uuid.New().String()[:8]
-	outputDir := filepath.Join(TempDir, "output", "pdf-to-word-"+uniqueID)
-	os.MkdirAll(outputDir, 0755)
-
-	// First convert PDF to ODT (LibreOffice's native format) - this works better
-	cmd := exec.Command("libreoffice",
-		"--headless",
-		"--infilter=writer_pdf_import",
-		"-env:UserInstallation=file:///app/.config/libreoffice",
-		"--convert-to", "docx:Office Open XML Text",
-		"--outdir", outputDir,
-		inputPath)
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("LibreOffice PDF to Word output: %s", string(output))
-		os.RemoveAll(outputDir)
-		sendError(w, fmt.Sprintf("Conversion failed: %v - %s", err, string(output)), http.StatusInternalServerError)
-		return
-	}
-
-	// Find the converted file
-	var convertedFile string
-	entries, err := os.ReadDir(outputDir)
-	if err == nil {
-		for _, entry := range entries {
-			if !entry.IsDir() && strings.HasSuffix(strings.ToLower(entry.Name()), ".docx") {
-				convertedFile = filepath.Join(outputDir, entry.Name())
-				break
-			}
-		}
-	}
-
-	if convertedFile == "" {
-		log.Printf("PDF to Word: No docx file found. Dir contents: %v", entries)
-		os.RemoveAll(outputDir)
-		sendError(w, "Conversion produced no output file", http.StatusInternalServerError)
-		return
-	}
-
-	finalPath := generateOutputPath("converted", ".docx")
-	err = os.Rename(convertedFile, finalPath)
-	if err != nil {
-		copyFile(convertedFile, finalPath)
-	}
-	os.RemoveAll(outputDir)
-
-	sendDownloadResponse(w, filepath.Base(finalPath))
+	runSingle(w, r, "converted", ".docx", ops.PDFToWord)
 }
 
 // POST /api/convert/pdf-to-excel
 func handlePDFToExcel(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	uniqueID := uuid.New().String()[:8]
-	outputDir := filepath.Join(TempDir, "output", "pdf-to-excel-"+uniqueID)
-	os.MkdirAll(outputDir, 0755)
-
-	// For PDF to Excel, we first extract text with tabular structure, then convert
-	// Use pdftotext with -layout to preserve table structure
-	textPath := filepath.Join(outputDir, "extracted.txt")
-	cmd := exec.Command("pdftotext", "-layout", inputPath, textPath)
-	cmd.Run()
-
-	// Convert to xlsx using LibreOffice - import the text file as CSV-like
-	cmd = exec.Command("libreoffice",
-		"--headless",
-		"-env:UserInstallation=file:///app/.config/libreoffice",
-		"--convert-to", "xlsx:Calc MS Excel 2007 XML",
-		"--outdir", outputDir,
-		textPath)
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("LibreOffice PDF to Excel output: %s", string(output))
-		os.RemoveAll(outputDir)
-		sendError(w, fmt.Sprintf("Conversion failed: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	// Find the converted file
-	var convertedFile string
-	entries, err := os.ReadDir(outputDir)
-	if err == nil {
-		for _, entry := range entries {
-			if !entry.IsDir() && strings.HasSuffix(strings.ToLower(entry.Name()), ".xlsx") {
-				convertedFile = filepath.Join(outputDir, entry.Name())
-				break
-			}
-		}
-	}
-
-	if convertedFile == "" {
-		log.Printf("PDF to Excel: No xlsx file found. Dir contents: %v", entries)
-		os.RemoveAll(outputDir)
-		sendError(w, "Conversion produced no output file", http.StatusInternalServerError)
-		return
-	}
-
-	finalPath := generateOutputPath("converted", ".xlsx")
-	err = os.Rename(convertedFile, finalPath)
-	if err != nil {
-		copyFile(convertedFile, finalPath)
-	}
-	os.RemoveAll(outputDir)
-
-	sendDownloadResponse(w, filepath.Base(finalPath))
+	runSingle(w, r, "converted", ".xlsx", ops.PDFToExcel)
 }
 
 // POST /api/convert/pdf-to-ppt
 func handlePDFToPPT(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	uniqueID := uuid.New().String()[:8]
-	outputDir := filepath.Join(TempDir, "output", "pdf-to-ppt-"+uniqueID)
-	imgDir := filepath.Join(outputDir, "images")
-	os.MkdirAll(imgDir, 0755)
-
-	// Convert PDF pages to images first using Ghostscript
-	cmd := exec.Command("gs",
-		"-dNOPAUSE", "-dBATCH",
-		"-sDEVICE=png16m",
-		"-r150",
-		fmt.Sprintf("-sOutputFile=%s/page-%%d.png", imgDir),
-		inputPath)
-	cmd.Run()
-
-	// Now convert images to PPTX using LibreOffice Impress
-	// First, create an ODP (Open Document Presentation) with the images
-	// We'll use ImageMagick to make a PDF of images, then convert to pptx
-	
-	// Get all image files
-	imgEntries, _ := os.ReadDir(imgDir)
-	if len(imgEntries) == 0 {
-		os.RemoveAll(outputDir)
-		sendError(w, "Failed to extract PDF pages", http.StatusInternalServerError)
-		return
-	}
-
-	var imgPaths []string
-	for _, entry := range imgEntries {
-		if strings.HasSuffix(entry.Name(), ".png") {
-			imgPaths = append(imgPaths, filepath.Join(imgDir, entry.Name()))
-		}
-	}
-
-	// Create a temporary PDF from images
-	tempPdf := filepath.Join(outputDir, "slides.pdf")
-	imgArgs := append(imgPaths, tempPdf)
-	cmd = exec.Command("convert", imgArgs...)
-	cmd.Run()
-
-	// Convert to pptx using LibreOffice (PDF imported as Impress slides)
-	cmd = exec.Command("libreoffice",
-		"--headless",
-		"--infilter=impress_pdf_import",
-		"-env:UserInstallation=file:///app/.config/libreoffice",
-		"--convert-to", "pptx:Impress MS PowerPoint 2007 XML",
-		"--outdir", outputDir,
-		tempPdf)
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("LibreOffice PDF to PPT output: %s", string(output))
-		os.RemoveAll(outputDir)
-		sendError(w, fmt.Sprintf("Conversion failed: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	// Find the converted file
-	var convertedFile string
-	entries, err := os.ReadDir(outputDir)
-	if err == nil {
-		for _, entry := range entries {
-			if !entry.IsDir() && strings.HasSuffix(strings.ToLower(entry.Name()), ".pptx") {
-				convertedFile = filepath.Join(outputDir, entry.Name())
-				break
-			}
-		}
-	}
-
-	if convertedFile == "" {
-		log.Printf("PDF to PPT: No pptx file found. Dir contents: %v", entries)
-		os.RemoveAll(outputDir)
-		sendError(w, "Conversion produced no output file", http.StatusInternalServerError)
-		return
-	}
-
-	finalPath := generateOutputPath("converted", ".pptx")
-	err = os.Rename(convertedFile, finalPath)
-	if err != nil {
-		copyFile(convertedFile, finalPath)
-	}
-	os.RemoveAll(outputDir)
-
-	sendDownloadResponse(w, filepath.Base(finalPath))
+	runSingle(w, r, "converted", ".pptx", ops.PDFToPPT)
 }
 
 // POST /api/convert/pdf-to-image
 func handlePDFToImage(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
 	inputPath, err := saveUploadedFile(r, "file0")
 	if err != nil {
 		sendError(w, "Failed to read file", http.StatusBadRequest)
 		return
 	}
 
-	format := r.FormValue("format")
-	if format == "" {
-		format = "png"
-	}
-
-	dpi := r.FormValue("dpi")
-	if dpi == "" {
-		dpi = "150"
-	}
-
-	outputDir := filepath.Join(TempDir, "output", "images-"+uuid.New().String()[:8])
-	os.MkdirAll(outputDir, 0755)
-
-	// Use Ghostscript to convert PDF to images
-	device := "png16m"
-	if format == "jpg" || format == "jpeg" {
-		device = "jpeg"
-	}
-
-	cmd := exec.Command("gs",
-		"-dNOPAUSE", "-dBATCH",
-		"-sDEVICE="+device,
-		"-r"+dpi,
-		fmt.Sprintf("-sOutputFile=%s/page-%%d.%s", outputDir, format),
-		inputPath)
+	params := paramsFrom(r)
+	opts := ops.ImageOptions{Format: params.String("format"), DPI: params.Int("dpi")}
 
-	output, err := cmd.CombinedOutput()
+	outputDir, err := workspaceFrom(r).MkdirTemp("images")
 	if err != nil {
-		log.Printf("Ghostscript output: %s", string(output))
-		sendError(w, fmt.Sprintf("PDF to image conversion failed: %v", err), http.StatusInternalServerError)
+		sendError(w, "Failed to create output directory", http.StatusInternalServerError)
 		return
 	}
 
-	// Create ZIP of images
-	zipPath := generateOutputPath("pdf-images", ".zip")
-	err = createZipFromDir(outputDir, zipPath)
+	images, err := ops.PDFToImages(r.Context(), inputPath, outputDir, opts)
 	if err != nil {
-		sendError(w, fmt.Sprintf("ZIP creation failed: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	os.RemoveAll(outputDir)
-	sendDownloadResponse(w, filepath.Base(zipPath))
-}
-
-// POST /api/convert/pdf-to-text
-func handlePDFToText(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		sendOpError(w, err)
 		return
 	}
-
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
+	images, err = nameResults(r, images)
 	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
+		sendError(w, fmt.Sprintf("Failed to name results: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	outputPath := generateOutputPath("extracted-text", ".txt")
-
-	// Use pdftotext from poppler-utils
-	cmd := exec.Command("pdftotext", "-layout", inputPath, outputPath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("pdftotext output: %s", string(output))
-		sendError(w, fmt.Sprintf("Text extraction failed: %v", err), http.StatusInternalServerError)
-		return
+	// Images come in page order, one per page
+	results := make([]resultPart, len(images))
+	for i, image := range images {
+		results[i] = resultPart{Path: image, Pages: ops.PageRange{Start: i + 1, End: i + 1}}
 	}
+	sendPartsResponse(w, r, inputPath, outputDir, "pdf-images", results)
+}
 
-	sendDownloadResponse(w, filepath.Base(outputPath))
+// POST /api/convert/pdf-to-text
+func handlePDFToText(w http.ResponseWriter, r *http.Request) {
+	runSingle(w, r, "extracted-text", ".txt", ops.PDFToText)
 }
 
 // POST /api/convert/pdf-to-pdfa
 func handlePDFToPDFA(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	outputPath := generateOutputPath("pdfa", ".pdf")
-
-	// Use Ghostscript to convert to PDF/A
-	cmd := exec.Command("gs",
-		"-dPDFA=2",
-		"-dBATCH", "-dNOPAUSE",
-		"-sColorConversionStrategy=UseDeviceIndependentColor",
-		"-sDEVICE=pdfwrite",
-		"-dPDFACompatibilityPolicy=1",
-		fmt.Sprintf("-sOutputFile=%s", outputPath),
-		inputPath)
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("Ghostscript PDF/A output: %s", string(output))
-		sendError(w, fmt.Sprintf("PDF/A conversion failed: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	sendDownloadResponse(w, filepath.Base(outputPath))
+	runSingle(w, r, "pdfa", ".pdf", ops.PDFToPDFA)
 }
 
-// Generic LibreOffice conversion handler
-func handleLibreOfficeConvert(w http.ResponseWriter, r *http.Request, convType, outputExt string) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+// sendZipResponse zips the files in dir and sends the download link
+func sendZipResponse(w http.ResponseWriter, r *http.Request, dir, prefix string) {
+	if wantsInline(r) {
+		sendInlineFiles(w, r, dir, prefix)
 		return
 	}
 
-	r.ParseMultipartForm(50 << 20)
-
-	inputPath, err := saveUploadedFile(r, "file0")
-	if err != nil {
-		sendError(w, "Failed to read file", http.StatusBadRequest)
-		return
-	}
-
-	// Create a unique output directory to avoid conflicts
-	uniqueID := uuid.New().String()[:8]
-	outputDir := filepath.Join(TempDir, "output", "libreoffice-"+uniqueID)
-	os.MkdirAll(outputDir, 0755)
-
-	// Determine output format for LibreOffice
-	var convertFormat string
-	switch convType {
-	case "word", "excel", "ppt", "html":
-		convertFormat = "pdf"
-	case "pdf-to-word":
-		convertFormat = "docx"
-	case "pdf-to-excel":
-		convertFormat = "xlsx"
-	case "pdf-to-ppt":
-		convertFormat = "pptx"
-	default:
-		convertFormat = "pdf"
-	}
-
-	// Run LibreOffice headless conversion
-	// Use -env:UserInstallation to keep profile under /app (not /home)
-	cmd := exec.Command("libreoffice",
-		"--headless",
-		"-env:UserInstallation=file:///app/.config/libreoffice",
-		"--convert-to", convertFormat,
-		"--outdir", outputDir,
-		inputPath)
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("LibreOffice output: %s", string(output))
-		os.RemoveAll(outputDir)
-		sendError(w, fmt.Sprintf("Conversion failed: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	// Find the converted file in the output directory
-	var convertedFile string
-	entries, err := os.ReadDir(outputDir)
-	if err != nil || len(entries) == 0 {
-		log.Printf("LibreOffice output dir empty or error: %v", err)
-		os.RemoveAll(outputDir)
-		sendError(w, "Conversion produced no output file", http.StatusInternalServerError)
-		return
-	}
-
-	// Find the file with the expected extension
-	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(strings.ToLower(entry.Name()), "."+convertFormat) {
-			convertedFile = filepath.Join(outputDir, entry.Name())
-			break
-		}
-	}
-
-	if convertedFile == "" {
-		log.Printf("LibreOffice: No %s file found in output. Files: %v", convertFormat, entries)
-		os.RemoveAll(outputDir)
-		sendError(w, fmt.Sprintf("Conversion produced no .%s file", convertFormat), http.StatusInternalServerError)
-		return
-	}
-
-	// Move to final location with our standard naming
-	finalPath := generateOutputPath("converted", outputExt)
-	err = os.Rename(convertedFile, finalPath)
-	if err != nil {
-		// Try copy if rename fails (cross-device)
-		copyFile(convertedFile, finalPath)
-	}
-
-	// Cleanup the temp output directory
-	os.RemoveAll(outputDir)
-
-	sendDownloadResponse(w, filepath.Base(finalPath))
-}
-
-// POST /api/pdf/batch - Batch compress multiple PDFs
-func handleBatch(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	r.ParseMultipartForm(200 << 20) // 200MB max
-
-	operation := r.FormValue("operation")
-	if operation == "" {
-		operation = "compress"
-	}
-
-	fileCountStr := r.FormValue("fileCount")
-	fileCount, _ := strconv.Atoi(fileCountStr)
-	if fileCount == 0 {
-		sendError(w, "No files provided", http.StatusBadRequest)
-		return
-	}
-
-	// For merge, use the merge handler
-	if operation == "merge" {
-		handleMerge(w, r)
-		return
-	}
-
-	// For compress, process each file and zip results
-	outputDir := filepath.Join(TempDir, "output", "batch-"+uuid.New().String()[:8])
-	os.MkdirAll(outputDir, 0755)
-
-	for i := 0; i < fileCount; i++ {
-		inputPath, err := saveUploadedFile(r, fmt.Sprintf("file%d", i))
-		if err != nil {
-			continue
-		}
-
-		// Get original filename for output
-		file, header, _ := r.FormFile(fmt.Sprintf("file%d", i))
-		if file != nil {
-			file.Close()
-		}
-		baseName := strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
-
-		outputPath := filepath.Join(outputDir, fmt.Sprintf("%s-compressed.pdf", baseName))
-
-		// Compress using optimize
-		conf := model.NewDefaultConfiguration()
-		err = api.OptimizeFile(inputPath, outputPath, conf)
-		if err != nil {
-			log.Printf("Batch compress failed for file %d: %v", i, err)
-			continue
-		}
-	}
-
-	// Create ZIP of all compressed files
-	zipPath := generateOutputPath("batch-compressed", ".zip")
-	err := createZipFromDir(outputDir, zipPath)
-	if err != nil {
+	zipPath := generateOutputPath(r, prefix, ".zip")
+	if err := createZipFromDir(dir, zipPath); err != nil {
 		sendError(w, fmt.Sprintf("ZIP creation failed: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	os.RemoveAll(outputDir)
-	sendDownloadResponse(w, filepath.Base(zipPath))
+	sendDownloadResponse(w, r, zipPath)
 }
 
 // ==================== UTILITIES ====================
@@ -1881,23 +906,6 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
-func copyFile(src, dst string) error {
-	source, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer source.Close()
-
-	dest, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer dest.Close()
-
-	_, err = io.Copy(dest, source)
-	return err
-}
-
 func createZipFromDir(srcDir, destZip string) error {
 	files, err := filepath.Glob(filepath.Join(srcDir, "*"))
 	if err != nil {
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"pdf-backend/ops"
+)
+
+// resultPart is one file of a multi-file result and the pages of the
+// input it was made from
+type resultPart struct {
+	Path  string
+	Pages ops.PageRange
+}
+
+// ManifestPart describes one file of a manifest response
+type ManifestPart struct {
+	Name         string        `json:"name"`
+	Pages        ops.PageRange `json:"pages"`
+	PageCount    int           `json:"pageCount"`
+	Size         int64         `json:"size"`
+	DownloadURL  string        `json:"downloadUrl"`
+	ThumbnailURL string        `json:"thumbnailUrl,omitempty"`
+}
+
+// wantsManifest reports whether the client asked for response=manifest,
+// a link per file instead of only the ZIP
+func wantsManifest(r *http.Request) bool {
+	return paramsFrom(r).String("response") == "manifest"
+}
+
+// sendPartsResponse sends the parts in dir like sendZipResponse or, with
+// response=manifest, lists every part with its own download link and,
+// with thumbnails=true, a thumbnail of its first page rendered from in.
+// The ZIP of all parts is still the downloadUrl.
+func sendPartsResponse(w http.ResponseWriter, r *http.Request, in, dir, prefix string, parts []resultPart) {
+	if !wantsManifest(r) {
+		sendZipResponse(w, r, dir, prefix)
+		return
+	}
+
+	var thumbnails map[int]string
+	if paramsFrom(r).Bool("thumbnails") {
+		var err error
+		if thumbnails, err = renderThumbnails(r, in, parts); err != nil {
+			sendOpError(w, err)
+			return
+		}
+	}
+
+	zipPath := generateOutputPath(r, prefix, ".zip")
+	if err := createZipFromDir(dir, zipPath); err != nil {
+		sendError(w, fmt.Sprintf("ZIP creation failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	manifest := make([]ManifestPart, len(parts))
+	thumbnailURLs := make(map[int]string)
+	for i, part := range parts {
+		// Promoted files may be encrypted, so sizes are taken first
+		info, err := os.Stat(part.Path)
+		if err != nil {
+			sendError(w, fmt.Sprintf("Failed to read output: %v", err), http.StatusInternalServerError)
+			return
+		}
+		url, err := publishOutput(r, part.Path)
+		if err != nil {
+			sendError(w, fmt.Sprintf("Failed to store output: %v", err), http.StatusInternalServerError)
+			return
+		}
+		manifest[i] = ManifestPart{
+			Name:        filepath.Base(part.Path),
+			Pages:       part.Pages,
+			PageCount:   part.Pages.End - part.Pages.Start + 1,
+			Size:        info.Size(),
+			DownloadURL: url,
+		}
+
+		if thumb, ok := thumbnails[part.Pages.Start]; ok {
+			if _, published := thumbnailURLs[part.Pages.Start]; !published {
+				if thumbnailURLs[part.Pages.Start], err = publishOutput(r, thumb); err != nil {
+					sendError(w, fmt.Sprintf("Failed to store output: %v", err), http.StatusInternalServerError)
+					return
+				}
+			}
+			manifest[i].ThumbnailURL = thumbnailURLs[part.Pages.Start]
+		}
+	}
+
+	zipURL, err := publishOutput(r, zipPath)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Failed to store output: %v", err), http.StatusInternalServerError)
+		return
+	}
+	resp := map[string]interface{}{"downloadUrl": zipURL, "parts": manifest}
+	if warnings := warningsOf(w); len(warnings) > 0 {
+		resp["warnings"] = warnings
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// renderThumbnails renders the first page of every part into a directory
+// of its own, named like the other results, and returns them by page
+func renderThumbnails(r *http.Request, in string, parts []resultPart) (map[int]string, error) {
+	dir, err := workspaceFrom(r).MkdirTemp("thumbnails")
+	if err != nil {
+		return nil, err
+	}
+	pages := make([]int, len(parts))
+	for i, part := range parts {
+		pages[i] = part.Pages.Start
+	}
+	thumbnails, err := ops.Thumbnails(r.Context(), in, dir, pages)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := make([]int, 0, len(thumbnails))
+	for page := range thumbnails {
+		rendered = append(rendered, page)
+	}
+	sort.Ints(rendered)
+	paths := make([]string, len(rendered))
+	for i, page := range rendered {
+		paths[i] = thumbnails[page]
+	}
+	if paths, err = nameResults(r, paths); err != nil {
+		return nil, err
+	}
+	for i, page := range rendered {
+		thumbnails[page] = paths[i]
+	}
+	return thumbnails, nil
+}
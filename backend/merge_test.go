@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+func TestMergeOptions(t *testing.T) {
+	oldTempDir, oldKeys := TempDir, APIKeys
+	TempDir, APIKeys = t.TempDir(), nil
+	t.Cleanup(func() { TempDir, APIKeys = oldTempDir, oldKeys })
+
+	merge := func(fields map[string]string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("fileCount", "2")
+		for name, value := range fields {
+			form.WriteField(name, value)
+		}
+		for i, name := range []string{"report10.pdf", "report9.pdf"} {
+			part, _ := form.CreateFormFile([]string{"file0", "file1"}[i], name)
+			part.Write(minimalPDF())
+		}
+		form.Close()
+		req := httptest.NewRequest("POST", "/api/pdf/merge", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rec := httptest.NewRecorder()
+		setupRoutes().ServeHTTP(rec, req)
+		return rec
+	}
+
+	bookmarksOf := func(rec *httptest.ResponseRecorder) []string {
+		var resp struct {
+			DownloadURL string `json:"downloadUrl"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.DownloadURL == "" {
+			t.Fatalf("merge: %d %s", rec.Code, rec.Body.String())
+		}
+		u, _ := url.Parse(resp.DownloadURL)
+		f, err := os.Open(filepath.Join(TempDir, "ns", AnonymousNamespace, "output", filepath.Base(u.Path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		bookmarks, err := api.Bookmarks(f, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, bookmark := range bookmarks {
+			titles = append(titles, bookmark.Title)
+		}
+		return titles
+	}
+
+	// Each file gets a bookmark unless the client opts out
+	rec := merge(map[string]string{"sort": "name", "pages": `{"file1":[{"start":1,"end":1}]}`})
+	if titles := bookmarksOf(rec); strings.Join(titles, ",") != "report9.pdf,report10.pdf" {
+		t.Errorf("bookmarks = %q", titles)
+	}
+	if titles := bookmarksOf(merge(map[string]string{"bookmarks": "false"})); len(titles) != 0 {
+		t.Errorf("bookmarks=false: bookmarks = %q", titles)
+	}
+
+	for _, fields := range []map[string]string{
+		{"pages": `{"file2":[{"start":1,"end":1}]}`},
+		{"pages": `{"file0":[{"start":3,"end":2}]}`},
+		{"sort": "size"},
+	} {
+		if rec := merge(fields); rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: %d %s", fields, rec.Code, rec.Body.String())
+		}
+	}
+	// Pages past the end are only known once the file is read
+	if rec := merge(map[string]string{"pages": `{"file0":[{"start":1,"end":2}]}`}); rec.Code != http.StatusBadRequest {
+		t.Errorf("range beyond the last page: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestMergeInterleave(t *testing.T) {
+	oldTempDir, oldKeys := TempDir, APIKeys
+	TempDir, APIKeys = t.TempDir(), nil
+	t.Cleanup(func() { TempDir, APIKeys = oldTempDir, oldKeys })
+
+	merge := func(fields map[string]string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		for name, value := range fields {
+			form.WriteField(name, value)
+		}
+		for _, field := range []string{"file0", "file1"} {
+			part, _ := form.CreateFormFile(field, field+".pdf")
+			part.Write(minimalPDF())
+		}
+		form.Close()
+		req := httptest.NewRequest("POST", "/api/pdf/merge", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rec := httptest.NewRecorder()
+		setupRoutes().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A missing back page is kept, with a warning
+	rec := merge(map[string]string{"fileCount": "2", "mode": "interleave", "reverseSecond": "true",
+		"pages": `{"file0":[{"start":1,"end":1},{"start":1,"end":1}]}`})
+	var resp struct {
+		DownloadURL string   `json:"downloadUrl"`
+		Warnings    []string `json:"warnings"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.DownloadURL == "" {
+		t.Fatalf("interleave: %d %s", rec.Code, rec.Body.String())
+	}
+	if len(resp.Warnings) != 1 || !strings.Contains(rec.Header().Get("Warning"), "differ by 1") {
+		t.Errorf("warnings = %v, header %q", resp.Warnings, rec.Header().Get("Warning"))
+	}
+	if rec := merge(map[string]string{"fileCount": "2"}); strings.Contains(rec.Body.String(), "warnings") {
+		t.Errorf("concatenation warned: %s", rec.Body.String())
+	}
+
+	for _, fields := range []map[string]string{
+		{"fileCount": "2", "mode": "interleave", "bookmarks": "true"},
+		{"fileCount": "2", "reverseSecond": "true"},
+	} {
+		if rec := merge(fields); rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: %d %s", fields, rec.Code, rec.Body.String())
+		}
+	}
+}
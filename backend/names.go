@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// OUTPUT_NAME_TEMPLATE names results. {name} is the uploaded filename
+// without its extension, {op} what was done ("compressed", "page-3"),
+// {ext} the result's extension and {id} a random 8 character id.
+var OutputNameTemplate = getEnv("OUTPUT_NAME_TEMPLATE", "{name}-{op}{ext}")
+
+// maxNameRunes keeps names well within filesystem limits
+const maxNameRunes = 100
+
+// outputName names a result made from the upload called filename
+func outputName(filename, op, ext string) string {
+	// Clients on Windows may send the full path
+	base := filepath.Base(strings.ReplaceAll(filename, `\`, "/"))
+	stem := sanitizeName(strings.TrimSuffix(base, filepath.Ext(base)))
+	if runes := []rune(stem); len(runes) > maxNameRunes {
+		stem = string(runes[:maxNameRunes])
+	}
+	if stem == "" {
+		stem = "document"
+	}
+
+	name := strings.NewReplacer(
+		"{name}", stem,
+		"{op}", op,
+		"{ext}", ext,
+		"{id}", uuid.New().String()[:8],
+	).Replace(OutputNameTemplate)
+	if !strings.Contains(OutputNameTemplate, "{ext}") {
+		name += ext
+	}
+	return sanitizeName(name)
+}
+
+// sanitizeName makes name safe as a single path element on any
+// filesystem and in a download URL; Unicode letters are kept
+func sanitizeName(name string) string {
+	name = strings.ToValidUTF8(name, "_")
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	// Leading dots hide files, trailing ones vanish on Windows
+	return strings.Trim(name, " .")
+}
+
+// uploadName is the client's filename of the upload sent as field
+func uploadName(r *http.Request, field string) string {
+	if uploads := formFiles(r, field); len(uploads) > 0 {
+		return uploads[0].Filename
+	}
+	return ""
+}
+
+// numberedName inserts -n before the extension of name, for n > 1
+func numberedName(name string, n int) string {
+	if n <= 1 {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), n, ext)
+}
+
+// uniquePath returns dir/name, numbered if that file already exists
+func uniquePath(dir, name string) string {
+	for n := 1; ; n++ {
+		path := filepath.Join(dir, numberedName(name, n))
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			return path
+		}
+	}
+}
+
+// nameSet hands out distinct names, numbering repeats
+type nameSet map[string]bool
+
+func (s nameSet) add(name string) string {
+	for n := 1; ; n++ {
+		candidate := numberedName(name, n)
+		if !s[candidate] {
+			s[candidate] = true
+			return candidate
+		}
+	}
+}
+
+// nameResults renames the results in files after the upload in file0,
+// using their current names as {op}
+func nameResults(r *http.Request, files []string) ([]string, error) {
+	renamed := make([]string, len(files))
+	for i, file := range files {
+		ext := filepath.Ext(file)
+		op := strings.TrimSuffix(filepath.Base(file), ext)
+		path := uniquePath(filepath.Dir(file), outputName(uploadName(r, "file0"), op, ext))
+		if err := os.Rename(file, path); err != nil {
+			return nil, err
+		}
+		renamed[i] = path
+	}
+	return renamed, nil
+}
+
+// contentDisposition is an attachment header for filename, with an ASCII
+// fallback and the exact name in RFC 5987 encoding
+func contentDisposition(filename string) string {
+	var fallback strings.Builder
+	for _, r := range filename {
+		switch {
+		case r == '"' || r == '\\':
+			fallback.WriteByte('_')
+		case r < utf8.RuneSelf && r >= ' ':
+			fallback.WriteRune(r)
+		default:
+			fallback.WriteByte('_')
+		}
+	}
+	header := fmt.Sprintf(`attachment; filename="%s"`, fallback.String())
+	if fallback.String() != filename {
+		header += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return header
+}
+
+// encodeRFC5987 percent-encodes everything outside attr-char
+func encodeRFC5987(s string) string {
+	const attrChars = "!#$&+-.^_`|~"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < utf8.RuneSelf && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) || strings.IndexByte(attrChars, c) >= 0) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputName(t *testing.T) {
+	for _, tc := range []struct {
+		template, filename, op, ext, want string
+	}{
+		{"{name}-{op}{ext}", "Report.pdf", "compressed", ".pdf", "Report-compressed.pdf"},
+		{"{name}-{op}{ext}", `C:\Users\me\Q3 Plan.docx`, "converted", ".pdf", "Q3 Plan-converted.pdf"},
+		{"{name}-{op}{ext}", "../../etc/passwd", "rotated", ".pdf", "passwd-rotated.pdf"},
+		{"{name}-{op}{ext}", "a:b*c?.pdf", "merged", ".pdf", "a_b_c_-merged.pdf"},
+		{"{name}-{op}{ext}", "Übersicht – 年报.pdf", "page-1", ".pdf", "Übersicht – 年报-page-1.pdf"},
+		{"{name}-{op}{ext}", ".pdf", "compressed", ".pdf", "document-compressed.pdf"},
+		{"{name}-{op}{ext}", "", "merged", ".pdf", "document-merged.pdf"},
+		{"{op}/{name}", "Report.pdf", "split", ".zip", "split_Report.zip"},
+	} {
+		OutputNameTemplate = tc.template
+		if got := outputName(tc.filename, tc.op, tc.ext); got != tc.want {
+			t.Errorf("outputName(%q, %q) with %q = %q, want %q", tc.filename, tc.op, tc.template, got, tc.want)
+		}
+	}
+	OutputNameTemplate = "{name}-{op}{ext}"
+}
+
+func TestUniqueNames(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.pdf"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, "a-2.pdf"), nil, 0644)
+	if got := uniquePath(dir, "a.pdf"); got != filepath.Join(dir, "a-3.pdf") {
+		t.Errorf("uniquePath = %q", got)
+	}
+
+	// Files of the same name from different directories stay apart in a ZIP
+	other := t.TempDir()
+	os.WriteFile(filepath.Join(other, "a.pdf"), []byte("other"), 0644)
+	var buf bytes.Buffer
+	if err := createZip([]string{filepath.Join(dir, "a.pdf"), filepath.Join(other, "a.pdf")}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil || len(archive.File) != 2 || archive.File[0].Name != "a.pdf" || archive.File[1].Name != "a-2.pdf" {
+		t.Fatalf("zip entries: %v %v", archive.File, err)
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	for name, want := range map[string]string{
+		"Report-compressed.pdf": `attachment; filename="Report-compressed.pdf"`,
+		`say "hi".pdf`:          `attachment; filename="say _hi_.pdf"; filename*=UTF-8''say%20%22hi%22.pdf`,
+		"Übersicht.pdf":         `attachment; filename="_bersicht.pdf"; filename*=UTF-8''%C3%9Cbersicht.pdf`,
+	} {
+		if got := contentDisposition(name); got != want {
+			t.Errorf("contentDisposition(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
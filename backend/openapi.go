@@ -0,0 +1,521 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// obj is a JSON object in the OpenAPI document
+type obj = map[string]interface{}
+
+// Router is a ServeMux that remembers its patterns, so tests can check the
+// OpenAPI document covers every route
+type Router struct {
+	*http.ServeMux
+	Patterns []string
+}
+
+func newRouter() *Router {
+	return &Router{ServeMux: http.NewServeMux()}
+}
+
+func (rt *Router) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	rt.Patterns = append(rt.Patterns, pattern)
+	rt.ServeMux.HandleFunc(pattern, handler)
+}
+
+// errorProperties describes ErrorResponse, plus extra properties
+func errorProperties(extra ...obj) obj {
+	props := obj{
+		"error": obj{"type": "string"},
+		"code": obj{"type": "string", "enum": errorCodes,
+			"description": "Stable reason for the failure; new codes may be added"},
+		"requestId": obj{"type": "string", "description": "Also sent as the X-Request-ID header"},
+		"retriable": obj{"type": "boolean", "description": "Whether sending the same request later may succeed"},
+		"diagnostics": obj{
+			"type":     "object",
+			"required": []string{"operation"},
+			"properties": obj{
+				"operation": obj{"type": "string"},
+				"tool":      obj{"type": "string"},
+				"exitCode":  obj{"type": "integer"},
+				"output":    obj{"type": "string", "description": "End of the tool's output"},
+			},
+		},
+	}
+	for _, e := range extra {
+		for name, schema := range e {
+			props[name] = schema
+		}
+	}
+	return props
+}
+
+// GET /openapi.json
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildOpenAPI())
+}
+
+// buildOpenAPI generates an OpenAPI 3.1 document from operationDefs plus
+// the hand-described utility routes
+func buildOpenAPI() obj {
+	paths := obj{}
+	for _, def := range operationDefs {
+		paths[def.Path] = obj{strings.ToLower(def.Method): def.openAPIOperation()}
+	}
+	for path, item := range utilityPaths() {
+		paths[path] = item
+	}
+
+	return obj{
+		"openapi": "3.1.0",
+		"info": obj{
+			"title":       "PDF Processing API",
+			"version":     "1.0.0",
+			"description": "Document operations take multipart/form-data and answer with a short-lived download URL.",
+		},
+		"servers": []obj{{"url": Host}},
+		"security": []obj{
+			{},
+			{"apiKey": []string{}},
+			{"bearer": []string{}},
+		},
+		"paths": paths,
+		"components": obj{
+			"securitySchemes": obj{
+				"apiKey": obj{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearer": obj{"type": "http", "scheme": "bearer"},
+			},
+			"schemas": obj{
+				"DownloadResponse": obj{
+					"type":     "object",
+					"required": []string{"downloadUrl"},
+					"properties": obj{
+						"downloadUrl": obj{"type": "string", "format": "uri",
+							"description": "Link for the caller's key, or with share=true a signed link valid until the file expires; with response=manifest, the ZIP of all parts"},
+						"warnings": obj{"type": "array", "items": obj{"type": "string"},
+							"description": "Things to check about a result that still succeeded; also sent as Warning headers"},
+						"parts": obj{"type": "array", "items": obj{"$ref": "#/components/schemas/ManifestPart"},
+							"description": "With response=manifest, every file of the result in order"},
+					},
+				},
+				"ManifestPart": obj{
+					"type":     "object",
+					"required": []string{"name", "pages", "pageCount", "size", "downloadUrl"},
+					"properties": obj{
+						"name": obj{"type": "string"},
+						"pages": obj{"type": "object", "description": "Pages of the input the part holds",
+							"properties": obj{"start": obj{"type": "integer"}, "end": obj{"type": "integer"}}},
+						"pageCount":    obj{"type": "integer"},
+						"size":         obj{"type": "integer", "description": "Size in bytes"},
+						"downloadUrl":  obj{"type": "string", "format": "uri", "description": "Link to this part, signed like downloadUrl"},
+						"thumbnailUrl": obj{"type": "string", "format": "uri", "description": "With thumbnails=true, a PNG of the part's first page"},
+					},
+				},
+				"JobAccepted": obj{
+					"type":     "object",
+					"required": []string{"id", "status", "statusUrl"},
+					"properties": obj{
+						"id":        obj{"type": "string"},
+						"status":    obj{"type": "string"},
+						"statusUrl": obj{"type": "string", "format": "uri"},
+					},
+				},
+				"Job": obj{
+					"type":     "object",
+					"required": []string{"id", "operation", "status", "createdAt"},
+					"properties": obj{
+						"id":         obj{"type": "string"},
+						"operation":  obj{"type": "string"},
+						"status":     obj{"type": "string", "enum": []string{"pending", "running", "succeeded", "failed"}},
+						"createdAt":  obj{"type": "string", "format": "date-time"},
+						"finishedAt": obj{"type": "string", "format": "date-time"},
+						"statusCode": obj{"type": "integer", "description": "Status the operation finished with"},
+						"result": obj{
+							"description": "Body the operation answered with",
+							"oneOf": []obj{
+								{"$ref": "#/components/schemas/DownloadResponse"},
+								{"$ref": "#/components/schemas/Error"},
+								{"$ref": "#/components/schemas/ValidationError"},
+							},
+						},
+					},
+				},
+				"Error": obj{
+					"type":       "object",
+					"required":   []string{"error", "code", "retriable"},
+					"properties": errorProperties(),
+				},
+				"ValidationError": obj{
+					"type":     "object",
+					"required": []string{"error", "code", "retriable", "fields"},
+					"properties": errorProperties(obj{
+						"fields": obj{
+							"type": "array",
+							"items": obj{
+								"type":     "object",
+								"required": []string{"field", "message"},
+								"properties": obj{
+									"field":   obj{"type": "string"},
+									"message": obj{"type": "string"},
+								},
+							},
+						},
+					}),
+				},
+			},
+			"responses": obj{
+				"Error":           jsonResponse("Error", "#/components/schemas/Error"),
+				"ValidationError": jsonResponse("Invalid request parameters", "#/components/schemas/ValidationError"),
+			},
+		},
+	}
+}
+
+func (def *OperationDef) openAPIOperation() obj {
+	properties := obj{}
+	required := []string{}
+
+	for i := 0; i < def.Files.Min; i++ {
+		name := fmt.Sprintf("file%d", i)
+		properties[name] = def.fileSchema()
+		required = append(required, name)
+	}
+	for _, param := range def.Params {
+		properties[param.Name] = param.schema()
+		if param.Required {
+			required = append(required, param.Name)
+		}
+	}
+
+	form := obj{"type": "object", "properties": properties, "required": required}
+	if def.Files.Max != def.Files.Min {
+		// Further files follow the same fileN naming
+		form["patternProperties"] = obj{"^file[0-9]+$": def.fileSchema()}
+	}
+
+	// The result params are mostly sent in the query, so they are listed
+	// there as well as in the form
+	parameters := []obj{{
+		"name": "Prefer", "in": "header",
+		"description": "respond-async runs the operation as a job and answers 202",
+		"schema":      obj{"type": "string", "enum": []string{"respond-async"}},
+	}}
+	for _, param := range resultParams(def.Output) {
+		parameters = append(parameters, queryParam(param.Name, param.Description, param.schema()))
+	}
+
+	description := def.Summary
+	if len(def.Requires) > 0 {
+		description += ". Requires " + strings.Join(def.Requires, ", ") + " on the server."
+	}
+
+	return obj{
+		"operationId": operationID(def.Name),
+		"tags":        []string{def.Category},
+		"summary":     def.Summary,
+		"description": description,
+		"requestBody": obj{
+			"required": true,
+			"content":  obj{"multipart/form-data": obj{"schema": form}},
+		},
+		"parameters": parameters,
+		"responses": obj{
+			"200": def.resultResponse(),
+			"202": jsonResponse("Accepted as a job; poll statusUrl", "#/components/schemas/JobAccepted"),
+			"400": obj{"$ref": "#/components/responses/ValidationError"},
+			"401": obj{"$ref": "#/components/responses/Error"},
+			"405": obj{"$ref": "#/components/responses/Error"},
+			"413": obj{"$ref": "#/components/responses/Error"},
+			"415": obj{"$ref": "#/components/responses/ValidationError"},
+			"500": obj{"$ref": "#/components/responses/Error"},
+			"503": obj{"$ref": "#/components/responses/Error"},
+			"504": obj{"$ref": "#/components/responses/Error"},
+			"507": obj{"$ref": "#/components/responses/Error"},
+		},
+		"x-max-upload-mb": def.MaxUploadMB,
+		"x-max-file-mb":   def.fileLimit() >> 20,
+	}
+}
+
+// resultResponse offers the download link and the inline result; ZIP
+// results can also stream as multipart/mixed
+func (def *OperationDef) resultResponse() obj {
+	response := jsonResponse("Processed file ("+def.Output+")", "#/components/schemas/DownloadResponse")
+	content := response["content"].(obj)
+	content[def.Output] = obj{"schema": obj{"type": "string", "format": "binary"}}
+	if def.Output == outputZIP {
+		content["multipart/mixed"] = obj{"schema": obj{"type": "string", "format": "binary"}}
+	}
+	return response
+}
+
+func (def *OperationDef) fileSchema() obj {
+	return obj{
+		"type":             "string",
+		"contentMediaType": "application/octet-stream",
+		"description":      "Accepted types: " + strings.Join(def.Files.Accept, ", ") + " (checked against the content, not the filename)",
+	}
+}
+
+// schema maps a Param onto JSON Schema. integer[] and json fields travel as
+// JSON text inside the form, so they are strings with a contentSchema.
+func (param Param) schema() obj {
+	s := obj{}
+	switch param.Type {
+	case TypeString:
+		s["type"] = "string"
+		if param.MaxLength > 0 {
+			s["maxLength"] = param.MaxLength
+		}
+		if param.Pattern != "" {
+			s["pattern"] = param.Pattern
+		}
+		if len(param.Enum) > 0 {
+			s["enum"] = param.Enum
+		}
+	case TypeInteger, TypeNumber:
+		s["type"] = param.Type
+		param.addRange(s)
+		if len(param.Enum) > 0 {
+			var values []int
+			for _, e := range param.Enum {
+				n, _ := strconv.Atoi(e)
+				values = append(values, n)
+			}
+			s["enum"] = values
+		}
+	case TypeBoolean:
+		s["type"] = "boolean"
+	case TypeIntArray:
+		items := obj{"type": "integer"}
+		param.addRange(items)
+		s["type"] = "string"
+		s["contentMediaType"] = "application/json"
+		s["contentSchema"] = obj{"type": "array", "minItems": 1, "items": items}
+	case TypeJSON:
+		s["type"] = "string"
+		s["contentMediaType"] = "application/json"
+		s["contentSchema"] = schemaForType(reflect.TypeOf(param.Shape))
+	}
+
+	if param.Description != "" {
+		s["description"] = param.Description
+	}
+	if param.Default != nil {
+		s["default"] = param.Default
+	}
+	if param.Example != "" {
+		s["examples"] = []string{param.Example}
+	}
+	return s
+}
+
+func (param Param) addRange(s obj) {
+	if param.Min != nil {
+		s["minimum"] = *param.Min
+	}
+	if param.Max != nil {
+		s["maximum"] = *param.Max
+	}
+}
+
+// schemaForType describes the Go shape of a json parameter
+func schemaForType(t reflect.Type) obj {
+	switch t.Kind() {
+	case reflect.Slice:
+		return obj{"type": "array", "items": schemaForType(t.Elem())}
+	case reflect.Struct:
+		properties := obj{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			properties[name] = schemaForType(field.Type)
+			required = append(required, name)
+		}
+		return obj{"type": "object", "properties": properties, "required": required, "additionalProperties": false}
+	case reflect.Map:
+		return obj{"type": "object", "additionalProperties": schemaForType(t.Elem())}
+	case reflect.Int, reflect.Int64:
+		return obj{"type": "integer"}
+	case reflect.Float64:
+		return obj{"type": "number"}
+	case reflect.Bool:
+		return obj{"type": "boolean"}
+	}
+	return obj{"type": "string"}
+}
+
+// operationID turns "convert/pdf-to-word" into "convertPdfToWord"
+func operationID(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '-' })
+	for i := 1; i < len(parts); i++ {
+		parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+	}
+	return strings.Join(parts, "")
+}
+
+func jsonResponse(description, ref string) obj {
+	return obj{
+		"description": description,
+		"content":     obj{"application/json": obj{"schema": obj{"$ref": ref}}},
+	}
+}
+
+func errorRef() obj {
+	return obj{"$ref": "#/components/responses/Error"}
+}
+
+func queryParam(name, description string, schema obj) obj {
+	return obj{"name": name, "in": "query", "description": description, "schema": schema}
+}
+
+func pathParam(name string) obj {
+	return obj{"name": name, "in": "path", "required": true, "schema": obj{"type": "string"}}
+}
+
+// utilityPaths describes the routes that are not document operations
+func utilityPaths() obj {
+	fileParams := []obj{
+		pathParam("namespace"),
+		pathParam("filename"),
+		queryParam("token", "Share token from downloadUrl", obj{"type": "string"}),
+	}
+	anyJSON := obj{"description": "OK", "content": obj{"application/json": obj{"schema": obj{"type": "object"}}}}
+	auditQuery := []obj{
+		queryParam("operation", "Only entries of this operation, e.g. pdf/merge", obj{"type": "string"}),
+		queryParam("from", "RFC 3339 lower bound", obj{"type": "string", "format": "date-time"}),
+		queryParam("to", "RFC 3339 upper bound", obj{"type": "string", "format": "date-time"}),
+		queryParam("limit", "Maximum number of entries", obj{"type": "integer", "minimum": 1}),
+		queryParam("actor", "Namespace to filter by (admin keys only)", obj{"type": "string"}),
+	}
+	admin := func(method, summary string, extra obj) obj {
+		op := obj{
+			"tags":      []string{"admin"},
+			"summary":   summary,
+			"security":  []obj{{"apiKey": []string{}}, {"bearer": []string{}}},
+			"responses": obj{"200": anyJSON, "401": errorRef()},
+		}
+		for k, v := range extra {
+			op[k] = v
+		}
+		return obj{method: op}
+	}
+
+	return obj{
+		"/health": obj{"get": obj{
+			"tags": []string{"system"}, "summary": "Health check with dependency status",
+			"security":  []obj{{}},
+			"responses": obj{"200": anyJSON},
+		}},
+		"/openapi.json": obj{"get": obj{
+			"tags": []string{"system"}, "summary": "This document",
+			"security":  []obj{{}},
+			"responses": obj{"200": anyJSON},
+		}},
+		"/api/operations": obj{"get": obj{
+			"tags": []string{"system"}, "summary": "Parameters, file types and limits of every operation",
+			"responses": obj{"200": anyJSON},
+		}},
+		"/files/{namespace}/{filename}": obj{
+			"get": obj{
+				"tags": []string{"files"}, "summary": "Download a processed file with the owner's key or a share token",
+				"parameters": fileParams,
+				"responses": obj{
+					"200": obj{"description": "File contents", "content": obj{"application/octet-stream": obj{}}},
+					"404": obj{"description": "File not found or expired"},
+					"410": obj{"description": "File was deleted"},
+				},
+			},
+			"post": obj{
+				"tags": []string{"files"}, "summary": "Mint a share link for a file, with the owner's key",
+				"parameters": fileParams,
+				"responses": obj{
+					"200": anyJSON,
+					"403": errorRef(),
+					"404": errorRef(),
+					"410": errorRef(),
+				},
+			},
+			"delete": obj{
+				"tags": []string{"files"}, "summary": "Delete a processed file before it expires, with the owner's key",
+				"parameters": fileParams,
+				"responses": obj{
+					"204": obj{"description": "Deleted"},
+					"403": errorRef(),
+					"404": errorRef(),
+					"410": errorRef(),
+				},
+			},
+		},
+		"/api/jobs/{id}": obj{
+			"get": obj{
+				"tags": []string{"jobs"}, "summary": "Status and result of an async job",
+				"parameters": []obj{pathParam("id")},
+				"responses": obj{
+					"200": jsonResponse("Job", "#/components/schemas/Job"),
+					"404": errorRef(),
+				},
+			},
+			"delete": obj{
+				"tags": []string{"jobs"}, "summary": "Cancel an async job",
+				"parameters": []obj{pathParam("id")},
+				"responses": obj{
+					"200": jsonResponse("Job", "#/components/schemas/Job"),
+					"404": errorRef(),
+				},
+			},
+		},
+		"/api/audit": obj{"get": obj{
+			"tags": []string{"audit"}, "summary": "Audit entries of the caller's namespace, newest first",
+			"parameters": auditQuery,
+			"responses":  obj{"200": anyJSON, "400": errorRef(), "401": errorRef()},
+		}},
+		"/api/audit/export": obj{"get": obj{
+			"tags": []string{"audit"}, "summary": "Audit entries as JSON lines",
+			"parameters": auditQuery,
+			"responses": obj{
+				"200": obj{"description": "One entry per line", "content": obj{"application/x-ndjson": obj{}}},
+				"400": errorRef(), "401": errorRef(),
+			},
+		}},
+		"/admin/operations": admin("get", "Running and queued operations", nil),
+		"/admin/operations/{id}/cancel": admin("post", "Cancel an operation and kill its tools", obj{
+			"parameters": []obj{pathParam("id")},
+		}),
+		"/admin/files/purge": admin("post", "Delete expired or all files", obj{
+			"parameters": []obj{
+				queryParam("scope", "Which files to delete", obj{"type": "string", "enum": []string{"expired", "all"}, "default": "expired"}),
+				queryParam("namespace", "Limit to one namespace", obj{"type": "string"}),
+			},
+		}),
+		"/admin/config": admin("get", "Effective configuration with secrets redacted", nil),
+		"/admin/toggles": obj{
+			"get": admin("get", "Enabled state of every operation", nil)["get"],
+			"post": admin("post", "Enable or disable an operation", obj{
+				"requestBody": obj{"required": true, "content": obj{"application/json": obj{"schema": obj{
+					"type":     "object",
+					"required": []string{"operation", "enabled"},
+					"properties": obj{
+						"operation": obj{"type": "string"},
+						"enabled":   obj{"type": "boolean"},
+					},
+				}}}},
+			})["post"],
+		},
+	}
+}
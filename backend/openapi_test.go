@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Every registered route must be described in /openapi.json
+func TestOpenAPICoversRoutes(t *testing.T) {
+	mux := setupRoutes()
+	paths := buildOpenAPI()["paths"].(obj)
+
+	for _, pattern := range mux.Patterns {
+		if _, ok := paths[pattern]; ok {
+			continue
+		}
+		// Subtree patterns like /files/ are described by their concrete paths
+		covered := false
+		if strings.HasSuffix(pattern, "/") {
+			for path := range paths {
+				if strings.HasPrefix(path, pattern) {
+					covered = true
+					break
+				}
+			}
+		}
+		if !covered {
+			t.Errorf("route %s is missing from the OpenAPI document", pattern)
+		}
+	}
+}
+
+func TestOpenAPIDescribesOperationFields(t *testing.T) {
+	paths := buildOpenAPI()["paths"].(obj)
+
+	for _, def := range operationDefs {
+		item, ok := paths[def.Path].(obj)
+		if !ok {
+			t.Errorf("%s: missing path", def.Path)
+			continue
+		}
+		op := item["post"].(obj)
+		form := op["requestBody"].(obj)["content"].(obj)["multipart/form-data"].(obj)["schema"].(obj)
+		properties := form["properties"].(obj)
+		for _, param := range def.Params {
+			if _, ok := properties[param.Name]; !ok {
+				t.Errorf("%s: field %s is missing", def.Path, param.Name)
+			}
+		}
+		if def.Files.Min > 0 {
+			if _, ok := properties["file0"]; !ok {
+				t.Errorf("%s: file0 is missing", def.Path)
+			}
+		}
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	setupRoutes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if doc["openapi"] != "3.1.0" {
+		t.Errorf("openapi = %v, want 3.1.0", doc["openapi"])
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"pdf-backend/ops"
+)
+
+// Accepted upload extensions
+var (
+	acceptPDF   = []string{".pdf"}
+	acceptWord  = []string{".doc", ".docx", ".odt", ".rtf"}
+	acceptExcel = []string{".xls", ".xlsx", ".ods", ".csv"}
+	acceptPPT   = []string{".ppt", ".pptx", ".odp"}
+	acceptImage = []string{".jpg", ".jpeg", ".png", ".gif", ".bmp", ".tif", ".tiff", ".webp"}
+	acceptHTML  = []string{".html", ".htm"}
+)
+
+// Output types
+const (
+	outputPDF  = "application/pdf"
+	outputZIP  = "application/zip"
+	outputDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	outputXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	outputPPTX = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	outputText = "text/plain"
+)
+
+func singlePDF() FileSpec { return FileSpec{Min: 1, Max: 1, Accept: acceptPDF} }
+
+func singleFile(accept []string) FileSpec { return FileSpec{Min: 1, Max: 1, Accept: accept} }
+
+// fixedDPI is RenderDPI for operations that always render at dpi
+func fixedDPI(dpi int) func(Params) int {
+	return func(Params) int { return dpi }
+}
+
+// splitRenderDPI is the resolution split renders pages at: mode=blank
+// measures the ink on every page and thumbnails render the parts
+func splitRenderDPI(p Params) int {
+	dpi := 0
+	if p.String("mode") == ops.SplitBlank {
+		dpi = ops.InkCoverageDPI
+	}
+	if p.Bool("thumbnails") {
+		dpi = max(dpi, ops.ThumbnailDPI)
+	}
+	return dpi
+}
+
+// thumbnailsParam asks operations with several results for a thumbnail
+// of each in the manifest
+func thumbnailsParam() Param {
+	return Param{Name: "thumbnails", Type: TypeBoolean, Default: false,
+		Description: "With response=manifest, add a thumbnail of the first page of every part"}
+}
+
+// resultParams choose how every operation hands back its result. Like
+// all params they may also be sent as query parameters.
+func resultParams(output string) []Param {
+	responses := []string{"inline"}
+	description := "inline streams the result in the response body instead of a download link; " +
+		"so does an Accept header naming the result type"
+	if output == outputZIP {
+		responses = append(responses, "manifest")
+		description += ". manifest lists every file of the result with a link of its own"
+	}
+	return []Param{
+		{Name: "response", Type: TypeString, Enum: responses, Description: description},
+		{Name: "deleteAfterDownload", Type: TypeBoolean, Default: false,
+			Description: "Delete the result once it has been downloaded in full instead of after the TTL"},
+		{Name: "share", Type: TypeBoolean, Default: false,
+			Description: "Return a downloadUrl with a share token that works without the key; " +
+				"results of anonymous requests always have one"},
+	}
+}
+
+func fileCountParam(min, max float64, required bool) Param {
+	p := Param{Name: "fileCount", Type: TypeInteger, Required: required,
+		Description: "Number of uploaded files (file0 ... fileN-1)",
+		Min:         floatPtr(min), Max: floatPtr(max)}
+	if !required {
+		p.Default = int(min)
+	}
+	return p
+}
+
+func pageListParam(name, description string) Param {
+	return Param{Name: name, Type: TypeIntArray, Required: true, Description: description,
+		Min: floatPtr(1), Example: "[1,3,5]"}
+}
+
+// operationDefs is the single source of truth for every document operation
+var operationDefs []*OperationDef
+
+func init() {
+	operationDefs = []*OperationDef{
+		// PDF Operations
+		{
+			Name: "pdf/merge", Summary: "Merge PDFs into one document",
+			Files: FileSpec{Min: 2, Max: 50, CountField: true, Accept: acceptPDF},
+			Params: []Param{
+				fileCountParam(2, 50, true),
+				{Name: "pages", Type: TypeJSON, Shape: map[string][]ops.PageRange{},
+					Description: "Page ranges to take per file field, in order; files left out are taken in full",
+					Example:     `{"file0":[{"start":2,"end":5}]}`},
+				{Name: "sort", Type: TypeString, Default: ops.SortGiven, Enum: ops.MergeSorts,
+					Description: "File order: as given, by natural filename order, or by creation date (undated files last)"},
+				{Name: "bookmarks", Type: TypeBoolean, Default: true,
+					Description: "Add a top-level bookmark per file, named after it"},
+				{Name: "tableOfContents", Type: TypeBoolean, Default: false,
+					Description: "Insert a page listing each file and its first page"},
+				{Name: "mode", Type: TypeString, Default: "concatenate", Enum: []string{"concatenate", "interleave"},
+					Description: "'interleave' alternates the pages of two files, for fronts and backs of duplex scans"},
+				{Name: "reverseSecond", Type: TypeBoolean, Default: false,
+					Description: "With mode=interleave, take the pages of file1 last to first"},
+			},
+			Validate: validateMerge,
+			Output:   outputPDF, MaxUploadMB: 100, MaxFileMB: 50, Handler: handleMerge,
+		},
+		{
+			Name: "pdf/split", Summary: "Split a PDF into single pages, page ranges or parts",
+			Files: singlePDF(),
+			Params: []Param{
+				{Name: "mode", Type: TypeString, Enum: ops.SplitModes,
+					Description: "'individual' splits into single pages, 'every' every N pages, 'bookmarks' at bookmarks, " +
+						"'size' into files of at most maxSizeMB, 'blank' at blank separator pages, which are left out"},
+				{Name: "ranges", Type: TypeJSON, Shape: []ops.PageRange{},
+					Description: "Page ranges, each written to its own PDF",
+					Example:     `[{"start":1,"end":3},{"start":5,"end":7}]`},
+				{Name: "every", Type: TypeInteger, Min: floatPtr(1),
+					Description: "With mode=every, pages per file"},
+				{Name: "level", Type: TypeInteger, Default: 1, Min: floatPtr(1),
+					Description: "With mode=bookmarks, the deepest bookmark level to split at; 1 is top-level only"},
+				{Name: "maxSizeMB", Type: TypeNumber, Min: floatPtr(0),
+					Description: "With mode=size, the largest file in megabytes"},
+				{Name: "blankThreshold", Type: TypeNumber, Default: ops.DefaultBlankThreshold, Min: floatPtr(0), Max: floatPtr(100),
+					Description: "With mode=blank, the ink coverage in percent of the page below which a page is blank"},
+				thumbnailsParam(),
+			},
+			Validate:  validateSplit,
+			RenderDPI: splitRenderDPI,
+			Output:    outputZIP, MaxUploadMB: 50, Handler: handleSplit,
+		},
+		{
+			Name: "pdf/compress", Summary: "Reduce PDF file size",
+			Files: singlePDF(),
+			Params: []Param{
+				{Name: "targetSize", Type: TypeInteger, Min: floatPtr(1),
+					Description: "Target size in bytes; downsamples images until reached"},
+			},
+			Output: outputPDF, MaxUploadMB: 50, Requires: []string{"ghostscript"}, Handler: handleCompress,
+		},
+		{
+			Name: "pdf/rotate", Summary: "Rotate all pages",
+			Files: singlePDF(),
+			Params: []Param{
+				{Name: "angle", Type: TypeInteger, Default: 90, Enum: []string{"90", "180", "270"},
+					Description: "Clockwise rotation in degrees"},
+			},
+			Output: outputPDF, MaxUploadMB: 50, Handler: handleRotate,
+		},
+		{
+			Name: "pdf/extract", Summary: "Create a PDF from selected pages",
+			Files:  singlePDF(),
+			Params: []Param{pageListParam("pages", "Page numbers to extract")},
+			Output: outputPDF, MaxUploadMB: 50, Handler: handleExtract,
+		},
+		{
+			Name: "pdf/watermark", Summary: "Add a diagonal text watermark",
+			Files: singlePDF(),
+			Params: []Param{
+				{Name: "text", Type: TypeString, Default: "WATERMARK", MaxLength: 200,
+					Description: "Watermark text"},
+			},
+			Output: outputPDF, MaxUploadMB: 50, Handler: handleWatermark,
+		},
+		{
+			Name: "pdf/delete-pages", Summary: "Remove pages",
+			Files:  singlePDF(),
+			Params: []Param{pageListParam("pages", "Page numbers to delete")},
+			Output: outputPDF, MaxUploadMB: 50, Handler: handleDeletePages,
+		},
+		{
+			Name: "pdf/reorder", Summary: "Reorder pages",
+			Files:  singlePDF(),
+			Params: []Param{pageListParam("order", "New page order; pages left out are dropped")},
+			Output: outputPDF, MaxUploadMB: 50, Handler: handleReorder,
+		},
+		{
+			Name: "pdf/crop", Summary: "Set the crop box of every page",
+			Files: singlePDF(),
+			Params: []Param{
+				{Name: "top", Type: TypeNumber, Default: 0.0, Min: floatPtr(0), Description: "Top edge in points"},
+				{Name: "right", Type: TypeNumber, Default: 0.0, Min: floatPtr(0), Description: "Right edge in points"},
+				{Name: "bottom", Type: TypeNumber, Default: 0.0, Min: floatPtr(0), Description: "Bottom edge in points"},
+				{Name: "left", Type: TypeNumber, Default: 0.0, Min: floatPtr(0), Description: "Left edge in points"},
+			},
+			Output: outputPDF, MaxUploadMB: 50, Handler: handleCrop,
+		},
+		{
+			Name: "pdf/repair", Summary: "Rebuild a damaged PDF",
+			Files:  singlePDF(),
+			Output: outputPDF, MaxUploadMB: 50, Handler: handleRepair,
+		},
+		{
+			Name: "pdf/add-page-numbers", Summary: "Stamp page numbers",
+			Files: singlePDF(),
+			Params: []Param{
+				{Name: "position", Type: TypeString, Default: "bottom-center", Enum: ops.PageNumberPositions,
+					Description: "Where to place the number"},
+			},
+			Output: outputPDF, MaxUploadMB: 50, Handler: handleAddPageNumbers,
+		},
+		{
+			Name: "pdf/add-header-footer", Summary: "Stamp header and footer text",
+			Files: singlePDF(),
+			Params: []Param{
+				{Name: "header", Type: TypeString, MaxLength: 200, Description: "Header text"},
+				{Name: "footer", Type: TypeString, MaxLength: 200, Description: "Footer text"},
+			},
+			Output: outputPDF, MaxUploadMB: 50, Handler: handleAddHeaderFooter,
+		},
+		{
+			Name: "pdf/metadata", Summary: "Set document properties",
+			Files: singlePDF(),
+			Params: []Param{
+				{Name: "title", Type: TypeString, MaxLength: 500, Description: "Document title"},
+				{Name: "author", Type: TypeString, MaxLength: 500, Description: "Document author"},
+				{Name: "subject", Type: TypeString, MaxLength: 500, Description: "Document subject"},
+				{Name: "keywords", Type: TypeString, MaxLength: 500, Description: "Document keywords"},
+			},
+			Output: outputPDF, MaxUploadMB: 50, Handler: handleMetadata,
+		},
+		{
+			Name: "pdf/unlock", Summary: "Remove password protection",
+			Files: singlePDF(),
+			Params: []Param{
+				{Name: "password", Type: TypeString, MaxLength: 128, Description: "Current PDF password"},
+			},
+			Output: outputPDF, MaxUploadMB: 50, PasswordParam: "password", Handler: handleUnlock,
+		},
+		{
+			Name: "pdf/ocr", Summary: "Add a searchable text layer",
+			Files: singlePDF(),
+			Params: []Param{
+				{Name: "language", Type: TypeString, Default: "eng", Pattern: `^[a-z_]{3,8}(\+[a-z_]{3,8})*$`,
+					Description: "Tesseract language code(s), e.g. eng or eng+deu"},
+			},
+			Output: outputPDF, MaxUploadMB: 50, Requires: []string{"ocrmypdf", "tesseract"}, RenderDPI: fixedDPI(300),
+			Handler: handleOCR,
+		},
+		{
+			Name: "pdf/sign", Summary: "Stamp a signature image",
+			Files: singlePDF(),
+			Params: []Param{
+				{Name: "signature", Type: TypeString, Required: true,
+					Description: "Base64 PNG, optionally as a data URL"},
+				{Name: "page", Type: TypeInteger, Default: 1, Min: floatPtr(1), Description: "Page to sign"},
+			},
+			Output: outputPDF, MaxUploadMB: 50, Handler: handleSign,
+		},
+		{
+			Name: "pdf/redact", Summary: "Black out rectangular areas",
+			Files: singlePDF(),
+			Params: []Param{
+				{Name: "areas", Type: TypeJSON, Required: true, Shape: []ops.RedactArea{},
+					Description: "Rectangles in points from the bottom-left corner",
+					Example:     `[{"page":1,"x":100,"y":200,"width":50,"height":20}]`},
+			},
+			Output: outputPDF, MaxUploadMB: 50, Handler: handleRedact,
+		},
+		{
+			Name: "pdf/compare", Summary: "Highlight visual differences between two PDFs",
+			Files:  FileSpec{Min: 2, Max: 2, Accept: acceptPDF},
+			Output: outputPDF, MaxUploadMB: 100, Requires: []string{"ghostscript", "imagemagick"}, RenderDPI: fixedDPI(150),
+			Handler: handleCompare,
+		},
+		{
+			Name: "pdf/batch", Summary: "Compress or merge many PDFs at once",
+			Files: FileSpec{Min: 1, Max: 100, CountField: true, Accept: acceptPDF},
+			Params: []Param{
+				fileCountParam(1, 100, true),
+				{Name: "operation", Type: TypeString, Default: "compress", Enum: []string{"compress", "merge"},
+					Description: "Operation applied to the batch; merge takes the fields of pdf/merge and is held to its rules"},
+			},
+			Output: outputZIP, MaxUploadMB: 200, MaxFileMB: 50, Handler: handleBatch,
+		},
+
+		// Security
+		{
+			Name: "security/protect", Summary: "Encrypt with a password",
+			Files: singlePDF(),
+			Params: []Param{
+				{Name: "password", Type: TypeString, Required: true, MaxLength: 128, Description: "Password to set"},
+			},
+			Output: outputPDF, MaxUploadMB: 50, Handler: handleProtect,
+		},
+
+		// Conversions - To PDF
+		{
+			Name: "convert/word-to-pdf", Summary: "Convert a Word document to PDF",
+			Files:  singleFile(acceptWord),
+			Output: outputPDF, MaxUploadMB: 50, Requires: []string{"libreoffice"}, Handler: handleWordToPDF,
+		},
+		{
+			Name: "convert/excel-to-pdf", Summary: "Convert a spreadsheet to PDF",
+			Files:  singleFile(acceptExcel),
+			Output: outputPDF, MaxUploadMB: 50, Requires: []string{"libreoffice"}, Handler: handleExcelToPDF,
+		},
+		{
+			Name: "convert/ppt-to-pdf", Summary: "Convert a presentation to PDF",
+			Files:  singleFile(acceptPPT),
+			Output: outputPDF, MaxUploadMB: 50, Requires: []string{"libreoffice"}, Handler: handlePPTToPDF,
+		},
+		{
+			Name: "convert/image-to-pdf", Summary: "Combine images into a PDF",
+			Files:  FileSpec{Min: 1, Max: 100, CountField: true, Accept: acceptImage},
+			Params: []Param{fileCountParam(1, 100, false)},
+			Output: outputPDF, MaxUploadMB: 100, Requires: []string{"imagemagick"}, Handler: handleImageToPDF,
+		},
+		{
+			Name: "convert/scan-to-pdf", Summary: "Enhance scanned images and make a searchable PDF",
+			Files:  FileSpec{Min: 1, Max: 100, CountField: true, Accept: acceptImage},
+			Params: []Param{fileCountParam(1, 100, false)},
+			Output: outputPDF, MaxUploadMB: 100, Requires: []string{"imagemagick", "ocrmypdf"}, Handler: handleScanToPDF,
+		},
+		{
+			Name: "convert/html-to-pdf", Summary: "Render an HTML file to PDF",
+			Files:  singleFile(acceptHTML),
+			Output: outputPDF, MaxUploadMB: 50, Requires: []string{"wkhtmltopdf"}, Handler: handleHTMLToPDF,
+		},
+
+		// Conversions - From PDF
+		{
+			Name: "convert/pdf-to-word", Summary: "Convert a PDF to DOCX",
+			Files:  singlePDF(),
+			Output: outputDOCX, MaxUploadMB: 50, Requires: []string{"libreoffice"}, Handler: handlePDFToWord,
+		},
+		{
+			Name: "convert/pdf-to-excel", Summary: "Convert PDF text tables to XLSX",
+			Files:  singlePDF(),
+			Output: outputXLSX, MaxUploadMB: 50, Requires: []string{"libreoffice", "pdftotext"}, Handler: handlePDFToExcel,
+		},
+		{
+			Name: "convert/pdf-to-ppt", Summary: "Convert PDF pages to PPTX slides",
+			Files:  singlePDF(),
+			Output: outputPPTX, MaxUploadMB: 50, Requires: []string{"libreoffice", "ghostscript", "imagemagick"}, RenderDPI: fixedDPI(150),
+			Handler: handlePDFToPPT,
+		},
+		{
+			Name: "convert/pdf-to-image", Summary: "Render pages to images",
+			Files: singlePDF(),
+			Params: []Param{
+				{Name: "format", Type: TypeString, Default: "png", Enum: []string{"png", "jpg", "jpeg"},
+					Description: "Image format"},
+				{Name: "dpi", Type: TypeInteger, Default: 150, Min: floatPtr(36), Max: floatPtr(600),
+					Description: "Resolution in dots per inch"},
+				thumbnailsParam(),
+			},
+			Output: outputZIP, MaxUploadMB: 50, Requires: []string{"ghostscript"},
+			RenderDPI: func(p Params) int { return p.Int("dpi") }, Handler: handlePDFToImage,
+		},
+		{
+			Name: "convert/pdf-to-text", Summary: "Extract text",
+			Files:  singlePDF(),
+			Output: outputText, MaxUploadMB: 50, Requires: []string{"pdftotext"}, Handler: handlePDFToText,
+		},
+		{
+			Name: "convert/pdf-to-pdfa", Summary: "Convert to PDF/A-2 for archiving",
+			Files:  singlePDF(),
+			Output: outputPDF, MaxUploadMB: 50, Requires: []string{"ghostscript"}, Handler: handlePDFToPDFA,
+		},
+	}
+
+	for _, def := range operationDefs {
+		def.Path = "/api/" + def.Name
+		def.Method = "POST"
+		def.Category = def.Name[:strings.Index(def.Name, "/")]
+		def.Params = append(def.Params, resultParams(def.Output)...)
+	}
+}
+
+// validateMerge checks that page ranges name uploaded files and that
+// interleaving gets two files and no options it ignores
+func validateMerge(p Params) []FieldError {
+	if p.String("mode") == "interleave" {
+		if p.Int("fileCount") != 2 {
+			return []FieldError{{"fileCount", "mode=interleave takes exactly 2 files"}}
+		}
+		for _, name := range []string{"sort", "bookmarks", "tableOfContents"} {
+			if p.Has(name) {
+				return []FieldError{{name, "not supported with mode=interleave"}}
+			}
+		}
+	} else if p.Has("reverseSecond") {
+		return []FieldError{{"reverseSecond", "only supported with mode=interleave"}}
+	}
+	pages, _ := p.Value("pages").(map[string][]ops.PageRange)
+	uploaded := make(map[string]bool)
+	for i := 0; i < p.Int("fileCount"); i++ {
+		uploaded[fmt.Sprintf("file%d", i)] = true
+	}
+	for field, ranges := range pages {
+		if !uploaded[field] {
+			return []FieldError{{"pages", fmt.Sprintf("%q is not an uploaded file", field)}}
+		}
+		for _, rng := range ranges {
+			if rng.Start < 1 || rng.End < rng.Start {
+				return []FieldError{{"pages", fmt.Sprintf("%s: invalid range %d-%d", field, rng.Start, rng.End)}}
+			}
+		}
+	}
+	return nil
+}
+
+// validateSplit requires exactly one way of splitting
+func validateSplit(p Params) []FieldError {
+	if p.Has("mode") == p.Has("ranges") {
+		return []FieldError{{"mode", "send either a mode or ranges"}}
+	}
+	mode := p.String("mode")
+	// Each mode's own setting, which no other mode takes
+	for _, setting := range []struct{ name, mode string }{
+		{"every", ops.SplitEvery}, {"level", ops.SplitBookmarks},
+		{"maxSizeMB", ops.SplitSize}, {"blankThreshold", ops.SplitBlank},
+	} {
+		if p.Has(setting.name) && mode != setting.mode {
+			return []FieldError{{setting.name, fmt.Sprintf("only applies to mode=%s", setting.mode)}}
+		}
+	}
+	if mode == ops.SplitEvery && !p.Has("every") {
+		return []FieldError{{"every", "required with mode=every"}}
+	}
+	if mode == ops.SplitSize && p.Float("maxSizeMB") <= 0 {
+		return []FieldError{{"maxSizeMB", "a positive size is required with mode=size"}}
+	}
+	ranges, _ := p.Value("ranges").([]ops.PageRange)
+	for _, rng := range ranges {
+		if rng.Start < 1 || rng.End < rng.Start {
+			return []FieldError{{"ranges", fmt.Sprintf("invalid range %d-%d", rng.Start, rng.End)}}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package ops
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// libreOffice converts in with a headless LibreOffice and moves the result
+// to out. convertTo is a --convert-to filter such as "pdf" or
+// "docx:Office Open XML Text"; ext is the extension it produces.
+func libreOffice(ctx context.Context, op, in, out, convertTo, ext string, extraArgs ...string) error {
+	dir, err := workDir(out, "libreoffice")
+	if err != nil {
+		return fail(ctx, op, "conversion failed", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A profile per run, inside the scratch directory: concurrent
+	// conversions do not fight over one, and documents cannot leave
+	// anything behind for the next
+	profile, err := filepath.Abs(filepath.Join(dir, "profile"))
+	if err != nil {
+		return fail(ctx, op, "conversion failed", err)
+	}
+	args := []string{"--headless"}
+	args = append(args, extraArgs...)
+	args = append(args,
+		"-env:UserInstallation=file://"+filepath.ToSlash(profile),
+		"--convert-to", convertTo,
+		"--outdir", dir,
+		in)
+
+	output, err := runTool(ctx, dir, "libreoffice", args...)
+	if err != nil {
+		return toolFail(ctx, op, "conversion failed", err, output)
+	}
+
+	converted := findFileWithExt(dir, ext)
+	if converted == "" {
+		return &Error{Op: op, Kind: KindFailed, Msg: fmt.Sprintf("conversion produced no %s file", ext), Output: output}
+	}
+	if err := moveFile(converted, out); err != nil {
+		return fail(ctx, op, "conversion failed", err)
+	}
+	return nil
+}
+
+// OfficeToPDF converts a Word, Excel, PowerPoint or HTML document to PDF
+// with LibreOffice
+func OfficeToPDF(ctx context.Context, in, out string) error {
+	return libreOffice(ctx, "office-to-pdf", in, out, "pdf", ".pdf")
+}
+
+// HTMLToPDF renders an HTML file with wkhtmltopdf, falling back to
+// LibreOffice
+func HTMLToPDF(ctx context.Context, in, out string) error {
+	output, err := runToolTo(ctx, out, "wkhtmltopdf", func(tmpOut string) []string {
+		return []string{in, tmpOut}
+	})
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return fail(ctx, "html-to-pdf", "conversion failed", err)
+	}
+	Logf("wkhtmltopdf failed, trying LibreOffice: %s", string(output))
+	return libreOffice(ctx, "html-to-pdf", in, out, "pdf", ".pdf")
+}
+
+// ImagesToPDF combines images into a PDF, one page each
+func ImagesToPDF(ctx context.Context, images []string, out string) error {
+	if len(images) == 0 {
+		return invalidf("image-to-pdf", "no images provided")
+	}
+	output, err := runToolTo(ctx, out, "convert", func(tmpOut string) []string {
+		return append(images, tmpOut)
+	})
+	if err != nil {
+		return toolFail(ctx, "image-to-pdf", "image to PDF conversion failed", err, output)
+	}
+	return nil
+}
+
+// ScanToPDF cleans up scanned images (grayscale, contrast, deskew,
+// sharpen), combines them into a PDF and makes it searchable with OCR.
+// Steps that fail fall back to the unenhanced image or the PDF without
+// a text layer.
+func ScanToPDF(ctx context.Context, images []string, out string) error {
+	if len(images) == 0 {
+		return invalidf("scan-to-pdf", "no images provided")
+	}
+
+	dir, err := workDir(out, "scan")
+	if err != nil {
+		return fail(ctx, "scan-to-pdf", "scan conversion failed", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var enhancedImages []string
+	for i, image := range images {
+		enhancedPath := filepath.Join(dir, fmt.Sprintf("enhanced-%d.png", i))
+		output, err := runTool(ctx, dir, "convert", image,
+			"-colorspace", "gray", // Convert to grayscale
+			"-normalize",     // Auto-adjust contrast
+			"-deskew", "40%", // Auto-straighten
+			"-sharpen", "0x1", // Sharpen for better OCR
+			"-quality", "95",
+			enhancedPath)
+		if err != nil {
+			Logf("ImageMagick enhance output: %s", string(output))
+			// Fall back to original if enhancement fails
+			enhancedPath = image
+		}
+		enhancedImages = append(enhancedImages, enhancedPath)
+	}
+
+	// Combine enhanced images into a single PDF
+	scanned := filepath.Join(dir, "scanned.pdf")
+	output, err := runTool(ctx, dir, "convert", append(enhancedImages, scanned)...)
+	if err != nil {
+		return toolFail(ctx, "scan-to-pdf", "failed to create PDF", err, output)
+	}
+
+	output, err = runToolTo(ctx, out, "ocrmypdf", func(tmpOut string) []string {
+		return []string{
+			"--skip-text",     // Skip pages that already have text
+			"--deskew",        // Additional deskew during OCR
+			"--clean",         // Clean up scan artifacts
+			"--optimize", "1", // Light optimization
+			"-l", "eng",
+			scanned,
+			tmpOut,
+		}
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return fail(ctx, "scan-to-pdf", "OCR failed", err)
+		}
+		Logf("OCRmyPDF output: %s", string(output))
+		// If OCR fails, use the non-OCR version
+		if err := moveFile(scanned, out); err != nil {
+			return fail(ctx, "scan-to-pdf", "failed to create PDF", err)
+		}
+	}
+	return nil
+}
+
+// PDFToWord converts a PDF to DOCX by importing it into LibreOffice Writer
+func PDFToWord(ctx context.Context, in, out string) error {
+	return libreOffice(ctx, "pdf-to-word", in, out, "docx:Office Open XML Text", ".docx",
+		"--infilter=writer_pdf_import")
+}
+
+// PDFToExcel extracts the text of a PDF with its layout and imports it
+// into a spreadsheet
+func PDFToExcel(ctx context.Context, in, out string) error {
+	dir, err := workDir(out, "pdf-to-excel")
+	if err != nil {
+		return fail(ctx, "pdf-to-excel", "conversion failed", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// pdftotext -layout preserves table structure
+	textPath := filepath.Join(dir, "extracted.txt")
+	runTool(ctx, dir, "pdftotext", "-layout", in, textPath)
+
+	return libreOffice(ctx, "pdf-to-excel", textPath, out, "xlsx:Calc MS Excel 2007 XML", ".xlsx")
+}
+
+// PDFToPPT renders each page to an image and turns them into slides
+func PDFToPPT(ctx context.Context, in, out string) error {
+	dir, err := workDir(out, "pdf-to-ppt")
+	if err != nil {
+		return fail(ctx, "pdf-to-ppt", "conversion failed", err)
+	}
+	defer os.RemoveAll(dir)
+
+	output, err := runTool(ctx, dir, "gs",
+		"-dNOPAUSE", "-dBATCH",
+		"-sDEVICE=png16m",
+		"-r150",
+		fmt.Sprintf("-sOutputFile=%s/page-%%d.png", dir),
+		in)
+
+	images, _ := filepath.Glob(filepath.Join(dir, "page-*.png"))
+	if len(images) == 0 {
+		return toolFail(ctx, "pdf-to-ppt", "failed to extract PDF pages", err, output)
+	}
+	sortPageFiles(images)
+
+	// Make a PDF of the images, which LibreOffice imports as Impress slides
+	slides := filepath.Join(dir, "slides.pdf")
+	runTool(ctx, dir, "convert", append(images, slides)...)
+
+	return libreOffice(ctx, "pdf-to-ppt", slides, out, "pptx:Impress MS PowerPoint 2007 XML", ".pptx",
+		"--infilter=impress_pdf_import")
+}
+
+// ImageOptions controls PDFToImages
+type ImageOptions struct {
+	Format string // png (default), jpg or jpeg
+	DPI    int    // default 150
+}
+
+// PDFToImages renders every page of in to outDir and returns the image
+// paths in page order
+func PDFToImages(ctx context.Context, in, outDir string, opts ImageOptions) ([]string, error) {
+	format := opts.Format
+	if format == "" {
+		format = "png"
+	}
+	device := "png16m"
+	switch format {
+	case "png":
+	case "jpg", "jpeg":
+		device = "jpeg"
+	default:
+		return nil, invalidf("pdf-to-image", "unsupported image format %q", format)
+	}
+	dpi := opts.DPI
+	if dpi == 0 {
+		dpi = 150
+	}
+
+	output, err := runTool(ctx, outDir, "gs",
+		"-dNOPAUSE", "-dBATCH",
+		"-sDEVICE="+device,
+		"-r"+strconv.Itoa(dpi),
+		fmt.Sprintf("-sOutputFile=%s/page-%%d.%s", outDir, format),
+		in)
+	if err != nil {
+		return nil, toolFail(ctx, "pdf-to-image", "PDF to image conversion failed", err, output)
+	}
+
+	images, err := filepath.Glob(filepath.Join(outDir, "page-*."+format))
+	if err != nil {
+		return nil, fail(ctx, "pdf-to-image", "PDF to image conversion failed", err)
+	}
+	sortPageFiles(images)
+	return images, nil
+}
+
+// ThumbnailDPI renders a Letter or A4 page about 200 pixels wide
+const ThumbnailDPI = 24
+
+// Thumbnails renders pages of in to outDir as thumb-N.png and returns the
+// images by page number
+func Thumbnails(ctx context.Context, in, outDir string, pages []int) (map[int]string, error) {
+	var unique []int
+	seen := map[int]bool{}
+	for _, page := range pages {
+		if page < 1 {
+			return nil, invalidf("thumbnails", "invalid page %d", page)
+		}
+		if !seen[page] {
+			seen[page] = true
+			unique = append(unique, page)
+		}
+	}
+	sort.Ints(unique)
+	thumbs := make(map[int]string, len(unique))
+	if len(unique) == 0 {
+		return thumbs, nil
+	}
+	list := make([]string, len(unique))
+	for i, page := range unique {
+		list[i] = strconv.Itoa(page)
+	}
+
+	output, err := runTool(ctx, outDir, "gs",
+		"-dNOPAUSE", "-dBATCH",
+		"-sDEVICE=png16m",
+		"-r"+strconv.Itoa(ThumbnailDPI),
+		"-dTextAlphaBits=4", "-dGraphicsAlphaBits=4",
+		"-sPageList="+strings.Join(list, ","),
+		fmt.Sprintf("-sOutputFile=%s/render-%%d.png", outDir),
+		in)
+	if err != nil {
+		return nil, toolFail(ctx, "thumbnails", "failed to render thumbnails", err, output)
+	}
+
+	// Ghostscript numbers the images it writes, not the pages
+	for i, page := range unique {
+		thumb := filepath.Join(outDir, fmt.Sprintf("thumb-%d.png", page))
+		if err := os.Rename(filepath.Join(outDir, fmt.Sprintf("render-%d.png", i+1)), thumb); err != nil {
+			return nil, toolFail(ctx, "thumbnails", "failed to render thumbnails", err, output)
+		}
+		thumbs[page] = thumb
+	}
+	return thumbs, nil
+}
+
+// PDFToText extracts the text of a PDF, keeping its layout
+func PDFToText(ctx context.Context, in, out string) error {
+	output, err := runToolTo(ctx, out, "pdftotext", func(tmpOut string) []string {
+		return []string{"-layout", in, tmpOut}
+	})
+	if err != nil {
+		return toolFail(ctx, "pdf-to-text", "text extraction failed", err, output)
+	}
+	return nil
+}
+
+// PDFToPDFA converts a PDF to PDF/A-2 for archiving
+func PDFToPDFA(ctx context.Context, in, out string) error {
+	output, err := runToolTo(ctx, out, "gs", func(tmpOut string) []string {
+		return []string{
+			"-dPDFA=2",
+			"-dBATCH", "-dNOPAUSE",
+			"-sColorConversionStrategy=UseDeviceIndependentColor",
+			"-sDEVICE=pdfwrite",
+			"-dPDFACompatibilityPolicy=1",
+			fmt.Sprintf("-sOutputFile=%s", tmpOut),
+			in,
+		}
+	})
+	if err != nil {
+		return toolFail(ctx, "pdf-to-pdfa", "PDF/A conversion failed", err, output)
+	}
+	return nil
+}
+
+// sortPageFiles orders page-N.ext files numerically, so page-10 follows
+// page-9
+func sortPageFiles(paths []string) {
+	pageNumber := func(path string) int {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		n, _ := strconv.Atoi(name[strings.LastIndex(name, "-")+1:])
+		return n
+	}
+	sort.Slice(paths, func(i, j int) bool { return pageNumber(paths[i]) < pageNumber(paths[j]) })
+}
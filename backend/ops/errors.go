@@ -0,0 +1,169 @@
+package ops
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+// Kind classifies why an operation failed
+type Kind string
+
+const (
+	// KindInvalidInput means the input files or options were rejected;
+	// retrying with the same input will fail again
+	KindInvalidInput Kind = "invalid_input"
+	// KindEncrypted means an input PDF needs a password that was not given
+	KindEncrypted Kind = "encrypted_pdf"
+	// KindWrongPassword means the password given does not open the PDF
+	KindWrongPassword Kind = "wrong_password"
+	// KindLimitExceeded means a tool ran into a resource limit (memory,
+	// output size) on this input
+	KindLimitExceeded Kind = "limit_exceeded"
+	// KindToolUnavailable means a required external tool is not installed
+	KindToolUnavailable Kind = "tool_unavailable"
+	// KindTimeout means the context's deadline passed or a tool used up
+	// its CPU time
+	KindTimeout Kind = "timeout"
+	// KindCanceled means the context was cancelled
+	KindCanceled Kind = "canceled"
+	// KindFailed covers every other processing failure
+	KindFailed Kind = "failed"
+)
+
+// Error is returned by every operation in this package
+type Error struct {
+	Op   string // operation, e.g. "merge"
+	Kind Kind
+	Msg  string // summary, e.g. "merge failed"
+	Err  error  // underlying cause, may be nil
+
+	// Tool, ExitCode and Output describe the external tool that failed,
+	// if any. ExitCode is -1 if the tool was killed by a signal.
+	Tool     string
+	ExitCode int
+	Output   []byte
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Msg, e.Err)
+	}
+	return e.Msg
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// KindOf returns the Kind of err, or KindFailed if err is not an *Error
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindFailed
+}
+
+func invalidf(op, format string, args ...interface{}) error {
+	return &Error{Op: op, Kind: KindInvalidInput, Msg: fmt.Sprintf(format, args...)}
+}
+
+// passwordError reports a PDF that password did not open
+func passwordError(op, password string, err error) error {
+	if password == "" {
+		return &Error{Op: op, Kind: KindEncrypted, Msg: "PDF is encrypted; a password is required", Err: err}
+	}
+	return &Error{Op: op, Kind: KindWrongPassword, Msg: "wrong password for the PDF", Err: err}
+}
+
+// fail wraps err, classifying cancellations, missing tools and PDFs
+// pdfcpu could not decrypt
+func fail(ctx context.Context, op, msg string, err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	kind := KindFailed
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		kind = KindTimeout
+		err = ctx.Err()
+	case ctx.Err() != nil:
+		kind = KindCanceled
+		err = ctx.Err()
+	case errors.Is(err, exec.ErrNotFound):
+		kind = KindToolUnavailable
+	case errors.Is(err, pdfcpu.ErrWrongPassword):
+		// Operations without a password parameter only see encrypted input
+		kind = KindEncrypted
+		msg = "PDF is encrypted"
+	}
+	return &Error{Op: op, Kind: kind, Msg: msg, Err: err}
+}
+
+// toolFail is fail for a tool run, keeping the tool's output and telling
+// resource limits and encrypted input apart by how the tool failed
+func toolFail(ctx context.Context, op, msg string, err error, output []byte) error {
+	wrapped := fail(ctx, op, msg, err)
+	e, ok := wrapped.(*Error)
+	if !ok || e.Output != nil {
+		return wrapped
+	}
+	e.Output = output
+
+	var te *toolError
+	if errors.As(err, &te) {
+		e.Tool = te.tool
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		e.ExitCode = exitErr.ExitCode()
+	}
+
+	if e.Kind == KindFailed {
+		if kind := limitKind(err); kind != "" {
+			e.Kind = kind
+		} else {
+			e.Kind = classifyOutput(output)
+		}
+	}
+	return wrapped
+}
+
+// toolOutputKinds recognises failures in what the tools print. The first
+// match wins, so the more specific patterns come first.
+var toolOutputKinds = []struct {
+	pattern string
+	kind    Kind
+}{
+	// Ghostscript, qpdf
+	{"requires a password", KindEncrypted},
+	{"invalid password", KindWrongPassword},
+	// Ghostscript, ImageMagick, C++ tools
+	{"VMerror", KindLimitExceeded},
+	{"memory allocation failed", KindLimitExceeded},
+	{"Cannot allocate memory", KindLimitExceeded},
+	{"std::bad_alloc", KindLimitExceeded},
+	{"File size limit exceeded", KindLimitExceeded},
+	// Ghostscript cannot find the structure of the input
+	{"Cannot find a 'startxref'", KindInvalidInput},
+	{"/syntaxerror", KindInvalidInput},
+	{"Couldn't initialise file", KindInvalidInput},
+	// ImageMagick
+	{"no decode delegate", KindInvalidInput},
+	{"improper image header", KindInvalidInput},
+	// Tesseract
+	{"Failed loading language", KindInvalidInput},
+}
+
+func classifyOutput(output []byte) Kind {
+	for _, k := range toolOutputKinds {
+		if bytes.Contains(output, []byte(k.pattern)) {
+			return k.kind
+		}
+	}
+	return KindFailed
+}
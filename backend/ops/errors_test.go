@@ -0,0 +1,102 @@
+//go:build unix
+
+package ops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+func TestToolFailClassifies(t *testing.T) {
+	dir := t.TempDir()
+	run := func(ctx context.Context, script string) *Error {
+		output, err := runTool(ctx, dir, "sh", "-c", script)
+		if err == nil {
+			t.Fatalf("%q succeeded", script)
+		}
+		return toolFail(ctx, "test", "test failed", err, output).(*Error)
+	}
+
+	e := run(context.Background(), "echo 'GPL Ghostscript: VMerror in setfont'; exit 1")
+	if e.Kind != KindLimitExceeded || e.Tool != "sh" || e.ExitCode != 1 || len(e.Output) == 0 {
+		t.Errorf("VMerror: %+v", e)
+	}
+	if e := run(context.Background(), "echo 'This file requires a password for access.'; exit 1"); e.Kind != KindEncrypted {
+		t.Errorf("password prompt: %v", e.Kind)
+	}
+	if e := run(context.Background(), "kill -XFSZ $$"); e.Kind != KindLimitExceeded || e.ExitCode != -1 {
+		t.Errorf("SIGXFSZ: %v %d", e.Kind, e.ExitCode)
+	}
+	if e := run(context.Background(), "echo something else; exit 3"); e.Kind != KindFailed {
+		t.Errorf("unknown failure: %v", e.Kind)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if e := run(ctx, "sleep 10"); e.Kind != KindTimeout {
+		t.Errorf("deadline: %v", e.Kind)
+	}
+}
+
+func TestPasswordError(t *testing.T) {
+	dir := t.TempDir()
+	locked := filepath.Join(dir, "locked.pdf")
+	writeEncryptedPDF(t, locked, "secret")
+	if kind := KindOf(Unlock(context.Background(), locked, filepath.Join(dir, "out.pdf"), "guess")); kind != KindWrongPassword {
+		t.Errorf("unlock with the wrong password: %v", kind)
+	}
+	if err := Unlock(context.Background(), locked, filepath.Join(dir, "out.pdf"), "secret"); err != nil {
+		t.Errorf("unlock: %v", err)
+	}
+
+	if kind := KindOf(passwordError("unlock", "", nil)); kind != KindEncrypted {
+		t.Errorf("no password: %v", kind)
+	}
+	if kind := KindOf(passwordError("unlock", "secret", nil)); kind != KindWrongPassword {
+		t.Errorf("wrong password: %v", kind)
+	}
+}
+
+func TestFailKinds(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	invalid := invalidf("merge", "at least 2 files required")
+
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want Kind
+	}{
+		{"plain error", context.Background(), errors.New("boom"), KindFailed},
+		{"already classified", canceled, invalid, KindInvalidInput},
+		{"cancelled", canceled, errors.New("boom"), KindCanceled},
+		{"deadline", expired, errors.New("boom"), KindTimeout},
+		{"missing tool", context.Background(), &toolError{tool: "gs", err: exec.ErrNotFound}, KindToolUnavailable},
+		{"encrypted", context.Background(), fmt.Errorf("read: %w", pdfcpu.ErrWrongPassword), KindEncrypted},
+	} {
+		err := fail(tc.ctx, "test", "test failed", tc.err)
+		if kind := KindOf(err); kind != tc.want {
+			t.Errorf("%s: kind %v, want %v", tc.name, kind, tc.want)
+		}
+	}
+
+	if err := fail(context.Background(), "test", "test failed", invalid); err != invalid {
+		t.Errorf("classified error was rewrapped: %v", err)
+	}
+	if kind := KindOf(fmt.Errorf("wrapped: %w", invalid)); kind != KindInvalidInput {
+		t.Errorf("wrapped *Error: %v", kind)
+	}
+	if kind := KindOf(nil); kind != KindFailed {
+		t.Errorf("nil: %v", kind)
+	}
+}
@@ -0,0 +1,188 @@
+package ops
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// DocumentStats measures how much work a PDF can cause, read from its
+// structure without decoding content or rendering anything
+type DocumentStats struct {
+	Pages int `json:"pages"`
+	// MaxPageSide is the longest page edge, in points
+	MaxPageSide float64 `json:"maxPageSide"`
+	// PageArea is the area of all pages together, in square points
+	PageArea float64 `json:"pageArea"`
+	// ImagePixels is the decoded size of all embedded images together
+	ImagePixels int64 `json:"imagePixels"`
+	Objects     int   `json:"objects"`
+}
+
+// RenderPixels is how many pixels rasterizing every page at dpi produces
+func (s DocumentStats) RenderPixels(dpi int) int64 {
+	scale := float64(dpi) / 72
+	return int64(s.PageArea * scale * scale)
+}
+
+// InspectOptions controls Inspect
+type InspectOptions struct {
+	Password string // for encrypted documents
+	// MaxPages stops walking the page tree once exceeded, so a document
+	// declaring millions of pages is not enumerated; Pages is then
+	// MaxPages+1
+	MaxPages int
+}
+
+// Inspect reads the structure of the PDF in r and measures it. Documents
+// that cannot be parsed or decrypted are invalid input.
+func Inspect(ctx context.Context, r io.ReadSeeker, opts InspectOptions) (stats *DocumentStats, err error) {
+	// pdfcpu panics on some malformed structures; that is bad input too
+	defer func() {
+		if p := recover(); p != nil {
+			stats, err = nil, invalidf("inspect", "malformed PDF structure")
+		}
+	}()
+
+	conf := model.NewDefaultConfiguration()
+	conf.UserPW = opts.Password
+	conf.OwnerPW = opts.Password
+
+	pdf, err := pdfcpu.ReadWithContext(ctx, r, conf)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fail(ctx, "inspect", "inspection failed", err)
+		}
+		if errors.Is(err, pdfcpu.ErrWrongPassword) {
+			return nil, passwordError("inspect", opts.Password, err)
+		}
+		return nil, &Error{Op: "inspect", Kind: KindInvalidInput, Msg: "file is not a readable PDF", Err: err}
+	}
+
+	xref := pdf.XRefTable
+	stats = &DocumentStats{Objects: len(xref.Table)}
+
+	for _, entry := range xref.Table {
+		sd, ok := entry.Object.(types.StreamDict)
+		if !ok || sd.Subtype() == nil || *sd.Subtype() != "Image" {
+			continue
+		}
+		width, height := intValue(xref, sd.Dict["Width"]), intValue(xref, sd.Dict["Height"])
+		stats.ImagePixels = saturatingAdd(stats.ImagePixels, saturatingMul(width, height))
+	}
+
+	root, err := xref.Pages()
+	if err != nil || root == nil {
+		return nil, invalidf("inspect", "PDF has no page tree")
+	}
+	w := pageWalker{xref: xref, stats: stats, maxPages: opts.MaxPages, seen: make(map[int]bool)}
+	if err := w.walk(ctx, *root, nil); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+type pageWalker struct {
+	xref     *model.XRefTable
+	stats    *DocumentStats
+	maxPages int
+	seen     map[int]bool
+}
+
+// errEnoughPages stops the walk once the page limit is exceeded
+var errEnoughPages = errors.New("enough pages")
+
+func (w *pageWalker) walk(ctx context.Context, ref types.IndirectRef, inherited types.Array) error {
+	if err := w.visit(ctx, ref, inherited); err != nil && err != errEnoughPages {
+		return err
+	}
+	return nil
+}
+
+// visit counts the pages under ref, measuring their media boxes, which
+// are inherited down the tree. Nodes are visited once, so reference
+// cycles cannot loop.
+func (w *pageWalker) visit(ctx context.Context, ref types.IndirectRef, mediaBox types.Array) error {
+	nr := ref.ObjectNumber.Value()
+	if w.seen[nr] {
+		return nil
+	}
+	w.seen[nr] = true
+	if ctx.Err() != nil {
+		return fail(ctx, "inspect", "inspection failed", ctx.Err())
+	}
+
+	node, err := w.xref.DereferenceDict(ref)
+	if err != nil || node == nil {
+		return invalidf("inspect", "malformed page tree")
+	}
+	if box, err := w.xref.DereferenceArray(node["MediaBox"]); err == nil && len(box) == 4 {
+		mediaBox = box
+	}
+
+	kids, err := w.xref.DereferenceArray(node["Kids"])
+	if err != nil {
+		return invalidf("inspect", "malformed page tree")
+	}
+	if kids == nil {
+		w.stats.Pages++
+		if w.maxPages > 0 && w.stats.Pages > w.maxPages {
+			return errEnoughPages
+		}
+		if mediaBox != nil {
+			if rect, err := w.xref.RectForArray(mediaBox); err == nil {
+				width, height := math.Abs(rect.Width()), math.Abs(rect.Height())
+				w.stats.MaxPageSide = math.Max(w.stats.MaxPageSide, math.Max(width, height))
+				w.stats.PageArea += width * height
+			}
+		}
+		return nil
+	}
+
+	for _, kid := range kids {
+		kidRef, ok := kid.(types.IndirectRef)
+		if !ok {
+			return invalidf("inspect", "malformed page tree")
+		}
+		if err := w.visit(ctx, kidRef, mediaBox); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func intValue(xref *model.XRefTable, o types.Object) int64 {
+	obj, err := xref.Dereference(o)
+	if err != nil {
+		return 0
+	}
+	switch v := obj.(type) {
+	case types.Integer:
+		return int64(v.Value())
+	case types.Float:
+		return int64(v.Value())
+	}
+	return 0
+}
+
+func saturatingMul(a, b int64) int64 {
+	if a <= 0 || b <= 0 {
+		return 0
+	}
+	if a > math.MaxInt64/b {
+		return math.MaxInt64
+	}
+	return a * b
+}
+
+func saturatingAdd(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
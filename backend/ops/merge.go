@@ -0,0 +1,369 @@
+package ops
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// MergeInput is one source document of MergeDocuments
+type MergeInput struct {
+	Path string
+	// Name labels the source in bookmarks and the table of contents and
+	// is what SortName compares; it defaults to the base name of Path
+	Name string
+	// Pages lists the ranges to take, in order; empty takes every page
+	Pages []PageRange
+}
+
+// Orders for MergeOptions.Sort
+const (
+	SortGiven   = "given"   // as passed
+	SortName    = "name"    // by Name, numbers compared by value
+	SortCreated = "created" // by creation date in the document info, undated last
+)
+
+// MergeSorts lists the orders MergeDocuments accepts
+var MergeSorts = []string{SortGiven, SortName, SortCreated}
+
+// MergeOptions tunes MergeDocuments
+type MergeOptions struct {
+	Sort string // one of MergeSorts, default SortGiven
+	// Bookmarks adds a top-level outline entry for each source, named
+	// after it, with the source's own outline beneath
+	Bookmarks bool
+	// TableOfContents inserts pages in front listing every source and the
+	// page it starts on
+	TableOfContents bool
+}
+
+// tocLinesPerPage is how many sources one table of contents page lists
+const tocLinesPerPage = 40
+
+// Merge concatenates inputs into out, bookmarking each under its file name
+func Merge(ctx context.Context, inputs []string, out string) error {
+	sources := make([]MergeInput, len(inputs))
+	for i, in := range inputs {
+		sources[i] = MergeInput{Path: in}
+	}
+	return MergeDocuments(ctx, sources, out, MergeOptions{Bookmarks: true})
+}
+
+// MergeDocuments concatenates the selected pages of inputs into out
+func MergeDocuments(ctx context.Context, inputs []MergeInput, out string, opts MergeOptions) error {
+	if len(inputs) < 2 {
+		return invalidf("merge", "at least 2 files required")
+	}
+	sources, err := sortMergeInputs(inputs, opts.Sort)
+	if err != nil {
+		return err
+	}
+
+	dir, err := workDir(out, "merge")
+	if err != nil {
+		return fail(ctx, "merge", "merge failed", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// pdfcpu names the bookmark of each source after its file, so every
+	// source is staged under its name in a directory of its own
+	staged := make([]string, len(sources))
+	pageCounts := make([]int, len(sources))
+	for i, src := range sources {
+		staged[i], pageCounts[i], err = stageMergeInput(ctx, src, filepath.Join(dir, strconv.Itoa(i)))
+		if err != nil {
+			return err
+		}
+	}
+
+	conf := model.NewDefaultConfiguration()
+	conf.CreateBookmarks = opts.Bookmarks
+	merged := out
+	if opts.TableOfContents {
+		merged = filepath.Join(dir, "merged.pdf")
+	}
+	if err := api.MergeCreateFile(staged, merged, false, conf); err != nil {
+		return fail(ctx, "merge", "merge failed", err)
+	}
+	if opts.TableOfContents {
+		names := make([]string, len(sources))
+		for i, src := range sources {
+			names[i] = src.Name
+		}
+		return addTableOfContents(ctx, merged, out, names, pageCounts)
+	}
+	return nil
+}
+
+// sortMergeInputs returns a copy of inputs with names filled in, in order
+func sortMergeInputs(inputs []MergeInput, order string) ([]MergeInput, error) {
+	sources := make([]MergeInput, len(inputs))
+	for i, in := range inputs {
+		if in.Name == "" {
+			in.Name = in.Path
+		}
+		in.Name = filepath.Base(in.Name)
+		if in.Name == "." || in.Name == ".." || in.Name == string(filepath.Separator) {
+			in.Name = "document.pdf"
+		}
+		sources[i] = in
+	}
+
+	switch order {
+	case "", SortGiven:
+	case SortName:
+		sort.SliceStable(sources, func(i, j int) bool { return naturalLess(sources[i].Name, sources[j].Name) })
+	case SortCreated:
+		dates := make([]time.Time, len(sources))
+		for i, src := range sources {
+			dates[i] = creationDate(src.Path)
+		}
+		index := make([]int, len(sources))
+		for i := range index {
+			index[i] = i
+		}
+		sort.SliceStable(index, func(i, j int) bool {
+			a, b := dates[index[i]], dates[index[j]]
+			if a.IsZero() || b.IsZero() {
+				return !a.IsZero()
+			}
+			return a.Before(b)
+		})
+		sorted := make([]MergeInput, len(sources))
+		for i, k := range index {
+			sorted[i] = sources[k]
+		}
+		sources = sorted
+	default:
+		return nil, invalidf("merge", "unknown sort order %q", order)
+	}
+	return sources, nil
+}
+
+// stageMergeInput writes the selected pages of src to dir/<name> and
+// returns the path and its page count
+func stageMergeInput(ctx context.Context, src MergeInput, dir string) (string, int, error) {
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return "", 0, fail(ctx, "merge", "merge failed", err)
+	}
+	staged := filepath.Join(dir, src.Name)
+
+	count, err := api.PageCountFile(src.Path)
+	if err != nil {
+		return "", 0, fail(ctx, "merge", fmt.Sprintf("failed to read %s", src.Name), err)
+	}
+	if len(src.Pages) == 0 {
+		if err := os.Link(src.Path, staged); err != nil {
+			if err := copyFile(src.Path, staged); err != nil {
+				return "", 0, fail(ctx, "merge", "merge failed", err)
+			}
+		}
+		return staged, count, nil
+	}
+
+	var selection []string
+	selected := 0
+	for _, rng := range src.Pages {
+		if rng.Start < 1 || rng.End < rng.Start {
+			return "", 0, invalidf("merge", "%s: invalid range %d-%d", src.Name, rng.Start, rng.End)
+		}
+		if rng.End > count {
+			return "", 0, invalidf("merge", "%s: range %d-%d is beyond its %d pages", src.Name, rng.Start, rng.End, count)
+		}
+		selection = append(selection, fmt.Sprintf("%d-%d", rng.Start, rng.End))
+		selected += rng.End - rng.Start + 1
+	}
+	if err := api.CollectFile(src.Path, staged, selection, nil); err != nil {
+		return "", 0, fail(ctx, "merge", fmt.Sprintf("failed to select pages of %s", src.Name), err)
+	}
+	return staged, selected, nil
+}
+
+// creationDate reads the creation date from the document info of path;
+// it is zero if the document has none or cannot be read
+func creationDate(path string) time.Time {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}
+	}
+	defer f.Close()
+
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+	pdfCtx, err := api.ReadAndValidate(f, conf)
+	if err != nil {
+		return time.Time{}
+	}
+	// Dates from XMP metadata come as RFC 3339
+	if t, ok := types.DateTime(pdfCtx.CreationDate, true); ok {
+		return t
+	}
+	t, _ := time.Parse(time.RFC3339Nano, pdfCtx.CreationDate)
+	return t
+}
+
+// naturalLess compares names case-insensitively with runs of digits
+// compared by value, so "scan2" sorts before "scan10"
+func naturalLess(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	for a != "" && b != "" {
+		da, db := leadingDigits(a), leadingDigits(b)
+		if da != "" && db != "" {
+			na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+// addTableOfContents writes in to out with blank pages in front that list
+// each source and the page it starts on
+func addTableOfContents(ctx context.Context, in, out string, names []string, pageCounts []int) error {
+	tocPages := (len(names) + tocLinesPerPage - 1) / tocLinesPerPage
+	lines := tocLines(names, pageCounts, tocPages)
+
+	if err := copyFile(in, out); err != nil {
+		return fail(ctx, "merge", "merge failed", err)
+	}
+	// Inserted pages take the size of the page they precede
+	for i := 0; i < tocPages; i++ {
+		if err := api.InsertPagesFile(out, "", []string{"1"}, true, nil); err != nil {
+			return fail(ctx, "merge", "failed to add table of contents", err)
+		}
+	}
+
+	// Courier keeps the page numbers in a column
+	desc := "font:Courier, points:10, scale:1 abs, pos:tl, offset:40 -40, aligntext:left, rotation:0, color:0 0 0"
+	for page := 0; page < tocPages; page++ {
+		text := strings.Join(lines[page*tocLinesPerPage:min((page+1)*tocLinesPerPage, len(lines))], "\n")
+		if page == 0 {
+			text = "Contents\n\n" + text
+		}
+		if err := api.AddTextWatermarksFile(out, "", []string{strconv.Itoa(page + 1)}, true, text, desc, nil); err != nil {
+			return fail(ctx, "merge", "failed to add table of contents", err)
+		}
+	}
+	return nil
+}
+
+// tocLines lists each source with the page it starts on after tocPages
+// pages of contents. Courier only has the WinAnsi characters, so sources
+// whose names need others are listed by position instead.
+func tocLines(names []string, pageCounts []int, tocPages int) []string {
+	lines := make([]string, len(names))
+	start := tocPages + 1
+	for i, name := range names {
+		if !inWinAnsi(name) {
+			name = fmt.Sprintf("document %d", i+1)
+		}
+		lines[i] = tocLine(name, start)
+		start += pageCounts[i]
+	}
+	return lines
+}
+
+// winAnsiExtras are the characters WinAnsiEncoding puts at 0x80-0x9F
+const winAnsiExtras = "€‚ƒ„…†‡ˆ‰Š‹ŒŽ‘’“”•–—˜™š›œžŸ"
+
+// inWinAnsi reports whether the standard PDF fonts can show all of s
+func inWinAnsi(s string) bool {
+	for _, r := range s {
+		if (r < 0x20 || r > 0x7e) && (r < 0xa0 || r > 0xff) && !strings.ContainsRune(winAnsiExtras, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// tocLine is "name ..... page" in tocLineWidth characters
+func tocLine(name string, page int) string {
+	const tocLineWidth = 64
+	number := strconv.Itoa(page)
+	room := tocLineWidth - len(number) - 2
+	if runes := []rune(name); len(runes) > room {
+		name = string(runes[:room-3]) + "..."
+	}
+	dots := room - len([]rune(name))
+	return name + " " + strings.Repeat(".", dots) + " " + number
+}
+
+// InterleaveOptions tunes Interleave
+type InterleaveOptions struct {
+	// ReverseBack takes the back pages last to first, as a scanner
+	// delivers them when the stack is turned over
+	ReverseBack bool
+}
+
+// Interleave merges the two halves of a duplex scan into out: front page
+// 1, back page 1, front page 2 and so on, after selecting the pages of
+// each. If one input has more pages, those without a partner follow at
+// the end; Interleave returns how many there were.
+func Interleave(ctx context.Context, front, back MergeInput, out string, opts InterleaveOptions) (int, error) {
+	sources, err := sortMergeInputs([]MergeInput{front, back}, SortGiven)
+	if err != nil {
+		return 0, err
+	}
+	dir, err := workDir(out, "interleave")
+	if err != nil {
+		return 0, fail(ctx, "merge", "merge failed", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var staged [2]string
+	var pageCounts [2]int
+	for i, src := range sources {
+		staged[i], pageCounts[i], err = stageMergeInput(ctx, src, filepath.Join(dir, strconv.Itoa(i)))
+		if err != nil {
+			return 0, err
+		}
+	}
+	if opts.ReverseBack {
+		reversed := make([]string, pageCounts[1])
+		for i := range reversed {
+			reversed[i] = strconv.Itoa(pageCounts[1] - i)
+		}
+		backPath := filepath.Join(dir, "back-reversed.pdf")
+		if err := api.CollectFile(staged[1], backPath, reversed, nil); err != nil {
+			return 0, fail(ctx, "merge", "failed to reverse "+sources[1].Name, err)
+		}
+		staged[1] = backPath
+	}
+
+	// pdfcpu weaves the pages pairwise and appends what is left
+	if err := api.MergeCreateZipFile(staged[0], staged[1], out, nil); err != nil {
+		return 0, fail(ctx, "merge", "merge failed", err)
+	}
+	unpaired := pageCounts[0] - pageCounts[1]
+	if unpaired < 0 {
+		unpaired = -unpaired
+	}
+	return unpaired, nil
+}
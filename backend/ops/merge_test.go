@@ -0,0 +1,222 @@
+package ops
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// writeTestPDF writes a PDF whose page i is 100+first+i points wide, so
+// pages can be told apart after merging. created sets the creation date.
+func writeTestPDF(t *testing.T, path string, first, pages int, created string) {
+	t.Helper()
+	objects := []string{"<< /Type /Catalog /Pages 2 0 R >>", ""}
+	kids := ""
+	for i := 0; i < pages; i++ {
+		kids += fmt.Sprintf("%d 0 R ", len(objects)+1)
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d 200] /Resources << >> >>", 100+first+i))
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids, pages)
+	info := ""
+	if created != "" {
+		objects = append(objects, fmt.Sprintf("<< /CreationDate (%s) >>", created))
+		info = fmt.Sprintf(" /Info %d 0 R", len(objects))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R%s >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, info, xref)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pageWidths returns the width of every page of path
+func pageWidths(t *testing.T, path string) []int {
+	t.Helper()
+	dims, err := api.PageDimsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	widths := make([]int, len(dims))
+	for i, dim := range dims {
+		widths[i] = int(dim.Width)
+	}
+	return widths
+}
+
+func TestMergeDocuments(t *testing.T) {
+	dir := t.TempDir()
+	a, b, c := filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c")
+	writeTestPDF(t, a, 0, 6, "D:20240301120000Z")
+	writeTestPDF(t, b, 10, 2, "D:20230101120000Z")
+	writeTestPDF(t, c, 20, 1, "")
+	out := filepath.Join(dir, "out.pdf")
+
+	// Pages 2-5 of one file plus all of another, in the given order
+	err := MergeDocuments(context.Background(), []MergeInput{
+		{Path: a, Name: "scan10.pdf", Pages: []PageRange{{Start: 2, End: 3}, {Start: 5, End: 5}}},
+		{Path: b, Name: "scan2.pdf"},
+	}, out, MergeOptions{Bookmarks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(pageWidths(t, out)); got != "[101 102 104 110 111]" {
+		t.Errorf("pages = %s", got)
+	}
+	f, _ := os.Open(out)
+	bookmarks, err := api.Bookmarks(f, nil)
+	f.Close()
+	if err != nil || len(bookmarks) != 2 || bookmarks[0].Title != "scan10.pdf" || bookmarks[1].Title != "scan2.pdf" || bookmarks[1].PageFrom != 4 {
+		t.Errorf("bookmarks = %+v, %v", bookmarks, err)
+	}
+
+	// Natural name order puts scan2 first, creation date puts b first and
+	// the undated c last
+	inputs := []MergeInput{{Path: c, Name: "scan10.pdf"}, {Path: a, Name: "Scan9.pdf"}, {Path: b, Name: "scan2.pdf"}}
+	for sort, want := range map[string]string{
+		SortName:    "[110 111 100 101 102 103 104 105 120]",
+		SortCreated: "[110 111 100 101 102 103 104 105 120]",
+		SortGiven:   "[120 100 101 102 103 104 105 110 111]",
+	} {
+		if err := MergeDocuments(context.Background(), inputs, out, MergeOptions{Sort: sort}); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(pageWidths(t, out)); got != want {
+			t.Errorf("sort %s: pages = %s, want %s", sort, got, want)
+		}
+	}
+
+	// The table of contents goes in front
+	if err := MergeDocuments(context.Background(), inputs[1:], out, MergeOptions{TableOfContents: true}); err != nil {
+		t.Fatal(err)
+	}
+	if widths := pageWidths(t, out); len(widths) != 9 || widths[1] != 100 {
+		t.Errorf("with table of contents: pages = %v", widths)
+	}
+
+	err = MergeDocuments(context.Background(), []MergeInput{{Path: a, Pages: []PageRange{{Start: 5, End: 7}}}, {Path: b}}, out, MergeOptions{})
+	if KindOf(err) != KindInvalidInput {
+		t.Errorf("range beyond the last page: %v", err)
+	}
+	if err := MergeDocuments(context.Background(), inputs, out, MergeOptions{Sort: "size"}); KindOf(err) != KindInvalidInput {
+		t.Errorf("unknown sort: %v", err)
+	}
+}
+
+// writeEncryptedPDF writes a test PDF that only opens with password
+func writeEncryptedPDF(t *testing.T, path, password string) {
+	t.Helper()
+	plain := path + ".plain"
+	writeTestPDF(t, plain, 0, 2, "")
+	if err := Protect(context.Background(), plain, path, password); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	dir := t.TempDir()
+	a, locked := filepath.Join(dir, "a.pdf"), filepath.Join(dir, "locked.pdf")
+	writeTestPDF(t, a, 0, 2, "")
+	writeEncryptedPDF(t, locked, "secret")
+	out := filepath.Join(dir, "out.pdf")
+
+	if err := Merge(context.Background(), []string{a}, out); KindOf(err) != KindInvalidInput {
+		t.Errorf("single input: %v", err)
+	}
+	if err := Merge(context.Background(), []string{a, locked}, out); KindOf(err) != KindEncrypted {
+		t.Errorf("encrypted input: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := Merge(ctx, []string{a, filepath.Join(dir, "missing.pdf")}, out)
+	var e *Error
+	if !errors.As(err, &e) || e.Kind != KindCanceled || e.Op != "merge" {
+		t.Errorf("cancelled: %#v", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("failed merges left %s behind", filepath.Base(out))
+	}
+}
+
+func TestTOCLines(t *testing.T) {
+	lines := tocLines([]string{"Résumé – 2024.pdf", "報告書.pdf", "Ωmega.pdf"}, []int{2, 3, 1}, 1)
+	want := []string{"Résumé – 2024.pdf", "document 2", "document 3"}
+	for i, line := range lines {
+		name := strings.TrimRight(strings.TrimRight(line, "0123456789"), " .")
+		if name != want[i] {
+			t.Errorf("line %d = %q, want %s", i+1, line, want[i])
+		}
+	}
+	if !strings.HasSuffix(lines[0], " 2") || !strings.HasSuffix(lines[1], " 4") || !strings.HasSuffix(lines[2], " 7") {
+		t.Errorf("start pages: %q", lines)
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		less bool
+	}{
+		{"scan2.pdf", "scan10.pdf", true},
+		{"scan10.pdf", "scan2.pdf", false},
+		{"Invoice.pdf", "appendix.pdf", false},
+		{"page007", "page7b", true},
+		{"a", "a", false},
+	} {
+		if got := naturalLess(tc.a, tc.b); got != tc.less {
+			t.Errorf("naturalLess(%q, %q) = %v", tc.a, tc.b, got)
+		}
+	}
+}
+
+func TestInterleave(t *testing.T) {
+	dir := t.TempDir()
+	front, back := filepath.Join(dir, "front.pdf"), filepath.Join(dir, "back.pdf")
+	writeTestPDF(t, front, 0, 3, "")
+	writeTestPDF(t, back, 10, 3, "")
+	out := filepath.Join(dir, "out.pdf")
+
+	unpaired, err := Interleave(context.Background(), MergeInput{Path: front}, MergeInput{Path: back}, out, InterleaveOptions{ReverseBack: true})
+	if err != nil || unpaired != 0 {
+		t.Fatalf("unpaired %d, %v", unpaired, err)
+	}
+	if got := fmt.Sprint(pageWidths(t, out)); got != "[100 112 101 111 102 110]" {
+		t.Errorf("reversed back: pages = %s", got)
+	}
+
+	// Unpaired pages of the longer input follow at the end
+	for _, tc := range []struct {
+		front, back MergeInput
+		want        string
+	}{
+		{MergeInput{Path: front}, MergeInput{Path: back, Pages: []PageRange{{Start: 1, End: 1}}}, "[100 110 101 102]"},
+		{MergeInput{Path: front, Pages: []PageRange{{Start: 1, End: 1}}}, MergeInput{Path: back}, "[100 110 111 112]"},
+	} {
+		unpaired, err := Interleave(context.Background(), tc.front, tc.back, out, InterleaveOptions{})
+		if err != nil || unpaired != 2 {
+			t.Fatalf("unpaired %d, %v", unpaired, err)
+		}
+		if got := fmt.Sprint(pageWidths(t, out)); got != tc.want {
+			t.Errorf("pages = %s, want %s", got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package ops implements the document operations behind the PDF API as
+// plain functions over files, so they can run in-process without HTTP.
+//
+// Every function takes a context; cancelling it kills any external tool
+// (Ghostscript, LibreOffice, ImageMagick, ...) still running. Failures are
+// returned as *Error, whose Kind tells bad input, encrypted PDFs and
+// resource limits apart from missing tools, timeouts and processing
+// failures.
+package ops
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Logf receives warnings about steps that failed but had a fallback.
+// Replace it to silence or redirect them.
+var Logf = log.Printf
+
+// workDir creates a scratch directory next to out, so results can be
+// renamed into place without crossing filesystems
+func workDir(out, prefix string) (string, error) {
+	return os.MkdirTemp(filepath.Dir(out), prefix+"-")
+}
+
+// findFileWithExt returns the first file in dir ending in ext
+func findFileWithExt(dir, ext string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(strings.ToLower(entry.Name()), ext) {
+			return filepath.Join(dir, entry.Name())
+		}
+	}
+	return ""
+}
+
+// moveFile renames src to dst, copying when they are on different devices
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	return copyFile(src, dst)
+}
+
+func copyFile(src, dst string) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	dest, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	_, err = io.Copy(dest, source)
+	return err
+}
+
+// pageSelection turns page numbers into pdfcpu selection strings
+func pageSelection(pages []int) []string {
+	var selection []string
+	for _, p := range pages {
+		selection = append(selection, strconv.Itoa(p))
+	}
+	return selection
+}
+
+func checkPages(op string, pages []int) error {
+	if len(pages) == 0 {
+		return invalidf(op, "no pages specified")
+	}
+	for _, p := range pages {
+		if p < 1 {
+			return invalidf(op, "invalid page number %d", p)
+		}
+	}
+	return nil
+}
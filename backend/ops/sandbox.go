@@ -0,0 +1,135 @@
+package ops
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Isolation is how strictly an external tool is confined
+type Isolation string
+
+const (
+	// IsolationNone runs the tool directly with the rights of this process
+	IsolationNone Isolation = "none"
+	// IsolationLimits applies resource limits and a private scratch HOME
+	// and TMPDIR, but no namespaces
+	IsolationLimits Isolation = "limits"
+	// IsolationStrict adds Linux namespaces (user, mount, PID, IPC, UTS and
+	// an empty network), a read-only filesystem except for the scratch
+	// directory, no capabilities and a seccomp filter
+	IsolationStrict Isolation = "strict"
+)
+
+// ParseIsolation validates an isolation level name
+func ParseIsolation(s string) (Isolation, error) {
+	switch level := Isolation(strings.ToLower(strings.TrimSpace(s))); level {
+	case IsolationNone, IsolationLimits, IsolationStrict:
+		return level, nil
+	}
+	return "", fmt.Errorf("unknown isolation level %q (want none, limits or strict)", s)
+}
+
+// SandboxPolicy confines one tool. Zero limits are not enforced.
+type SandboxPolicy struct {
+	Isolation Isolation
+	CPUTime   time.Duration // RLIMIT_CPU
+	Memory    int64         // RLIMIT_AS, in bytes
+	FileSize  int64         // RLIMIT_FSIZE, in bytes
+}
+
+// SandboxConfig picks the policy for each tool
+type SandboxConfig struct {
+	Default SandboxPolicy
+	// Isolation overrides the default level per tool name, e.g. "gs" or
+	// "libreoffice"
+	Isolation map[string]Isolation
+}
+
+// Policy returns the policy tool runs under
+func (c SandboxConfig) Policy(tool string) SandboxPolicy {
+	policy := c.Default
+	if level, ok := c.Isolation[tool]; ok {
+		policy.Isolation = level
+	}
+	if policy.Isolation == "" {
+		policy.Isolation = IsolationNone
+	}
+	return policy
+}
+
+// Sandbox confines the external tools operations run. The zero value runs
+// them directly; servers handling untrusted documents should set it at
+// startup, after checking the host supports the level with CheckSandbox.
+var Sandbox SandboxConfig
+
+// sandboxEnv carries the sandboxSpec to the re-executed helper process
+const sandboxEnv = "PDFPAL_SANDBOX"
+
+// sandboxSpec is what the helper needs to confine a tool before it
+// replaces itself with it
+type sandboxSpec struct {
+	Isolation Isolation `json:"isolation"`
+	CPUTime   int64     `json:"cpuSeconds,omitempty"`
+	Memory    int64     `json:"memory,omitempty"`
+	FileSize  int64     `json:"fileSize,omitempty"`
+	// Scratch is the only writable directory under strict isolation
+	Scratch string `json:"scratch"`
+	// Probe checks the confinement and exits instead of running a tool
+	Probe bool `json:"probe,omitempty"`
+}
+
+func newSandboxSpec(policy SandboxPolicy, scratch string) (sandboxSpec, error) {
+	abs, err := filepath.Abs(scratch)
+	if err != nil {
+		return sandboxSpec{}, err
+	}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		return sandboxSpec{}, fmt.Errorf("sandbox scratch directory %s is not a directory", scratch)
+	}
+	cpu := int64(policy.CPUTime / time.Second)
+	if policy.CPUTime > 0 && cpu == 0 {
+		cpu = 1
+	}
+	return sandboxSpec{
+		Isolation: policy.Isolation,
+		CPUTime:   cpu,
+		Memory:    policy.Memory,
+		FileSize:  policy.FileSize,
+		Scratch:   abs,
+	}, nil
+}
+
+// CheckSandbox reports whether this host can confine tools at level, by
+// starting the sandbox with a probe instead of a tool
+func CheckSandbox(level Isolation) error {
+	if level == IsolationNone {
+		return nil
+	}
+	dir, err := os.MkdirTemp("", "sandbox-probe-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	spec, err := newSandboxSpec(SandboxPolicy{Isolation: level}, dir)
+	if err != nil {
+		return err
+	}
+	spec.Probe = true
+	cmd, err := sandboxCommand(context.Background(), spec, "sandbox-probe", "", nil)
+	if err != nil {
+		return err
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if msg := bytes.TrimSpace(output); len(msg) > 0 {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
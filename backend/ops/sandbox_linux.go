@@ -0,0 +1,194 @@
+//go:build linux
+
+package ops
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Sandboxed tools are started through this same binary: the child sees
+// sandboxEnv, confines itself and then execs the tool, so the limits and
+// filters are in place before the tool reads a byte of input. This must
+// run before main, hence init.
+func init() {
+	if encoded := os.Getenv(sandboxEnv); encoded != "" {
+		os.Exit(sandboxMain(encoded))
+	}
+}
+
+// sandboxCommand starts path as name inside the sandbox described by spec
+func sandboxCommand(ctx context.Context, spec sandboxSpec, name, path string, args []string) (*exec.Cmd, error) {
+	encoded, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "/proc/self/exe")
+	cmd.Args = append([]string{name, path}, args...)
+	cmd.Env = append(toolEnv(spec.Scratch), sandboxEnv+"="+string(encoded))
+
+	if spec.Isolation == IsolationStrict {
+		uid, gid := os.Getuid(), os.Getgid()
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Cloneflags: unix.CLONE_NEWUSER | unix.CLONE_NEWNS | unix.CLONE_NEWPID |
+				unix.CLONE_NEWNET | unix.CLONE_NEWIPC | unix.CLONE_NEWUTS,
+			UidMappings: []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}},
+			GidMappings: []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}},
+			// Needed to set up the mounts; dropped before the tool starts
+			AmbientCaps: []uintptr{unix.CAP_SYS_ADMIN, unix.CAP_SETPCAP},
+		}
+	}
+	return cmd, nil
+}
+
+// sandboxMain runs in the helper child. It only returns on failure, with
+// the exit status for the parent.
+func sandboxMain(encoded string) int {
+	// Capabilities, no_new_privs and seccomp are per thread; the exec
+	// below must happen on the thread they were applied to
+	runtime.LockOSThread()
+
+	failf := func(format string, args ...interface{}) int {
+		fmt.Fprintf(os.Stderr, "sandbox: "+format+"\n", args...)
+		return 125
+	}
+
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(encoded), &spec); err != nil {
+		return failf("invalid spec: %v", err)
+	}
+
+	strict := spec.Isolation == IsolationStrict
+	if strict {
+		if err := confineFilesystem(spec.Scratch); err != nil {
+			return failf("%v", err)
+		}
+	}
+	if err := setLimits(spec); err != nil {
+		return failf("setting resource limits: %v", err)
+	}
+	if strict {
+		if err := dropCapabilities(); err != nil {
+			return failf("dropping capabilities: %v", err)
+		}
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return failf("setting no_new_privs: %v", err)
+	}
+	if strict {
+		if err := installSeccomp(); err != nil {
+			return failf("installing seccomp filter: %v", err)
+		}
+	}
+
+	if spec.Probe {
+		if err := probeSandbox(spec); err != nil {
+			return failf("%v", err)
+		}
+		return 0
+	}
+	if len(os.Args) < 2 {
+		return failf("no tool given")
+	}
+	err := syscall.Exec(os.Args[1], append([]string{os.Args[0]}, os.Args[2:]...), toolEnv(spec.Scratch))
+	return failf("starting %s: %v", os.Args[0], err)
+}
+
+// confineFilesystem makes everything but scratch read-only. It runs in a
+// fresh mount namespace, so none of this is visible outside.
+func confineFilesystem(scratch string) error {
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("making mounts private: %w", err)
+	}
+	if err := unix.Mount(scratch, scratch, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("binding scratch directory: %w", err)
+	}
+	// A /proc for the new PID namespace. Hosts that mask parts of /proc
+	// (e.g. Docker) refuse this; the host /proc is then kept read-only.
+	unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "")
+
+	readOnly := &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY | unix.MOUNT_ATTR_NOSUID}
+	if err := unix.MountSetattr(unix.AT_FDCWD, "/", unix.AT_RECURSIVE, readOnly); err != nil {
+		return fmt.Errorf("making the filesystem read-only (needs Linux 5.12+): %w", err)
+	}
+	writable := &unix.MountAttr{Attr_clr: unix.MOUNT_ATTR_RDONLY}
+	if err := unix.MountSetattr(unix.AT_FDCWD, scratch, unix.AT_RECURSIVE, writable); err != nil {
+		return fmt.Errorf("making scratch directory writable: %w", err)
+	}
+
+	// Python's multiprocessing (ocrmypdf) needs a writable /dev/shm
+	if _, err := os.Stat("/dev/shm"); err == nil {
+		if err := unix.Mount("tmpfs", "/dev/shm", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "size=64m"); err != nil {
+			return fmt.Errorf("mounting /dev/shm: %w", err)
+		}
+	}
+	return nil
+}
+
+func setLimits(spec sandboxSpec) error {
+	limits := []struct {
+		resource int
+		value    int64
+	}{
+		{unix.RLIMIT_CPU, spec.CPUTime},
+		{unix.RLIMIT_AS, spec.Memory},
+		{unix.RLIMIT_FSIZE, spec.FileSize},
+	}
+	for _, l := range limits {
+		if l.value <= 0 {
+			continue
+		}
+		var current unix.Rlimit
+		if err := unix.Getrlimit(l.resource, &current); err != nil {
+			return err
+		}
+		// Never raise a limit the server already runs under
+		value := min(uint64(l.value), current.Max)
+		if err := unix.Setrlimit(l.resource, &unix.Rlimit{Cur: value, Max: value}); err != nil {
+			return err
+		}
+	}
+	return unix.Setrlimit(unix.RLIMIT_CORE, &unix.Rlimit{})
+}
+
+// dropCapabilities empties every capability set, including the bounding
+// set, so the tool cannot regain them by exec
+func dropCapabilities() error {
+	for c := 0; c < 64; c++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil && !errors.Is(err, unix.EINVAL) {
+			return err
+		}
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return err
+	}
+	var data [2]unix.CapUserData
+	return unix.Capset(&unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}, &data[0])
+}
+
+// probeSandbox checks the scratch directory is writable and, under strict
+// isolation, that its parent is not
+func probeSandbox(spec sandboxSpec) error {
+	if err := os.WriteFile(filepath.Join(spec.Scratch, "probe"), nil, 0644); err != nil {
+		return fmt.Errorf("scratch directory not writable: %w", err)
+	}
+	if spec.Isolation != IsolationStrict {
+		return nil
+	}
+	outside := filepath.Join(filepath.Dir(spec.Scratch), "sandbox-escape-probe")
+	if err := os.WriteFile(outside, nil, 0644); err == nil {
+		os.Remove(outside)
+		return fmt.Errorf("%s is writable", filepath.Dir(spec.Scratch))
+	}
+	return nil
+}
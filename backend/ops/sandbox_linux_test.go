@@ -0,0 +1,73 @@
+package ops
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withSandbox(t *testing.T, policy SandboxPolicy) {
+	t.Helper()
+	if err := CheckSandbox(policy.Isolation); err != nil {
+		t.Skipf("%s sandbox unavailable here: %v", policy.Isolation, err)
+	}
+	old := Sandbox
+	Sandbox = SandboxConfig{Default: policy}
+	t.Cleanup(func() { Sandbox = old })
+}
+
+func TestStrictSandbox(t *testing.T) {
+	withSandbox(t, SandboxPolicy{Isolation: IsolationStrict, CPUTime: 7 * time.Second, FileSize: 1 << 20})
+
+	parent := t.TempDir()
+	scratch := filepath.Join(parent, "scratch")
+	os.Mkdir(scratch, 0755)
+
+	script := `
+		echo ok > "$HOME/inside" || echo "scratch not writable"
+		touch ../outside 2>/dev/null && echo "parent writable"
+		[ "$(ulimit -t)" = 7 ] || echo "cpu limit $(ulimit -t)"
+		grep -v -e lo: -e Inter -e face /proc/net/dev
+		unshare -r true 2>/dev/null && echo "unshare allowed"
+		exit 0`
+	cmd, err := toolCommand(context.Background(), scratch, "sh", []string{"-c", script})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Dir = scratch
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+	if problems := strings.TrimSpace(string(output)); problems != "" {
+		t.Errorf("sandbox leaks:\n%s", problems)
+	}
+	if _, err := os.Stat(filepath.Join(scratch, "inside")); err != nil {
+		t.Errorf("scratch write lost: %v", err)
+	}
+}
+
+func TestSandboxedToolFailures(t *testing.T) {
+	withSandbox(t, SandboxPolicy{Isolation: IsolationLimits})
+	dir := t.TempDir()
+
+	// Missing tools are still reported as unavailable
+	_, err := runTool(context.Background(), dir, "no-such-converter")
+	if KindOf(fail(context.Background(), "test", "failed", err)) != KindToolUnavailable {
+		t.Errorf("missing tool: %v", err)
+	}
+
+	// Cancelling kills the sandboxed tool
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := runTool(ctx, dir, "sleep", "30"); err == nil {
+		t.Error("sleep was not killed")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cancel took %v", elapsed)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package ops
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+)
+
+func sandboxCommand(ctx context.Context, spec sandboxSpec, name, path string, args []string) (*exec.Cmd, error) {
+	return nil, errors.New("sandboxed tools need Linux; set the isolation level to none")
+}
@@ -0,0 +1,25 @@
+package ops
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSandboxConfigPolicy(t *testing.T) {
+	c := SandboxConfig{
+		Default:   SandboxPolicy{Isolation: IsolationStrict, CPUTime: time.Minute},
+		Isolation: map[string]Isolation{"libreoffice": IsolationLimits},
+	}
+	if p := c.Policy("gs"); p.Isolation != IsolationStrict || p.CPUTime != time.Minute {
+		t.Errorf("gs policy = %+v", p)
+	}
+	if p := c.Policy("libreoffice"); p.Isolation != IsolationLimits || p.CPUTime != time.Minute {
+		t.Errorf("libreoffice policy = %+v", p)
+	}
+	if p := (SandboxConfig{}).Policy("gs"); p.Isolation != IsolationNone {
+		t.Errorf("zero config policy = %+v", p)
+	}
+	if _, err := ParseIsolation("paranoid"); err == nil {
+		t.Error("unknown level accepted")
+	}
+}
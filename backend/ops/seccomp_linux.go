@@ -0,0 +1,94 @@
+//go:build linux && (amd64 || arm64)
+
+package ops
+
+import (
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// deniedSyscalls are refused with EPERM inside the strict sandbox. None
+// of the converters need them; they are the usual ways out of a sandbox
+// or into the kernel's less exercised code.
+var deniedSyscalls = []uint32{
+	unix.SYS_MOUNT, unix.SYS_UMOUNT2, unix.SYS_PIVOT_ROOT, unix.SYS_CHROOT,
+	unix.SYS_MOUNT_SETATTR, unix.SYS_MOVE_MOUNT, unix.SYS_OPEN_TREE,
+	unix.SYS_FSOPEN, unix.SYS_FSCONFIG, unix.SYS_FSMOUNT, unix.SYS_FSPICK,
+	unix.SYS_UNSHARE, unix.SYS_SETNS, unix.SYS_PTRACE,
+	unix.SYS_PROCESS_VM_READV, unix.SYS_PROCESS_VM_WRITEV,
+	unix.SYS_KEXEC_LOAD, unix.SYS_INIT_MODULE, unix.SYS_FINIT_MODULE, unix.SYS_DELETE_MODULE,
+	unix.SYS_BPF, unix.SYS_PERF_EVENT_OPEN, unix.SYS_USERFAULTFD,
+	unix.SYS_KEYCTL, unix.SYS_ADD_KEY, unix.SYS_REQUEST_KEY,
+	unix.SYS_OPEN_BY_HANDLE_AT, unix.SYS_REBOOT, unix.SYS_SWAPON, unix.SYS_SWAPOFF, unix.SYS_ACCT,
+}
+
+// Namespace flags clone must not be given, so the tool cannot build a
+// sandbox of its own with fresh capabilities
+const cloneNamespaceFlags = unix.CLONE_NEWUSER | unix.CLONE_NEWNS | unix.CLONE_NEWPID |
+	unix.CLONE_NEWNET | unix.CLONE_NEWIPC | unix.CLONE_NEWUTS | unix.CLONE_NEWCGROUP
+
+var seccompArch = map[string]uint32{
+	"amd64": unix.AUDIT_ARCH_X86_64,
+	"arm64": unix.AUDIT_ARCH_AARCH64,
+}[runtime.GOARCH]
+
+// Classic BPF opcodes and seccomp return values
+const (
+	bpfLoad    = unix.BPF_LD | unix.BPF_W | unix.BPF_ABS
+	bpfJumpEq  = unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K
+	bpfJumpGE  = unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K
+	bpfJumpSet = unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K
+	bpfReturn  = unix.BPF_RET | unix.BPF_K
+
+	seccompAllow = 0x7fff0000
+	seccompKill  = 0x80000000 // SECCOMP_RET_KILL_PROCESS
+	seccompErrno = 0x00050000
+
+	// Offsets into struct seccomp_data
+	offsetNr   = 0
+	offsetArch = 4
+	offsetArg0 = 16 // low 32 bits on little-endian
+)
+
+// seccompFilter builds the BPF program: wrong architecture or the x32
+// ABI kills, denied calls and namespace-creating clones get EPERM, clone3
+// gets ENOSYS so libc falls back to clone, everything else is allowed
+func seccompFilter() []unix.SockFilter {
+	stmt := func(code uint16, k uint32) unix.SockFilter { return unix.SockFilter{Code: code, K: k} }
+	jump := func(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+	}
+
+	filter := []unix.SockFilter{
+		stmt(bpfLoad, offsetArch),
+		jump(bpfJumpEq, seccompArch, 1, 0),
+		stmt(bpfReturn, seccompKill),
+		stmt(bpfLoad, offsetNr),
+		jump(bpfJumpGE, 0x40000000, 0, 1),
+		stmt(bpfReturn, seccompKill),
+	}
+	for _, nr := range deniedSyscalls {
+		filter = append(filter,
+			jump(bpfJumpEq, nr, 0, 1),
+			stmt(bpfReturn, seccompErrno|uint32(unix.EPERM)))
+	}
+	return append(filter,
+		jump(bpfJumpEq, unix.SYS_CLONE3, 0, 1),
+		stmt(bpfReturn, seccompErrno|uint32(unix.ENOSYS)),
+		jump(bpfJumpEq, unix.SYS_CLONE, 0, 3),
+		stmt(bpfLoad, offsetArg0),
+		jump(bpfJumpSet, cloneNamespaceFlags, 0, 1),
+		stmt(bpfReturn, seccompErrno|uint32(unix.EPERM)),
+		stmt(bpfReturn, seccompAllow),
+	)
+}
+
+// installSeccomp applies the filter to the calling thread, which then
+// execs the tool; no_new_privs must already be set
+func installSeccomp() error {
+	filter := seccompFilter()
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	return unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0)
+}
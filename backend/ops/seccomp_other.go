@@ -0,0 +1,13 @@
+//go:build linux && !amd64 && !arm64
+
+package ops
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// The seccomp filter is written for amd64 and arm64 syscall numbers
+func installSeccomp() error {
+	return fmt.Errorf("no seccomp filter for %s", runtime.GOARCH)
+}
@@ -0,0 +1,390 @@
+package ops
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+// Ways to split, for SplitOptions.Mode
+const (
+	SplitIndividual = "individual" // a file per page
+	SplitEvery      = "every"      // a file every Every pages
+	SplitBookmarks  = "bookmarks"  // a file per bookmark down to Level, named after it
+	SplitSize       = "size"       // files of at most MaxSize bytes
+	SplitBlank      = "blank"      // at blank separator pages, which are left out
+)
+
+// SplitModes lists the modes Split accepts
+var SplitModes = []string{SplitIndividual, SplitEvery, SplitBookmarks, SplitSize, SplitBlank}
+
+// DefaultBlankThreshold is the ink coverage, in percent of the page area,
+// below which SplitBlank takes a page for a separator. It leaves room for
+// the specks of a scanned blank sheet.
+const DefaultBlankThreshold = 0.5
+
+// InkCoverageDPI is the resolution SplitBlank renders pages at to measure
+// their ink coverage
+const InkCoverageDPI = 72
+
+// maxPartNameRunes keeps names taken from bookmark titles short
+const maxPartNameRunes = 80
+
+// SplitOptions selects how Split cuts the document. Ranges writes each
+// range to its own file and cannot be combined with a Mode; with neither,
+// every page becomes its own file.
+type SplitOptions struct {
+	Mode   string // one of SplitModes
+	Ranges []PageRange
+	// Every is the number of pages per file for SplitEvery
+	Every int
+	// Level is the deepest bookmark level SplitBookmarks cuts at; 1, the
+	// default, cuts at top-level bookmarks only
+	Level int
+	// MaxSize is the largest file SplitSize writes, in bytes. A page that
+	// is bigger on its own still gets a file of its own.
+	MaxSize int64
+	// BlankThreshold is the ink coverage in percent below which
+	// SplitBlank counts a page as blank. It is used as given, so 0 finds
+	// no blank pages; DefaultBlankThreshold suits scanned separators.
+	BlankThreshold float64
+}
+
+// SplitPart is a file Split wrote and the pages of the input it holds
+type SplitPart struct {
+	Path  string
+	Pages PageRange
+}
+
+// partPlan is a run of pages Split writes to <Name>.pdf
+type partPlan struct {
+	Name  string
+	Pages PageRange
+}
+
+// rangePart names a run of pages after its range, pages_S-E
+func rangePart(rng PageRange) partPlan {
+	return partPlan{Name: fmt.Sprintf("pages_%d-%d", rng.Start, rng.End), Pages: rng}
+}
+
+// Split writes the parts of in to outDir and returns them in page order,
+// or for Ranges in the order given. Single pages are named page-N.pdf,
+// parts cut at bookmarks after their titles and other parts pages_S-E.pdf.
+func Split(ctx context.Context, in, outDir string, opts SplitOptions) ([]SplitPart, error) {
+	mode := opts.Mode
+	if len(opts.Ranges) > 0 && mode != "" {
+		return nil, invalidf("split", "ranges cannot be combined with mode %q", mode)
+	}
+	if mode == "" && len(opts.Ranges) == 0 {
+		mode = SplitIndividual
+	}
+	if mode == SplitIndividual {
+		return splitPages(ctx, in, outDir)
+	}
+
+	count, err := api.PageCountFile(in)
+	if err != nil {
+		return nil, fail(ctx, "split", "failed to read PDF", err)
+	}
+	var parts []partPlan
+	switch mode {
+	case "":
+		for _, rng := range opts.Ranges {
+			if rng.Start < 1 || rng.End < rng.Start {
+				return nil, invalidf("split", "invalid range %d-%d", rng.Start, rng.End)
+			}
+			if rng.End > count {
+				return nil, invalidf("split", "range %d-%d is beyond the last page, %d", rng.Start, rng.End, count)
+			}
+			parts = append(parts, rangePart(rng))
+		}
+	case SplitEvery:
+		if opts.Every < 1 {
+			return nil, invalidf("split", "every must be at least 1")
+		}
+		for start := 1; start <= count; start += opts.Every {
+			parts = append(parts, rangePart(PageRange{Start: start, End: min(start+opts.Every-1, count)}))
+		}
+	case SplitBookmarks:
+		parts, err = bookmarkParts(ctx, in, count, opts.Level)
+	case SplitSize:
+		if opts.MaxSize < 1 {
+			return nil, invalidf("split", "maximum size must be positive")
+		}
+		return splitBySize(ctx, in, outDir, count, opts.MaxSize)
+	case SplitBlank:
+		if opts.BlankThreshold < 0 {
+			return nil, invalidf("split", "blank threshold cannot be negative")
+		}
+		parts, err = blankParts(ctx, in, outDir, count, opts.BlankThreshold)
+	default:
+		return nil, invalidf("split", "unknown mode %q", mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return writeParts(ctx, in, outDir, parts)
+}
+
+// splitPages writes every page of in to outDir as page-N.pdf
+func splitPages(ctx context.Context, in, outDir string) ([]SplitPart, error) {
+	if err := api.SplitFile(in, outDir, 1, nil); err != nil {
+		return nil, fail(ctx, "split", "split failed", err)
+	}
+	// pdfcpu names the pages after the input, <name>_N.pdf
+	written, err := filepath.Glob(filepath.Join(outDir, "*_*.pdf"))
+	if err != nil {
+		return nil, fail(ctx, "split", "split failed", err)
+	}
+	parts := make([]SplitPart, len(written))
+	for i, part := range written {
+		stem := strings.TrimSuffix(filepath.Base(part), ".pdf")
+		page, _ := strconv.Atoi(stem[strings.LastIndex(stem, "_")+1:])
+		parts[i] = SplitPart{Path: filepath.Join(outDir, fmt.Sprintf("page-%d.pdf", page)), Pages: PageRange{Start: page, End: page}}
+		if err := os.Rename(part, parts[i].Path); err != nil {
+			return nil, fail(ctx, "split", "split failed", err)
+		}
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Pages.Start < parts[j].Pages.Start })
+	return parts, nil
+}
+
+// writeParts collects the pages of each part into outDir, numbering
+// repeated names
+func writeParts(ctx context.Context, in, outDir string, plans []partPlan) ([]SplitPart, error) {
+	parts := make([]SplitPart, len(plans))
+	used := map[string]bool{}
+	for i, plan := range plans {
+		name := plan.Name
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s-%d", plan.Name, n)
+		}
+		used[strings.ToLower(name)] = true
+
+		parts[i] = SplitPart{Path: filepath.Join(outDir, name+".pdf"), Pages: plan.Pages}
+		if err := collectRange(in, parts[i].Path, plan.Pages); err != nil {
+			return nil, fail(ctx, "split", fmt.Sprintf("failed to write pages %d-%d", plan.Pages.Start, plan.Pages.End), err)
+		}
+	}
+	return parts, nil
+}
+
+// collectRange writes the pages of rng to out
+func collectRange(in, out string, rng PageRange) error {
+	return api.CollectFile(in, out, []string{fmt.Sprintf("%d-%d", rng.Start, rng.End)}, nil)
+}
+
+// bookmarkParts cuts before every bookmark down to level. Pages ahead of
+// the first bookmark make a part of their own; of bookmarks starting on
+// the same page the outermost names the part.
+func bookmarkParts(ctx context.Context, in string, count, level int) ([]partPlan, error) {
+	f, err := os.Open(in)
+	if err != nil {
+		return nil, fail(ctx, "split", "failed to read PDF", err)
+	}
+	bookmarks, err := api.Bookmarks(f, nil)
+	f.Close()
+	if err != nil {
+		return nil, fail(ctx, "split", "failed to read bookmarks", err)
+	}
+
+	if level < 1 {
+		level = 1
+	}
+	var cuts []pdfcpu.Bookmark
+	var walk func(bookmarks []pdfcpu.Bookmark, depth int)
+	walk = func(bookmarks []pdfcpu.Bookmark, depth int) {
+		for _, bm := range bookmarks {
+			if bm.PageFrom >= 1 && bm.PageFrom <= count {
+				cuts = append(cuts, bm)
+			}
+			if depth < level {
+				walk(bm.Kids, depth+1)
+			}
+		}
+	}
+	walk(bookmarks, 1)
+	if len(cuts) == 0 {
+		return nil, invalidf("split", "the document has no bookmarks to split at")
+	}
+	sort.SliceStable(cuts, func(i, j int) bool { return cuts[i].PageFrom < cuts[j].PageFrom })
+
+	var parts []partPlan
+	if cuts[0].PageFrom > 1 {
+		parts = append(parts, rangePart(PageRange{Start: 1, End: cuts[0].PageFrom - 1}))
+	}
+	for i, bm := range cuts {
+		if i > 0 && cuts[i-1].PageFrom == bm.PageFrom {
+			continue
+		}
+		end := count
+		for _, next := range cuts[i+1:] {
+			if next.PageFrom > bm.PageFrom {
+				end = next.PageFrom - 1
+				break
+			}
+		}
+		parts = append(parts, partPlan{Name: partName(bm.Title), Pages: PageRange{Start: bm.PageFrom, End: end}})
+	}
+	return parts, nil
+}
+
+// partName makes a bookmark title usable as a file name on any system
+func partName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, title)
+	if runes := []rune(name); len(runes) > maxPartNameRunes {
+		name = string(runes[:maxPartNameRunes])
+	}
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return "untitled"
+	}
+	return name
+}
+
+// splitBySize writes the longest runs of pages that fit in maxSize. Files
+// grow with their page count, so the end of each run is found by
+// bisection, trying the rest of the document first.
+func splitBySize(ctx context.Context, in, outDir string, count int, maxSize int64) ([]SplitPart, error) {
+	dir, err := workDir(outDir, "split")
+	if err != nil {
+		return nil, fail(ctx, "split", "split failed", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var parts []SplitPart
+	for start := 1; start <= count; {
+		end, fitting := start, ""
+		lo, hi := start, count
+		for mid := hi; lo <= hi; mid = (lo + hi) / 2 {
+			if err := ctx.Err(); err != nil {
+				return nil, fail(ctx, "split", "split failed", err)
+			}
+			candidate := filepath.Join(dir, fmt.Sprintf("%d-%d.pdf", start, mid))
+			if err := collectRange(in, candidate, PageRange{Start: start, End: mid}); err != nil {
+				return nil, fail(ctx, "split", "split failed", err)
+			}
+			info, err := os.Stat(candidate)
+			if err != nil {
+				return nil, fail(ctx, "split", "split failed", err)
+			}
+			// Only the longest run that fits so far is kept, so scratch
+			// never holds more than one candidate besides the one tried
+			if info.Size() <= maxSize {
+				if fitting != "" {
+					os.Remove(fitting)
+				}
+				end, fitting = mid, candidate
+				lo = mid + 1
+			} else {
+				os.Remove(candidate)
+				hi = mid - 1
+			}
+		}
+
+		part := rangePart(PageRange{Start: start, End: end})
+		path := filepath.Join(outDir, part.Name+".pdf")
+		if fitting == "" {
+			// Page start alone is over the limit
+			Logf("Split: page %d alone exceeds %d bytes", start, maxSize)
+			err = collectRange(in, path, part.Pages)
+		} else {
+			err = moveFile(fitting, path)
+		}
+		if err != nil {
+			return nil, fail(ctx, "split", "split failed", err)
+		}
+		parts = append(parts, SplitPart{Path: path, Pages: part.Pages})
+		start = end + 1
+	}
+	return parts, nil
+}
+
+// blankParts cuts at pages whose ink coverage, as Ghostscript's inkcov
+// device renders it, is below threshold percent. Those pages are left
+// out, so a separator sheet scanned on both sides is dropped whole.
+func blankParts(ctx context.Context, in, outDir string, count int, threshold float64) ([]partPlan, error) {
+	// gs runs in a scratch directory so nothing it leaves behind can end
+	// up among the parts
+	dir, err := workDir(outDir, "inkcov")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	output, err := runTool(ctx, dir, "gs",
+		"-q", "-dNOPAUSE", "-dBATCH",
+		"-sDEVICE=inkcov",
+		"-r"+strconv.Itoa(InkCoverageDPI),
+		"-sOutputFile=%stdout",
+		in)
+	if err != nil {
+		return nil, toolFail(ctx, "split", "failed to detect blank pages", err, output)
+	}
+	coverage := parseInkCoverage(output)
+	if len(coverage) != count {
+		err := fmt.Errorf("measured %d of %d pages", len(coverage), count)
+		return nil, toolFail(ctx, "split", "failed to detect blank pages", err, output)
+	}
+
+	var parts []partPlan
+	start := 0
+	for page := 1; page <= count+1; page++ {
+		if page <= count && coverage[page-1] >= threshold {
+			if start == 0 {
+				start = page
+			}
+			continue
+		}
+		if start != 0 {
+			parts = append(parts, rangePart(PageRange{Start: start, End: page - 1}))
+			start = 0
+		}
+	}
+	if len(parts) == 0 {
+		return nil, invalidf("split", "every page is blank")
+	}
+	return parts, nil
+}
+
+// parseInkCoverage reads the per page lines of the inkcov device,
+// "C M Y K CMYK OK" with each channel a fraction of the page, and returns
+// the total coverage of each page in percent
+func parseInkCoverage(output []byte) []float64 {
+	var coverage []float64
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[4] != "CMYK" {
+			continue
+		}
+		total := 0.0
+		valid := true
+		for _, field := range fields[:4] {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				valid = false
+				break
+			}
+			total += v
+		}
+		if valid {
+			coverage = append(coverage, total*100)
+		}
+	}
+	return coverage
+}
@@ -0,0 +1,214 @@
+package ops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+// splitResult lists each part by file name and page widths, checking
+// that the pages are those its range names
+func splitResult(t *testing.T, parts []SplitPart) string {
+	t.Helper()
+	var names []string
+	for _, part := range parts {
+		widths := pageWidths(t, part.Path)
+		if len(widths) != part.Pages.End-part.Pages.Start+1 || widths[0] != 99+part.Pages.Start {
+			t.Errorf("%s holds %v, not pages %d-%d", filepath.Base(part.Path), widths, part.Pages.Start, part.Pages.End)
+		}
+		names = append(names, fmt.Sprintf("%s%v", filepath.Base(part.Path), widths))
+	}
+	return strings.Join(names, " ")
+}
+
+func TestSplit(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.pdf")
+	writeTestPDF(t, in, 0, 5, "")
+
+	for _, tc := range []struct {
+		opts SplitOptions
+		want string
+	}{
+		{SplitOptions{}, "page-1.pdf[100] page-2.pdf[101] page-3.pdf[102] page-4.pdf[103] page-5.pdf[104]"},
+		{SplitOptions{Ranges: []PageRange{{Start: 4, End: 5}, {Start: 1, End: 2}}}, "pages_4-5.pdf[103 104] pages_1-2.pdf[100 101]"},
+		{SplitOptions{Ranges: []PageRange{{Start: 2, End: 2}, {Start: 2, End: 2}}}, "pages_2-2.pdf[101] pages_2-2-2.pdf[101]"},
+		{SplitOptions{Mode: SplitEvery, Every: 2}, "pages_1-2.pdf[100 101] pages_3-4.pdf[102 103] pages_5-5.pdf[104]"},
+	} {
+		out := t.TempDir()
+		parts, err := Split(context.Background(), in, out, tc.opts)
+		if err != nil {
+			t.Fatalf("%+v: %v", tc.opts, err)
+		}
+		if got := splitResult(t, parts); got != tc.want {
+			t.Errorf("%+v: got %s, want %s", tc.opts, got, tc.want)
+		}
+	}
+
+	for _, opts := range []SplitOptions{
+		{Ranges: []PageRange{{Start: 4, End: 6}}},
+		{Mode: SplitEvery},
+		{Mode: SplitSize},
+		{Mode: SplitEvery, Every: 2, Ranges: []PageRange{{Start: 1, End: 1}}},
+		{Mode: "chapters"},
+		{Mode: SplitBookmarks},
+	} {
+		if _, err := Split(context.Background(), in, t.TempDir(), opts); KindOf(err) != KindInvalidInput {
+			t.Errorf("%+v: %v", opts, err)
+		}
+	}
+}
+
+func TestSplitBookmarks(t *testing.T) {
+	dir := t.TempDir()
+	plain, in := filepath.Join(dir, "plain.pdf"), filepath.Join(dir, "in.pdf")
+	writeTestPDF(t, plain, 0, 6, "")
+	err := api.AddBookmarksFile(plain, in, []pdfcpu.Bookmark{
+		{Title: "Part 1: Intro", PageFrom: 2, Kids: []pdfcpu.Bookmark{
+			{Title: "Overview", PageFrom: 2},
+			{Title: "Details", PageFrom: 3},
+		}},
+		{Title: "Part 2", PageFrom: 4, Kids: []pdfcpu.Bookmark{{Title: "Summary", PageFrom: 5}}},
+	}, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for level, want := range map[int]string{
+		1: "pages_1-1.pdf[100] Part 1_ Intro.pdf[101 102] Part 2.pdf[103 104 105]",
+		2: "pages_1-1.pdf[100] Part 1_ Intro.pdf[101] Details.pdf[102] Part 2.pdf[103] Summary.pdf[104 105]",
+	} {
+		parts, err := Split(context.Background(), in, t.TempDir(), SplitOptions{Mode: SplitBookmarks, Level: level})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := splitResult(t, parts); got != want {
+			t.Errorf("level %d: got %s, want %s", level, got, want)
+		}
+	}
+}
+
+func TestSplitBySize(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.pdf")
+	writeTestPDF(t, in, 0, 9, "")
+
+	// Room for a few of the pages at a time
+	whole := filepath.Join(dir, "whole.pdf")
+	single := filepath.Join(dir, "single.pdf")
+	if err := collectRange(in, whole, PageRange{Start: 1, End: 9}); err != nil {
+		t.Fatal(err)
+	}
+	if err := collectRange(in, single, PageRange{Start: 1, End: 1}); err != nil {
+		t.Fatal(err)
+	}
+	wholeInfo, _ := os.Stat(whole)
+	singleInfo, _ := os.Stat(single)
+	limit := singleInfo.Size() + (wholeInfo.Size()-singleInfo.Size())/3
+
+	parts, err := Split(context.Background(), in, t.TempDir(), SplitOptions{Mode: SplitSize, MaxSize: limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) < 2 || len(parts) > 4 {
+		t.Errorf("%d parts", len(parts))
+	}
+	var widths []int
+	for _, part := range parts {
+		if info, _ := os.Stat(part.Path); info.Size() > limit {
+			t.Errorf("%s is %d bytes, over %d", filepath.Base(part.Path), info.Size(), limit)
+		}
+		widths = append(widths, pageWidths(t, part.Path)...)
+	}
+	splitResult(t, parts)
+	if got := fmt.Sprint(widths); got != "[100 101 102 103 104 105 106 107 108]" {
+		t.Errorf("pages = %s", got)
+	}
+
+	// A page over the limit on its own still gets a file
+	parts, err = Split(context.Background(), in, t.TempDir(), SplitOptions{Mode: SplitSize, MaxSize: 1})
+	if err != nil || len(parts) != 9 {
+		t.Errorf("%d parts, %v", len(parts), err)
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	dir := t.TempDir()
+	in, locked := filepath.Join(dir, "in.pdf"), filepath.Join(dir, "locked.pdf")
+	writeTestPDF(t, in, 0, 3, "")
+	writeEncryptedPDF(t, locked, "secret")
+
+	if _, err := Split(context.Background(), locked, t.TempDir(), SplitOptions{Mode: SplitEvery, Every: 1}); KindOf(err) != KindEncrypted {
+		t.Errorf("encrypted input: %v", err)
+	}
+	if _, err := Split(context.Background(), filepath.Join(dir, "missing.pdf"), t.TempDir(), SplitOptions{Mode: SplitEvery, Every: 1}); KindOf(err) != KindFailed {
+		t.Errorf("missing input: %v", err)
+	}
+
+	// Blank page detection needs gs
+	t.Setenv("PATH", t.TempDir())
+	_, err := Split(context.Background(), in, t.TempDir(), SplitOptions{Mode: SplitBlank})
+	var e *Error
+	if !errors.As(err, &e) || e.Kind != KindToolUnavailable || e.Tool != "gs" {
+		t.Errorf("without gs: %#v", err)
+	}
+}
+
+func TestParseInkCoverage(t *testing.T) {
+	output := []byte(" 0.01234  0.01000  0.00000  0.20000 CMYK OK\n" +
+		"GPL Ghostscript: a warning\n" +
+		" 0.00000  0.00000  0.00000  0.00100 CMYK OK\n")
+	got := parseInkCoverage(output)
+	if len(got) != 2 || fmt.Sprintf("%.3f %.3f", got[0], got[1]) != "22.234 0.100" {
+		t.Errorf("coverage = %v", got)
+	}
+}
+
+func TestSplitBlankPages(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.pdf")
+	writeTestPDF(t, in, 0, 5, "")
+
+	// A stand-in for gs that reports page 3 as blank
+	bin := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"printf ' 0.10 0.10 0.10 0.10 CMYK OK\\n 0.10 0.10 0.10 0.10 CMYK OK\\n" +
+		" 0.00 0.00 0.00 0.00 CMYK OK\\n 0.10 0.10 0.10 0.10 CMYK OK\\n 0.10 0.10 0.10 0.10 CMYK OK\\n'\n"
+	if err := os.WriteFile(filepath.Join(bin, "gs"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	out := filepath.Join(t.TempDir(), "out")
+	os.Mkdir(out, 0755)
+	parts, err := Split(context.Background(), in, out, SplitOptions{Mode: SplitBlank, BlankThreshold: DefaultBlankThreshold})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := splitResult(t, parts); got != "pages_1-2.pdf[100 101] pages_4-5.pdf[103 104]" {
+		t.Errorf("got %s", got)
+	}
+
+	// A threshold of 0 is taken as given and finds no blank pages
+	parts, err = Split(context.Background(), in, t.TempDir(), SplitOptions{Mode: SplitBlank})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := splitResult(t, parts); got != "pages_1-5.pdf[100 101 102 103 104]" {
+		t.Errorf("threshold 0: got %s", got)
+	}
+
+	// Only the parts are left, in the output directory and next to it
+	entries, _ := os.ReadDir(out)
+	siblings, _ := os.ReadDir(filepath.Dir(out))
+	if len(entries) != 2 || len(siblings) != 1 {
+		t.Errorf("output %d entries, %d next to it", len(entries), len(siblings))
+	}
+}
@@ -0,0 +1,122 @@
+package ops
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ToolObserver is told about the external processes an operation starts,
+// e.g. so a server can list and kill them
+type ToolObserver interface {
+	ToolStarted(pid int)
+	ToolExited(pid int)
+}
+
+type observerKey struct{}
+
+// WithToolObserver returns a context whose operations report their tool
+// processes to obs
+func WithToolObserver(ctx context.Context, obs ToolObserver) context.Context {
+	return context.WithValue(ctx, observerKey{}, obs)
+}
+
+// runTool runs an external command and returns its combined output.
+// Cancelling ctx kills the tool and everything it spawned. dir is the
+// tool's scratch directory: its HOME and TMPDIR, and under strict
+// isolation the only place it can write, so outputs must go there.
+func runTool(ctx context.Context, dir, name string, args ...string) ([]byte, error) {
+	cmd, err := toolCommand(ctx, dir, name, args)
+	if err != nil {
+		return nil, &toolError{name, err}
+	}
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	configureToolProcess(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return nil, &toolError{name, err}
+	}
+
+	obs, _ := ctx.Value(observerKey{}).(ToolObserver)
+	if obs != nil {
+		obs.ToolStarted(cmd.Process.Pid)
+	}
+
+	err = cmd.Wait()
+
+	if obs != nil {
+		obs.ToolExited(cmd.Process.Pid)
+	}
+	if err != nil {
+		return output.Bytes(), &toolError{name, err}
+	}
+	return output.Bytes(), nil
+}
+
+// toolCommand builds the command for name under its sandbox policy
+func toolCommand(ctx context.Context, dir, name string, args []string) (*exec.Cmd, error) {
+	policy := Sandbox.Policy(name)
+	if policy.Isolation == IsolationNone {
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Env = toolEnv(dir)
+		return cmd, nil
+	}
+
+	// Resolve here so a missing tool is reported as exec.ErrNotFound
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := newSandboxSpec(policy, dir)
+	if err != nil {
+		return nil, err
+	}
+	return sandboxCommand(ctx, spec, name, path, args)
+}
+
+// toolEnv is the environment tools run with: the server's PATH and locale,
+// with HOME and the temp directory variables pointing at scratch. Nothing
+// else is passed on, so a tool cannot read the server's keys and secrets.
+func toolEnv(scratch string) []string {
+	env := []string{"HOME=" + scratch, "TMPDIR=" + scratch, "TMP=" + scratch, "TEMP=" + scratch}
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if key == "PATH" || key == "LANG" || strings.HasPrefix(key, "LC_") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// runToolTo runs a tool that writes the single file out. The tool writes
+// to the path it is given inside a scratch directory next to out, and the
+// result is moved into place when it succeeds.
+func runToolTo(ctx context.Context, out, name string, args func(tmpOut string) []string) ([]byte, error) {
+	dir, err := workDir(out, name)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmpOut := filepath.Join(dir, "out"+filepath.Ext(out))
+	output, err := runTool(ctx, dir, name, args(tmpOut)...)
+	if err != nil {
+		return output, err
+	}
+	return output, moveFile(tmpOut, out)
+}
+
+// toolError is how a tool run failed, naming the tool
+type toolError struct {
+	tool string
+	err  error
+}
+
+func (e *toolError) Error() string { return e.tool + ": " + e.err.Error() }
+
+func (e *toolError) Unwrap() error { return e.err }
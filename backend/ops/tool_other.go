@@ -0,0 +1,16 @@
+//go:build !unix
+
+package ops
+
+import (
+	"os/exec"
+	"time"
+)
+
+func configureToolProcess(cmd *exec.Cmd) {
+	cmd.WaitDelay = 5 * time.Second
+}
+
+func limitKind(err error) Kind {
+	return ""
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package ops
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestToolEnvironment(t *testing.T) {
+	t.Setenv("ENCRYPTION_KEY", "server-secret")
+	t.Setenv("LC_ALL", "C")
+
+	for _, isolation := range []Isolation{IsolationNone, IsolationLimits} {
+		if err := CheckSandbox(isolation); err != nil {
+			t.Logf("%s sandbox unavailable here: %v", isolation, err)
+			continue
+		}
+		old := Sandbox
+		Sandbox = SandboxConfig{Default: SandboxPolicy{Isolation: isolation}}
+
+		dir := t.TempDir()
+		output, err := runTool(context.Background(), dir, "sh", "-c", `echo "key=$ENCRYPTION_KEY home=$HOME lc=$LC_ALL"`)
+		Sandbox = old
+		if err != nil {
+			t.Fatalf("%s: %v: %s", isolation, err, output)
+		}
+		if got, want := strings.TrimSpace(string(output)), "key= home="+dir+" lc=C"; got != want {
+			t.Errorf("%s: tool saw %q, want %q", isolation, got, want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package ops
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// configureToolProcess runs the tool in its own process group so that
+// cancelling kills helpers it spawned too (soffice.bin, gs children)
+func configureToolProcess(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 5 * time.Second
+}
+
+// limitKind tells whether the sandbox's resource limits killed the tool:
+// SIGXCPU for CPU time, SIGXFSZ for file size
+func limitKind(err error) Kind {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return ""
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+	switch status.Signal() {
+	case syscall.SIGXCPU:
+		return KindTimeout
+	case syscall.SIGXFSZ:
+		return KindLimitExceeded
+	}
+	return ""
+}
@@ -0,0 +1,5 @@
+// Package pdfpb holds the generated protobuf and gRPC code for the gRPC
+// API defined in pdfpal.proto.
+package pdfpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative pdfpal.proto
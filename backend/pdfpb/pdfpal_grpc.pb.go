@@ -0,0 +1,475 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: pdfpal.proto
+
+// gRPC interface to the PDF processing backend. It exposes the same
+// operations as the REST API (GET /api/operations) and applies the same API
+// keys, namespaces, quotas, concurrency limits and operation toggles. Send
+// the API key as "x-api-key" or "authorization: Bearer <key>" metadata.
+
+package pdfpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Documents_Run_FullMethodName            = "/pdfpal.v1.Documents/Run"
+	Documents_ListOperations_FullMethodName = "/pdfpal.v1.Documents/ListOperations"
+)
+
+// DocumentsClient is the client API for Documents service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DocumentsClient interface {
+	// Run streams the inputs up and the result back. The client sends a
+	// Start message, then for each input a FileStart followed by its data
+	// chunks, and closes the send side. The server answers with a
+	// ResultFile followed by the result's data chunks. Errors use the
+	// standard status codes; rejected parameters carry a
+	// google.rpc.BadRequest detail.
+	Run(ctx context.Context, opts ...grpc.CallOption) (Documents_RunClient, error)
+	// ListOperations describes every operation and its parameters.
+	ListOperations(ctx context.Context, in *ListOperationsRequest, opts ...grpc.CallOption) (*ListOperationsResponse, error)
+}
+
+type documentsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDocumentsClient(cc grpc.ClientConnInterface) DocumentsClient {
+	return &documentsClient{cc}
+}
+
+func (c *documentsClient) Run(ctx context.Context, opts ...grpc.CallOption) (Documents_RunClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Documents_ServiceDesc.Streams[0], Documents_Run_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &documentsRunClient{stream}
+	return x, nil
+}
+
+type Documents_RunClient interface {
+	Send(*RunRequest) error
+	Recv() (*RunResponse, error)
+	grpc.ClientStream
+}
+
+type documentsRunClient struct {
+	grpc.ClientStream
+}
+
+func (x *documentsRunClient) Send(m *RunRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *documentsRunClient) Recv() (*RunResponse, error) {
+	m := new(RunResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *documentsClient) ListOperations(ctx context.Context, in *ListOperationsRequest, opts ...grpc.CallOption) (*ListOperationsResponse, error) {
+	out := new(ListOperationsResponse)
+	err := c.cc.Invoke(ctx, Documents_ListOperations_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DocumentsServer is the server API for Documents service.
+// All implementations must embed UnimplementedDocumentsServer
+// for forward compatibility
+type DocumentsServer interface {
+	// Run streams the inputs up and the result back. The client sends a
+	// Start message, then for each input a FileStart followed by its data
+	// chunks, and closes the send side. The server answers with a
+	// ResultFile followed by the result's data chunks. Errors use the
+	// standard status codes; rejected parameters carry a
+	// google.rpc.BadRequest detail.
+	Run(Documents_RunServer) error
+	// ListOperations describes every operation and its parameters.
+	ListOperations(context.Context, *ListOperationsRequest) (*ListOperationsResponse, error)
+	mustEmbedUnimplementedDocumentsServer()
+}
+
+// UnimplementedDocumentsServer must be embedded to have forward compatible implementations.
+type UnimplementedDocumentsServer struct {
+}
+
+func (UnimplementedDocumentsServer) Run(Documents_RunServer) error {
+	return status.Errorf(codes.Unimplemented, "method Run not implemented")
+}
+func (UnimplementedDocumentsServer) ListOperations(context.Context, *ListOperationsRequest) (*ListOperationsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListOperations not implemented")
+}
+func (UnimplementedDocumentsServer) mustEmbedUnimplementedDocumentsServer() {}
+
+// UnsafeDocumentsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DocumentsServer will
+// result in compilation errors.
+type UnsafeDocumentsServer interface {
+	mustEmbedUnimplementedDocumentsServer()
+}
+
+func RegisterDocumentsServer(s grpc.ServiceRegistrar, srv DocumentsServer) {
+	s.RegisterService(&Documents_ServiceDesc, srv)
+}
+
+func _Documents_Run_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DocumentsServer).Run(&documentsRunServer{stream})
+}
+
+type Documents_RunServer interface {
+	Send(*RunResponse) error
+	Recv() (*RunRequest, error)
+	grpc.ServerStream
+}
+
+type documentsRunServer struct {
+	grpc.ServerStream
+}
+
+func (x *documentsRunServer) Send(m *RunResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *documentsRunServer) Recv() (*RunRequest, error) {
+	m := new(RunRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Documents_ListOperations_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListOperationsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DocumentsServer).ListOperations(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Documents_ListOperations_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DocumentsServer).ListOperations(ctx, req.(*ListOperationsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Documents_ServiceDesc is the grpc.ServiceDesc for Documents service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Documents_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pdfpal.v1.Documents",
+	HandlerType: (*DocumentsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListOperations",
+			Handler:    _Documents_ListOperations_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Run",
+			Handler:       _Documents_Run_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "pdfpal.proto",
+}
+
+const (
+	Jobs_Submit_FullMethodName = "/pdfpal.v1.Jobs/Submit"
+	Jobs_Get_FullMethodName    = "/pdfpal.v1.Jobs/Get"
+	Jobs_Cancel_FullMethodName = "/pdfpal.v1.Jobs/Cancel"
+	Jobs_Result_FullMethodName = "/pdfpal.v1.Jobs/Result"
+)
+
+// JobsClient is the client API for Jobs service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type JobsClient interface {
+	// Submit uploads the inputs like Documents.Run and returns the pending
+	// job once the upload is complete.
+	Submit(ctx context.Context, opts ...grpc.CallOption) (Jobs_SubmitClient, error)
+	// Get reports the state of a job.
+	Get(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error)
+	// Cancel stops a job that has not finished and returns its state.
+	Cancel(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error)
+	// Result streams the output of a succeeded job like Documents.Run.
+	// Unfinished jobs fail with FAILED_PRECONDITION; failed jobs with the
+	// status of the operation.
+	Result(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (Jobs_ResultClient, error)
+}
+
+type jobsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewJobsClient(cc grpc.ClientConnInterface) JobsClient {
+	return &jobsClient{cc}
+}
+
+func (c *jobsClient) Submit(ctx context.Context, opts ...grpc.CallOption) (Jobs_SubmitClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Jobs_ServiceDesc.Streams[0], Jobs_Submit_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &jobsSubmitClient{stream}
+	return x, nil
+}
+
+type Jobs_SubmitClient interface {
+	Send(*RunRequest) error
+	CloseAndRecv() (*Job, error)
+	grpc.ClientStream
+}
+
+type jobsSubmitClient struct {
+	grpc.ClientStream
+}
+
+func (x *jobsSubmitClient) Send(m *RunRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *jobsSubmitClient) CloseAndRecv() (*Job, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(Job)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *jobsClient) Get(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Jobs_Get_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *jobsClient) Cancel(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Jobs_Cancel_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *jobsClient) Result(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (Jobs_ResultClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Jobs_ServiceDesc.Streams[1], Jobs_Result_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &jobsResultClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Jobs_ResultClient interface {
+	Recv() (*RunResponse, error)
+	grpc.ClientStream
+}
+
+type jobsResultClient struct {
+	grpc.ClientStream
+}
+
+func (x *jobsResultClient) Recv() (*RunResponse, error) {
+	m := new(RunResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// JobsServer is the server API for Jobs service.
+// All implementations must embed UnimplementedJobsServer
+// for forward compatibility
+type JobsServer interface {
+	// Submit uploads the inputs like Documents.Run and returns the pending
+	// job once the upload is complete.
+	Submit(Jobs_SubmitServer) error
+	// Get reports the state of a job.
+	Get(context.Context, *JobRequest) (*Job, error)
+	// Cancel stops a job that has not finished and returns its state.
+	Cancel(context.Context, *JobRequest) (*Job, error)
+	// Result streams the output of a succeeded job like Documents.Run.
+	// Unfinished jobs fail with FAILED_PRECONDITION; failed jobs with the
+	// status of the operation.
+	Result(*JobRequest, Jobs_ResultServer) error
+	mustEmbedUnimplementedJobsServer()
+}
+
+// UnimplementedJobsServer must be embedded to have forward compatible implementations.
+type UnimplementedJobsServer struct {
+}
+
+func (UnimplementedJobsServer) Submit(Jobs_SubmitServer) error {
+	return status.Errorf(codes.Unimplemented, "method Submit not implemented")
+}
+func (UnimplementedJobsServer) Get(context.Context, *JobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedJobsServer) Cancel(context.Context, *JobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Cancel not implemented")
+}
+func (UnimplementedJobsServer) Result(*JobRequest, Jobs_ResultServer) error {
+	return status.Errorf(codes.Unimplemented, "method Result not implemented")
+}
+func (UnimplementedJobsServer) mustEmbedUnimplementedJobsServer() {}
+
+// UnsafeJobsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to JobsServer will
+// result in compilation errors.
+type UnsafeJobsServer interface {
+	mustEmbedUnimplementedJobsServer()
+}
+
+func RegisterJobsServer(s grpc.ServiceRegistrar, srv JobsServer) {
+	s.RegisterService(&Jobs_ServiceDesc, srv)
+}
+
+func _Jobs_Submit_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(JobsServer).Submit(&jobsSubmitServer{stream})
+}
+
+type Jobs_SubmitServer interface {
+	SendAndClose(*Job) error
+	Recv() (*RunRequest, error)
+	grpc.ServerStream
+}
+
+type jobsSubmitServer struct {
+	grpc.ServerStream
+}
+
+func (x *jobsSubmitServer) SendAndClose(m *Job) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *jobsSubmitServer) Recv() (*RunRequest, error) {
+	m := new(RunRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Jobs_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JobsServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Jobs_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JobsServer).Get(ctx, req.(*JobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Jobs_Cancel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JobsServer).Cancel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Jobs_Cancel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JobsServer).Cancel(ctx, req.(*JobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Jobs_Result_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(JobRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(JobsServer).Result(m, &jobsResultServer{stream})
+}
+
+type Jobs_ResultServer interface {
+	Send(*RunResponse) error
+	grpc.ServerStream
+}
+
+type jobsResultServer struct {
+	grpc.ServerStream
+}
+
+func (x *jobsResultServer) Send(m *RunResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Jobs_ServiceDesc is the grpc.ServiceDesc for Jobs service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Jobs_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pdfpal.v1.Jobs",
+	HandlerType: (*JobsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _Jobs_Get_Handler,
+		},
+		{
+			MethodName: "Cancel",
+			Handler:    _Jobs_Cancel_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Submit",
+			Handler:       _Jobs_Submit_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Result",
+			Handler:       _Jobs_Result_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pdfpal.proto",
+}
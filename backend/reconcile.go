@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// reconcileStats counts what reconcileTempDir did
+type reconcileStats struct {
+	Registered int // files kept until their TTL runs out
+	Expired    int // files already past their TTL
+	WorkDirs   int // directories of operations that never finished
+}
+
+// reconcileTempDir takes over the files a previous process left in
+// TempDir, since the registry only lives in memory. Files are registered
+// with their modification time, so they expire as if the server had never
+// stopped, and files already past the TTL are deleted. Directories under
+// work/ and output/ belonged to operations that died with the process and
+// are removed. It must run before the server accepts requests.
+func reconcileTempDir() reconcileStats {
+	var stats reconcileStats
+	ttl := time.Duration(FileTTLMinutes) * time.Minute
+	auditPath, _ := filepath.Abs(AuditLogPath)
+
+	filepath.WalkDir(TempDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == TempDir {
+			return nil
+		}
+		if d.IsDir() {
+			if isLeftoverDir(path) {
+				removeAll(path)
+				stats.WorkDirs++
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if abs, _ := filepath.Abs(path); abs == auditPath {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if time.Since(info.ModTime()) >= ttl {
+			removeFile(path)
+			stats.Expired++
+			return nil
+		}
+		registerFileAt(path, info.ModTime())
+		stats.Registered++
+		return nil
+	})
+	return stats
+}
+
+// isLeftoverDir reports whether path is ns/<namespace>/work/<dir> or
+// ns/<namespace>/output/<dir>
+func isLeftoverDir(path string) bool {
+	rel, err := filepath.Rel(filepath.Join(TempDir, "ns"), path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	return len(parts) == 3 && (parts[1] == "work" || parts[1] == "output")
+}
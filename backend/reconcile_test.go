@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReconcileTempDir(t *testing.T) {
+	oldTempDir := TempDir
+	TempDir = t.TempDir()
+	t.Cleanup(func() { TempDir = oldTempDir })
+
+	write := func(rel string, age time.Duration) string {
+		path := filepath.Join(TempDir, rel)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("x"), 0644)
+		mtime := time.Now().Add(-age)
+		os.Chtimes(path, mtime, mtime)
+		return path
+	}
+	ttl := time.Duration(FileTTLMinutes) * time.Minute
+	fresh := write("ns/acme/output/merged-1.pdf", time.Minute)
+	stale := write("ns/acme/output/merged-2.pdf", ttl+time.Minute)
+	legacy := write("uploads/old.pdf", ttl+time.Hour)
+	write("ns/acme/work/ws-123/upload-1.pdf", 0)
+	write("ns/beta/output/split-abc/page-1.pdf", 0)
+	// A namespace that happens to be called "output" is not a leftover
+	kept := write("ns/output/output/rotated-1.pdf", 0)
+
+	stats := reconcileTempDir()
+	if stats != (reconcileStats{Registered: 2, Expired: 2, WorkDirs: 2}) {
+		t.Errorf("stats = %+v", stats)
+	}
+	for _, path := range []string{stale, legacy, filepath.Join(TempDir, "ns/acme/work/ws-123"), filepath.Join(TempDir, "ns/beta/output/split-abc")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", path)
+		}
+	}
+
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+	for _, path := range []string{fresh, kept} {
+		if _, ok := fileRegistry[path]; !ok {
+			t.Errorf("%s is not registered", path)
+		}
+	}
+	// The TTL keeps running from the file's modification time
+	if age := time.Since(fileRegistry[fresh].CreatedAt); age < 30*time.Second {
+		t.Errorf("%s registered %v ago, not with its mtime", fresh, age)
+	}
+	delete(fileRegistry, fresh)
+	delete(fileRegistry, kept)
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Parameter types
+const (
+	TypeString   = "string"
+	TypeInteger  = "integer"
+	TypeNumber   = "number"
+	TypeBoolean  = "boolean"
+	TypeIntArray = "integer[]"
+	TypeJSON     = "json"
+)
+
+// Param describes one multipart form field of an operation
+type Param struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required"`
+	Default     interface{} `json:"default,omitempty"`
+	Min         *float64    `json:"min,omitempty"`
+	Max         *float64    `json:"max,omitempty"`
+	MaxLength   int         `json:"maxLength,omitempty"`
+	Enum        []string    `json:"enum,omitempty"`
+	Pattern     string      `json:"pattern,omitempty"`
+	Example     string      `json:"example,omitempty"`
+
+	// Shape is a zero value of the Go type a TypeJSON field decodes into
+	Shape interface{} `json:"-"`
+}
+
+// FileSpec describes the uploaded files of an operation. Files are sent
+// as file0, file1, ...; with CountField the client states how many in
+// fileCount.
+type FileSpec struct {
+	Min        int      `json:"min"`
+	Max        int      `json:"max,omitempty"`
+	CountField bool     `json:"countField"`
+	Accept     []string `json:"accept"`
+}
+
+// OperationDef declares an operation once: its route, inputs, parameters
+// and handler. Everything else (routing, validation, discovery, toggles)
+// is derived from it.
+type OperationDef struct {
+	Name        string   `json:"name"`
+	Path        string   `json:"path"`
+	Method      string   `json:"method"`
+	Category    string   `json:"category"`
+	Summary     string   `json:"summary"`
+	Files       FileSpec `json:"files"`
+	Params      []Param  `json:"params"`
+	Output      string   `json:"output"`
+	MaxUploadMB int64    `json:"maxUploadMB"`
+	MaxFileMB   int64    `json:"maxFileMB,omitempty"` // per file; MaxUploadMB if zero
+	Requires    []string `json:"requires,omitempty"`
+
+	// Validate runs after the individual fields are valid, for rules that
+	// span several fields
+	Validate func(p Params) []FieldError `json:"-"`
+	// RenderDPI is the resolution the operation rasterizes pages at, for
+	// the render pixel limit; nil for operations that do not rasterize
+	RenderDPI func(p Params) int `json:"-"`
+	// PasswordParam names the param holding the password of encrypted
+	// inputs, which preflight opens them with; empty if there is none
+	PasswordParam string           `json:"-"`
+	Handler       http.HandlerFunc `json:"-"`
+}
+
+// FieldError reports why a single field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Params holds the validated, typed values of a request
+type Params struct {
+	values map[string]interface{}
+	set    map[string]bool
+}
+
+type paramsKey struct{}
+
+func paramsFrom(r *http.Request) Params {
+	if p, ok := r.Context().Value(paramsKey{}).(Params); ok {
+		return p
+	}
+	return Params{}
+}
+
+// Has reports whether the client sent the field
+func (p Params) Has(name string) bool { return p.set[name] }
+
+func (p Params) String(name string) string {
+	v, _ := p.values[name].(string)
+	return v
+}
+
+func (p Params) Int(name string) int {
+	v, _ := p.values[name].(int)
+	return v
+}
+
+func (p Params) Int64(name string) int64 {
+	v, _ := p.values[name].(int)
+	return int64(v)
+}
+
+func (p Params) Float(name string) float64 {
+	v, _ := p.values[name].(float64)
+	return v
+}
+
+func (p Params) Bool(name string) bool {
+	v, _ := p.values[name].(bool)
+	return v
+}
+
+func (p Params) Ints(name string) []int {
+	v, _ := p.values[name].([]int)
+	return v
+}
+
+// Value returns a decoded TypeJSON field; assert it to the param's Shape
+func (p Params) Value(name string) interface{} {
+	return p.values[name]
+}
+
+// ==================== REGISTRATION ====================
+
+func floatPtr(f float64) *float64 { return &f }
+
+// registerOperations mounts every operation in operationDefs
+func registerOperations(mux *Router) {
+	for _, def := range operationDefs {
+		mux.HandleFunc(def.Path, def.serve)
+	}
+	mux.HandleFunc("/api/operations", handleListOperations)
+}
+
+func lookupOperation(name string) *OperationDef {
+	for _, def := range operationDefs {
+		if def.Name == name {
+			return def
+		}
+	}
+	return nil
+}
+
+// GET /api/operations
+func handleListOperations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"operations": operationDefs,
+	})
+}
+
+// serve parses and validates the request against the definition before
+// handing it to the operation's handler
+func (def *OperationDef) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != def.Method {
+		sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Everything the operation writes lives in its workspace until the
+	// output is promoted
+	ws, err := newWorkspace(principalFrom(r).Namespace)
+	if err != nil {
+		sendError(w, "Failed to create workspace", http.StatusInternalServerError)
+		return
+	}
+	defer ws.Remove()
+
+	values, uploads, err := def.readForm(r, ws)
+	if err != nil {
+		var uploadErr *uploadError
+		if errors.As(err, &uploadErr) {
+			sendError(w, uploadErr.msg, uploadErr.status)
+		} else {
+			sendError(w, fmt.Sprintf("Failed to store upload: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+	auditForm(r, values)
+	r.PostForm = values
+	r.Form = mergeQuery(values, r.URL.Query())
+	r.MultipartForm = &multipart.Form{Value: values}
+
+	ctx := context.WithValue(r.Context(), workspaceKey{}, ws)
+	ctx = context.WithValue(ctx, uploadsKey{}, uploads)
+	r = r.WithContext(ctx)
+
+	params, errs := def.parse(r)
+	if len(errs) > 0 {
+		sendFieldErrors(w, errs)
+		return
+	}
+
+	if errs := def.checkTypes(r, params); len(errs) > 0 {
+		sendTypeErrors(w, errs)
+		return
+	}
+
+	if errs, err := def.preflight(r, params); err != nil {
+		sendOpError(w, err)
+		return
+	} else if len(errs) > 0 {
+		sendLimitErrors(w, errs)
+		return
+	}
+
+	// Only now that the upload is in does the operation take a slot
+	release, ok := acquireSlot(r.Context())
+	if !ok {
+		writeError(w, http.StatusServiceUnavailable, ErrorResponse{Error: "Operation cancelled", Code: CodeCanceled})
+		return
+	}
+	defer release()
+
+	def.Handler(w, r.WithContext(context.WithValue(r.Context(), paramsKey{}, params)))
+}
+
+// mergeQuery adds the URL query to the form values, which come first, as
+// http.Request.Form would have them
+func mergeQuery(values, query url.Values) url.Values {
+	form := make(url.Values, len(values)+len(query))
+	for key, vs := range values {
+		form[key] = append(form[key], vs...)
+	}
+	for key, vs := range query {
+		form[key] = append(form[key], vs...)
+	}
+	return form
+}
+
+func sendFieldErrors(w http.ResponseWriter, errs []FieldError) {
+	writeFieldErrors(w, http.StatusBadRequest, "Invalid request parameters", errs)
+}
+
+// sendTypeErrors rejects uploads whose content the operation cannot take
+func sendTypeErrors(w http.ResponseWriter, errs []FieldError) {
+	writeFieldErrors(w, http.StatusUnsupportedMediaType, errs[0].Field+": "+errs[0].Message, errs)
+}
+
+func writeFieldErrors(w http.ResponseWriter, status int, message string, errs []FieldError) {
+	writeError(w, status, ErrorResponse{Error: message, Code: codeForStatus(status), Fields: errs})
+}
+
+func (def *OperationDef) parse(r *http.Request) (Params, []FieldError) {
+	params := Params{values: make(map[string]interface{}), set: make(map[string]bool)}
+	var errs []FieldError
+
+	for _, param := range def.Params {
+		raw := r.FormValue(param.Name)
+		if raw == "" {
+			if param.Required {
+				errs = append(errs, FieldError{param.Name, "is required"})
+			} else if param.Default != nil {
+				params.values[param.Name] = param.Default
+			}
+			continue
+		}
+
+		value, err := param.parse(raw)
+		if err != nil {
+			errs = append(errs, FieldError{param.Name, err.Error()})
+			continue
+		}
+		params.values[param.Name] = value
+		params.set[param.Name] = true
+	}
+
+	if len(errs) == 0 {
+		errs = append(errs, def.checkFiles(r, params)...)
+	}
+	if len(errs) == 0 && def.Validate != nil {
+		errs = append(errs, def.Validate(params)...)
+	}
+	return params, errs
+}
+
+// checkFiles makes sure every expected fileN part is present
+func (def *OperationDef) checkFiles(r *http.Request, params Params) []FieldError {
+	var errs []FieldError
+	for _, field := range def.fileFields(params) {
+		if len(formFiles(r, field)) == 0 {
+			errs = append(errs, FieldError{field, "file is required"})
+		}
+	}
+	return errs
+}
+
+// checkTypes sniffs every upload and rejects content the operation does
+// not accept. The client's filename is not trusted.
+func (def *OperationDef) checkTypes(r *http.Request, params Params) []FieldError {
+	var errs []FieldError
+	for _, field := range def.fileFields(params) {
+		upload := formFiles(r, field)[0]
+		typ, err := sniffUpload(upload)
+		if err != nil {
+			errs = append(errs, FieldError{field, fmt.Sprintf("cannot read file: %v", err)})
+			continue
+		}
+		upload.Type = typ
+		if !typ.matches(def.Files.Accept) {
+			errs = append(errs, FieldError{field, fmt.Sprintf("unsupported file type: detected %s (%s), expected one of %s",
+				typ.Name, typ.MIME, strings.Join(def.Files.Accept, ", "))})
+		}
+	}
+	return errs
+}
+
+func (def *OperationDef) fileFields(params Params) []string {
+	count := def.Files.Min
+	if def.Files.CountField {
+		count = params.Int("fileCount")
+	}
+	fields := make([]string, count)
+	for i := range fields {
+		fields[i] = fmt.Sprintf("file%d", i)
+	}
+	return fields
+}
+
+func sniffUpload(upload *Upload) (fileType, error) {
+	f, err := openStored(upload.Path)
+	if err != nil {
+		return fileType{}, err
+	}
+	defer f.Close()
+	typ := detectType(f, upload.Size)
+	// A single column has no separators to tell it from prose, so text
+	// the client calls a CSV is taken for one
+	if typ.MIME == typeText.MIME && strings.EqualFold(filepath.Ext(upload.Filename), ".csv") {
+		typ = typeCSV
+	}
+	return typ, nil
+}
+
+func (param Param) parse(raw string) (interface{}, error) {
+	switch param.Type {
+	case TypeString:
+		if param.MaxLength > 0 && len(raw) > param.MaxLength {
+			return nil, fmt.Errorf("must be at most %d characters", param.MaxLength)
+		}
+		if len(param.Enum) > 0 && !contains(param.Enum, raw) {
+			return nil, fmt.Errorf("must be one of %s", strings.Join(param.Enum, ", "))
+		}
+		if param.Pattern != "" && !regexp.MustCompile(param.Pattern).MatchString(raw) {
+			return nil, fmt.Errorf("must match %s", param.Pattern)
+		}
+		return raw, nil
+
+	case TypeInteger:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		if len(param.Enum) > 0 && !contains(param.Enum, strconv.Itoa(n)) {
+			return nil, fmt.Errorf("must be one of %s", strings.Join(param.Enum, ", "))
+		}
+		return n, param.checkRange(float64(n))
+
+	case TypeNumber:
+		f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return f, param.checkRange(f)
+
+	case TypeBoolean:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return b, nil
+
+	case TypeIntArray:
+		var ints []int
+		if err := json.Unmarshal([]byte(raw), &ints); err != nil {
+			return nil, fmt.Errorf("must be a JSON array of integers, e.g. %s", param.Example)
+		}
+		if len(ints) == 0 {
+			return nil, fmt.Errorf("must not be empty")
+		}
+		for _, n := range ints {
+			if err := param.checkRange(float64(n)); err != nil {
+				return nil, fmt.Errorf("element %d %v", n, err)
+			}
+		}
+		return ints, nil
+
+	case TypeJSON:
+		target := reflect.New(reflect.TypeOf(param.Shape))
+		dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(target.Interface()); err != nil {
+			return nil, fmt.Errorf("must be JSON like %s: %v", param.Example, err)
+		}
+		return target.Elem().Interface(), nil
+	}
+	return nil, fmt.Errorf("unsupported parameter type %s", param.Type)
+}
+
+func (param Param) checkRange(f float64) error {
+	if param.Min != nil && f < *param.Min {
+		return fmt.Errorf("must be at least %v", *param.Min)
+	}
+	if param.Max != nil && f > *param.Max {
+		return fmt.Errorf("must be at most %v", *param.Max)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"pdf-backend/ops"
+)
+
+// parseFields runs the named operation's parsing and validation on fields
+// as if they were posted with every file the operation expects
+func parseFields(t *testing.T, operation string, fields map[string]string) (Params, []FieldError) {
+	t.Helper()
+	def := lookupOperation(operation)
+	if def == nil {
+		t.Fatalf("unknown operation %s", operation)
+	}
+
+	form := make(url.Values)
+	for name, value := range fields {
+		form.Set(name, value)
+	}
+	files := def.Files.Min
+	if n, err := strconv.Atoi(fields["fileCount"]); err == nil && def.Files.CountField {
+		files = n
+	}
+	uploads := make(map[string][]*Upload)
+	for i := 0; i < files; i++ {
+		field := fmt.Sprintf("file%d", i)
+		uploads[field] = []*Upload{{Field: field}}
+	}
+
+	req := httptest.NewRequest("POST", def.Path, nil)
+	req.Form = form
+	req = req.WithContext(context.WithValue(req.Context(), uploadsKey{}, uploads))
+	return def.parse(req)
+}
+
+// fieldError is "field: message" of the first error, or "" for none
+func fieldError(errs []FieldError) string {
+	if len(errs) == 0 {
+		return ""
+	}
+	return errs[0].Field + ": " + errs[0].Message
+}
+
+func TestParamParse(t *testing.T) {
+	for _, tc := range []struct {
+		param Param
+		raw   string
+		want  string // error, "" if raw is valid
+	}{
+		{Param{Type: TypeString, MaxLength: 3}, "abcd", "must be at most 3 characters"},
+		{Param{Type: TypeString, Enum: []string{"a", "b"}}, "c", "must be one of a, b"},
+		{Param{Type: TypeString, Pattern: `^[a-z]+$`}, "A1", "must match ^[a-z]+$"},
+		{Param{Type: TypeString, Pattern: `^[a-z]+$`}, "abc", ""},
+		{Param{Type: TypeInteger, Min: floatPtr(1)}, "0", "must be at least 1"},
+		{Param{Type: TypeInteger, Max: floatPtr(10)}, "11", "must be at most 10"},
+		{Param{Type: TypeInteger}, "1.5", "must be an integer"},
+		{Param{Type: TypeInteger, Enum: []string{"90", "180"}}, " 90 ", ""},
+		{Param{Type: TypeInteger, Enum: []string{"90", "180"}}, "45", "must be one of 90, 180"},
+		{Param{Type: TypeNumber, Min: floatPtr(0)}, "-0.5", "must be at least 0"},
+		{Param{Type: TypeNumber}, "lots", "must be a number"},
+		{Param{Type: TypeBoolean}, "yes", "must be true or false"},
+		{Param{Type: TypeBoolean}, "1", ""},
+		{Param{Type: TypeIntArray, Example: "[1,2]"}, "1,2", "must be a JSON array of integers, e.g. [1,2]"},
+		{Param{Type: TypeIntArray}, "[]", "must not be empty"},
+		{Param{Type: TypeIntArray, Min: floatPtr(1)}, "[1,0]", "element 0 must be at least 1"},
+		{Param{Type: TypeJSON, Shape: map[string]int{}}, `{"a":1}`, ""},
+	} {
+		_, err := tc.param.parse(tc.raw)
+		if got := fmt.Sprint(err); (err == nil) != (tc.want == "") || (err != nil && got != tc.want) {
+			t.Errorf("%s %q: %v, want %q", tc.param.Type, tc.raw, err, tc.want)
+		}
+	}
+}
+
+func TestParseDefaultsAndRequired(t *testing.T) {
+	params, errs := parseFields(t, "security/protect", nil)
+	if fieldError(errs) != "password: is required" {
+		t.Errorf("without password: %v", errs)
+	}
+
+	params, errs = parseFields(t, "pdf/merge", map[string]string{"fileCount": "2"})
+	if len(errs) != 0 {
+		t.Fatalf("merge: %v", errs)
+	}
+	if params.String("sort") != "given" || !params.Bool("bookmarks") || params.Has("bookmarks") {
+		t.Errorf("defaults: sort %q, bookmarks %v, sent %v", params.String("sort"), params.Bool("bookmarks"), params.Has("bookmarks"))
+	}
+
+	// Files the count promises must have been uploaded
+	def := lookupOperation("pdf/merge")
+	req := httptest.NewRequest("POST", def.Path, nil)
+	req.Form = url.Values{"fileCount": {"3"}}
+	req = req.WithContext(context.WithValue(req.Context(), uploadsKey{}, map[string][]*Upload{
+		"file0": {{}}, "file1": {{}},
+	}))
+	if _, errs := def.parse(req); fieldError(errs) != "file2: file is required" {
+		t.Errorf("missing file: %v", errs)
+	}
+}
+
+func TestResultParams(t *testing.T) {
+	for _, tc := range []struct {
+		operation string
+		fields    map[string]string
+		want      string
+	}{
+		{"pdf/compress", map[string]string{"response": "inline", "deleteAfterDownload": "true", "share": "true"}, ""},
+		{"pdf/compress", map[string]string{"response": "manifest"}, "response: must be one of inline"},
+		{"pdf/compress", map[string]string{"response": "json"}, "response: must be one of inline"},
+		{"pdf/split", map[string]string{"mode": "individual", "response": "manifest"}, ""},
+		{"pdf/compress", map[string]string{"deleteAfterDownload": "yes"}, "deleteAfterDownload: must be true or false"},
+		{"pdf/compress", map[string]string{"share": "please"}, "share: must be true or false"},
+	} {
+		if _, errs := parseFields(t, tc.operation, tc.fields); fieldError(errs) != tc.want {
+			t.Errorf("%s %v: %q, want %q", tc.operation, tc.fields, fieldError(errs), tc.want)
+		}
+	}
+
+	// Every operation takes them and lists them for discovery
+	for _, def := range operationDefs {
+		for _, name := range []string{"response", "deleteAfterDownload", "share"} {
+			found := false
+			for _, param := range def.Params {
+				found = found || param.Name == name
+			}
+			if !found {
+				t.Errorf("%s does not declare %s", def.Name, name)
+			}
+		}
+	}
+}
+
+func TestValidateMerge(t *testing.T) {
+	for _, tc := range []struct {
+		fields map[string]string
+		want   string
+	}{
+		{map[string]string{"fileCount": "3", "pages": `{"file2":[{"start":1,"end":4}]}`}, ""},
+		{map[string]string{"fileCount": "2", "pages": `{"file2":[{"start":1,"end":1}]}`}, `pages: "file2" is not an uploaded file`},
+		{map[string]string{"fileCount": "2", "pages": `{"file0":[{"start":3,"end":2}]}`}, "pages: file0: invalid range 3-2"},
+		{map[string]string{"fileCount": "2", "pages": `{"file0":[{"start":0,"end":2}]}`}, "pages: file0: invalid range 0-2"},
+		{map[string]string{"fileCount": "2", "pages": `{"file0":[{"first":1}]}`}, "pages: must be JSON like"},
+		{map[string]string{"fileCount": "2", "mode": "interleave", "reverseSecond": "true"}, ""},
+		{map[string]string{"fileCount": "3", "mode": "interleave"}, "fileCount: mode=interleave takes exactly 2 files"},
+		{map[string]string{"fileCount": "2", "mode": "interleave", "sort": "name"}, "sort: not supported with mode=interleave"},
+		{map[string]string{"fileCount": "2", "mode": "interleave", "bookmarks": "false"}, "bookmarks: not supported with mode=interleave"},
+		{map[string]string{"fileCount": "2", "reverseSecond": "true"}, "reverseSecond: only supported with mode=interleave"},
+		{map[string]string{"fileCount": "1"}, "fileCount: must be at least 2"},
+	} {
+		_, errs := parseFields(t, "pdf/merge", tc.fields)
+		// Decoding errors end in the decoder's own message
+		if got := fieldError(errs); got != tc.want && (tc.want == "" || !strings.HasPrefix(got, tc.want)) {
+			t.Errorf("%v: %q, want %q", tc.fields, got, tc.want)
+		}
+	}
+}
+
+func TestValidateSplit(t *testing.T) {
+	for _, tc := range []struct {
+		fields map[string]string
+		want   string
+	}{
+		{map[string]string{"mode": "individual"}, ""},
+		{map[string]string{"ranges": `[{"start":1,"end":3}]`}, ""},
+		{map[string]string{"mode": "every", "every": "2"}, ""},
+		{map[string]string{"mode": "bookmarks", "level": "2"}, ""},
+		{map[string]string{"mode": "size", "maxSizeMB": "1.5"}, ""},
+		{map[string]string{"mode": "blank", "blankThreshold": "0.2"}, ""},
+		{map[string]string{"mode": "blank", "blankThreshold": "0"}, ""},
+		{nil, "mode: send either a mode or ranges"},
+		{map[string]string{"mode": "every", "ranges": `[{"start":1,"end":1}]`}, "mode: send either a mode or ranges"},
+		{map[string]string{"mode": "every"}, "every: required with mode=every"},
+		{map[string]string{"mode": "individual", "every": "2"}, "every: only applies to mode=every"},
+		{map[string]string{"mode": "every", "every": "2", "level": "1"}, "level: only applies to mode=bookmarks"},
+		{map[string]string{"mode": "blank", "maxSizeMB": "1"}, "maxSizeMB: only applies to mode=size"},
+		{map[string]string{"mode": "size", "blankThreshold": "1"}, "blankThreshold: only applies to mode=blank"},
+		{map[string]string{"mode": "size"}, "maxSizeMB: a positive size is required with mode=size"},
+		{map[string]string{"ranges": `[{"start":2,"end":1}]`}, "ranges: invalid range 2-1"},
+		{map[string]string{"mode": "chapters"}, "mode: must be one of individual, every, bookmarks, size, blank"},
+	} {
+		if _, errs := parseFields(t, "pdf/split", tc.fields); fieldError(errs) != tc.want {
+			t.Errorf("%v: %q, want %q", tc.fields, fieldError(errs), tc.want)
+		}
+	}
+}
+
+func TestSplitRenderDPI(t *testing.T) {
+	for _, tc := range []struct {
+		fields map[string]string
+		want   int
+	}{
+		{map[string]string{"mode": "every", "every": "2"}, 0},
+		{map[string]string{"mode": "blank"}, ops.InkCoverageDPI},
+		{map[string]string{"mode": "every", "every": "2", "thumbnails": "true"}, ops.ThumbnailDPI},
+		{map[string]string{"mode": "blank", "thumbnails": "true"}, ops.InkCoverageDPI},
+	} {
+		params, errs := parseFields(t, "pdf/split", tc.fields)
+		if len(errs) > 0 {
+			t.Fatalf("%v: %v", tc.fields, errs)
+		}
+		if dpi := lookupOperation("pdf/split").RenderDPI(params); dpi != tc.want {
+			t.Errorf("%v: %d DPI, want %d", tc.fields, dpi, tc.want)
+		}
+	}
+}
+
+func TestBatchMergeValidation(t *testing.T) {
+	oldTempDir, oldKeys := TempDir, APIKeys
+	TempDir, APIKeys = t.TempDir(), nil
+	t.Cleanup(func() { TempDir, APIKeys = oldTempDir, oldKeys })
+
+	batch := func(fields map[string]string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		for name, value := range fields {
+			form.WriteField(name, value)
+		}
+		n, _ := strconv.Atoi(fields["fileCount"])
+		for i := 0; i < n; i++ {
+			part, _ := form.CreateFormFile(fmt.Sprintf("file%d", i), "upload.pdf")
+			part.Write(minimalPDF())
+		}
+		form.Close()
+
+		req := httptest.NewRequest("POST", "/api/pdf/batch", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rec := httptest.NewRecorder()
+		setupRoutes().ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, tc := range []struct {
+		fields map[string]string
+		want   string
+	}{
+		{map[string]string{"operation": "merge", "fileCount": "3", "mode": "interleave"}, "mode=interleave takes exactly 2 files"},
+		{map[string]string{"operation": "merge", "fileCount": "2", "bookmarks": "maybe"}, "must be true or false"},
+		{map[string]string{"operation": "merge", "fileCount": "2", "pages": `{"file5":[{"start":1,"end":1}]}`}, "is not an uploaded file"},
+	} {
+		rec := batch(tc.fields)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tc.want) {
+			t.Errorf("%v: status %d: %s", tc.fields, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := batch(map[string]string{"operation": "merge", "fileCount": "2"}); rec.Code != http.StatusOK {
+		t.Errorf("valid batch merge: status %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"pdf-backend/ops"
+)
+
+// Sandbox config for the external converters
+var (
+	SandboxIsolation  = getEnv("SANDBOX_ISOLATION", "auto")
+	SandboxTools      = getEnv("SANDBOX_TOOLS", "")
+	SandboxCPUSeconds = getEnvInt("SANDBOX_CPU_SECONDS", 300)
+	SandboxMemoryMB   = getEnvInt("SANDBOX_MEMORY_MB", 4096)
+	SandboxFileSizeMB = getEnvInt("SANDBOX_FILE_SIZE_MB", 1024)
+)
+
+// configureSandbox sets ops.Sandbox from the config. "auto" uses strict
+// isolation where the host supports it and falls back to limits; a level
+// named explicitly must work or the server refuses to start.
+func configureSandbox() error {
+	sandbox := ops.SandboxConfig{
+		Default: ops.SandboxPolicy{
+			CPUTime:  time.Duration(SandboxCPUSeconds) * time.Second,
+			Memory:   int64(SandboxMemoryMB) << 20,
+			FileSize: int64(SandboxFileSizeMB) << 20,
+		},
+		Isolation: make(map[string]ops.Isolation),
+	}
+
+	if strings.EqualFold(SandboxIsolation, "auto") {
+		sandbox.Default.Isolation = ops.IsolationStrict
+		if err := ops.CheckSandbox(ops.IsolationStrict); err != nil {
+			log.Printf("⚠️  Strict tool sandbox unavailable, using resource limits only: %v", err)
+			sandbox.Default.Isolation = ops.IsolationLimits
+		}
+	} else {
+		level, err := ops.ParseIsolation(SandboxIsolation)
+		if err != nil {
+			return fmt.Errorf("SANDBOX_ISOLATION: %v", err)
+		}
+		sandbox.Default.Isolation = level
+	}
+
+	// SANDBOX_TOOLS overrides the level per tool: "libreoffice=limits,gs=strict"
+	for _, entry := range strings.Split(SandboxTools, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		tool, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("SANDBOX_TOOLS: %q is not tool=level", entry)
+		}
+		level, err := ops.ParseIsolation(value)
+		if err != nil {
+			return fmt.Errorf("SANDBOX_TOOLS: %s: %v", strings.TrimSpace(tool), err)
+		}
+		sandbox.Isolation[strings.TrimSpace(tool)] = level
+	}
+
+	// Every level named explicitly must work on this host
+	var levels []ops.Isolation
+	if !strings.EqualFold(SandboxIsolation, "auto") {
+		levels = append(levels, sandbox.Default.Isolation)
+	}
+	for _, level := range sandbox.Isolation {
+		levels = append(levels, level)
+	}
+	for _, level := range levels {
+		if err := ops.CheckSandbox(level); err != nil {
+			return fmt.Errorf("%s tool sandbox unavailable: %v", level, err)
+		}
+	}
+
+	ops.Sandbox = sandbox
+	return nil
+}
+
+// sandboxSummary describes the sandbox for logs and the admin config
+func sandboxSummary() map[string]interface{} {
+	tools := make(map[string]string)
+	for tool, level := range ops.Sandbox.Isolation {
+		tools[tool] = string(level)
+	}
+	return map[string]interface{}{
+		"isolation":  ops.Sandbox.Default.Isolation,
+		"tools":      tools,
+		"cpuSeconds": SandboxCPUSeconds,
+		"memoryMB":   SandboxMemoryMB,
+		"fileSizeMB": SandboxFileSizeMB,
+	}
+}
+
+func sandboxLogLine() string {
+	line := string(ops.Sandbox.Default.Isolation)
+	var overrides []string
+	for tool, level := range ops.Sandbox.Isolation {
+		overrides = append(overrides, tool+"="+string(level))
+	}
+	if len(overrides) > 0 {
+		sort.Strings(overrides)
+		line += " (" + strings.Join(overrides, ", ") + ")"
+	}
+	return fmt.Sprintf("%s, limits: %ds CPU, %d MB memory, %d MB files", line, SandboxCPUSeconds, SandboxMemoryMB, SandboxFileSizeMB)
+}
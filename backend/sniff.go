@@ -0,0 +1,257 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// sniffLen is how much of an upload is read to detect its type
+const sniffLen = 1024
+
+// pdfHeaderSlack is how many bytes may come before "%PDF-", for the byte
+// order marks and stray line ends some generators write
+const pdfHeaderSlack = 16
+
+const utf8BOM = "\xEF\xBB\xBF"
+
+// fileType is what an upload actually contains, judged by its bytes
+type fileType struct {
+	MIME string
+	Name string
+	// Exts are the upload extensions this content satisfies; the first is
+	// used when the client's own extension does not match
+	Exts []string
+}
+
+var (
+	typePDF  = fileType{"application/pdf", "PDF document", []string{".pdf"}}
+	typeJPEG = fileType{"image/jpeg", "JPEG image", []string{".jpg", ".jpeg"}}
+	typePNG  = fileType{"image/png", "PNG image", []string{".png"}}
+	typeGIF  = fileType{"image/gif", "GIF image", []string{".gif"}}
+	typeBMP  = fileType{"image/bmp", "BMP image", []string{".bmp"}}
+	typeTIFF = fileType{"image/tiff", "TIFF image", []string{".tif", ".tiff"}}
+	typeWebP = fileType{"image/webp", "WebP image", []string{".webp"}}
+	typeDOCX = fileType{outputDOCX, "Word document", []string{".docx"}}
+	typeXLSX = fileType{outputXLSX, "Excel workbook", []string{".xlsx"}}
+	typePPTX = fileType{outputPPTX, "PowerPoint presentation", []string{".pptx"}}
+	typeODT  = fileType{"application/vnd.oasis.opendocument.text", "OpenDocument text", []string{".odt"}}
+	typeODS  = fileType{"application/vnd.oasis.opendocument.spreadsheet", "OpenDocument spreadsheet", []string{".ods"}}
+	typeODP  = fileType{"application/vnd.oasis.opendocument.presentation", "OpenDocument presentation", []string{".odp"}}
+	typeZIP  = fileType{outputZIP, "ZIP archive", []string{".zip"}}
+	// The legacy binary Office formats share one container; telling them
+	// apart means parsing it, so any of them is accepted
+	typeOLE  = fileType{"application/x-ole-storage", "legacy Office document", []string{".doc", ".xls", ".ppt"}}
+	typeRTF  = fileType{"application/rtf", "RTF document", []string{".rtf"}}
+	typeHTML = fileType{"text/html", "HTML document", []string{".html", ".htm"}}
+	typeCSV  = fileType{"text/csv", "CSV table", []string{".csv"}}
+	typeText = fileType{"text/plain", "plain text", []string{".txt"}}
+)
+
+// magicTypes maps leading signatures to their type
+var magicTypes = []struct {
+	magic string
+	typ   fileType
+}{
+	{"\xFF\xD8\xFF", typeJPEG},
+	{"\x89PNG\r\n\x1a\n", typePNG},
+	{"GIF87a", typeGIF},
+	{"GIF89a", typeGIF},
+	{"II*\x00", typeTIFF},
+	{"MM\x00*", typeTIFF},
+	{"\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1", typeOLE},
+	{"{\\rtf", typeRTF},
+}
+
+// detectType identifies the content of an upload from its magic bytes
+func detectType(r io.ReaderAt, size int64) fileType {
+	head := make([]byte, sniffLen)
+	n, _ := r.ReadAt(head, 0)
+	head = head[:n]
+	if n == 0 {
+		return fileType{MIME: "application/x-empty", Name: "empty file"}
+	}
+
+	for _, m := range magicTypes {
+		if bytes.HasPrefix(head, []byte(m.magic)) {
+			return m.typ
+		}
+	}
+	// "BM" alone is too common at the start of text; the reserved header
+	// fields after the file size are always zero
+	if bytes.HasPrefix(head, []byte("BM")) && len(head) >= 10 && bytes.Equal(head[6:10], make([]byte, 4)) {
+		return typeBMP
+	}
+	if bytes.HasPrefix(head, []byte("RIFF")) && len(head) >= 12 && string(head[8:12]) == "WEBP" {
+		return typeWebP
+	}
+	if bytes.HasPrefix(head, []byte("PK\x03\x04")) {
+		return detectZipType(r, size)
+	}
+	// PDF readers tolerate a little junk before the header
+	if i := bytes.Index(head, []byte("%PDF-")); i >= 0 && i <= pdfHeaderSlack {
+		return typePDF
+	}
+
+	// http.DetectContentType does not skip a UTF-8 byte order mark
+	switch detected := http.DetectContentType(bytes.TrimPrefix(head, []byte(utf8BOM))); {
+	case strings.HasPrefix(detected, "text/html"):
+		return typeHTML
+	case strings.HasPrefix(detected, "text/xml") && bytes.Contains(bytes.ToLower(head), []byte("<html")):
+		return typeHTML
+	case isText(head) && isDelimited(head):
+		return typeCSV
+	case isText(head):
+		return typeText
+	default:
+		mime, _, _ := strings.Cut(detected, ";")
+		return fileType{MIME: mime, Name: "unrecognized data"}
+	}
+}
+
+// detectZipType tells Office Open XML and OpenDocument files from plain
+// ZIP archives by their entries
+func detectZipType(r io.ReaderAt, size int64) fileType {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return typeZIP
+	}
+	for _, f := range zr.File {
+		switch {
+		case f.Name == "mimetype":
+			if mime := readSmall(f); strings.HasPrefix(mime, "application/vnd.oasis.opendocument.") {
+				for _, t := range []fileType{typeODT, typeODS, typeODP} {
+					if mime == t.MIME {
+						return t
+					}
+				}
+			}
+		case strings.HasPrefix(f.Name, "word/"):
+			return typeDOCX
+		case strings.HasPrefix(f.Name, "xl/"):
+			return typeXLSX
+		case strings.HasPrefix(f.Name, "ppt/"):
+			return typePPTX
+		}
+	}
+	return typeZIP
+}
+
+func readSmall(f *zip.File) string {
+	rc, err := f.Open()
+	if err != nil {
+		return ""
+	}
+	defer rc.Close()
+	b, _ := io.ReadAll(io.LimitReader(rc, 128))
+	return strings.TrimSpace(string(b))
+}
+
+// isText reports whether head is UTF-8 without binary control bytes,
+// allowing a rune cut off at the end
+func isText(head []byte) bool {
+	for _, b := range head {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' {
+			return false
+		}
+	}
+	if utf8.Valid(head) {
+		return true
+	}
+	if len(head) < sniffLen {
+		return false
+	}
+	for i := 1; i < utf8.UTFMax; i++ {
+		if utf8.Valid(head[:len(head)-i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDelimited reports whether text looks like a table: its whole records
+// have the same number of commas, semicolons or tabs outside quotes, and
+// at least one of them. A lone record, such as a header, is enough.
+func isDelimited(head []byte) bool {
+	records := csvRecords(string(head))
+	if len(head) == sniffLen || records[len(records)-1] == "" {
+		// The last record is cut off or empty
+		records = records[:len(records)-1]
+	}
+	if len(records) == 0 {
+		return false
+	}
+	for _, sep := range []rune{',', ';', '\t'} {
+		want := fieldSeparators(records[0], sep)
+		same := want > 0
+		for _, record := range records[1:] {
+			same = same && fieldSeparators(record, sep) == want
+		}
+		if same {
+			return true
+		}
+	}
+	return false
+}
+
+// csvRecords splits text at line ends outside double quotes, so a quoted
+// field may span lines
+func csvRecords(text string) []string {
+	var records []string
+	start, quoted := 0, false
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '"':
+			quoted = !quoted
+		case text[i] == '\n' && !quoted:
+			records = append(records, strings.TrimSuffix(text[start:i], "\r"))
+			start = i + 1
+		}
+	}
+	return append(records, text[start:])
+}
+
+// fieldSeparators counts sep in line outside double quotes
+func fieldSeparators(line string, sep rune) int {
+	count, quoted := 0, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == sep && !quoted:
+			count++
+		}
+	}
+	return count
+}
+
+// matches reports whether the content satisfies one of the accepted
+// extensions
+func (t fileType) matches(accept []string) bool {
+	if len(accept) == 0 {
+		return true
+	}
+	for _, ext := range t.Exts {
+		if contains(accept, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// extFor picks the extension to store an upload under: the client's if it
+// agrees with the content, otherwise the content's own
+func (t fileType) extFor(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if contains(t.Exts, ext) {
+		return ext
+	}
+	if len(t.Exts) > 0 {
+		return t.Exts[0]
+	}
+	return ".bin"
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func zipWith(names ...string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, _ := zw.Create(name)
+		if name == "mimetype" {
+			f.Write([]byte(typeODS.MIME))
+		}
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestDetectType(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want fileType
+	}{
+		{"pdf", minimalPDF(), typePDF},
+		{"pdf after junk", append([]byte("\x00\x00junk\n"), minimalPDF()...), typePDF},
+		{"jpeg", []byte("\xFF\xD8\xFF\xE0\x00\x10JFIF"), typeJPEG},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00"), typePNG},
+		{"bmp", []byte("BM\x36\x00\x00\x00\x00\x00\x00\x00\x36\x00"), typeBMP},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), typeWebP},
+		{"docx", zipWith("[Content_Types].xml", "word/document.xml"), typeDOCX},
+		{"ods", zipWith("mimetype", "content.xml"), typeODS},
+		{"zip", zipWith("notes.txt"), typeZIP},
+		{"ole", []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1\x00"), typeOLE},
+		{"html", []byte("<!DOCTYPE html><html><body>hi</body></html>"), typeHTML},
+		{"csv", []byte("BMW,Munich\nAudi,Ingolstadt\n"), typeCSV},
+		{"csv with quotes", []byte("name;city\r\n\"Müller; Sohn\";Köln\r\nSchmidt;Bonn"), typeCSV},
+		{"tsv", []byte("a\tb\tc\n1\t2\t3\n"), typeCSV},
+		{"csv header only", []byte("name,city,zip\n"), typeCSV},
+		{"csv single row", []byte("Audi;Ingolstadt;85045"), typeCSV},
+		{"csv quoted line break", []byte("name,address\nKim,\"Hauptstr. 1\nBerlin\"\nLee,Bonn\n"), typeCSV},
+		{"csv with BOM", []byte("\xEF\xBB\xBFname,city\nKim,Berlin\n"), typeCSV},
+		{"html with BOM", []byte("\xEF\xBB\xBF<!DOCTYPE html><html><body>hi</body></html>"), typeHTML},
+		{"prose", []byte("Dear team,\nthe report is attached.\nRegards, Kim\n"), typeText},
+		{"pdf header in text", append(append([]byte("Dear team, see below.\n"), bytes.Repeat([]byte("x"), 40)...), minimalPDF()...), typeText},
+	} {
+		got := detectType(bytes.NewReader(tc.data), int64(len(tc.data)))
+		if got.MIME != tc.want.MIME {
+			t.Errorf("%s: detected %s, want %s", tc.name, got.MIME, tc.want.MIME)
+		}
+	}
+
+	if got := detectType(bytes.NewReader([]byte{0, 1, 2, 3}), 4); got.Exts != nil {
+		t.Errorf("binary junk detected as %+v", got)
+	}
+}
+
+func TestSniffUploadCSVName(t *testing.T) {
+	dir := t.TempDir()
+	sniff := func(filename, content string) fileType {
+		path := filepath.Join(dir, filename)
+		os.WriteFile(path, []byte(content), 0644)
+		typ, err := sniffUpload(&Upload{Filename: filename, Path: path, Size: int64(len(content))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return typ
+	}
+
+	// A single column has no separators, so only its name marks it
+	if typ := sniff("list.csv", "name\nKim\nLee\n"); typ.MIME != typeCSV.MIME {
+		t.Errorf("single-column CSV detected as %s", typ.MIME)
+	}
+	if typ := sniff("list.txt", "name\nKim\nLee\n"); typ.MIME != typeText.MIME {
+		t.Errorf("text detected as %s", typ.MIME)
+	}
+	if typ := sniff("photo.csv", "\xFF\xD8\xFF\xE0\x00\x10JFIF"); typ.MIME != typeJPEG.MIME {
+		t.Errorf("JPEG named .csv detected as %s", typ.MIME)
+	}
+}
+
+func TestSpreadsheetRejectsText(t *testing.T) {
+	if typeText.matches(acceptExcel) {
+		t.Error("plain text accepted as a spreadsheet")
+	}
+	if !typeCSV.matches(acceptExcel) || typeCSV.matches(acceptWord) {
+		t.Error("CSV accepted by the wrong operations")
+	}
+}
+
+func TestExtFor(t *testing.T) {
+	if ext := typeJPEG.extFor("photo.JPEG"); ext != ".jpeg" {
+		t.Errorf("matching extension = %s", ext)
+	}
+	if ext := typePDF.extFor("scan.jpg"); ext != ".pdf" {
+		t.Errorf("mismatched extension = %s", ext)
+	}
+	if ext := typeOLE.extFor("sheet.xls"); ext != ".xls" {
+		t.Errorf("legacy office extension = %s", ext)
+	}
+}
+
+func TestUploadTypeMismatch(t *testing.T) {
+	oldTempDir, oldKeys := TempDir, APIKeys
+	TempDir, APIKeys = t.TempDir(), nil
+	t.Cleanup(func() { TempDir, APIKeys = oldTempDir, oldKeys })
+
+	upload := func(path string, files map[string][]byte, fields map[string]string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		for name, value := range fields {
+			form.WriteField(name, value)
+		}
+		for field, data := range files {
+			part, _ := form.CreateFormFile(field, "upload.bin")
+			part.Write(data)
+		}
+		form.Close()
+
+		req := httptest.NewRequest("POST", path, &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rec := httptest.NewRecorder()
+		setupRoutes().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A JPEG named .pdf is refused with the detected type
+	rec := upload("/api/pdf/merge", map[string][]byte{
+		"file0": minimalPDF(),
+		"file1": []byte("\xFF\xD8\xFF\xE0\x00\x10JFIF"),
+	}, map[string]string{"fileCount": "2"})
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var payload struct {
+		Error  string       `json:"error"`
+		Fields []FieldError `json:"fields"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &payload)
+	if len(payload.Fields) != 1 || payload.Fields[0].Field != "file1" || !strings.Contains(payload.Error, "image/jpeg") {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	// A PDF is stored under .pdf whatever the client called it
+	rec = upload("/api/pdf/rotate", map[string][]byte{"file0": minimalPDF()}, map[string]string{"angle": "90"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rotate status = %d: %s", rec.Code, rec.Body.String())
+	}
+	ws, err := newWorkspace(AnonymousNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Remove()
+	stored := &Upload{Field: "file0", Filename: "upload.bin", Path: ws.File("upload", ""), Type: typePDF}
+	os.WriteFile(stored.Path, minimalPDF(), 0644)
+	uploads := map[string][]*Upload{"file0": {stored}}
+	req := httptest.NewRequest("POST", "/api/pdf/rotate", nil)
+	req = req.WithContext(context.WithValue(req.Context(), uploadsKey{}, uploads))
+	if path, err := saveUploadedFile(req, "file0"); err != nil || filepath.Ext(path) != ".pdf" {
+		t.Errorf("saved upload = %q, %v", path, err)
+	}
+}
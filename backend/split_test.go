@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// postSplit sends minimalPDF as scan.pdf to the split endpoint
+func postSplit(fields map[string]string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	part, _ := form.CreateFormFile("file0", "scan.pdf")
+	part.Write(minimalPDF())
+	form.Close()
+	req := httptest.NewRequest("POST", "/api/pdf/split", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	setupRoutes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSplitModes(t *testing.T) {
+	oldTempDir, oldKeys := TempDir, APIKeys
+	TempDir, APIKeys = t.TempDir(), nil
+	t.Cleanup(func() { TempDir, APIKeys = oldTempDir, oldKeys })
+	split := postSplit
+
+	var resp struct {
+		DownloadURL string   `json:"downloadUrl"`
+		Warnings    []string `json:"warnings"`
+	}
+	rec := split(map[string]string{"mode": "every", "every": "2"})
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.DownloadURL == "" || len(resp.Warnings) != 0 {
+		t.Fatalf("every: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// A page over the limit is still written, with a warning
+	resp.Warnings = nil
+	rec = split(map[string]string{"mode": "size", "maxSizeMB": "0.0001"})
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Warnings) != 1 || rec.Header().Get("Warning") == "" {
+		t.Errorf("size: %d %s", rec.Code, rec.Body.String())
+	}
+
+	for _, fields := range []map[string]string{
+		{},
+		{"mode": "every"},
+		{"mode": "size", "maxSizeMB": "0"},
+		{"mode": "bookmarks", "every": "2"},
+		{"mode": "individual", "ranges": `[{"start":1,"end":1}]`},
+		{"ranges": `[{"start":1,"end":1}]`, "level": "2"},
+		// Only known once the file is read
+		{"mode": "bookmarks"},
+		{"ranges": `[{"start":1,"end":2}]`},
+	} {
+		if rec := split(fields); rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: %d %s", fields, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestSplitManifest(t *testing.T) {
+	oldTempDir, oldKeys := TempDir, APIKeys
+	TempDir, APIKeys = t.TempDir(), nil
+	t.Cleanup(func() { TempDir, APIKeys = oldTempDir, oldKeys })
+
+	rec := postSplit(map[string]string{"mode": "individual", "response": "manifest"})
+	var resp struct {
+		DownloadURL string         `json:"downloadUrl"`
+		Parts       []ManifestPart `json:"parts"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Parts) != 1 {
+		t.Fatalf("%d %s", rec.Code, rec.Body.String())
+	}
+	part := resp.Parts[0]
+	if part.Name != "scan-page-1.pdf" || part.Pages.Start != 1 || part.Pages.End != 1 || part.PageCount != 1 ||
+		part.ThumbnailURL != "" {
+		t.Errorf("part = %+v", part)
+	}
+	if !strings.Contains(resp.DownloadURL, "scan-split.zip") {
+		t.Errorf("ZIP link = %s", resp.DownloadURL)
+	}
+
+	// Each part downloads on its own
+	u, _ := url.Parse(part.DownloadURL)
+	download := httptest.NewRecorder()
+	setupRoutes().ServeHTTP(download, httptest.NewRequest("GET", u.RequestURI(), nil))
+	if download.Code != http.StatusOK || !bytes.HasPrefix(download.Body.Bytes(), []byte("%PDF")) || int64(download.Body.Len()) != part.Size {
+		t.Errorf("part download: %d, %d bytes, manifest says %d", download.Code, download.Body.Len(), part.Size)
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tenant config
+var (
+	// API_KEYS is a comma-separated list of "key:namespace" or
+	// "key:namespace:plan" entries
+	APIKeys          = parseAPIKeys(getEnv("API_KEYS", ""))
+	RequireAPIKey    = getEnv("REQUIRE_API_KEY", "false") == "true"
+	ShareSecret      = loadShareSecret(getEnv("SHARE_SECRET", ""))
+	NamespaceQuotaMB = getEnvInt("NAMESPACE_QUOTA_MB", 500)
+)
+
+// AnonymousNamespace holds files uploaded without an API key. Nobody owns
+// it, so its files can only be downloaded with a share token. Each client
+// gets a namespace of its own under this prefix, see anonymousNamespace.
+const AnonymousNamespace = "anonymous"
+
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// APIKey is what an API key grants: its namespace and the plan whose
+// limits apply to it
+type APIKey struct {
+	Namespace string
+	Plan      string
+}
+
+// Principal identifies who a request is made on behalf of
+type Principal struct {
+	Namespace     string
+	Plan          string
+	Authenticated bool
+	Admin         bool
+}
+
+type principalKey struct{}
+
+func parseAPIKeys(value string) map[string]APIKey {
+	keys := make(map[string]APIKey)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) < 2 || parts[0] == "" || !namespacePattern.MatchString(parts[1]) {
+			log.Printf("⚠️  Ignoring malformed API_KEYS entry")
+			continue
+		}
+		if parts[1] == AnonymousNamespace || parts[1] == AdminNamespace || strings.HasPrefix(parts[1], AnonymousNamespace+"-") {
+			log.Printf("⚠️  Ignoring API key mapped to reserved namespace %q", parts[1])
+			continue
+		}
+		key := APIKey{Namespace: parts[1]}
+		if len(parts) == 3 {
+			key.Plan = parts[2]
+		}
+		keys[parts[0]] = key
+	}
+	return keys
+}
+
+func loadShareSecret(value string) []byte {
+	if value != "" {
+		return []byte(value)
+	}
+	// Without a configured secret, share links stop working at restart
+	// even though reconcileTempDir keeps the files behind them; main warns
+	// when that happens
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("Failed to generate share secret: %v", err)
+	}
+	return secret
+}
+
+// shareSecretConfigured reports whether share links survive a restart
+func shareSecretConfigured() bool {
+	return getEnv("SHARE_SECRET", "") != ""
+}
+
+// Auth middleware resolves the caller's namespace from their API key
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := Principal{Namespace: anonymousNamespace(r)}
+
+		if key := requestAPIKey(r); key != "" && isAdminKey(key) {
+			principal = Principal{Namespace: AdminNamespace, Authenticated: true, Admin: true}
+		} else if key != "" {
+			apiKey, ok := lookupAPIKey(key)
+			if !ok {
+				sendError(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+			principal = Principal{Namespace: apiKey.Namespace, Plan: apiKey.Plan, Authenticated: true}
+		} else if RequireAPIKey && requiresAPIKey(r) {
+			sendError(w, "API key required", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalKey{}, principal)
+		r = r.WithContext(ctx)
+
+		if r.Method == "POST" && strings.HasPrefix(r.URL.Path, "/api/") {
+			// A chunked body has no length to check up front, so it is
+			// checked for room now and held to that room as it is read
+			incoming := r.ContentLength
+			if incoming < 0 {
+				incoming = 0
+			}
+			if err := checkDiskSpace(incoming); err != nil {
+				sendError(w, err.Error(), http.StatusInsufficientStorage)
+				return
+			}
+			if err := checkQuota(r, incoming); err != nil {
+				sendError(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if r.ContentLength < 0 {
+				r.Body = limitUnsizedBody(r)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Health checks and share-token downloads stay reachable without a key
+func requiresAPIKey(r *http.Request) bool {
+	if r.URL.Path == "/health" {
+		return false
+	}
+	return !strings.HasPrefix(r.URL.Path, "/files/")
+}
+
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+func lookupAPIKey(key string) (APIKey, bool) {
+	for candidate, apiKey := range APIKeys {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			return apiKey, true
+		}
+	}
+	return APIKey{}, false
+}
+
+func isAdminKey(key string) bool {
+	for _, candidate := range AdminAPIKeys {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// anonymousNamespace gives each client without a key, told apart by its
+// address, a namespace and quota of its own, so one of them cannot fill
+// the room of all the others. The address is not readable from the name.
+func anonymousNamespace(r *http.Request) string {
+	mac := hmac.New(sha256.New, ShareSecret)
+	fmt.Fprintf(mac, "anonymous|%s", clientIP(r))
+	return AnonymousNamespace + "-" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+func principalFrom(r *http.Request) Principal {
+	if p, ok := r.Context().Value(principalKey{}).(Principal); ok {
+		return p
+	}
+	return Principal{Namespace: AnonymousNamespace}
+}
+
+// namespaceDir returns the uploads or output directory of the caller's
+// namespace, creating it on first use
+func namespaceDir(r *http.Request, kind string) string {
+	dir := filepath.Join(TempDir, "ns", principalFrom(r).Namespace, kind)
+	os.MkdirAll(dir, 0755)
+	return dir
+}
+
+// namespaceOf returns the namespace a registered path lives in
+func namespaceOf(path string) string {
+	rel, err := filepath.Rel(filepath.Join(TempDir, "ns"), path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+}
+
+// ==================== SHARE TOKENS ====================
+
+// shareToken signs namespace/filename with an expiry as "<unix>.<sig>"
+func shareToken(namespace, filename string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + shareSignature(namespace, filename, exp)
+}
+
+func shareSignature(namespace, filename, exp string) string {
+	mac := hmac.New(sha256.New, ShareSecret)
+	fmt.Fprintf(mac, "%s/%s|%s", namespace, filename, exp)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func validShareToken(namespace, filename, token string) bool {
+	exp, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expUnix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expUnix {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(shareSignature(namespace, filename, exp)))
+}
+
+// downloadURL builds the link to a stored file. Only the owning
+// namespace's key can fetch it; see shareURL for a link to hand on.
+func downloadURL(namespace, filename string) string {
+	return fmt.Sprintf("%s/files/%s/%s", Host, url.PathEscape(namespace), url.PathEscape(filename))
+}
+
+// shareURL builds a link that works for anyone holding it until expires
+func shareURL(namespace, filename string, expires time.Time) string {
+	return downloadURL(namespace, filename) + "?token=" + shareToken(namespace, filename, expires)
+}
+
+// wantsShareLink reports whether the client asked for a result link that
+// works without its key, with share=true. Anonymous callers own nothing,
+// so a share link is the only kind they can use.
+func wantsShareLink(r *http.Request) bool {
+	return paramsFrom(r).Bool("share") || !principalFrom(r).Authenticated
+}
+
+// POST /files/{namespace}/{filename} mints a share link for a file the
+// caller owns. It expires with the file, and holding one link does not
+// let anyone mint another.
+func handleShareFile(w http.ResponseWriter, r *http.Request, path string, isOwner bool) {
+	if !isOwner && !principalFrom(r).Admin {
+		sendError(w, "Only the owner's key can share a file", http.StatusForbidden)
+		return
+	}
+	info, ok := registeredFile(path)
+	if ok && info.DeletedAt != nil {
+		sendError(w, "File was deleted", http.StatusGone)
+		return
+	}
+	if _, err := os.Stat(path); !ok || err != nil {
+		sendError(w, "File not found or expired", http.StatusNotFound)
+		return
+	}
+
+	expires := info.CreatedAt.Add(time.Duration(FileTTLMinutes) * time.Minute)
+	sendJSON(w, map[string]interface{}{
+		"downloadUrl": shareURL(namespaceOf(path), filepath.Base(path), expires),
+		"expiresAt":   expires.UTC(),
+	})
+}
+
+// ==================== QUOTAS ====================
+
+// namespaceUsage sums the bytes stored under a namespace
+func namespaceUsage(namespace string) int64 {
+	return dirSize(filepath.Join(TempDir, "ns", namespace))
+}
+
+// checkQuota makes sure the caller's namespace has room for incoming
+// bytes, evicting its expired files before giving up
+func checkQuota(r *http.Request, incoming int64) error {
+	if NamespaceQuotaMB <= 0 {
+		return nil
+	}
+	namespace := principalFrom(r).Namespace
+	quota := int64(NamespaceQuotaMB) << 20
+
+	if namespaceUsage(namespace)+incoming <= quota {
+		return nil
+	}
+	cleanupNamespace(namespace)
+	if namespaceUsage(namespace)+incoming <= quota {
+		return nil
+	}
+	return fmt.Errorf("storage quota of %d MB exceeded for namespace %s", NamespaceQuotaMB, namespace)
+}
+
+// limitUnsizedBody caps a body sent without Content-Length at the room
+// left in the caller's quota and on disk. Reading past it fails with the
+// error checkQuota or checkDiskSpace would have given for the full body.
+func limitUnsizedBody(r *http.Request) io.ReadCloser {
+	var body *storageLimit
+	if NamespaceQuotaMB > 0 {
+		namespace := principalFrom(r).Namespace
+		body = &storageLimit{ReadCloser: r.Body, room: int64(NamespaceQuotaMB)<<20 - namespaceUsage(namespace),
+			err: tooLarge("storage quota of %d MB exceeded for namespace %s", NamespaceQuotaMB, namespace)}
+	}
+	if MinFreeDiskMB > 0 {
+		free, _, err := diskFree(TempDir)
+		if room := free - int64(MinFreeDiskMB)<<20; err == nil && (body == nil || room < body.room) {
+			body = &storageLimit{ReadCloser: r.Body, room: room, err: &uploadError{http.StatusInsufficientStorage,
+				fmt.Sprintf("insufficient storage on the server: %d MB free", free>>20)}}
+		}
+	}
+	if body == nil {
+		return r.Body
+	}
+	return body
+}
+
+// storageLimit fails reads once more than room bytes were read
+type storageLimit struct {
+	io.ReadCloser
+	room int64
+	err  error
+}
+
+func (l *storageLimit) Read(p []byte) (int, error) {
+	if l.room < 0 {
+		return 0, l.err
+	}
+	if int64(len(p)) > l.room+1 {
+		p = p[:l.room+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.room -= int64(n)
+	if l.room < 0 {
+		return n, l.err
+	}
+	return n, err
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withTenants(t *testing.T) http.Handler {
+	oldTempDir, oldKeys, oldQuota := TempDir, APIKeys, NamespaceQuotaMB
+	TempDir, APIKeys = t.TempDir(), parseAPIKeys("k1:acme,k2:beta")
+	t.Cleanup(func() { TempDir, APIKeys, NamespaceQuotaMB = oldTempDir, oldKeys, oldQuota })
+	return authMiddleware(setupRoutes())
+}
+
+// rotateAs runs pdf/rotate on data with key and returns the response
+func rotateAs(handler http.Handler, key, query string, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("angle", "90")
+	part, _ := form.CreateFormFile("file0", "in.pdf")
+	part.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/api/pdf/rotate"+query, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func resultTarget(t *testing.T, rec *httptest.ResponseRecorder) string {
+	var resp struct {
+		DownloadURL string `json:"downloadUrl"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.DownloadURL == "" {
+		t.Fatalf("%d %s", rec.Code, rec.Body.String())
+	}
+	u, _ := url.Parse(resp.DownloadURL)
+	return u.RequestURI()
+}
+
+func TestNamespaceIsolation(t *testing.T) {
+	handler := withTenants(t)
+	fetch := func(method, target, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Keyed results come without a token and only their owner can fetch them
+	target := resultTarget(t, rotateAs(handler, "k1", "", minimalPDF()))
+	if strings.Contains(target, "token=") || !strings.HasPrefix(target, "/files/acme/") {
+		t.Fatalf("owner link = %s", target)
+	}
+	if rec := fetch("GET", target, "k1"); rec.Code != http.StatusOK {
+		t.Errorf("owner download: %d", rec.Code)
+	}
+	for _, key := range []string{"k2", ""} {
+		if rec := fetch("GET", target, key); rec.Code != http.StatusNotFound {
+			t.Errorf("download with key %q: %d", key, rec.Code)
+		}
+	}
+
+	// Share links are minted on request, by the owner only
+	if rec := fetch("POST", target, "k2"); rec.Code != http.StatusNotFound {
+		t.Errorf("share by another key: %d", rec.Code)
+	}
+	shared := resultTarget(t, fetch("POST", target, "k1"))
+	if rec := fetch("GET", shared, ""); rec.Code != http.StatusOK {
+		t.Errorf("shared download: %d", rec.Code)
+	}
+	if rec := fetch("POST", shared, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("share with a token: %d", rec.Code)
+	}
+	opted := resultTarget(t, rotateAs(handler, "k1", "?share=true", minimalPDF()))
+	if rec := fetch("GET", opted, "k2"); rec.Code != http.StatusOK {
+		t.Errorf("share=true download: %d", rec.Code)
+	}
+
+	// Anonymous results always carry a token since nobody owns them
+	if anon := resultTarget(t, rotateAs(handler, "", "", minimalPDF())); !strings.Contains(anon, "token=") {
+		t.Errorf("anonymous link = %s", anon)
+	}
+
+	// Tokens only work for the file, namespace and time they were signed for
+	u, _ := url.Parse(target)
+	filename := filepath.Base(u.Path)
+	valid := shareToken("acme", filename, time.Now().Add(time.Hour))
+	exp, _, _ := strings.Cut(valid, ".")
+	for name, token := range map[string]string{
+		"expired":        shareToken("acme", filename, time.Now().Add(-time.Minute)),
+		"forged":         exp + ".AAAA",
+		"extended":       strings.Replace(valid, exp, exp+"0", 1),
+		"other file":     shareToken("acme", "other.pdf", time.Now().Add(time.Hour)),
+		"other tenant":   shareToken("beta", filename, time.Now().Add(time.Hour)),
+		"no signature":   exp,
+		"not a deadline": "soon." + shareSignature("acme", filename, "soon"),
+	} {
+		if rec := fetch("GET", u.Path+"?token="+url.QueryEscape(token), ""); rec.Code != http.StatusNotFound {
+			t.Errorf("%s token: %d", name, rec.Code)
+		}
+	}
+	if rec := fetch("GET", "/files/beta/"+filename+"?token="+valid, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("token moved to another namespace: %d", rec.Code)
+	}
+}
+
+func TestNamespaceQuota(t *testing.T) {
+	handler := withTenants(t)
+	NamespaceQuotaMB = 1
+
+	big := append(minimalPDF(), bytes.Repeat([]byte("\n"), 2<<20)...)
+	rec := rotateAs(handler, "k1", "", big)
+	if rec.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rec.Body.String(), "quota") {
+		t.Errorf("over quota: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Other namespaces keep their own room
+	full := filepath.Join(TempDir, "ns", "acme", "output", "full.bin")
+	os.MkdirAll(filepath.Dir(full), 0755)
+	os.WriteFile(full, make([]byte, 1<<20), 0644)
+	registerFile(full)
+	if rec := rotateAs(handler, "k1", "", minimalPDF()); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("full namespace: %d", rec.Code)
+	}
+	if rec := rotateAs(handler, "k2", "", minimalPDF()); rec.Code != http.StatusOK {
+		t.Errorf("other namespace: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAnonymousQuotaPerClient(t *testing.T) {
+	handler := withTenants(t)
+	NamespaceQuotaMB = 1
+
+	rotateFrom := func(addr string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("angle", "90")
+		part, _ := form.CreateFormFile("file0", "in.pdf")
+		part.Write(minimalPDF())
+		form.Close()
+
+		req := httptest.NewRequest("POST", "/api/pdf/rotate", &body)
+		req.RemoteAddr = addr
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// One anonymous client filling its room leaves the others theirs
+	first := resultTarget(t, rotateFrom("192.0.2.1:1234"))
+	ns := strings.Split(first, "/")[2]
+	if !strings.HasPrefix(ns, AnonymousNamespace+"-") || strings.Contains(ns, "192.0.2.1") {
+		t.Fatalf("anonymous namespace = %s", ns)
+	}
+	full := filepath.Join(TempDir, "ns", ns, "output", "full.bin")
+	os.WriteFile(full, make([]byte, 1<<20), 0644)
+	registerFile(full)
+	if rec := rotateFrom("192.0.2.1:5678"); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("same client over quota: %d", rec.Code)
+	}
+	if rec := rotateFrom("198.51.100.7:1234"); rec.Code != http.StatusOK {
+		t.Errorf("other client: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Keys cannot claim an anonymous namespace
+	if keys := parseAPIKeys("k3:" + ns); len(keys) != 0 {
+		t.Errorf("key mapped to %s", ns)
+	}
+}
+
+func TestChunkedUploadQuota(t *testing.T) {
+	handler := withTenants(t)
+	NamespaceQuotaMB = 1
+
+	chunked := func(data []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("angle", "90")
+		part, _ := form.CreateFormFile("file0", "in.pdf")
+		part.Write(data)
+		form.Close()
+
+		// Without a length the body can only be checked as it is read
+		req := httptest.NewRequest("POST", "/api/pdf/rotate", io.MultiReader(&body))
+		req.ContentLength = -1
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.Header.Set("X-API-Key", "k1")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	big := append(minimalPDF(), bytes.Repeat([]byte("\n"), 2<<20)...)
+	if rec := chunked(big); rec.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rec.Body.String(), "quota") {
+		t.Errorf("chunked over quota: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := chunked(minimalPDF()); rec.Code != http.StatusOK {
+		t.Errorf("chunked within quota: %d %s", rec.Code, rec.Body.String())
+	}
+}
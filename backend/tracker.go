@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"pdf-backend/ops"
+)
+
+// Concurrency config
+var MaxConcurrentOps = getEnvInt("MAX_CONCURRENT_OPS", 4)
+
+// Operation states
+const (
+	StateUploading = "uploading"
+	StateQueued    = "queued"
+	StateRunning   = "running"
+)
+
+// TrackedOperation is a document operation whose upload is still being
+// read, that is waiting for a slot or that is running
+type TrackedOperation struct {
+	ID         string     `json:"id"`
+	Operation  string     `json:"operation"`
+	Namespace  string     `json:"namespace"`
+	State      string     `json:"state"`
+	ReceivedAt time.Time  `json:"receivedAt"`
+	QueuedAt   *time.Time `json:"queuedAt,omitempty"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	// UploadSeconds is how long reading and checking the request took,
+	// so far while it is still uploading
+	UploadSeconds float64 `json:"uploadSeconds"`
+	PIDs          []int   `json:"pids"`
+
+	cancel context.CancelFunc
+}
+
+type trackedKey struct{}
+
+var (
+	operations   = make(map[string]*TrackedOperation)
+	operationsMu sync.Mutex
+	opSlots      = make(chan struct{}, maxInt(MaxConcurrentOps, 1))
+
+	// Operations switched off at runtime through the admin API
+	disabledOps   = make(map[string]bool)
+	disabledOpsMu sync.RWMutex
+)
+
+// Track middleware makes document operations visible and cancellable
+// through the admin API. They queue behind MAX_CONCURRENT_OPS only once
+// their upload is read and checked, see acquireSlot, so slow uploaders
+// cannot hold the slots.
+func trackMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || !isDocumentOperation(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		name := strings.TrimPrefix(r.URL.Path, "/api/")
+		if !operationEnabled(name) {
+			sendError(w, "Operation is temporarily disabled", http.StatusServiceUnavailable)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		op := &TrackedOperation{
+			ID:         uuid.New().String(),
+			Operation:  name,
+			Namespace:  principalFrom(r).Namespace,
+			State:      StateUploading,
+			ReceivedAt: time.Now(),
+			PIDs:       []int{},
+			cancel:     cancel,
+		}
+		operationsMu.Lock()
+		operations[op.ID] = op
+		operationsMu.Unlock()
+		defer func() {
+			operationsMu.Lock()
+			delete(operations, op.ID)
+			operationsMu.Unlock()
+		}()
+
+		ctx = context.WithValue(ops.WithToolObserver(ctx, op), trackedKey{}, op)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// acquireSlot waits for one of the MAX_CONCURRENT_OPS slots and marks the
+// tracked operation, if any, running. It returns false if ctx ends first;
+// otherwise the caller must call release when done.
+func acquireSlot(ctx context.Context) (release func(), ok bool) {
+	op, _ := ctx.Value(trackedKey{}).(*TrackedOperation)
+	if op != nil {
+		operationsMu.Lock()
+		now := time.Now()
+		op.State = StateQueued
+		op.QueuedAt = &now
+		operationsMu.Unlock()
+	}
+
+	select {
+	case opSlots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, false
+	}
+
+	if op != nil {
+		operationsMu.Lock()
+		now := time.Now()
+		op.State = StateRunning
+		op.StartedAt = &now
+		operationsMu.Unlock()
+	}
+	return func() { <-opSlots }, true
+}
+
+// ToolStarted records the PID of a tool the operation started, see
+// ops.WithToolObserver
+func (op *TrackedOperation) ToolStarted(pid int) {
+	operationsMu.Lock()
+	defer operationsMu.Unlock()
+	op.PIDs = append(op.PIDs, pid)
+}
+
+func (op *TrackedOperation) ToolExited(pid int) {
+	operationsMu.Lock()
+	defer operationsMu.Unlock()
+	for i, p := range op.PIDs {
+		if p == pid {
+			op.PIDs = append(op.PIDs[:i], op.PIDs[i+1:]...)
+			break
+		}
+	}
+}
+
+// listOperations returns copies of all tracked operations, oldest first
+func listOperations() []TrackedOperation {
+	operationsMu.Lock()
+	defer operationsMu.Unlock()
+
+	list := make([]TrackedOperation, 0, len(operations))
+	for _, op := range operations {
+		cp := *op
+		cp.PIDs = append([]int{}, op.PIDs...)
+		uploadEnd := time.Now()
+		if op.QueuedAt != nil {
+			uploadEnd = *op.QueuedAt
+		}
+		cp.UploadSeconds = uploadEnd.Sub(op.ReceivedAt).Seconds()
+		list = append(list, cp)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ReceivedAt.Before(list[j].ReceivedAt) })
+	return list
+}
+
+// cancelOperation cancels a queued or running operation, killing its tools
+func cancelOperation(id string) bool {
+	operationsMu.Lock()
+	defer operationsMu.Unlock()
+
+	op, ok := operations[id]
+	if ok {
+		op.cancel()
+	}
+	return ok
+}
+
+func operationEnabled(name string) bool {
+	disabledOpsMu.RLock()
+	defer disabledOpsMu.RUnlock()
+	return !disabledOps[name]
+}
+
+func setOperationEnabled(name string, enabled bool) {
+	disabledOpsMu.Lock()
+	defer disabledOpsMu.Unlock()
+	if enabled {
+		delete(disabledOps, name)
+	} else {
+		disabledOps[name] = true
+	}
+}
+
+func isKnownOperation(name string) bool {
+	return lookupOperation(name) != nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// maxFieldBytes caps a single non-file form field
+const maxFieldBytes = 10 << 20
+
+// Upload is one file part of a request, streamed into the workspace
+type Upload struct {
+	Field    string
+	Filename string // as sent by the client; not trusted
+	Path     string
+	Size     int64
+	SHA256   string
+	// Sealed is set while the file is stored encrypted, see atrest.go
+	Sealed bool
+	// Type is the sniffed content type, set once the upload was checked
+	Type fileType
+}
+
+type uploadsKey struct{}
+
+// uploadError rejects a request body with the status to answer
+type uploadError struct {
+	status int
+	msg    string
+}
+
+func (e *uploadError) Error() string { return e.msg }
+
+func tooLarge(format string, args ...interface{}) error {
+	return &uploadError{http.StatusRequestEntityTooLarge, fmt.Sprintf(format, args...)}
+}
+
+// readForm streams the multipart body of r without buffering it: file
+// parts go straight to ws and are hashed and measured on the way, other
+// fields are kept in memory. Parts over the per-file limit and bodies
+// over the operation's limit are rejected with 413, and a body that ends
+// before its closing boundary is an error rather than a shorter form.
+func (def *OperationDef) readForm(r *http.Request, ws *Workspace) (url.Values, map[string][]*Upload, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, &uploadError{http.StatusBadRequest, fmt.Sprintf("Invalid multipart form: %v", err)}
+	}
+
+	maxFile, maxTotal := def.fileLimit(), def.MaxUploadMB<<20
+	values := make(url.Values)
+	uploads := make(map[string][]*Upload)
+	var total int64
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, bodyError(err)
+		}
+
+		name := part.FormName()
+		if name == "" {
+			part.Close()
+			continue
+		}
+
+		// Neither kind of part may take the request past its limit
+		limit := maxTotal - total
+		if part.FileName() == "" {
+			perField := limit >= maxFieldBytes
+			if perField {
+				limit = maxFieldBytes
+			}
+			value, err := io.ReadAll(io.LimitReader(part, limit+1))
+			part.Close()
+			if err != nil {
+				return nil, nil, bodyError(err)
+			}
+			if int64(len(value)) > limit && perField {
+				return nil, nil, tooLarge("%s: field exceeds %d MB", name, maxFieldBytes>>20)
+			}
+			if int64(len(value)) > limit {
+				return nil, nil, tooLarge("Request exceeds the %d MB upload limit", def.MaxUploadMB)
+			}
+			total += int64(len(value))
+			values.Add(name, string(value))
+			continue
+		}
+
+		perFile := limit >= maxFile
+		if perFile {
+			limit = maxFile
+		}
+		upload, err := saveUpload(part, ws, limit)
+		part.Close()
+		if err == errPartTooLarge && perFile {
+			return nil, nil, tooLarge("%s: file exceeds the %d MB limit per file", name, maxFile>>20)
+		}
+		if err == errPartTooLarge {
+			return nil, nil, tooLarge("Request exceeds the %d MB upload limit", def.MaxUploadMB)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		total += upload.Size
+		uploads[name] = append(uploads[name], upload)
+	}
+	return values, uploads, nil
+}
+
+var errPartTooLarge = errors.New("part too large")
+
+// saveUpload writes one file part of at most limit bytes to ws
+func saveUpload(part *multipart.Part, ws *Workspace, limit int64) (*Upload, error) {
+	upload := &Upload{Field: part.FormName(), Filename: part.FileName(), Path: ws.File("upload", ""), Sealed: encryptionEnabled()}
+	out, err := createStored(upload.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, hash), io.LimitReader(part, limit+1))
+	if err != nil {
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			return nil, err
+		}
+		return nil, bodyError(err)
+	}
+	if size > limit {
+		return nil, errPartTooLarge
+	}
+
+	upload.Size = size
+	upload.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return upload, out.Close()
+}
+
+// bodyError describes a failure reading the request body. A body that
+// ends early is truncated, not merely short of parts.
+func bodyError(err error) error {
+	var upErr *uploadError
+	if errors.As(err, &upErr) {
+		return upErr
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return &uploadError{http.StatusBadRequest, "Request body is truncated"}
+	}
+	return &uploadError{http.StatusBadRequest, fmt.Sprintf("Invalid multipart form: %v", err)}
+}
+
+// fileLimit is the largest single file the operation takes
+func (def *OperationDef) fileLimit() int64 {
+	if def.MaxFileMB > 0 {
+		return def.MaxFileMB << 20
+	}
+	return def.MaxUploadMB << 20
+}
+
+// formFiles returns the uploads sent as field
+func formFiles(r *http.Request, field string) []*Upload {
+	uploads, _ := r.Context().Value(uploadsKey{}).(map[string][]*Upload)
+	return uploads[field]
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadForm(t *testing.T) {
+	oldTempDir := TempDir
+	TempDir = t.TempDir()
+	t.Cleanup(func() { TempDir = oldTempDir })
+
+	def := &OperationDef{MaxUploadMB: 2, MaxFileMB: 1}
+	body := func(files ...[]byte) ([]byte, string) {
+		var buf bytes.Buffer
+		form := multipart.NewWriter(&buf)
+		form.WriteField("angle", "90")
+		for i, data := range files {
+			part, _ := form.CreateFormFile(fmt.Sprintf("file%d", i), "in.pdf")
+			part.Write(data)
+		}
+		form.Close()
+		return buf.Bytes(), form.FormDataContentType()
+	}
+	read := func(data []byte, contentType string) (map[string][]*Upload, error) {
+		ws, err := newWorkspace(AnonymousNamespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ws.Remove() })
+		req := httptest.NewRequest("POST", "/api/pdf/merge", bytes.NewReader(data))
+		req.Header.Set("Content-Type", contentType)
+		values, uploads, err := def.readForm(req, ws)
+		if err == nil && values.Get("angle") != "90" {
+			t.Errorf("values = %v", values)
+		}
+		return uploads, err
+	}
+	status := func(err error) int {
+		var uploadErr *uploadError
+		if errors.As(err, &uploadErr) {
+			return uploadErr.status
+		}
+		return 0
+	}
+
+	// Parts are stored with their size and hash
+	pdf := minimalPDF()
+	uploads, err := read(body(pdf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(pdf)
+	upload := uploads["file0"][0]
+	if upload.Size != int64(len(pdf)) || upload.SHA256 != hex.EncodeToString(sum[:]) || upload.Filename != "in.pdf" {
+		t.Errorf("upload = %+v", upload)
+	}
+	if stored, _ := os.ReadFile(upload.Path); !bytes.Equal(stored, pdf) {
+		t.Error("stored upload differs")
+	}
+
+	// One file over the per-file limit
+	_, err = read(body(make([]byte, 1<<20+1)))
+	if status(err) != http.StatusRequestEntityTooLarge || !strings.Contains(err.Error(), "file0") {
+		t.Errorf("per-file limit: %v", err)
+	}
+
+	// Files within the per-file limit that add up to more than the total
+	_, err = read(body(make([]byte, 900<<10), make([]byte, 900<<10), make([]byte, 900<<10)))
+	if status(err) != http.StatusRequestEntityTooLarge || !strings.Contains(err.Error(), "2 MB upload limit") {
+		t.Errorf("total limit: %v", err)
+	}
+
+	// Bodies cut off inside a part or before the closing boundary
+	data, contentType := body(pdf)
+	for _, cut := range []int{len(data) / 2, len(data) - 10} {
+		if _, err := read(data[:cut], contentType); status(err) != http.StatusBadRequest || !strings.Contains(err.Error(), "truncated") {
+			t.Errorf("cut at %d of %d: %v", cut, len(data), err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+// Workspace owns every intermediate file of one request or job: the
+// uploads, scratch directories of the tools and outputs not yet handed
+// out. It lives under TempDir/ns/<namespace>/work and is removed when the
+// operation finishes, whatever the outcome; only outputs promoted with
+// Promote outlive it.
+type Workspace struct {
+	Dir       string
+	namespace string
+}
+
+type workspaceKey struct{}
+
+// newWorkspace creates an empty workspace in namespace
+func newWorkspace(namespace string) (*Workspace, error) {
+	parent := filepath.Join(TempDir, "ns", namespace, "work")
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(parent, "ws-")
+	if err != nil {
+		return nil, err
+	}
+	return &Workspace{Dir: dir, namespace: namespace}, nil
+}
+
+// workspaceFrom returns the workspace of the operation serving r
+func workspaceFrom(r *http.Request) *Workspace {
+	ws, _ := r.Context().Value(workspaceKey{}).(*Workspace)
+	return ws
+}
+
+// File returns a fresh path for a file named prefix-<id><ext>
+func (ws *Workspace) File(prefix, ext string) string {
+	return filepath.Join(ws.Dir, fmt.Sprintf("%s-%s%s", prefix, uuid.New().String()[:8], ext))
+}
+
+// Result returns where to write the result called name, numbered if an
+// earlier result of the operation has that name
+func (ws *Workspace) Result(name string) string {
+	dir := filepath.Join(ws.Dir, "results")
+	os.MkdirAll(dir, 0755)
+	return uniquePath(dir, name)
+}
+
+// MkdirTemp creates a directory for intermediate files
+func (ws *Workspace) MkdirTemp(prefix string) (string, error) {
+	return os.MkdirTemp(ws.Dir, prefix+"-")
+}
+
+// Promote moves a finished output into the namespace's output directory,
+// encrypting it if ENCRYPTION_KEY is set, and registers it for cleanup
+// after the TTL. A name already taken there is numbered. It returns the
+// new path.
+func (ws *Workspace) Promote(path string) (string, error) {
+	outputDir := filepath.Join(TempDir, "ns", ws.namespace, "output")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", err
+	}
+	// Linking and sealing fail instead of replacing a file another request
+	// promoted
+	move := os.Link
+	if encryptionEnabled() {
+		move = sealFile
+	}
+	for n := 1; ; n++ {
+		dest := filepath.Join(outputDir, numberedName(filepath.Base(path), n))
+		err := move(path, dest)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		removeFile(path)
+		registerFile(dest)
+		return dest, nil
+	}
+}
+
+// Remove deletes the workspace and everything left in it, erased first
+// under SECURE_ERASE
+func (ws *Workspace) Remove() error {
+	return removeAll(ws.Dir)
+}
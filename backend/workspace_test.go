@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkspaceCleanup(t *testing.T) {
+	oldTempDir, oldKeys := TempDir, APIKeys
+	TempDir, APIKeys = t.TempDir(), nil
+	t.Cleanup(func() { TempDir, APIKeys = oldTempDir, oldKeys })
+	t.Setenv("PATH", t.TempDir()) // no converters
+
+	run := func(path string, fields map[string]string) int {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		for name, value := range fields {
+			form.WriteField(name, value)
+		}
+		part, _ := form.CreateFormFile("file0", "upload.pdf")
+		part.Write(minimalPDF())
+		form.Close()
+
+		req := httptest.NewRequest("POST", path, &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rec := httptest.NewRecorder()
+		setupRoutes().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Only the output of a successful operation is kept and registered
+	if code := run("/api/pdf/rotate", map[string]string{"angle": "90"}); code != http.StatusOK {
+		t.Fatalf("rotate status = %d", code)
+	}
+	// A failing tool leaves nothing behind
+	if code := run("/api/convert/pdf-to-text", nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("pdf-to-text status = %d", code)
+	}
+
+	nsDir := filepath.Join(TempDir, "ns", AnonymousNamespace)
+	if leftovers, _ := os.ReadDir(filepath.Join(nsDir, "work")); len(leftovers) != 0 {
+		t.Errorf("work directory not empty: %v", leftovers)
+	}
+	outputs, _ := filepath.Glob(filepath.Join(nsDir, "output", "*"))
+	if len(outputs) != 1 {
+		t.Fatalf("outputs = %v", outputs)
+	}
+	fileMutex.RLock()
+	_, registered := fileRegistry[outputs[0]]
+	fileMutex.RUnlock()
+	if !registered {
+		t.Errorf("%s is not registered for cleanup", outputs[0])
+	}
+}
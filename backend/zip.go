@@ -7,12 +7,14 @@ import (
 	"path/filepath"
 )
 
-func createZip(files []string, dest *os.File) error {
+func createZip(files []string, dest io.Writer) error {
 	zipWriter := zip.NewWriter(dest)
 	defer zipWriter.Close()
 
+	// Entries from different directories may share a name
+	names := make(nameSet)
 	for _, file := range files {
-		if err := addFileToZip(zipWriter, file); err != nil {
+		if err := addFileToZip(zipWriter, file, names.add(filepath.Base(file))); err != nil {
 			return err
 		}
 	}
@@ -20,7 +22,7 @@ func createZip(files []string, dest *os.File) error {
 	return nil
 }
 
-func addFileToZip(zipWriter *zip.Writer, filename string) error {
+func addFileToZip(zipWriter *zip.Writer, filename, name string) error {
 	file, err := os.Open(filename)
 	if err != nil {
 		return err
@@ -37,7 +39,7 @@ func addFileToZip(zipWriter *zip.Writer, filename string) error {
 		return err
 	}
 
-	header.Name = filepath.Base(filename)
+	header.Name = name
 	header.Method = zip.Deflate
 
 	writer, err := zipWriter.CreateHeader(header)